@@ -0,0 +1,104 @@
+package apis
+
+// DeepCopy copy the receiver, creates a new ResourceTree.
+func (in *ResourceTree) DeepCopy() *ResourceTree {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceTree)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto copy the receiver, writes into out. in must be non-nil.
+// Nodes shared between the root element, the status list and the parent
+// references of other nodes are still shared in the copy.
+func (in *ResourceTree) DeepCopyInto(out *ResourceTree) {
+	copier := statusCopier{}
+	out.CompositionId = in.CompositionId
+	out.RootElementStatus = copier.copy(in.RootElementStatus)
+	in.Resources.deepCopyInto(&out.Resources, copier)
+}
+
+// DeepCopy copy the receiver, creates a new ResourceTreeJson.
+func (in *ResourceTreeJson) DeepCopy() *ResourceTreeJson {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceTreeJson)
+	in.deepCopyInto(out, statusCopier{})
+	return out
+}
+
+func (in *ResourceTreeJson) deepCopyInto(out *ResourceTreeJson, copier statusCopier) {
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	if in.Spec.Tree != nil {
+		out.Spec.Tree = make([]ResourceNode, len(in.Spec.Tree))
+		for i := range in.Spec.Tree {
+			in.Spec.Tree[i].DeepCopyInto(&out.Spec.Tree[i])
+		}
+	} else {
+		out.Spec.Tree = nil
+	}
+	out.Status = copier.copySlice(in.Status)
+}
+
+// DeepCopyInto copy the receiver, writes into out. in must be non-nil.
+func (in *ResourceNode) DeepCopyInto(out *ResourceNode) {
+	*out = *in
+	if in.ParentRefs != nil {
+		out.ParentRefs = make([]Reference, len(in.ParentRefs))
+		copy(out.ParentRefs, in.ParentRefs)
+	}
+}
+
+// DeepCopy copy the receiver, creates a new ResourceNodeStatus.
+func (in *ResourceNodeStatus) DeepCopy() *ResourceNodeStatus {
+	return statusCopier{}.copy(in)
+}
+
+// statusCopier remembers the nodes it already copied, so that the pointer
+// graph (e.g., every node referencing the same root as parent) is preserved.
+type statusCopier map[*ResourceNodeStatus]*ResourceNodeStatus
+
+func (s statusCopier) copy(in *ResourceNodeStatus) *ResourceNodeStatus {
+	if in == nil {
+		return nil
+	}
+	if out, ok := s[in]; ok {
+		return out
+	}
+	out := new(ResourceNodeStatus)
+	s[in] = out
+
+	out.ResourceRefStatus = in.ResourceRefStatus
+	out.ParentRefs = s.copySlice(in.ParentRefs)
+	if in.UID != nil {
+		uid := *in.UID
+		out.UID = &uid
+	}
+	if in.ResourceVersion != nil {
+		resourceVersion := *in.ResourceVersion
+		out.ResourceVersion = &resourceVersion
+	}
+	if in.Health != nil {
+		health := *in.Health
+		out.Health = &health
+	}
+	if in.CreatedAt != nil {
+		out.CreatedAt = in.CreatedAt.DeepCopy()
+	}
+	return out
+}
+
+func (s statusCopier) copySlice(in []*ResourceNodeStatus) []*ResourceNodeStatus {
+	if in == nil {
+		return nil
+	}
+	out := make([]*ResourceNodeStatus, len(in))
+	for i := range in {
+		out[i] = s.copy(in[i])
+	}
+	return out
+}
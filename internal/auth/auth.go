@@ -0,0 +1,144 @@
+// Package auth authenticates the requests to the HTTP API from their bearer token. Tokens are verified by
+// the authenticators of the methods accepted: Kubernetes TokenReview, static shared tokens and JWTs signed
+// by a key of a JWKS. Read and write routes have separate requirements, see Requirement. The bodies of the
+// events can also be signed with HMAC, see SignatureVerifier.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Method is the way a token is verified
+type Method string
+
+const (
+	MethodTokenReview Method = "tokenreview"
+	MethodStatic      Method = "static"
+	MethodJWT         Method = "jwt"
+)
+
+// User is the identity of an authenticated request
+type User struct {
+	Name   string              `json:"name"`
+	UID    string              `json:"uid,omitempty"`
+	Groups []string            `json:"groups,omitempty"`
+	Extra  map[string][]string `json:"extra,omitempty"`
+	// Method is the method that verified the token
+	Method Method `json:"method"`
+}
+
+var (
+	// ErrUnrecognized is returned by the authenticators for the tokens they do not handle, so that the next one is tried
+	ErrUnrecognized = errors.New("token not recognized")
+	// ErrUnauthenticated is returned when the request has no valid token
+	ErrUnauthenticated = errors.New("authentication required")
+	// ErrForbidden is returned when the user is authenticated but not allowed by the requirement
+	ErrForbidden = errors.New("forbidden")
+)
+
+// Authenticator verifies the tokens of a method
+type Authenticator interface {
+	Method() Method
+	// Authenticate returns the user of the token, ErrUnrecognized if the token is not for this authenticator
+	Authenticate(ctx context.Context, token string) (*User, error)
+}
+
+// Requirement is what a class of routes requires from the requests
+type Requirement struct {
+	// Methods are the methods accepted, anonymous requests are allowed if empty
+	Methods []Method
+	// Subjects are the users and groups (group:<name>) allowed, every authenticated user if empty
+	Subjects []string
+}
+
+// ParseRequirement parses the comma separated methods, none for anonymous access, and subjects
+func ParseRequirement(methods string, subjects string) (Requirement, error) {
+	requirement := Requirement{}
+	for _, method := range strings.Split(methods, ",") {
+		switch method = strings.ToLower(strings.TrimSpace(method)); Method(method) {
+		case "", "none":
+		case MethodTokenReview, MethodStatic, MethodJWT:
+			if !slices.Contains(requirement.Methods, Method(method)) {
+				requirement.Methods = append(requirement.Methods, Method(method))
+			}
+		default:
+			return Requirement{}, fmt.Errorf("invalid authentication method %q, expected %s, %s, %s or none", method, MethodTokenReview, MethodStatic, MethodJWT)
+		}
+	}
+	for _, subject := range strings.Split(subjects, ",") {
+		if subject = strings.TrimSpace(subject); subject != "" {
+			requirement.Subjects = append(requirement.Subjects, subject)
+		}
+	}
+	if len(requirement.Methods) == 0 && len(requirement.Subjects) > 0 {
+		return Requirement{}, fmt.Errorf("subjects cannot be required without an authentication method")
+	}
+	return requirement, nil
+}
+
+// Anonymous reports whether the requests do not need to be authenticated
+func (r Requirement) Anonymous() bool {
+	return len(r.Methods) == 0
+}
+
+// allows reports whether the user is one of the subjects
+func (r Requirement) allows(user *User) bool {
+	if len(r.Subjects) == 0 {
+		return true
+	}
+	for _, subject := range r.Subjects {
+		if group, ok := strings.CutPrefix(subject, "group:"); ok {
+			if slices.Contains(user.Groups, group) {
+				return true
+			}
+		} else if subject == user.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticators are the authenticators of the methods configured, tried in order
+type Authenticators []Authenticator
+
+// Authenticate returns the user of the token according to the requirement: nil for anonymous requests when allowed,
+// ErrUnauthenticated when the token is missing or not valid for the methods required, ErrForbidden when the user
+// is not one of the subjects.
+func (a Authenticators) Authenticate(ctx context.Context, token string, requirement Requirement) (*User, error) {
+	if requirement.Anonymous() {
+		return nil, nil
+	}
+	if token == "" {
+		return nil, ErrUnauthenticated
+	}
+	for _, authenticator := range a {
+		if !slices.Contains(requirement.Methods, authenticator.Method()) {
+			continue
+		}
+		user, err := authenticator.Authenticate(ctx, token)
+		if errors.Is(err, ErrUnrecognized) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrUnauthenticated, err)
+		}
+		if !requirement.allows(user) {
+			return user, fmt.Errorf("%w: user %s is not allowed", ErrForbidden, user.Name)
+		}
+		return user, nil
+	}
+	return nil, fmt.Errorf("%w: invalid token", ErrUnauthenticated)
+}
+
+// Configured returns the methods of the authenticators
+func (a Authenticators) Configured() []Method {
+	methods := []Method{}
+	for _, authenticator := range a {
+		methods = append(methods, authenticator.Method())
+	}
+	return methods
+}
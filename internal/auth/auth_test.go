@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	authenticationv1 "k8s.io/api/authentication/v1"
+)
+
+func writeFile(t *testing.T, name string, content []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseRequirement(t *testing.T) {
+	requirement, err := ParseRequirement("TokenReview, static,static", "admin, group:platform")
+	if err != nil || len(requirement.Methods) != 2 || len(requirement.Subjects) != 2 || requirement.Anonymous() {
+		t.Errorf("unexpected requirement %+v, %v", requirement, err)
+	}
+	if requirement, err := ParseRequirement("none", ""); err != nil || !requirement.Anonymous() {
+		t.Errorf("unexpected requirement %+v, %v", requirement, err)
+	}
+	for _, methods := range [][2]string{{"basic", ""}, {"", "admin"}} {
+		if _, err := ParseRequirement(methods[0], methods[1]); err == nil {
+			t.Errorf("%v: expected an error", methods)
+		}
+	}
+}
+
+func TestStaticAuthenticator(t *testing.T) {
+	path := writeFile(t, "tokens.csv", []byte("# eventrouter\nsecret-token,eventrouter,1,\"system:eventrouters,ops\"\nother-token,admin\n"))
+	authenticator, err := NewStaticAuthenticator(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := authenticator.Authenticate(context.Background(), "secret-token")
+	if err != nil || user.Name != "eventrouter" || user.UID != "1" || len(user.Groups) != 2 || user.Method != MethodStatic {
+		t.Errorf("unexpected user %+v, %v", user, err)
+	}
+	if _, err := authenticator.Authenticate(context.Background(), "wrong"); !errors.Is(err, ErrUnrecognized) {
+		t.Errorf("expected ErrUnrecognized, got %v", err)
+	}
+	if _, err := NewStaticAuthenticator(writeFile(t, "tokens.csv", []byte("only-token\n"))); err == nil {
+		t.Error("expected an error for a token without user")
+	}
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, _ := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: key.Public(), KeyID: "test", Algorithm: string(jose.ES256), Use: "sig"}}})
+	authenticator, err := NewJWTAuthenticator(JWTOptions{JWKSFile: writeFile(t, "jwks.json", jwks), Issuer: "https://issuer", Audience: "resource-tree-handler", UsernameClaim: "email"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signWith := func(key *ecdsa.PrivateKey, kid string, claims jwt.Claims, email string) string {
+		options := &jose.SignerOptions{}
+		if kid != "" {
+			options = options.WithHeader(jose.HeaderKey("kid"), kid)
+		}
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := jwt.Signed(signer).Claims(claims).Claims(map[string]any{"email": email, "groups": []string{"platform"}}).Serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	sign := func(kid string, claims jwt.Claims, email string) string {
+		return signWith(key, kid, claims, email)
+	}
+	valid := jwt.Claims{Issuer: "https://issuer", Subject: "1234", Audience: jwt.Audience{"resource-tree-handler"}, Expiry: jwt.NewNumericDate(time.Now().Add(time.Hour))}
+
+	user, err := authenticator.Authenticate(context.Background(), sign("test", valid, "dev@example.com"))
+	if err != nil || user.Name != "dev@example.com" || user.UID != "1234" || len(user.Groups) != 1 || user.Groups[0] != "platform" {
+		t.Errorf("unexpected user %+v, %v", user, err)
+	}
+	if user, err := authenticator.Authenticate(context.Background(), sign("", valid, "dev@example.com")); err != nil || user.Name != "dev@example.com" {
+		t.Errorf("without key id: unexpected user %+v, %v", user, err)
+	}
+
+	expired := valid
+	expired.Expiry = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+	otherAudience := valid
+	otherAudience.Audience = jwt.Audience{"other"}
+	for name, token := range map[string]string{"expired": sign("test", expired, "dev@example.com"), "audience": sign("test", otherAudience, "dev@example.com"), "username": sign("test", valid, ""),
+		// The key id matches, the signature does not
+		"signature": signWith(otherKey, "test", valid, "dev@example.com")} {
+		if _, err := authenticator.Authenticate(context.Background(), token); err == nil || errors.Is(err, ErrUnrecognized) {
+			t.Errorf("%s: expected an invalid token, got %v", name, err)
+		}
+	}
+
+	otherIssuer := valid
+	otherIssuer.Issuer = "https://kubernetes.default.svc"
+	for name, token := range map[string]string{"issuer": sign("test", otherIssuer, "dev@example.com"), "kid": sign("other", valid, "dev@example.com"), "opaque": "secret-token",
+		// Without key id, e.g., a ServiceAccount token, left to the TokenReview
+		"no kid": signWith(otherKey, "", valid, "dev@example.com")} {
+		if _, err := authenticator.Authenticate(context.Background(), token); !errors.Is(err, ErrUnrecognized) {
+			t.Errorf("%s: expected ErrUnrecognized, got %v", name, err)
+		}
+	}
+}
+
+func TestAuthenticators(t *testing.T) {
+	reviews := 0
+	tokenReview := NewTokenReviewAuthenticator(func(ctx context.Context, token string) (*authenticationv1.TokenReviewStatus, error) {
+		reviews++
+		if token != "sa-token" {
+			return &authenticationv1.TokenReviewStatus{}, nil
+		}
+		return &authenticationv1.TokenReviewStatus{Authenticated: true, User: authenticationv1.UserInfo{Username: "system:serviceaccount:krateo-system:frontend", Groups: []string{"system:serviceaccounts"}}}, nil
+	})
+	static, err := NewStaticAuthenticator(writeFile(t, "tokens.csv", []byte("secret-token,eventrouter\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticators := Authenticators{static, tokenReview}
+	read, _ := ParseRequirement("static,tokenreview", "")
+	write, _ := ParseRequirement("static", "eventrouter")
+
+	if user, err := authenticators.Authenticate(context.Background(), "", Requirement{}); user != nil || err != nil {
+		t.Errorf("anonymous request not allowed: %v", err)
+	}
+	if _, err := authenticators.Authenticate(context.Background(), "", read); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("expected ErrUnauthenticated, got %v", err)
+	}
+	for range 2 {
+		if user, err := authenticators.Authenticate(context.Background(), "sa-token", read); err != nil || user.Method != MethodTokenReview {
+			t.Errorf("unexpected user %+v, %v", user, err)
+		}
+	}
+	if reviews != 1 {
+		t.Errorf("expected the review to be cached, got %d reviews", reviews)
+	}
+	if _, err := authenticators.Authenticate(context.Background(), "wrong", read); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("expected ErrUnauthenticated, got %v", err)
+	}
+	// The token of the ServiceAccount is not reviewed for the write routes
+	if _, err := authenticators.Authenticate(context.Background(), "sa-token", write); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("expected ErrUnauthenticated, got %v", err)
+	}
+	if user, err := authenticators.Authenticate(context.Background(), "secret-token", write); err != nil || user.Name != "eventrouter" {
+		t.Errorf("unexpected user %+v, %v", user, err)
+	}
+	write.Subjects = []string{"group:admins"}
+	if _, err := authenticators.Authenticate(context.Background(), "secret-token", write); !errors.Is(err, ErrForbidden) {
+		t.Errorf("expected ErrForbidden, got %v", err)
+	}
+}
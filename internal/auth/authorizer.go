@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/krateoplatformops/plumbing/cache"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// Validity of the results of the access reviews, so that the API server is not asked for every node
+	accessReviewTTL     = time.Minute
+	accessReviewTimeout = 10 * time.Second
+)
+
+// RedactionMode is what the users see of the nodes of the resource trees they cannot get in Kubernetes
+type RedactionMode string
+
+const (
+	// RedactionOff serves the whole resource trees to every user
+	RedactionOff RedactionMode = "off"
+	// RedactionPlaceholder replaces the nodes with opaque placeholders, so that the shape of the tree is kept
+	RedactionPlaceholder RedactionMode = "redact"
+	// RedactionOmit removes the nodes
+	RedactionOmit RedactionMode = "omit"
+)
+
+func ParseRedactionMode(value string) (RedactionMode, error) {
+	switch mode := RedactionMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "":
+		return RedactionOff, nil
+	case RedactionOff, RedactionPlaceholder, RedactionOmit:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid redaction mode %q, expected %s, %s or %s", value, RedactionOff, RedactionPlaceholder, RedactionOmit)
+}
+
+// Attributes are the objects of an access review: the objects of a resource in a namespace, in every namespace if empty
+type Attributes struct {
+	Group     string
+	Resource  string
+	Namespace string
+}
+
+// AccessReviewFunc asks the API server whether the user can get the objects, see reviews.Access
+type AccessReviewFunc func(ctx context.Context, user *User, attributes Attributes) (bool, error)
+
+// Authorizer checks whether the users can get objects in Kubernetes, caching the answers by user, resource and namespace
+type Authorizer struct {
+	review  AccessReviewFunc
+	results *cache.TTLCache[string, bool]
+}
+
+func NewAuthorizer(review AccessReviewFunc) *Authorizer {
+	return &Authorizer{review: review, results: cache.NewTTL[string, bool]()}
+}
+
+// CanGet reports whether the user can get the objects. Errors of the review deny the access and are not cached.
+func (a *Authorizer) CanGet(ctx context.Context, user *User, attributes Attributes) bool {
+	groups := slices.Clone(user.Groups)
+	slices.Sort(groups)
+	key := strings.Join([]string{user.Name, user.UID, strings.Join(groups, ","), attributes.Group, attributes.Resource, attributes.Namespace}, "\x00")
+	if allowed, ok := a.results.Get(key); ok {
+		return allowed
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, accessReviewTimeout)
+	defer cancel()
+	allowed, err := a.review(ctx, user, attributes)
+	if err != nil {
+		log.Warn().Err(err).Msgf("could not review access of %s to %s.%s in namespace %q", user.Name, attributes.Resource, attributes.Group, attributes.Namespace)
+		return false
+	}
+	a.results.Set(key, allowed, accessReviewTTL)
+	return allowed
+}
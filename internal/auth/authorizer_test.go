@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestParseRedactionMode(t *testing.T) {
+	for value, expected := range map[string]RedactionMode{"": RedactionOff, "off": RedactionOff, " Redact": RedactionPlaceholder, "OMIT": RedactionOmit} {
+		if mode, err := ParseRedactionMode(value); err != nil || mode != expected {
+			t.Errorf("%q: expected %s, got %s, %v", value, expected, mode, err)
+		}
+	}
+	if _, err := ParseRedactionMode("hide"); err == nil {
+		t.Error("expected an error for an invalid mode")
+	}
+}
+
+func TestAuthorizer(t *testing.T) {
+	reviews := 0
+	failing := true
+	authorizer := NewAuthorizer(func(_ context.Context, user *User, attributes Attributes) (bool, error) {
+		reviews++
+		if attributes.Resource == "secrets" && failing {
+			return false, errors.New("API server unavailable")
+		}
+		return user.Name == "admin" || attributes.Namespace == "demo", nil
+	})
+	viewer := &User{Name: "viewer", Groups: []string{"b", "a"}}
+	ctx := context.Background()
+
+	if !authorizer.CanGet(ctx, viewer, Attributes{Resource: "configmaps", Namespace: "demo"}) {
+		t.Error("expected viewer to get the configmaps of demo")
+	}
+	if authorizer.CanGet(ctx, viewer, Attributes{Resource: "configmaps", Namespace: "krateo-system"}) {
+		t.Error("expected viewer not to get the configmaps of krateo-system")
+	}
+	// Cached, also for the same groups in another order
+	authorizer.CanGet(ctx, &User{Name: "viewer", Groups: []string{"a", "b"}}, Attributes{Resource: "configmaps", Namespace: "demo"})
+	if reviews != 2 {
+		t.Errorf("expected 2 reviews, got %d", reviews)
+	}
+	if !authorizer.CanGet(ctx, &User{Name: "admin"}, Attributes{Resource: "configmaps", Namespace: "krateo-system"}) {
+		t.Error("expected admin to get the configmaps of krateo-system")
+	}
+
+	// Errors deny the access and are reviewed again
+	if authorizer.CanGet(ctx, viewer, Attributes{Resource: "secrets", Namespace: "demo"}) {
+		t.Error("expected the access to be denied when the review fails")
+	}
+	failing = false
+	if !authorizer.CanGet(ctx, viewer, Attributes{Resource: "secrets", Namespace: "demo"}) {
+		t.Error("expected the failed review not to be cached")
+	}
+}
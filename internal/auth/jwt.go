@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+// Signature algorithms accepted, the symmetric ones are excluded since the keys of a JWKS file are public
+var jwtAlgorithms = []jose.SignatureAlgorithm{jose.RS256, jose.RS384, jose.RS512, jose.PS256, jose.PS384, jose.PS512, jose.ES256, jose.ES384, jose.ES512, jose.EdDSA}
+
+// JWTOptions configure the verification of the JWTs, e.g., the ID tokens of an OIDC provider
+type JWTOptions struct {
+	// JWKSFile is the JSON Web Key Set with the public keys, read again when modified
+	JWKSFile string
+	// Issuer and Audience are checked when set. Tokens of other issuers are left to the other authenticators.
+	Issuer   string
+	Audience string
+	// UsernameClaim and GroupsClaim are the claims of the user, sub and groups if empty
+	UsernameClaim string
+	GroupsClaim   string
+}
+
+type jwtAuthenticator struct {
+	options JWTOptions
+
+	mu       sync.Mutex
+	keys     *jose.JSONWebKeySet
+	modified time.Time
+}
+
+func NewJWTAuthenticator(options JWTOptions) (Authenticator, error) {
+	if options.UsernameClaim == "" {
+		options.UsernameClaim = "sub"
+	}
+	if options.GroupsClaim == "" {
+		options.GroupsClaim = "groups"
+	}
+	authenticator := &jwtAuthenticator{options: options}
+	if _, err := authenticator.keySet(); err != nil {
+		return nil, err
+	}
+	return authenticator, nil
+}
+
+func (a *jwtAuthenticator) Method() Method {
+	return MethodJWT
+}
+
+// keySet returns the keys of the JWKS file, reading it again when modified. The previous keys are kept if
+// the modified file cannot be read.
+func (a *jwtAuthenticator) keySet() (*jose.JSONWebKeySet, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	info, err := os.Stat(a.options.JWKSFile)
+	if err != nil {
+		if a.keys != nil {
+			return a.keys, nil
+		}
+		return nil, fmt.Errorf("could not read the JWKS file: %w", err)
+	}
+	if a.keys != nil && info.ModTime().Equal(a.modified) {
+		return a.keys, nil
+	}
+
+	data, err := os.ReadFile(a.options.JWKSFile)
+	if err == nil {
+		keys := &jose.JSONWebKeySet{}
+		if err = json.Unmarshal(data, keys); err == nil && len(keys.Keys) == 0 {
+			err = fmt.Errorf("no keys")
+		}
+		if err == nil {
+			a.keys, a.modified = keys, info.ModTime()
+			return a.keys, nil
+		}
+	}
+	if a.keys != nil {
+		return a.keys, nil
+	}
+	return nil, fmt.Errorf("could not read the JWKS file: %w", err)
+}
+
+func (a *jwtAuthenticator) Authenticate(_ context.Context, token string) (*User, error) {
+	parsed, err := jwt.ParseSigned(token, jwtAlgorithms)
+	if err != nil {
+		// Not a JWT, or signed with an algorithm not accepted
+		return nil, ErrUnrecognized
+	}
+	var unverified jwt.Claims
+	if err := parsed.UnsafeClaimsWithoutVerification(&unverified); err != nil {
+		return nil, ErrUnrecognized
+	}
+	if a.options.Issuer != "" && unverified.Issuer != a.options.Issuer {
+		return nil, ErrUnrecognized
+	}
+
+	keys, err := a.keySet()
+	if err != nil {
+		return nil, err
+	}
+	var claims jwt.Claims
+	custom := map[string]any{}
+	if len(parsed.Headers) > 0 && parsed.Headers[0].KeyID != "" {
+		// Tokens signed with other keys, e.g., by the API server, are left to the other authenticators
+		matches := keys.Key(parsed.Headers[0].KeyID)
+		if len(matches) == 0 {
+			return nil, ErrUnrecognized
+		}
+		if err := parsed.Claims(matches[0], &claims, &custom); err != nil {
+			return nil, fmt.Errorf("invalid JWT: %w", err)
+		}
+	} else if !verifiesWithAny(parsed, keys.Keys, &claims, &custom) {
+		// Without key id, e.g., a ServiceAccount or OIDC token, the token may be for the other authenticators
+		return nil, ErrUnrecognized
+	}
+
+	expected := jwt.Expected{Issuer: a.options.Issuer, Time: time.Now()}
+	if a.options.Audience != "" {
+		expected.AnyAudience = jwt.Audience{a.options.Audience}
+	}
+	if err := claims.Validate(expected); err != nil {
+		return nil, fmt.Errorf("invalid JWT: %w", err)
+	}
+
+	name, _ := custom[a.options.UsernameClaim].(string)
+	if name == "" {
+		return nil, fmt.Errorf("invalid JWT: no %s claim", a.options.UsernameClaim)
+	}
+	user := &User{Name: name, UID: claims.Subject, Method: MethodJWT}
+	switch groups := custom[a.options.GroupsClaim].(type) {
+	case string:
+		user.Groups = []string{groups}
+	case []any:
+		for _, group := range groups {
+			if group, ok := group.(string); ok {
+				user.Groups = append(user.Groups, group)
+			}
+		}
+	}
+	return user, nil
+}
+
+// verifiesWithAny reports whether the token is signed with one of the keys, and then reads its claims
+func verifiesWithAny(parsed *jwt.JSONWebToken, keys []jose.JSONWebKey, claims ...any) bool {
+	for _, key := range keys {
+		if parsed.Claims(key, claims...) == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// SignatureHeader carries the HMAC-SHA256 signatures of the request, sha256=<hex>, comma separated when the
+	// sender signs with several keys during a rotation
+	SignatureHeader = "X-Signature"
+	// SignatureTimestampHeader carries the Unix time of the signature, in seconds
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+	// DefaultSignatureTolerance is the replay window, i.e., the maximum difference between the timestamp and the clock
+	DefaultSignatureTolerance = 5 * time.Minute
+
+	signaturePrefix = "sha256="
+	// The keys are loaded again after signatureKeysTTL, or after signatureKeysRetry when a signature does not
+	// match, so that a rotated key is picked up without restarting
+	signatureKeysTTL   = time.Minute
+	signatureKeysRetry = 10 * time.Second
+	signatureTimeout   = 10 * time.Second
+)
+
+// ErrInvalidSignature is returned when the signature is missing, expired or does not match any key
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// KeysFunc loads the active keys of the signatures, e.g., from a Secret
+type KeysFunc func(ctx context.Context) ([][]byte, error)
+
+// SignatureVerifier verifies the HMAC-SHA256 signatures of the requests, computed on "<timestamp>.<body>"
+type SignatureVerifier struct {
+	load      KeysFunc
+	tolerance time.Duration
+	now       func() time.Time
+
+	mu     sync.Mutex
+	keys   [][]byte
+	loaded time.Time
+}
+
+// NewSignatureVerifier returns the verifier of the keys of load, the tolerance is DefaultSignatureTolerance if not positive
+func NewSignatureVerifier(load KeysFunc, tolerance time.Duration) *SignatureVerifier {
+	if tolerance <= 0 {
+		tolerance = DefaultSignatureTolerance
+	}
+	return &SignatureVerifier{load: load, tolerance: tolerance, now: time.Now}
+}
+
+// ParseSignatureKeys returns the keys of a Secret value, one per line, ignoring the empty lines
+func ParseSignatureKeys(data []byte) [][]byte {
+	keys := [][]byte{}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			keys = append(keys, line)
+		}
+	}
+	return keys
+}
+
+// Sign returns the value of the SignatureHeader of a body signed at timestamp
+func Sign(key []byte, timestamp int64, body []byte) string {
+	return signaturePrefix + hex.EncodeToString(mac(key, strconv.FormatInt(timestamp, 10), body))
+}
+
+func mac(key []byte, timestamp string, body []byte) []byte {
+	hash := hmac.New(sha256.New, key)
+	hash.Write([]byte(timestamp))
+	hash.Write([]byte("."))
+	hash.Write(body)
+	return hash.Sum(nil)
+}
+
+// Verify checks that one of the signatures matches one of the active keys, and that the timestamp is within
+// the replay window. It returns ErrInvalidSignature when the request must be rejected, other errors when
+// the keys cannot be loaded.
+func (v *SignatureVerifier) Verify(ctx context.Context, timestamp string, signatures string, body []byte) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: missing or invalid %s header", ErrInvalidSignature, SignatureTimestampHeader)
+	}
+	if age := v.now().Sub(time.Unix(seconds, 0)).Abs(); age > v.tolerance {
+		return fmt.Errorf("%w: timestamp outside of the %s window", ErrInvalidSignature, v.tolerance)
+	}
+	sums := [][]byte{}
+	for _, signature := range strings.Split(signatures, ",") {
+		value, ok := strings.CutPrefix(strings.TrimSpace(signature), signaturePrefix)
+		if sum, err := hex.DecodeString(value); ok && err == nil {
+			sums = append(sums, sum)
+		}
+	}
+	if len(sums) == 0 {
+		return fmt.Errorf("%w: missing or invalid %s header", ErrInvalidSignature, SignatureHeader)
+	}
+
+	for _, force := range []bool{false, true} {
+		keys, reloaded, err := v.activeKeys(ctx, force)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			expected := mac(key, timestamp, body)
+			for _, sum := range sums {
+				if hmac.Equal(sum, expected) {
+					return nil
+				}
+			}
+		}
+		if !force && reloaded {
+			// The keys are already the latest ones
+			break
+		}
+	}
+	return fmt.Errorf("%w: no active key matches", ErrInvalidSignature)
+}
+
+// activeKeys returns the keys, loading them again when expired or, if force, when not loaded recently.
+// The previous keys are kept if they cannot be loaded.
+func (v *SignatureVerifier) activeKeys(ctx context.Context, force bool) (keys [][]byte, reloaded bool, err error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	age := v.now().Sub(v.loaded)
+	if v.keys != nil && age < signatureKeysTTL && (!force || age < signatureKeysRetry) {
+		return v.keys, false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, signatureTimeout)
+	defer cancel()
+	keys, err = v.load(ctx)
+	if err == nil && len(keys) == 0 {
+		err = fmt.Errorf("no keys")
+	}
+	if err != nil {
+		if v.keys != nil {
+			v.loaded = v.now()
+			return v.keys, false, nil
+		}
+		return nil, false, fmt.Errorf("could not load the signature keys: %w", err)
+	}
+	v.keys, v.loaded = keys, v.now()
+	return v.keys, true, nil
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseSignatureKeys(t *testing.T) {
+	keys := ParseSignatureKeys([]byte("new\n\n  old \n"))
+	if len(keys) != 2 || string(keys[0]) != "new" || string(keys[1]) != "old" {
+		t.Errorf("unexpected keys %q", keys)
+	}
+}
+
+func TestSignatureVerifier(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	active := [][]byte{[]byte("new"), []byte("old")}
+	loads := 0
+	verifier := NewSignatureVerifier(func(context.Context) ([][]byte, error) {
+		loads++
+		return active, nil
+	}, time.Minute)
+	verifier.now = func() time.Time { return now }
+	body := []byte(`{"reason":"CompositionDeleted"}`)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	tests := []struct {
+		name       string
+		timestamp  string
+		signatures string
+		body       []byte
+		valid      bool
+	}{
+		{"current key", timestamp, Sign([]byte("new"), now.Unix(), body), body, true},
+		{"previous key", timestamp, Sign([]byte("old"), now.Unix(), body), body, true},
+		{"several signatures", timestamp, "sha256=00, " + Sign([]byte("new"), now.Unix(), body), body, true},
+		{"within the window", strconv.FormatInt(now.Unix()-50, 10), Sign([]byte("new"), now.Unix()-50, body), body, true},
+		{"unknown key", timestamp, Sign([]byte("other"), now.Unix(), body), body, false},
+		{"modified body", timestamp, Sign([]byte("new"), now.Unix(), body), []byte(`{}`), false},
+		{"modified timestamp", strconv.FormatInt(now.Unix()-1, 10), Sign([]byte("new"), now.Unix(), body), body, false},
+		{"replayed", strconv.FormatInt(now.Unix()-120, 10), Sign([]byte("new"), now.Unix()-120, body), body, false},
+		{"missing timestamp", "", Sign([]byte("new"), now.Unix(), body), body, false},
+		{"missing signature", timestamp, "", body, false},
+	}
+	for _, tt := range tests {
+		err := verifier.Verify(context.Background(), tt.timestamp, tt.signatures, tt.body)
+		if tt.valid && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: expected ErrInvalidSignature, got %v", tt.name, err)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("expected the keys to be loaded once, got %d", loads)
+	}
+
+	// A rotated key is picked up when a signature does not match, after signatureKeysRetry
+	active = [][]byte{[]byte("rotated")}
+	now = now.Add(signatureKeysRetry)
+	if err := verifier.Verify(context.Background(), strconv.FormatInt(now.Unix(), 10), Sign([]byte("rotated"), now.Unix(), body), body); err != nil {
+		t.Errorf("rotated key: unexpected error %v", err)
+	}
+	if err := verifier.Verify(context.Background(), strconv.FormatInt(now.Unix(), 10), Sign([]byte("old"), now.Unix(), body), body); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("removed key: expected ErrInvalidSignature, got %v", err)
+	}
+	if loads != 2 {
+		t.Errorf("expected the keys to be loaded twice, got %d", loads)
+	}
+}
+
+func TestSignatureVerifierWithoutKeys(t *testing.T) {
+	verifier := NewSignatureVerifier(func(context.Context) ([][]byte, error) {
+		return nil, errors.New("secret not found")
+	}, 0)
+	err := verifier.Verify(context.Background(), strconv.FormatInt(time.Now().Unix(), 10), Sign([]byte("key"), time.Now().Unix(), nil), nil)
+	if err == nil || errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected an error loading the keys, got %v", err)
+	}
+}
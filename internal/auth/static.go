@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// staticAuthenticator verifies the tokens shared with trusted clients, e.g., the eventrouter
+type staticAuthenticator struct {
+	// users by the hash of their token, compared in constant time
+	tokens [][sha256.Size]byte
+	users  []User
+}
+
+// NewStaticAuthenticator reads the tokens from a CSV file with the same format as the static token file of the
+// Kubernetes API server: token,user,uid,"group1,group2", where uid and groups are optional
+func NewStaticAuthenticator(path string) (Authenticator, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open the static tokens file: %w", err)
+	}
+	defer file.Close()
+
+	authenticator := &staticAuthenticator{}
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not parse the static tokens file: %w", err)
+		}
+		if len(record) < 2 || record[0] == "" || record[1] == "" {
+			return nil, fmt.Errorf("line %d of the static tokens file: expected at least a token and a user", line)
+		}
+		user := User{Name: record[1], Method: MethodStatic}
+		if len(record) > 2 {
+			user.UID = record[2]
+		}
+		if len(record) > 3 && record[3] != "" {
+			user.Groups = strings.Split(record[3], ",")
+		}
+		authenticator.tokens = append(authenticator.tokens, sha256.Sum256([]byte(record[0])))
+		authenticator.users = append(authenticator.users, user)
+	}
+	if len(authenticator.tokens) == 0 {
+		return nil, fmt.Errorf("the static tokens file has no tokens")
+	}
+	return authenticator, nil
+}
+
+func (a *staticAuthenticator) Method() Method {
+	return MethodStatic
+}
+
+func (a *staticAuthenticator) Authenticate(_ context.Context, token string) (*User, error) {
+	hash := sha256.Sum256([]byte(token))
+	match := -1
+	for i := range a.tokens {
+		if subtle.ConstantTimeCompare(hash[:], a.tokens[i][:]) == 1 {
+			match = i
+		}
+	}
+	if match < 0 {
+		return nil, ErrUnrecognized
+	}
+	user := a.users[match]
+	return &user, nil
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"github.com/krateoplatformops/plumbing/cache"
+	authenticationv1 "k8s.io/api/authentication/v1"
+)
+
+const (
+	// Validity of the results of the token reviews, so that the API server is not asked at every request
+	tokenReviewTTL       = time.Minute
+	failedTokenReviewTTL = 10 * time.Second
+	tokenReviewTimeout   = 10 * time.Second
+)
+
+// ReviewFunc asks the API server to review a token, see reviews.Token
+type ReviewFunc func(ctx context.Context, token string) (*authenticationv1.TokenReviewStatus, error)
+
+// tokenReviewAuthenticator verifies the tokens known to the API server, e.g., the tokens of the ServiceAccounts
+type tokenReviewAuthenticator struct {
+	review ReviewFunc
+	// results of the reviews by the hash of the token, a nil user for tokens not authenticated
+	results *cache.TTLCache[[sha256.Size]byte, *User]
+}
+
+func NewTokenReviewAuthenticator(review ReviewFunc) Authenticator {
+	return &tokenReviewAuthenticator{review: review, results: cache.NewTTL[[sha256.Size]byte, *User]()}
+}
+
+func (a *tokenReviewAuthenticator) Method() Method {
+	return MethodTokenReview
+}
+
+func (a *tokenReviewAuthenticator) Authenticate(ctx context.Context, token string) (*User, error) {
+	key := sha256.Sum256([]byte(token))
+	if user, ok := a.results.Get(key); ok {
+		return copyUser(user)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, tokenReviewTimeout)
+	defer cancel()
+	status, err := a.review(ctx, token)
+	if err != nil {
+		// Not cached, the API server may be unavailable
+		return nil, err
+	}
+	if !status.Authenticated {
+		a.results.Set(key, nil, failedTokenReviewTTL)
+		return copyUser(nil)
+	}
+	user := &User{Name: status.User.Username, UID: status.User.UID, Groups: status.User.Groups, Method: MethodTokenReview}
+	if len(status.User.Extra) > 0 {
+		user.Extra = map[string][]string{}
+		for key, values := range status.User.Extra {
+			user.Extra[key] = values
+		}
+	}
+	a.results.Set(key, user, tokenReviewTTL)
+	return copyUser(user)
+}
+
+// copyUser returns a copy of a cached user, or the error of a token not authenticated
+func copyUser(user *User) (*User, error) {
+	if user == nil {
+		return nil, fmt.Errorf("token not authenticated by the API server")
+	}
+	copied := *user
+	return &copied, nil
+}
@@ -5,233 +5,112 @@ import (
 	types "resource-tree-handler/apis"
 	kubehelper "resource-tree-handler/internal/helpers/kube/client"
 	compositionhelper "resource-tree-handler/internal/helpers/kube/compositions"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
 )
 
+// instance distinguishes the revisions of this process from the ones of previous runs, since revisions restart at each start
+var instance = strconv.FormatInt(time.Now().UnixNano(), 36)
+
 type ResourceTreeUpdate struct {
 	LastUpdate           time.Time
 	ResourceTree         types.ResourceTree
 	CompositionReference types.Reference
 	Filters              types.Filters
+
+	// Revision is assigned by the store every time the entry is replaced or an update is committed.
+	// It increases monotonically and is never reused, not even for another composition, so it
+	// identifies a version of the resource tree. It is also used to detect concurrent modifications
+	// between a snapshot and its commit. The value set by callers of Put is ignored.
+	Revision uint64
 }
 
-type operation int
+// ETag returns the entity tag of the resource tree at this revision
+func (in *ResourceTreeUpdate) ETag() string {
+	return fmt.Sprintf("\"%s-%d\"", instance, in.Revision)
+}
 
 // UpdateOperation represents a function that modifies a ResourceTreeUpdate
 type UpdateOperation func(*ResourceTreeUpdate) error
 
-const (
-	opAdd operation = iota
-	opUpdate
-	opGet
-	opGetResourceTree
-	opDelete
-	opListKeys
-	opIsUidInCache
-	opQueuedUpdate
-	// opWaitForResource: When received, checks if resource exists in cache and returns immediately if found.
-	// If not found, adds caller's response channel to waiters list for that composition ID.
-	// Caller will be notified through the channel when resource is added via opAdd, or will timeout.
-	opWaitForResource
-	opCleanupWaiter
-)
-
-type request struct {
-	op            operation
-	compositionId string
-	eventObjectId string
-	resourceTree  types.ResourceTree
-	compReference types.Reference
-	filters       types.Filters
-	updateOp      UpdateOperation
-	responseChan  chan interface{}
-	errorChan     chan error
-}
-
 type waitResult struct {
 	update    *ResourceTreeUpdate
 	ok        bool
 	discarded bool
 }
 
+// ThreadSafeCache wraps a Store with the operations needed by the webservice and the SSE client,
+// such as filtering the resource tree and waiting for a resource tree to be created.
 type ThreadSafeCache struct {
-	requestChan  chan request
-	cache        map[string]*ResourceTreeUpdate
-	waiters      map[string]map[string]chan interface{}
+	store Store
+	// waiters: When a resource tree is not in the store, the caller's channel is added to the waiters list
+	// for that composition ID. The caller is notified through the channel when the resource tree is added, or will timeout.
+	waiters      map[string]map[string]chan waitResult
 	waitersMutex sync.Mutex
 }
 
 func NewThreadSafeCache() *ThreadSafeCache {
-	c := &ThreadSafeCache{
-		requestChan: make(chan request),
-		cache:       make(map[string]*ResourceTreeUpdate),
-		waiters:     make(map[string]map[string]chan interface{}),
-	}
-	go c.run()
-	return c
+	return NewThreadSafeCacheWithStore(NewMemoryStore())
 }
 
-func (c *ThreadSafeCache) run() {
-	for req := range c.requestChan {
-		switch req.op {
-		case opAdd:
-			delete(c.cache, req.compositionId)
-			c.cache[req.compositionId] = &ResourceTreeUpdate{
-				LastUpdate:           time.Now(),
-				ResourceTree:         req.resourceTree,
-				CompositionReference: req.compReference,
-				Filters:              req.filters,
-			}
-			req.responseChan <- struct{}{}
-			c.notifyWaiters(req.compositionId)
-
-		case opUpdate:
-			if _, ok := c.cache[req.compositionId]; ok {
-				c.cache[req.compositionId].LastUpdate = time.Now()
-				c.cache[req.compositionId].ResourceTree = req.resourceTree
-			}
-			req.responseChan <- struct{}{}
-
-		case opGet:
-			obj, ok := c.cache[req.compositionId]
-			if ok {
-				req.responseChan <- struct {
-					status *ResourceTreeUpdate
-					ok     bool
-				}{obj, true}
-			} else {
-				req.responseChan <- struct {
-					status *ResourceTreeUpdate
-					ok     bool
-				}{nil, false}
-			}
-
-		case opGetResourceTree:
-			obj, ok := c.cache[req.compositionId]
-			if ok {
-				req.responseChan <- struct {
-					update *ResourceTreeUpdate
-					ok     bool
-				}{obj, true}
-			} else {
-				req.responseChan <- struct {
-					update *ResourceTreeUpdate
-					ok     bool
-				}{&ResourceTreeUpdate{}, false}
-			}
-
-		case opDelete:
-			delete(c.cache, req.compositionId)
-			req.responseChan <- struct{}{}
-
-		case opListKeys:
-			keys := make([]string, 0, len(c.cache))
-			for k := range c.cache {
-				keys = append(keys, k)
-			}
-			req.responseChan <- keys
-
-		case opIsUidInCache:
-			_, exists := c.cache[req.compositionId]
-			req.responseChan <- exists
-
-		case opQueuedUpdate:
-			if obj, ok := c.cache[req.compositionId]; ok {
-				if err := req.updateOp(obj); err != nil {
-					// Send error to error channel
-					req.errorChan <- err
-					// Also send an empty response to ensure the response channel is not blocked
-					req.responseChan <- struct{}{}
-				} else {
-					obj.LastUpdate = time.Now()
-					req.responseChan <- struct{}{}
-				}
-			} else {
-				// Send error to error channel
-				req.errorChan <- fmt.Errorf("resource tree for composition id %s not found", req.compositionId)
-				// Also send an empty response to ensure the response channel is not blocked
-				req.responseChan <- struct{}{}
-			}
+func NewThreadSafeCacheWithStore(store Store) *ThreadSafeCache {
+	return &ThreadSafeCache{
+		store:   store,
+		waiters: make(map[string]map[string]chan waitResult),
+	}
+}
 
-		case opWaitForResource:
-			if obj, exists := c.cache[req.compositionId]; exists {
-				req.responseChan <- waitResult{update: obj, ok: true, discarded: false}
-			} else {
-				log.Warn().Msgf("Composition not ready %s, setting up waiter %s", req.compositionId, req.eventObjectId)
-				c.waitersMutex.Lock()
-				if _, exists := c.waiters[req.compositionId]; !exists {
-					c.waiters[req.compositionId] = make(map[string]chan interface{})
-				}
-				if responseChan, ok := c.waiters[req.compositionId][req.eventObjectId]; ok {
-					log.Warn().Msgf("Sending discard to %s %s", req.compositionId, req.eventObjectId)
-					responseChan <- waitResult{update: &ResourceTreeUpdate{}, ok: true, discarded: true}
-				}
-				c.waiters[req.compositionId][req.eventObjectId] = req.responseChan
-				c.waitersMutex.Unlock()
-			}
+// Store returns the underlying typed store
+func (c *ThreadSafeCache) Store() Store {
+	return c.store
+}
 
-		case opCleanupWaiter:
-			c.waitersMutex.Lock()
-			if innerMap, exists := c.waiters[req.compositionId]; exists {
-				if _, exists := innerMap[req.eventObjectId]; exists {
-					delete(innerMap, req.eventObjectId)
-					if len(innerMap) == 0 {
-						delete(c.waiters, req.compositionId)
-					}
-				}
-			}
-			c.waitersMutex.Unlock()
-			req.responseChan <- struct{}{}
-		}
+// Stats returns the size and eviction statistics of the underlying store, if it supports eviction
+func (c *ThreadSafeCache) Stats() (EvictionStats, bool) {
+	if store, ok := c.store.(interface{ Stats() EvictionStats }); ok {
+		return store.Stats(), true
 	}
+	return EvictionStats{}, false
 }
 
 func (c *ThreadSafeCache) AddToCache(resourceTree types.ResourceTree, compositionId string, compositionReference types.Reference, filters types.Filters) {
-	responseChan := make(chan interface{})
-	c.requestChan <- request{
-		op:            opAdd,
-		compositionId: compositionId,
-		resourceTree:  resourceTree,
-		compReference: compositionReference,
-		filters:       filters,
-		responseChan:  responseChan,
-	}
-	<-responseChan
+	c.store.Put(compositionId, &ResourceTreeUpdate{
+		LastUpdate:           time.Now(),
+		ResourceTree:         resourceTree,
+		CompositionReference: compositionReference,
+		Filters:              filters,
+	})
+	c.notifyWaiters(compositionId)
 }
 
 func (c *ThreadSafeCache) UpdateCacheEntry(resourceTree types.ResourceTree, compositionId string, compositionReference types.Reference) {
-	responseChan := make(chan interface{})
-	c.requestChan <- request{
-		op:            opUpdate,
-		compositionId: compositionId,
-		resourceTree:  resourceTree,
-		compReference: compositionReference,
-		responseChan:  responseChan,
+	err := c.store.Update(compositionId, func(update *ResourceTreeUpdate) error {
+		update.ResourceTree = resourceTree
+		return nil
+	})
+	if err != nil {
+		log.Warn().Err(err).Msgf("could not update cache entry for composition id %s", compositionId)
 	}
-	<-responseChan
 }
 
 func (c *ThreadSafeCache) GetJSONFromCache(compositionId string) ([]*types.ResourceNodeStatus, bool) {
-	responseChan := make(chan interface{})
-	c.requestChan <- request{
-		op:            opGet,
-		compositionId: compositionId,
-		responseChan:  responseChan,
+	status, ok := c.store.Get(compositionId)
+	if !ok {
+		return []*types.ResourceNodeStatus{}, false
 	}
-	response := <-responseChan
-	result := response.(struct {
-		status *ResourceTreeUpdate
-		ok     bool
-	})
+	return FilterResourceTree(status), true
+}
 
+// FilterResourceTree returns the status of the resource tree without the resources excluded by the filters
+func FilterResourceTree(status *ResourceTreeUpdate) []*types.ResourceNodeStatus {
 	final_array := []*types.ResourceNodeStatus{}
-	if result.ok {
-		excludes := result.status.Filters.Exclude
-		for _, managedResource := range result.status.ResourceTree.Resources.Status {
-			skip := false
+	excludes := status.Filters.Exclude
+	for _, managedResource := range status.ResourceTree.Resources.Status {
+		skip := false
+		if len(excludes) > 0 {
 			gr := kubehelper.InferGroupResource(managedResource.Version, managedResource.Kind)
 			reference := types.Reference{
 				ApiVersion: managedResource.Version,
@@ -246,61 +125,75 @@ func (c *ThreadSafeCache) GetJSONFromCache(compositionId string) ([]*types.Resou
 					break
 				}
 			}
-			if skip {
-				continue
-			}
-			final_array = append(final_array, managedResource)
 		}
+		if skip {
+			continue
+		}
+		final_array = append(final_array, managedResource)
 	}
-
-	return final_array, result.ok
+	return final_array
 }
 
 func (c *ThreadSafeCache) GetResourceTreeFromCache(compositionId string) (*ResourceTreeUpdate, bool) {
-	responseChan := make(chan interface{})
-	c.requestChan <- request{
-		op:            opGetResourceTree,
-		compositionId: compositionId,
-		responseChan:  responseChan,
+	update, ok := c.store.Get(compositionId)
+	if !ok {
+		return &ResourceTreeUpdate{}, false
 	}
-	response := <-responseChan
-	result := response.(struct {
-		update *ResourceTreeUpdate
-		ok     bool
-	})
-	return result.update, result.ok
+	return update, true
+}
+
+// GetRevisionFromCache returns the resource tree at the given revision, if the store still has it
+func (c *ThreadSafeCache) GetRevisionFromCache(compositionId string, revision uint64) (*ResourceTreeUpdate, bool) {
+	store, ok := c.store.(RevisionStore)
+	if !ok {
+		return nil, false
+	}
+	return store.GetRevision(compositionId, revision)
 }
 
 func (c *ThreadSafeCache) GetResourceTreeFromCacheWithTimeout(compositionId string, eventObjectId string, timeout time.Duration) (*ResourceTreeUpdate, bool, bool) {
-	responseChan := make(chan interface{})
+	// Buffered, so that the notifier never blocks on a waiter that already timed out
+	responseChan := make(chan waitResult, 1)
 
-	c.requestChan <- request{
-		op:            opWaitForResource,
-		compositionId: compositionId,
-		eventObjectId: eventObjectId,
-		responseChan:  responseChan,
+	c.waitersMutex.Lock()
+	if obj, exists := c.store.Get(compositionId); exists {
+		c.waitersMutex.Unlock()
+		return obj, true, false
+	}
+	log.Warn().Msgf("Composition not ready %s, setting up waiter %s", compositionId, eventObjectId)
+	if _, exists := c.waiters[compositionId]; !exists {
+		c.waiters[compositionId] = make(map[string]chan waitResult)
 	}
+	if previousChan, ok := c.waiters[compositionId][eventObjectId]; ok {
+		log.Warn().Msgf("Sending discard to %s %s", compositionId, eventObjectId)
+		previousChan <- waitResult{update: &ResourceTreeUpdate{}, ok: true, discarded: true}
+	}
+	c.waiters[compositionId][eventObjectId] = responseChan
+	c.waitersMutex.Unlock()
 
 	select {
 	case result := <-responseChan:
-		if r, ok := result.(waitResult); ok {
-			return r.update, r.ok, r.discarded
-		}
-		return &ResourceTreeUpdate{}, false, false
+		return result.update, result.ok, result.discarded
 	case <-time.After(timeout):
-		cleanupResponseChan := make(chan interface{})
-		c.requestChan <- request{
-			op:            opCleanupWaiter,
-			compositionId: compositionId,
-			eventObjectId: eventObjectId,
-			responseChan:  cleanupResponseChan,
-		}
-		// Make sure to consume the response to avoid goroutine leaks
-		<-cleanupResponseChan
+		c.cleanupWaiter(compositionId, eventObjectId, responseChan)
 		return &ResourceTreeUpdate{}, false, false
 	}
 }
 
+func (c *ThreadSafeCache) cleanupWaiter(compositionId string, eventObjectId string, responseChan chan waitResult) {
+	c.waitersMutex.Lock()
+	defer c.waitersMutex.Unlock()
+	if innerMap, exists := c.waiters[compositionId]; exists {
+		// The waiter might have been replaced by a newer one for the same object
+		if current, exists := innerMap[eventObjectId]; exists && current == responseChan {
+			delete(innerMap, eventObjectId)
+			if len(innerMap) == 0 {
+				delete(c.waiters, compositionId)
+			}
+		}
+	}
+}
+
 func (c *ThreadSafeCache) notifyWaiters(compositionId string) {
 	c.waitersMutex.Lock()
 	defer c.waitersMutex.Unlock()
@@ -308,71 +201,46 @@ func (c *ThreadSafeCache) notifyWaiters(compositionId string) {
 	log.Info().Msgf("Notifying eventsse waiters for composition id %s", compositionId)
 
 	if waiters, exists := c.waiters[compositionId]; exists {
-		obj := c.cache[compositionId]
 		for key, objectWaiters := range waiters {
 			log.Info().Msgf("\tNotifying eventsse waiter for object id %s", key)
-			objectWaiters <- waitResult{update: obj, ok: true, discarded: false}
+			obj, ok := c.store.Get(compositionId)
+			objectWaiters <- waitResult{update: obj, ok: ok, discarded: false}
 		}
 		delete(c.waiters, compositionId)
 	}
 }
 
-// QueueUpdate allows atomic updates to the ResourceTreeUpdate
+// QueueUpdate allows atomic updates to the ResourceTreeUpdate.
+// The update operation is executed on a copy of the entry, so that slow operations (e.g., calls to the
+// Kubernetes API server) do not block the other cache operations. See Store.Update.
 func (c *ThreadSafeCache) QueueUpdate(compositionId string, updateOp UpdateOperation) error {
-	responseChan := make(chan interface{})
-	errorChan := make(chan error)
-
-	c.requestChan <- request{
-		op:            opQueuedUpdate,
-		compositionId: compositionId,
-		updateOp:      updateOp,
-		responseChan:  responseChan,
-		errorChan:     errorChan,
-	}
-
-	// Use select to handle both channels
-	select {
-	case err := <-errorChan:
-		// Consume the response channel to avoid goroutine leak
-		<-responseChan
-		return err
-	case <-responseChan:
-		// Check if there's also an error
-		select {
-		case err := <-errorChan:
-			return err
-		default:
-			// No error, continue
-			return nil
-		}
-	}
+	return c.store.Update(compositionId, updateOp)
 }
 
 func (c *ThreadSafeCache) DeleteFromCache(compositionId string) {
-	responseChan := make(chan interface{})
-	c.requestChan <- request{
-		op:            opDelete,
-		compositionId: compositionId,
-		responseChan:  responseChan,
+	c.store.Delete(compositionId)
+}
+
+// RangeCache calls fn for every cached resource tree until fn returns false. The entries are read-only
+// and must not be retained: with stores that do not implement Range, they are copies.
+func (c *ThreadSafeCache) RangeCache(fn func(compositionId string, entry *ResourceTreeUpdate) bool) {
+	if store, ok := c.store.(interface {
+		Range(fn func(compositionId string, entry *ResourceTreeUpdate) bool)
+	}); ok {
+		store.Range(fn)
+		return
+	}
+	for _, compositionId := range c.store.List() {
+		if entry, ok := c.store.Get(compositionId); ok && !fn(compositionId, entry) {
+			return
+		}
 	}
-	<-responseChan
 }
 
 func (c *ThreadSafeCache) ListKeysFromCache() []string {
-	responseChan := make(chan interface{})
-	c.requestChan <- request{
-		op:           opListKeys,
-		responseChan: responseChan,
-	}
-	return (<-responseChan).([]string)
+	return c.store.List()
 }
 
 func (c *ThreadSafeCache) IsUidInCache(compositionId string) bool {
-	responseChan := make(chan interface{})
-	c.requestChan <- request{
-		op:            opIsUidInCache,
-		compositionId: compositionId,
-		responseChan:  responseChan,
-	}
-	return (<-responseChan).(bool)
+	return c.store.Has(compositionId)
 }
@@ -0,0 +1,194 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	types "resource-tree-handler/apis"
+
+	"github.com/rs/zerolog"
+)
+
+func TestMain(m *testing.M) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	os.Exit(m.Run())
+}
+
+func testResourceTree(compositionId string) types.ResourceTree {
+	uid := "root-uid"
+	root := &types.ResourceNodeStatus{
+		ResourceRefStatus: types.ResourceRefStatus{Kind: "CompositionReference", Name: "root"},
+		UID:               &uid,
+		Health:            &types.Health{Type: "Ready", Status: "True"},
+	}
+	child := &types.ResourceNodeStatus{
+		ResourceRefStatus: types.ResourceRefStatus{Kind: "ConfigMap", Version: "v1", Name: "child"},
+		ParentRefs:        []*types.ResourceNodeStatus{root},
+		Health:            &types.Health{},
+	}
+	return types.ResourceTree{
+		CompositionId:     compositionId,
+		RootElementStatus: root,
+		Resources: types.ResourceTreeJson{
+			Status: []*types.ResourceNodeStatus{root, child},
+		},
+	}
+}
+
+func TestQueueUpdateDoesNotBlockReads(t *testing.T) {
+	c := NewThreadSafeCache()
+	c.AddToCache(testResourceTree("slow"), "slow", types.Reference{}, types.Filters{})
+	c.AddToCache(testResourceTree("fast"), "fast", types.Reference{}, types.Filters{})
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- c.QueueUpdate("slow", func(update *ResourceTreeUpdate) error {
+			close(started)
+			<-release
+			update.ResourceTree.RootElementStatus.Health.Status = "False"
+			return nil
+		})
+	}()
+	<-started
+
+	readDone := make(chan struct{})
+	go func() {
+		c.GetResourceTreeFromCache("slow")
+		c.GetResourceTreeFromCache("fast")
+		c.AddToCache(testResourceTree("other"), "other", types.Reference{}, types.Filters{})
+		close(readDone)
+	}()
+	select {
+	case <-readDone:
+	case <-time.After(time.Second):
+		t.Fatal("cache operations blocked by an in-flight update")
+	}
+
+	// The update is not visible until it is committed
+	update, _ := c.GetResourceTreeFromCache("slow")
+	if update.ResourceTree.RootElementStatus.Health.Status != "True" {
+		t.Fatal("uncommitted update is visible")
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	update, _ = c.GetResourceTreeFromCache("slow")
+	if update.ResourceTree.RootElementStatus.Health.Status != "False" {
+		t.Fatal("committed update is not visible")
+	}
+}
+
+func TestQueueUpdateRecomputesOnConflict(t *testing.T) {
+	c := NewThreadSafeCache()
+	c.AddToCache(testResourceTree("id"), "id", types.Reference{}, types.Filters{})
+
+	attempts := 0
+	err := c.QueueUpdate("id", func(update *ResourceTreeUpdate) error {
+		attempts++
+		if attempts == 1 {
+			// A full rebuild happens while the update is being computed
+			c.AddToCache(testResourceTree("id"), "id", types.Reference{Name: "rebuilt"}, types.Filters{})
+		}
+		update.ResourceTree.CompositionId = "updated"
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 {
+		t.Fatalf("expected 2 attempts, got %d", attempts)
+	}
+	update, _ := c.GetResourceTreeFromCache("id")
+	if update.CompositionReference.Name != "rebuilt" || update.ResourceTree.CompositionId != "updated" {
+		t.Fatal("update was not applied on top of the rebuilt resource tree")
+	}
+}
+
+func TestQueueUpdateNotFound(t *testing.T) {
+	c := NewThreadSafeCache()
+	err := c.QueueUpdate("missing", func(update *ResourceTreeUpdate) error {
+		t.Fatal("update executed for missing composition")
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected error for missing composition")
+	}
+}
+
+// BenchmarkGetUnderConcurrentUpdates measures the read latency while slow updates,
+// simulating calls to the Kubernetes API server, are running for other compositions.
+func BenchmarkGetUnderConcurrentUpdates(b *testing.B) {
+	for _, updaters := range []int{0, 10, 50} {
+		b.Run(fmt.Sprintf("updaters=%d", updaters), func(b *testing.B) {
+			c := NewThreadSafeCache()
+			c.AddToCache(testResourceTree("read"), "read", types.Reference{}, types.Filters{})
+			for i := range updaters {
+				id := fmt.Sprintf("update-%d", i)
+				c.AddToCache(testResourceTree(id), id, types.Reference{}, types.Filters{})
+			}
+
+			var stop atomic.Bool
+			var wg sync.WaitGroup
+			for i := range updaters {
+				wg.Add(1)
+				go func(id string) {
+					defer wg.Done()
+					for !stop.Load() {
+						c.QueueUpdate(id, func(update *ResourceTreeUpdate) error {
+							time.Sleep(5 * time.Millisecond)
+							return nil
+						})
+					}
+				}(fmt.Sprintf("update-%d", i))
+			}
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, ok := c.GetResourceTreeFromCache("read"); !ok {
+						b.Error("entry not found")
+					}
+				}
+			})
+			b.StopTimer()
+
+			stop.Store(true)
+			wg.Wait()
+		})
+	}
+}
+
+func TestWatchSlow(t *testing.T) {
+	s := NewMemoryStore()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := s.Watch(ctx)
+
+	// The watcher is dropped once it falls more than maxWatchQueue events behind, without blocking the store
+	for i := range maxWatchQueue + 2 {
+		s.Put("a", testEntry(fmt.Sprintf("a-%d", i)))
+	}
+	timeout := time.After(5 * time.Second)
+	for received := 0; ; received++ {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				if received > maxWatchQueue {
+					t.Fatalf("received %d events, more than the queue size", received)
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatal("slow watcher not dropped")
+		}
+	}
+}
@@ -0,0 +1,329 @@
+// Package cachetest implements the tests that every cache.Store backend must pass.
+package cachetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	types "resource-tree-handler/apis"
+	"resource-tree-handler/internal/cache"
+)
+
+// TestStore runs the conformance suite against the stores returned by newStore,
+// every subtest receives a new, empty, store.
+func TestStore(t *testing.T, newStore func() cache.Store) {
+	t.Run("GetMissing", func(t *testing.T) { testGetMissing(t, newStore()) })
+	t.Run("Has", func(t *testing.T) { testHas(t, newStore()) })
+	t.Run("PutGet", func(t *testing.T) { testPutGet(t, newStore()) })
+	t.Run("PutReplaces", func(t *testing.T) { testPutReplaces(t, newStore()) })
+	t.Run("GetReturnsCopy", func(t *testing.T) { testGetReturnsCopy(t, newStore()) })
+	t.Run("PutStoresCopy", func(t *testing.T) { testPutStoresCopy(t, newStore()) })
+	t.Run("Update", func(t *testing.T) { testUpdate(t, newStore()) })
+	t.Run("UpdateMissing", func(t *testing.T) { testUpdateMissing(t, newStore()) })
+	t.Run("UpdateError", func(t *testing.T) { testUpdateError(t, newStore()) })
+	t.Run("ConcurrentUpdates", func(t *testing.T) { testConcurrentUpdates(t, newStore()) })
+	t.Run("Revision", func(t *testing.T) { testRevision(t, newStore()) })
+	t.Run("Delete", func(t *testing.T) { testDelete(t, newStore()) })
+	t.Run("List", func(t *testing.T) { testList(t, newStore()) })
+	t.Run("Watch", func(t *testing.T) { testWatch(t, newStore()) })
+	t.Run("WatchReturnsCopy", func(t *testing.T) { testWatchReturnsCopy(t, newStore()) })
+	t.Run("WatchClosed", func(t *testing.T) { testWatchClosed(t, newStore()) })
+}
+
+// NewEntry returns a small resource tree with a root element and one child.
+func NewEntry(compositionId string) *cache.ResourceTreeUpdate {
+	uid := compositionId + "-root"
+	root := &types.ResourceNodeStatus{
+		ResourceRefStatus: types.ResourceRefStatus{Version: "resourcetrees.krateo.io/v1", Kind: "CompositionReference", Name: compositionId},
+		UID:               &uid,
+		Health:            &types.Health{Type: "Ready", Status: "True"},
+	}
+	childUid := compositionId + "-child"
+	child := &types.ResourceNodeStatus{
+		ResourceRefStatus: types.ResourceRefStatus{Version: "v1", Kind: "ConfigMap", Name: compositionId},
+		UID:               &childUid,
+		ParentRefs:        []*types.ResourceNodeStatus{root},
+		Health:            &types.Health{},
+	}
+	return &cache.ResourceTreeUpdate{
+		LastUpdate: time.Now(),
+		ResourceTree: types.ResourceTree{
+			CompositionId:     compositionId,
+			RootElementStatus: root,
+			Resources: types.ResourceTreeJson{
+				Status: []*types.ResourceNodeStatus{root, child},
+			},
+		},
+		CompositionReference: types.Reference{Uid: compositionId, Name: compositionId},
+		Filters:              types.Filters{Exclude: []types.Exclude{{Resource: "widgets"}}},
+	}
+}
+
+func mustGet(t *testing.T, s cache.Store, compositionId string) *cache.ResourceTreeUpdate {
+	t.Helper()
+	obj, ok := s.Get(compositionId)
+	if !ok {
+		t.Fatalf("entry %s not found", compositionId)
+	}
+	return obj
+}
+
+func testGetMissing(t *testing.T, s cache.Store) {
+	if _, ok := s.Get("missing"); ok {
+		t.Fatal("Get returned an entry for a missing composition id")
+	}
+}
+
+func testHas(t *testing.T, s cache.Store) {
+	if s.Has("a") {
+		t.Fatal("Has reported a missing composition id")
+	}
+	s.Put("a", NewEntry("a"))
+	if !s.Has("a") {
+		t.Fatal("Has did not report a stored composition id")
+	}
+	s.Delete("a")
+	if s.Has("a") {
+		t.Fatal("Has reported a deleted composition id")
+	}
+}
+
+func testPutGet(t *testing.T, s cache.Store) {
+	s.Put("a", NewEntry("a"))
+	obj := mustGet(t, s, "a")
+	if obj.CompositionReference.Name != "a" || len(obj.ResourceTree.Resources.Status) != 2 || len(obj.Filters.Exclude) != 1 {
+		t.Fatalf("unexpected entry %+v", obj)
+	}
+}
+
+func testPutReplaces(t *testing.T, s cache.Store) {
+	s.Put("a", NewEntry("a"))
+	replacement := NewEntry("a")
+	replacement.CompositionReference.Name = "replaced"
+	s.Put("a", replacement)
+	if obj := mustGet(t, s, "a"); obj.CompositionReference.Name != "replaced" {
+		t.Fatal("Put did not replace the entry")
+	}
+}
+
+func testGetReturnsCopy(t *testing.T, s cache.Store) {
+	s.Put("a", NewEntry("a"))
+	obj := mustGet(t, s, "a")
+	obj.ResourceTree.Resources.Status[0].Health.Status = "False"
+	obj.ResourceTree.Resources.Status = obj.ResourceTree.Resources.Status[:1]
+	obj.Filters.Exclude[0].Resource = "changed"
+
+	obj = mustGet(t, s, "a")
+	if obj.ResourceTree.Resources.Status[0].Health.Status != "True" || len(obj.ResourceTree.Resources.Status) != 2 || obj.Filters.Exclude[0].Resource != "widgets" {
+		t.Fatal("modifying the value returned by Get changed the stored entry")
+	}
+}
+
+func testPutStoresCopy(t *testing.T, s cache.Store) {
+	entry := NewEntry("a")
+	s.Put("a", entry)
+	entry.ResourceTree.RootElementStatus.Health.Status = "False"
+	if obj := mustGet(t, s, "a"); obj.ResourceTree.RootElementStatus.Health.Status != "True" {
+		t.Fatal("modifying the value passed to Put changed the stored entry")
+	}
+}
+
+func testUpdate(t *testing.T, s cache.Store) {
+	s.Put("a", NewEntry("a"))
+	err := s.Update("a", func(obj *cache.ResourceTreeUpdate) error {
+		obj.ResourceTree.Resources.Status[1].Health.Status = "False"
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj := mustGet(t, s, "a"); obj.ResourceTree.Resources.Status[1].Health.Status != "False" {
+		t.Fatal("Update was not stored")
+	}
+}
+
+func testUpdateMissing(t *testing.T, s cache.Store) {
+	err := s.Update("missing", func(obj *cache.ResourceTreeUpdate) error {
+		t.Fatal("update operation executed for a missing entry")
+		return nil
+	})
+	if !errors.Is(err, cache.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func testUpdateError(t *testing.T, s cache.Store) {
+	s.Put("a", NewEntry("a"))
+	updateErr := errors.New("update failed")
+	err := s.Update("a", func(obj *cache.ResourceTreeUpdate) error {
+		obj.CompositionReference.Name = "partial"
+		return updateErr
+	})
+	if !errors.Is(err, updateErr) {
+		t.Fatalf("expected the update error, got %v", err)
+	}
+	if obj := mustGet(t, s, "a"); obj.CompositionReference.Name != "a" {
+		t.Fatal("a failed update was stored")
+	}
+}
+
+func testConcurrentUpdates(t *testing.T, s cache.Store) {
+	s.Put("a", NewEntry("a"))
+	const updates = 20
+	var wg sync.WaitGroup
+	for i := range updates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.Update("a", func(obj *cache.ResourceTreeUpdate) error {
+				obj.ResourceTree.Resources.Status = append(obj.ResourceTree.Resources.Status, &types.ResourceNodeStatus{
+					ResourceRefStatus: types.ResourceRefStatus{Name: fmt.Sprintf("node-%d", i)},
+				})
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if obj := mustGet(t, s, "a"); len(obj.ResourceTree.Resources.Status) != 2+updates {
+		t.Fatalf("expected %d nodes, got %d: concurrent updates were lost", 2+updates, len(obj.ResourceTree.Resources.Status))
+	}
+}
+
+func testRevision(t *testing.T, s cache.Store) {
+	entry := NewEntry("a")
+	entry.Revision = 100
+	s.Put("a", entry)
+	s.Put("b", NewEntry("b"))
+	first := mustGet(t, s, "a").Revision
+	if first == 0 || first == 100 {
+		t.Fatalf("Put did not assign a revision, got %d", first)
+	}
+	if mustGet(t, s, "b").Revision == first {
+		t.Fatal("revision reused by another entry")
+	}
+
+	if err := s.Update("a", func(update *cache.ResourceTreeUpdate) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	updated := mustGet(t, s, "a").Revision
+	if updated <= first {
+		t.Fatalf("Update did not increase the revision: %d after %d", updated, first)
+	}
+
+	s.Delete("a")
+	s.Put("a", NewEntry("a"))
+	if readded := mustGet(t, s, "a").Revision; readded <= updated {
+		t.Fatalf("revision reused after Delete: %d after %d", readded, updated)
+	}
+}
+
+func testDelete(t *testing.T, s cache.Store) {
+	s.Put("a", NewEntry("a"))
+	if !s.Delete("a") {
+		t.Fatal("Delete returned false for an existing entry")
+	}
+	if _, ok := s.Get("a"); ok {
+		t.Fatal("entry still present after Delete")
+	}
+	if s.Delete("a") {
+		t.Fatal("Delete returned true for a missing entry")
+	}
+}
+
+func testList(t *testing.T, s cache.Store) {
+	if len(s.List()) != 0 {
+		t.Fatal("List of an empty store is not empty")
+	}
+	s.Put("a", NewEntry("a"))
+	s.Put("b", NewEntry("b"))
+	keys := s.List()
+	slices.Sort(keys)
+	if !slices.Equal(keys, []string{"a", "b"}) {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+}
+
+func receive(t *testing.T, events <-chan cache.WatchEvent) cache.WatchEvent {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("watch channel closed")
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for watch event")
+	}
+	return cache.WatchEvent{}
+}
+
+func testWatch(t *testing.T, s cache.Store) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := s.Watch(ctx)
+
+	s.Put("a", NewEntry("a"))
+	s.Update("a", func(obj *cache.ResourceTreeUpdate) error {
+		obj.CompositionReference.Name = "updated"
+		return nil
+	})
+	s.Put("a", NewEntry("a"))
+	s.Delete("a")
+
+	event := receive(t, events)
+	if event.Type != cache.EventAdded || event.CompositionId != "a" || event.Entry == nil || event.Previous != nil {
+		t.Fatalf("unexpected first event %+v", event)
+	}
+	event = receive(t, events)
+	if event.Type != cache.EventUpdated || event.Entry.CompositionReference.Name != "updated" || event.Previous.CompositionReference.Name != "a" {
+		t.Fatalf("unexpected second event %+v", event)
+	}
+	event = receive(t, events)
+	if event.Type != cache.EventUpdated || event.Entry.CompositionReference.Name != "a" || event.Previous.CompositionReference.Name != "updated" {
+		t.Fatalf("unexpected third event %+v", event)
+	}
+	event = receive(t, events)
+	if event.Type != cache.EventDeleted || event.Entry != nil || event.Previous == nil {
+		t.Fatalf("unexpected fourth event %+v", event)
+	}
+}
+
+func testWatchReturnsCopy(t *testing.T, s cache.Store) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := s.Watch(ctx)
+
+	s.Put("a", NewEntry("a"))
+	event := receive(t, events)
+	event.Entry.ResourceTree.RootElementStatus.Health.Status = "False"
+	if obj := mustGet(t, s, "a"); obj.ResourceTree.RootElementStatus.Health.Status != "True" {
+		t.Fatal("modifying a watch event changed the stored entry")
+	}
+}
+
+func testWatchClosed(t *testing.T, s cache.Store) {
+	ctx, cancel := context.WithCancel(context.Background())
+	events := s.Watch(ctx)
+	cancel()
+	// Changes after the cancellation must not block the store
+	s.Put("a", NewEntry("a"))
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("watch channel not closed after context cancellation")
+		}
+	}
+}
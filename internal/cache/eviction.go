@@ -0,0 +1,233 @@
+package cache
+
+import (
+	"container/list"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// EvictionPolicy bounds the memory used by a MemoryStore. Zero values disable the respective limit.
+// Evicted compositions are rebuilt from scratch the next time they are requested.
+type EvictionPolicy struct {
+	// MaxEntries is the maximum number of resource trees kept in the store
+	MaxEntries int `json:"maxEntries" yaml:"maxEntries"`
+	// MaxBytes is the approximate memory budget for all the resource trees, in bytes
+	MaxBytes int64 `json:"maxBytes" yaml:"maxBytes"`
+	// IdleTTL evicts the resource trees that were not requested nor updated within this window
+	IdleTTL time.Duration `json:"idleTTL" yaml:"idleTTL"`
+}
+
+// Eviction reasons reported in EvictionStats
+const (
+	EvictionReasonMaxEntries = "maxEntries"
+	EvictionReasonMaxBytes   = "maxBytes"
+	EvictionReasonIdleTTL    = "idleTTL"
+)
+
+// EvictionStats reports the current size of a MemoryStore and the evictions since its creation.
+type EvictionStats struct {
+	Policy  EvictionPolicy `json:"policy"`
+	Entries int            `json:"entries"`
+	// Bytes is the approximate size of all the resource trees currently stored
+	Bytes int64 `json:"bytes"`
+	// Evictions counts the evicted resource trees, by reason
+	Evictions map[string]uint64 `json:"evictions"`
+	// EvictedBytes is the approximate size of all the evicted resource trees
+	EvictedBytes uint64 `json:"evictedBytes"`
+}
+
+// entryMeta is the bookkeeping of a single entry, used to choose which entry to evict
+type entryMeta struct {
+	element    *list.Element
+	size       int64
+	lastAccess time.Time
+}
+
+// NewMemoryStoreWithEviction returns a MemoryStore that evicts the least recently used
+// resource trees when the policy limits are exceeded.
+// If policy.IdleTTL is set, a background goroutine evicts idle entries until Close is called.
+func NewMemoryStoreWithEviction(policy EvictionPolicy) *MemoryStore {
+	s := NewMemoryStore()
+	s.policy = policy
+	if policy.IdleTTL > 0 {
+		s.stop = make(chan struct{})
+		go s.janitor(policy.IdleTTL)
+	}
+	return s
+}
+
+// Close stops the background eviction of idle entries.
+func (s *MemoryStore) Close() {
+	s.closeOnce.Do(func() {
+		if s.stop != nil {
+			close(s.stop)
+		}
+	})
+}
+
+// Stats returns the current size of the store and the evictions since its creation.
+func (s *MemoryStore) Stats() EvictionStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.lruMu.Lock()
+	defer s.lruMu.Unlock()
+	evictions := make(map[string]uint64, len(s.evictions))
+	for reason, count := range s.evictions {
+		evictions[reason] = count
+	}
+	return EvictionStats{
+		Policy:       s.policy,
+		Entries:      len(s.entries),
+		Bytes:        s.bytes,
+		Evictions:    evictions,
+		EvictedBytes: s.evictedBytes,
+	}
+}
+
+// touch marks the entry as the most recently used one
+func (s *MemoryStore) touch(compositionId string) {
+	s.lruMu.Lock()
+	defer s.lruMu.Unlock()
+	if meta, ok := s.meta[compositionId]; ok {
+		meta.lastAccess = time.Now()
+		s.lru.MoveToFront(meta.element)
+	}
+}
+
+// track records a new value for the entry, s.mu must be held for writing
+func (s *MemoryStore) track(compositionId string, obj *ResourceTreeUpdate) {
+	s.lruMu.Lock()
+	defer s.lruMu.Unlock()
+	size := obj.approximateSize()
+	meta, ok := s.meta[compositionId]
+	if !ok {
+		meta = &entryMeta{element: s.lru.PushFront(compositionId)}
+		s.meta[compositionId] = meta
+	} else {
+		s.bytes -= meta.size
+		s.lru.MoveToFront(meta.element)
+	}
+	meta.size = size
+	meta.lastAccess = time.Now()
+	s.bytes += size
+}
+
+// untrack removes the entry bookkeeping and returns its size, s.mu must be held for writing
+func (s *MemoryStore) untrack(compositionId string) int64 {
+	s.lruMu.Lock()
+	defer s.lruMu.Unlock()
+	meta, ok := s.meta[compositionId]
+	if !ok {
+		return 0
+	}
+	s.lru.Remove(meta.element)
+	delete(s.meta, compositionId)
+	s.bytes -= meta.size
+	return meta.size
+}
+
+// enforceLimits evicts the least recently used entries until the store respects its policy.
+// The entry that was just written (keep) is never evicted. s.mu must be held for writing.
+func (s *MemoryStore) enforceLimits(keep string) {
+	for {
+		reason := ""
+		switch {
+		case s.policy.MaxEntries > 0 && len(s.entries) > s.policy.MaxEntries:
+			reason = EvictionReasonMaxEntries
+		case s.policy.MaxBytes > 0 && s.bytes > s.policy.MaxBytes:
+			reason = EvictionReasonMaxBytes
+		default:
+			return
+		}
+
+		s.lruMu.Lock()
+		element := s.lru.Back()
+		if element != nil && element.Value.(string) == keep {
+			element = element.Prev()
+		}
+		s.lruMu.Unlock()
+		if element == nil {
+			return
+		}
+		s.evict(element.Value.(string), reason)
+	}
+}
+
+// evict removes the entry and notifies the watchers. s.mu must be held for writing.
+func (s *MemoryStore) evict(compositionId string, reason string) {
+	previous, ok := s.entries[compositionId]
+	if !ok {
+		return
+	}
+	delete(s.entries, compositionId)
+	delete(s.history, compositionId)
+	s.reindex(compositionId, previous, nil)
+	size := s.untrack(compositionId)
+	s.lruMu.Lock()
+	s.evictions[reason]++
+	s.evictedBytes += uint64(size)
+	s.lruMu.Unlock()
+	log.Info().Msgf("Evicted resource tree for composition id %s from cache (%s, ~%d bytes)", compositionId, reason, size)
+	s.notify(WatchEvent{Type: EventEvicted, CompositionId: compositionId, Previous: previous})
+}
+
+func (s *MemoryStore) janitor(ttl time.Duration) {
+	interval := min(ttl/2, time.Minute)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.evictIdle(time.Now().Add(-ttl))
+		}
+	}
+}
+
+// evictIdle evicts all the entries that were not accessed after deadline
+func (s *MemoryStore) evictIdle(deadline time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		s.lruMu.Lock()
+		element := s.lru.Back()
+		idle := element != nil && s.meta[element.Value.(string)].lastAccess.Before(deadline)
+		s.lruMu.Unlock()
+		if !idle {
+			return
+		}
+		s.evict(element.Value.(string), EvictionReasonIdleTTL)
+	}
+}
+
+// approximateSize estimates the memory used by the entry, counting the strings and
+// a fixed overhead for each node of the resource tree
+func (in *ResourceTreeUpdate) approximateSize() int64 {
+	const (
+		entryOverhead = 512
+		nodeOverhead  = 256
+	)
+	size := int64(entryOverhead)
+	for _, node := range in.ResourceTree.Resources.Status {
+		if node == nil {
+			continue
+		}
+		size += nodeOverhead + int64(len(node.Version)+len(node.Kind)+len(node.Namespace)+len(node.Name))
+		if node.UID != nil {
+			size += int64(len(*node.UID))
+		}
+		if node.ResourceVersion != nil {
+			size += int64(len(*node.ResourceVersion))
+		}
+		if node.Health != nil {
+			size += int64(len(node.Health.Type) + len(node.Health.Status) + len(node.Health.Reason) + len(node.Health.Message))
+		}
+		size += int64(8 * len(node.ParentRefs))
+	}
+	for _, node := range in.ResourceTree.Resources.Spec.Tree {
+		size += nodeOverhead + int64(len(node.APIVersion)+len(node.Resource)+len(node.Name)+len(node.Namespace))
+	}
+	return size
+}
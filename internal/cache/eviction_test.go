@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	types "resource-tree-handler/apis"
+)
+
+func testEntry(compositionId string) *ResourceTreeUpdate {
+	return &ResourceTreeUpdate{ResourceTree: testResourceTree(compositionId)}
+}
+
+func TestEvictionMaxEntries(t *testing.T) {
+	s := NewMemoryStoreWithEviction(EvictionPolicy{MaxEntries: 2})
+	defer s.Close()
+	events := s.Watch(context.Background())
+
+	s.Put("a", testEntry("a"))
+	s.Put("b", testEntry("b"))
+	// "a" becomes the most recently used entry, so "b" is evicted
+	s.Get("a")
+	s.Put("c", testEntry("c"))
+
+	if _, ok := s.Get("b"); ok {
+		t.Fatal("least recently used entry was not evicted")
+	}
+	if _, ok := s.Get("a"); !ok {
+		t.Fatal("recently used entry was evicted")
+	}
+	if _, ok := s.Get("c"); !ok {
+		t.Fatal("new entry was evicted")
+	}
+
+	for range 3 {
+		<-events
+	}
+	if event := <-events; event.Type != EventEvicted || event.CompositionId != "b" {
+		t.Fatalf("expected eviction event for b, got %+v", event)
+	}
+
+	stats := s.Stats()
+	if stats.Entries != 2 || stats.Evictions[EvictionReasonMaxEntries] != 1 || stats.EvictedBytes == 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestEvictionHasIsNotAccess(t *testing.T) {
+	s := NewMemoryStoreWithEviction(EvictionPolicy{MaxEntries: 2})
+	defer s.Close()
+
+	s.Put("a", testEntry("a"))
+	s.Put("b", testEntry("b"))
+	// Unlike Get, Has does not make "a" the most recently used entry
+	s.Has("a")
+	s.Put("c", testEntry("c"))
+
+	if s.Has("a") {
+		t.Fatal("least recently used entry was not evicted")
+	}
+	if !s.Has("b") {
+		t.Fatal("recently used entry was evicted")
+	}
+}
+
+func TestEvictionMaxBytes(t *testing.T) {
+	size := testEntry("a").approximateSize()
+	s := NewMemoryStoreWithEviction(EvictionPolicy{MaxBytes: 2*size + size/2})
+	defer s.Close()
+
+	s.Put("a", testEntry("a"))
+	s.Put("b", testEntry("b"))
+	s.Put("c", testEntry("c"))
+
+	if _, ok := s.Get("a"); ok {
+		t.Fatal("entry was not evicted when exceeding the memory budget")
+	}
+	stats := s.Stats()
+	if stats.Entries != 2 || stats.Bytes > stats.Policy.MaxBytes || stats.Evictions[EvictionReasonMaxBytes] != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// A single entry larger than the budget is kept, otherwise it could never be served
+	s = NewMemoryStoreWithEviction(EvictionPolicy{MaxBytes: 1})
+	s.Put("a", testEntry("a"))
+	if _, ok := s.Get("a"); !ok {
+		t.Fatal("the only entry was evicted")
+	}
+}
+
+func TestEvictionIdleTTL(t *testing.T) {
+	s := NewMemoryStoreWithEviction(EvictionPolicy{})
+	s.Put("idle", testEntry("idle"))
+	s.Put("updated", testEntry("updated"))
+	deadline := time.Now()
+	s.Update("updated", func(update *ResourceTreeUpdate) error {
+		update.CompositionReference = types.Reference{Name: "updated"}
+		return nil
+	})
+
+	s.evictIdle(deadline)
+	if _, ok := s.Get("idle"); ok {
+		t.Fatal("idle entry was not evicted")
+	}
+	if _, ok := s.Get("updated"); !ok {
+		t.Fatal("updated entry was evicted")
+	}
+	if stats := s.Stats(); stats.Evictions[EvictionReasonIdleTTL] != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
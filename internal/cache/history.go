@@ -0,0 +1,56 @@
+package cache
+
+const (
+	// DefaultHistorySize is the number of previous revisions kept for each resource tree
+	DefaultHistorySize = 10
+)
+
+// RevisionStore is implemented by the stores that keep the previous revisions of their entries,
+// so that clients can be sent only the changes since the revision they already have.
+type RevisionStore interface {
+	// GetRevision returns a copy of the entry at the given revision, if it is the current one or it is still in the history
+	GetRevision(compositionId string, revision uint64) (*ResourceTreeUpdate, bool)
+}
+
+// SetHistorySize sets the number of previous revisions kept for each entry, 0 disables the history.
+// It must be called before the store is used.
+func (s *MemoryStore) SetHistorySize(size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.historySize = max(size, 0)
+}
+
+func (s *MemoryStore) GetRevision(compositionId string, revision uint64) (*ResourceTreeUpdate, bool) {
+	s.mu.RLock()
+	var found *ResourceTreeUpdate
+	if current, ok := s.entries[compositionId]; ok && current.Revision == revision {
+		found = current
+	} else {
+		for _, previous := range s.history[compositionId] {
+			if previous.Revision == revision {
+				found = previous
+				break
+			}
+		}
+	}
+	s.mu.RUnlock()
+	if found == nil {
+		return nil, false
+	}
+	// Stored entries are never modified in place, the copy can happen outside of the lock
+	return found.DeepCopy(), true
+}
+
+// record adds the replaced value of an entry to its history, s.mu must be held for writing.
+// The history is not counted in the memory bounds of the eviction policy.
+func (s *MemoryStore) record(compositionId string, previous *ResourceTreeUpdate) {
+	if s.historySize == 0 {
+		return
+	}
+	history := append(s.history[compositionId], previous)
+	if len(history) > s.historySize {
+		history[0] = nil
+		history = history[1:]
+	}
+	s.history[compositionId] = history
+}
@@ -0,0 +1,41 @@
+package cache
+
+import "testing"
+
+func TestRevisionHistory(t *testing.T) {
+	s := NewMemoryStore()
+	s.SetHistorySize(2)
+
+	s.Put("a", testEntry("a"))
+	s.Put("b", testEntry("b"))
+	for range 3 {
+		if err := s.Update("a", func(update *ResourceTreeUpdate) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Revisions are shared by all the entries: "a" went through 1, 3, 4 and 5
+	current, _ := s.Get("a")
+	if current.Revision != 5 {
+		t.Fatalf("expected revision 5, got %d", current.Revision)
+	}
+	for revision, expected := range map[uint64]bool{1: false, 2: false, 3: true, 4: true, 5: true} {
+		entry, ok := s.GetRevision("a", revision)
+		if ok != expected {
+			t.Errorf("revision %d: expected found=%t, got %t", revision, expected, ok)
+		}
+		if ok && entry.Revision != revision {
+			t.Errorf("revision %d: got entry at revision %d", revision, entry.Revision)
+		}
+	}
+
+	// The history does not survive the entry, revisions are never reused
+	s.Delete("a")
+	if _, ok := s.GetRevision("a", 4); ok {
+		t.Error("history kept after delete")
+	}
+	s.Put("a", testEntry("a"))
+	if current, _ = s.Get("a"); current.Revision != 6 {
+		t.Errorf("expected revision 6 after re-adding, got %d", current.Revision)
+	}
+}
@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// IndexByName indexes the resource trees by the namespace and name of their composition
+	IndexByName = "byName"
+	// IndexByKind indexes the resource trees by the group, kind, namespace and name of their composition
+	IndexByKind = "byKind"
+	// IndexByResource indexes the resource trees by the group, resource, namespace and name of their composition
+	IndexByResource = "byResource"
+	// IndexByNodeResource indexes the resource trees by the apiVersion, resource, namespace and name of their nodes
+	IndexByNodeResource = "byNodeResource"
+	// IndexByNodeUID indexes the resource trees by the uid of their nodes
+	IndexByNodeUID = "byNodeUID"
+)
+
+// IndexFunc returns the keys of an entry in an index
+type IndexFunc func(entry *ResourceTreeUpdate) []string
+
+// Indexers are the indexes kept by the stores returned by this package
+var Indexers = map[string]IndexFunc{
+	IndexByName: func(entry *ResourceTreeUpdate) []string {
+		reference := entry.CompositionReference
+		return []string{NameIndexKey(reference.Namespace, reference.Name)}
+	},
+	IndexByKind: func(entry *ResourceTreeUpdate) []string {
+		reference := entry.CompositionReference
+		if reference.Kind == "" {
+			return nil
+		}
+		return []string{ObjectIndexKey(schema.FromAPIVersionAndKind(reference.ApiVersion, "").Group, reference.Kind, reference.Namespace, reference.Name)}
+	},
+	IndexByResource: func(entry *ResourceTreeUpdate) []string {
+		reference := entry.CompositionReference
+		if reference.Resource == "" {
+			return nil
+		}
+		return []string{ObjectIndexKey(schema.FromAPIVersionAndKind(reference.ApiVersion, "").Group, reference.Resource, reference.Namespace, reference.Name)}
+	},
+	IndexByNodeResource: func(entry *ResourceTreeUpdate) []string {
+		keys := make([]string, 0, len(entry.ResourceTree.Resources.Spec.Tree))
+		for _, node := range entry.ResourceTree.Resources.Spec.Tree {
+			keys = append(keys, NodeIndexKey(node.APIVersion, node.Resource, node.Namespace, node.Name))
+		}
+		return keys
+	},
+	IndexByNodeUID: func(entry *ResourceTreeUpdate) []string {
+		keys := make([]string, 0, len(entry.ResourceTree.Resources.Status))
+		for _, node := range entry.ResourceTree.Resources.Status {
+			if node != nil && node.UID != nil && *node.UID != "" {
+				keys = append(keys, *node.UID)
+			}
+		}
+		return keys
+	},
+}
+
+// NameIndexKey returns the key of IndexByName
+func NameIndexKey(namespace string, name string) string {
+	return namespace + "/" + name
+}
+
+// ObjectIndexKey returns the key of IndexByKind and IndexByResource, kinds and resources are case insensitive
+func ObjectIndexKey(group string, kindOrResource string, namespace string, name string) string {
+	return group + "/" + strings.ToLower(kindOrResource) + "/" + namespace + "/" + name
+}
+
+// NodeIndexKey returns the key of IndexByNodeResource, resources are case insensitive
+func NodeIndexKey(apiVersion string, resource string, namespace string, name string) string {
+	return apiVersion + "/" + strings.ToLower(resource) + "/" + namespace + "/" + name
+}
+
+// IndexedStore is implemented by the stores that keep the Indexers up to date
+type IndexedStore interface {
+	// ByIndex returns the composition ids of the entries with the key in the index
+	ByIndex(indexName string, key string) []string
+}
+
+// index maps the keys of an index to the composition ids
+type index map[string]map[string]struct{}
+
+func (s *MemoryStore) ByIndex(indexName string, key string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	compositionIds := []string{}
+	for compositionId := range s.indexes[indexName][key] {
+		compositionIds = append(compositionIds, compositionId)
+	}
+	return compositionIds
+}
+
+// reindex replaces the index keys of the previous value of an entry with the ones of its new value,
+// either can be nil. s.mu must be held for writing.
+func (s *MemoryStore) reindex(compositionId string, previous *ResourceTreeUpdate, entry *ResourceTreeUpdate) {
+	for name, indexFunc := range Indexers {
+		idx, ok := s.indexes[name]
+		if !ok {
+			idx = index{}
+			s.indexes[name] = idx
+		}
+		if previous != nil {
+			for _, key := range indexFunc(previous) {
+				delete(idx[key], compositionId)
+				if len(idx[key]) == 0 {
+					delete(idx, key)
+				}
+			}
+		}
+		if entry != nil {
+			for _, key := range indexFunc(entry) {
+				if idx[key] == nil {
+					idx[key] = map[string]struct{}{}
+				}
+				idx[key][compositionId] = struct{}{}
+			}
+		}
+	}
+}
+
+// ByIndexFromCache returns the composition ids of the cached resource trees with the key in the index.
+// With stores that do not implement IndexedStore, all the entries are scanned.
+func (c *ThreadSafeCache) ByIndexFromCache(indexName string, key string) []string {
+	if store, ok := c.store.(IndexedStore); ok {
+		return store.ByIndex(indexName, key)
+	}
+	compositionIds := []string{}
+	indexFunc, ok := Indexers[indexName]
+	if !ok {
+		return compositionIds
+	}
+	c.RangeCache(func(compositionId string, entry *ResourceTreeUpdate) bool {
+		for _, entryKey := range indexFunc(entry) {
+			if entryKey == key {
+				compositionIds = append(compositionIds, compositionId)
+				break
+			}
+		}
+		return true
+	})
+	return compositionIds
+}
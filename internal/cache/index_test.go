@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	types "resource-tree-handler/apis"
+)
+
+func TestIndexes(t *testing.T) {
+	s := NewMemoryStoreWithEviction(EvictionPolicy{MaxEntries: 2})
+	defer s.Close()
+
+	put := func(compositionId string, name string) {
+		entry := testEntry(compositionId)
+		entry.CompositionReference = types.Reference{ApiVersion: "composition.krateo.io/v1-2-0", Kind: "FireworksApp", Resource: "fireworksapps", Namespace: "demo", Name: name, Uid: compositionId}
+		s.Put(compositionId, entry)
+	}
+	byName := func(name string) string {
+		compositionIds := s.ByIndex(IndexByName, NameIndexKey("demo", name))
+		slices.Sort(compositionIds)
+		return fmt.Sprint(compositionIds)
+	}
+
+	put("a", "app")
+	put("b", "other")
+	if got := s.ByIndex(IndexByKind, ObjectIndexKey("composition.krateo.io", "fireworksApp", "demo", "app")); fmt.Sprint(got) != "[a]" {
+		t.Errorf("by kind: expected [a], got %v", got)
+	}
+	if got := s.ByIndex(IndexByResource, ObjectIndexKey("composition.krateo.io", "fireworksapps", "demo", "other")); fmt.Sprint(got) != "[b]" {
+		t.Errorf("by resource: expected [b], got %v", got)
+	}
+
+	// Every test entry has a node with the same uid
+	nodes := s.ByIndex(IndexByNodeUID, "root-uid")
+	slices.Sort(nodes)
+	if fmt.Sprint(nodes) != "[a b]" {
+		t.Errorf("by node uid: expected [a b], got %v", nodes)
+	}
+
+	// Renaming moves the entry to the new key
+	if err := s.Update("b", func(update *ResourceTreeUpdate) error {
+		update.CompositionReference.Name = "app"
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got := byName("app"); got != "[a b]" {
+		t.Errorf("after update: expected [a b], got %v", got)
+	}
+	if got := byName("other"); got != "[]" {
+		t.Errorf("after update: expected [], got %v", got)
+	}
+
+	s.Delete("a")
+	if got := byName("app"); got != "[b]" {
+		t.Errorf("after delete: expected [b], got %v", got)
+	}
+	if got := s.ByIndex(IndexByNodeUID, "root-uid"); fmt.Sprint(got) != "[b]" {
+		t.Errorf("by node uid after delete: expected [b], got %v", got)
+	}
+
+	// "b" is evicted when the third entry is added
+	put("c", "third")
+	put("d", "fourth")
+	if got := byName("app"); got != "[]" {
+		t.Errorf("after eviction: expected [], got %v", got)
+	}
+}
@@ -0,0 +1,291 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// Maximum number of times an update is recomputed when the entry changes while the update is computed
+	maxUpdateAttempts = 3
+	// Maximum number of events buffered for a watcher, slower watchers are dropped
+	maxWatchQueue = 4096
+)
+
+// MemoryStore is the in-memory implementation of Store.
+// Reads only take a read lock, while updates are computed on a copy of the entry without holding
+// any lock shared with other compositions, and committed only if the entry did not change meanwhile.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	entries map[string]*ResourceTreeUpdate
+	// revision is the last revision assigned to an entry
+	revision uint64
+
+	// history keeps the previous revisions of each entry, oldest first, see history.go
+	history     map[string][]*ResourceTreeUpdate
+	historySize int
+
+	// indexes maps the keys of the Indexers to the composition ids, see index.go
+	indexes map[string]index
+
+	// updateLocks serializes the updates of a single composition, without blocking the others
+	updateLocks   map[string]*sync.Mutex
+	updateLocksMu sync.Mutex
+
+	watchers   map[*watcher]struct{}
+	watchersMu sync.Mutex
+
+	// Eviction bookkeeping, see eviction.go
+	policy       EvictionPolicy
+	lru          *list.List
+	meta         map[string]*entryMeta
+	bytes        int64
+	evictions    map[string]uint64
+	evictedBytes uint64
+	lruMu        sync.Mutex
+	stop         chan struct{}
+	closeOnce    sync.Once
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries:     make(map[string]*ResourceTreeUpdate),
+		history:     make(map[string][]*ResourceTreeUpdate),
+		historySize: DefaultHistorySize,
+		indexes:     make(map[string]index),
+		updateLocks: make(map[string]*sync.Mutex),
+		watchers:    make(map[*watcher]struct{}),
+		lru:         list.New(),
+		meta:        make(map[string]*entryMeta),
+		evictions:   make(map[string]uint64),
+	}
+}
+
+func (s *MemoryStore) Get(compositionId string) (*ResourceTreeUpdate, bool) {
+	s.mu.RLock()
+	obj, ok := s.entries[compositionId]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	s.touch(compositionId)
+	// Stored entries are never modified in place, the copy can happen outside of the lock
+	return obj.DeepCopy(), true
+}
+
+func (s *MemoryStore) Has(compositionId string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.entries[compositionId]
+	return ok
+}
+
+func (s *MemoryStore) Put(compositionId string, entry *ResourceTreeUpdate) {
+	obj := entry.DeepCopy()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, ok := s.entries[compositionId]
+	s.revision++
+	obj.Revision = s.revision
+	eventType := EventAdded
+	if ok {
+		eventType = EventUpdated
+		s.record(compositionId, previous)
+	}
+	s.entries[compositionId] = obj
+	s.reindex(compositionId, previous, obj)
+	s.track(compositionId, obj)
+	s.notify(WatchEvent{Type: eventType, CompositionId: compositionId, Entry: obj, Previous: previous})
+	s.enforceLimits(compositionId)
+}
+
+func (s *MemoryStore) Update(compositionId string, updateOp UpdateOperation) error {
+	lock := s.updateLock(compositionId)
+	lock.Lock()
+	defer lock.Unlock()
+
+	for attempt := 1; attempt <= maxUpdateAttempts; attempt++ {
+		s.mu.RLock()
+		obj, ok := s.entries[compositionId]
+		s.mu.RUnlock()
+		if !ok {
+			return fmt.Errorf("%w for composition id %s", ErrNotFound, compositionId)
+		}
+
+		snapshot := obj.DeepCopy()
+		if err := updateOp(snapshot); err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		current, ok := s.entries[compositionId]
+		if !ok {
+			s.mu.Unlock()
+			return fmt.Errorf("%w for composition id %s", ErrNotFound, compositionId)
+		}
+		if current.Revision == obj.Revision {
+			s.revision++
+			snapshot.LastUpdate = time.Now()
+			snapshot.Revision = s.revision
+			s.entries[compositionId] = snapshot
+			s.reindex(compositionId, current, snapshot)
+			s.record(compositionId, current)
+			s.track(compositionId, snapshot)
+			s.notify(WatchEvent{Type: EventUpdated, CompositionId: compositionId, Entry: snapshot, Previous: current})
+			s.enforceLimits(compositionId)
+			s.mu.Unlock()
+			return nil
+		}
+		s.mu.Unlock()
+		log.Warn().Msgf("resource tree for composition id %s changed while updating (attempt %d/%d), recomputing update", compositionId, attempt, maxUpdateAttempts)
+	}
+
+	return fmt.Errorf("could not update resource tree for composition id %s: too many concurrent modifications", compositionId)
+}
+
+func (s *MemoryStore) Delete(compositionId string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, ok := s.entries[compositionId]
+	if !ok {
+		return false
+	}
+	delete(s.entries, compositionId)
+	delete(s.history, compositionId)
+	s.reindex(compositionId, previous, nil)
+	s.untrack(compositionId)
+	s.updateLocksMu.Lock()
+	delete(s.updateLocks, compositionId)
+	s.updateLocksMu.Unlock()
+	s.notify(WatchEvent{Type: EventDeleted, CompositionId: compositionId, Previous: previous})
+	return true
+}
+
+func (s *MemoryStore) List() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]string, 0, len(s.entries))
+	for k := range s.entries {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Range calls fn for every entry, without copying the entries and without counting as an access for the
+// eviction, until fn returns false. The entries must not be modified nor retained after fn returns.
+func (s *MemoryStore) Range(fn func(compositionId string, entry *ResourceTreeUpdate) bool) {
+	s.mu.RLock()
+	entries := make(map[string]*ResourceTreeUpdate, len(s.entries))
+	for compositionId, entry := range s.entries {
+		entries[compositionId] = entry
+	}
+	s.mu.RUnlock()
+	// Stored entries are never modified in place, they can be read outside of the lock
+	for compositionId, entry := range entries {
+		if !fn(compositionId, entry) {
+			return
+		}
+	}
+}
+
+func (s *MemoryStore) Watch(ctx context.Context) <-chan WatchEvent {
+	w := &watcher{
+		signal: make(chan struct{}, 1),
+		out:    make(chan WatchEvent),
+	}
+	s.watchersMu.Lock()
+	s.watchers[w] = struct{}{}
+	s.watchersMu.Unlock()
+
+	go func() {
+		w.run(ctx)
+		s.watchersMu.Lock()
+		delete(s.watchers, w)
+		s.watchersMu.Unlock()
+	}()
+	return w.out
+}
+
+func (s *MemoryStore) updateLock(compositionId string) *sync.Mutex {
+	s.updateLocksMu.Lock()
+	defer s.updateLocksMu.Unlock()
+	lock, ok := s.updateLocks[compositionId]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.updateLocks[compositionId] = lock
+	}
+	return lock
+}
+
+// notify must be called while holding s.mu, so that watchers receive the events in commit order
+func (s *MemoryStore) notify(event WatchEvent) {
+	s.watchersMu.Lock()
+	defer s.watchersMu.Unlock()
+	for w := range s.watchers {
+		w.enqueue(event)
+	}
+}
+
+// watcher buffers the events of a single Watch call, so that slow readers never block the store
+type watcher struct {
+	mu    sync.Mutex
+	queue []WatchEvent
+	// overflow is set when the queue is full, the watcher is then dropped
+	overflow bool
+	signal   chan struct{}
+	out      chan WatchEvent
+}
+
+func (w *watcher) enqueue(event WatchEvent) {
+	w.mu.Lock()
+	if len(w.queue) >= maxWatchQueue {
+		w.overflow = true
+		w.queue = nil
+	} else if !w.overflow {
+		w.queue = append(w.queue, event)
+	}
+	w.mu.Unlock()
+	select {
+	case w.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (w *watcher) run(ctx context.Context) {
+	defer close(w.out)
+	for {
+		w.mu.Lock()
+		if w.overflow {
+			w.mu.Unlock()
+			log.Warn().Msgf("Store watcher too slow, dropped after %d events behind", maxWatchQueue)
+			return
+		}
+		if len(w.queue) == 0 {
+			w.mu.Unlock()
+			select {
+			case <-ctx.Done():
+				return
+			case <-w.signal:
+				continue
+			}
+		}
+		event := w.queue[0]
+		w.queue[0] = WatchEvent{}
+		w.queue = w.queue[1:]
+		w.mu.Unlock()
+
+		event.Entry = event.Entry.DeepCopy()
+		event.Previous = event.Previous.DeepCopy()
+		select {
+		case <-ctx.Done():
+			return
+		case w.out <- event:
+		}
+	}
+}
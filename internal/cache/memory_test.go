@@ -0,0 +1,14 @@
+package cache_test
+
+import (
+	"testing"
+
+	"resource-tree-handler/internal/cache"
+	"resource-tree-handler/internal/cache/cachetest"
+)
+
+func TestMemoryStore(t *testing.T) {
+	cachetest.TestStore(t, func() cache.Store {
+		return cache.NewMemoryStore()
+	})
+}
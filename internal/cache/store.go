@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"context"
+	"errors"
+
+	types "resource-tree-handler/apis"
+)
+
+// ErrNotFound is returned when the requested composition id is not stored.
+var ErrNotFound = errors.New("resource tree not found")
+
+// Store is the typed storage of the resource trees, indexed by composition id.
+// Implementations must be safe for concurrent use and must never share memory with the callers:
+// the values passed to Put and returned by Get, as well as the values sent to watchers, are copies.
+type Store interface {
+	// Get returns a copy of the entry for the composition id.
+	Get(compositionId string) (*ResourceTreeUpdate, bool)
+	// Has reports whether there is an entry for the composition id, without copying it
+	// and without counting as an access for the eviction.
+	Has(compositionId string) bool
+	// Put stores a copy of the entry, replacing any previous entry for the composition id.
+	Put(compositionId string, entry *ResourceTreeUpdate)
+	// Update executes updateOp on a copy of the entry and stores the result.
+	// The operation may be executed more than once if the entry changes concurrently,
+	// it returns ErrNotFound if there is no entry for the composition id.
+	Update(compositionId string, updateOp UpdateOperation) error
+	// Delete removes the entry, it returns false if there was no entry for the composition id.
+	Delete(compositionId string) bool
+	// List returns the composition ids of all the entries.
+	List() []string
+	// Watch returns a channel that receives, in order, all changes made after the call.
+	// The channel is closed when ctx is done, or when the reader falls too far behind: in that case
+	// some changes were lost, and the reader should Watch again and reconcile with the entries.
+	Watch(ctx context.Context) <-chan WatchEvent
+}
+
+// EventType is the type of change reported by Store.Watch
+type EventType string
+
+const (
+	EventAdded   EventType = "ADDED"
+	EventUpdated EventType = "UPDATED"
+	EventDeleted EventType = "DELETED"
+	// EventEvicted is sent when the store removes an entry on its own, e.g., to respect its memory bounds
+	EventEvicted EventType = "EVICTED"
+)
+
+// WatchEvent describes a change to an entry of a Store.
+type WatchEvent struct {
+	Type          EventType
+	CompositionId string
+	// Entry is the new value, nil for EventDeleted and EventEvicted
+	Entry *ResourceTreeUpdate
+	// Previous is the replaced value, nil for EventAdded
+	Previous *ResourceTreeUpdate
+}
+
+// DeepCopy copy the receiver, creates a new ResourceTreeUpdate.
+func (in *ResourceTreeUpdate) DeepCopy() *ResourceTreeUpdate {
+	if in == nil {
+		return nil
+	}
+	out := &ResourceTreeUpdate{
+		LastUpdate:           in.LastUpdate,
+		CompositionReference: in.CompositionReference,
+		Revision:             in.Revision,
+	}
+	in.ResourceTree.DeepCopyInto(&out.ResourceTree)
+	if in.Filters.Exclude != nil {
+		out.Filters.Exclude = make([]types.Exclude, len(in.Filters.Exclude))
+		copy(out.Filters.Exclude, in.Filters.Exclude)
+	}
+	return out
+}
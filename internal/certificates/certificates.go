@@ -0,0 +1,213 @@
+// Package certificates loads the TLS certificates of the webservice and of the SSE client, from files or
+// from a Secret, and reloads them in the background so that rotated certificates are used without restarting.
+package certificates
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultReloadInterval is the period of the reloads of the certificates
+	DefaultReloadInterval = time.Minute
+	loadTimeout           = 10 * time.Second
+
+	// Keys of the kubernetes.io/tls Secrets, as written by cert-manager
+	SecretCertificateKey = "tls.crt"
+	SecretKeyKey         = "tls.key"
+	SecretCAKey          = "ca.crt"
+)
+
+// ClientAuth is the verification of the client certificates by the webservice
+type ClientAuth string
+
+const (
+	// ClientAuthNone does not ask for client certificates
+	ClientAuthNone ClientAuth = "none"
+	// ClientAuthOptional verifies the client certificates when presented, e.g., by the eventrouter
+	ClientAuthOptional ClientAuth = "optional"
+	// ClientAuthRequire rejects the connections without a valid client certificate
+	ClientAuthRequire ClientAuth = "require"
+)
+
+func ParseClientAuth(value string) (ClientAuth, error) {
+	switch mode := ClientAuth(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "":
+		return ClientAuthNone, nil
+	case ClientAuthNone, ClientAuthOptional, ClientAuthRequire:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid client authentication %q, expected %s, %s or %s", value, ClientAuthNone, ClientAuthOptional, ClientAuthRequire)
+}
+
+// Bundle is a certificate with its key and the CAs, either of them may be missing
+type Bundle struct {
+	Certificate *tls.Certificate
+	// CAs verify the other side of the connections: the client certificates for the webservice, the server
+	// certificate for the SSE client
+	CAs *x509.CertPool
+}
+
+// LoadFunc loads a Bundle, see FromFiles and FromSecret
+type LoadFunc func(ctx context.Context) (*Bundle, error)
+
+// FromFiles loads the PEM files, the certificate and the key are optional but go together, the CA is optional
+func FromFiles(certFile string, keyFile string, caFile string) LoadFunc {
+	return func(context.Context) (*Bundle, error) {
+		var certificate, key, ca []byte
+		var err error
+		if certFile != "" || keyFile != "" {
+			if certificate, err = os.ReadFile(certFile); err != nil {
+				return nil, fmt.Errorf("could not read the certificate: %w", err)
+			}
+			if key, err = os.ReadFile(keyFile); err != nil {
+				return nil, fmt.Errorf("could not read the key: %w", err)
+			}
+		}
+		if caFile != "" {
+			if ca, err = os.ReadFile(caFile); err != nil {
+				return nil, fmt.Errorf("could not read the CA bundle: %w", err)
+			}
+		}
+		return parse(certificate, key, ca)
+	}
+}
+
+// SecretFunc returns the data of a Secret
+type SecretFunc func(ctx context.Context) (map[string][]byte, error)
+
+// FromSecret loads a kubernetes.io/tls Secret, with the CA in ca.crt if any
+func FromSecret(get SecretFunc) LoadFunc {
+	return func(ctx context.Context) (*Bundle, error) {
+		data, err := get(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(data[SecretCertificateKey]) == 0 || len(data[SecretKeyKey]) == 0 {
+			return nil, fmt.Errorf("the Secret has no %s or %s", SecretCertificateKey, SecretKeyKey)
+		}
+		return parse(data[SecretCertificateKey], data[SecretKeyKey], data[SecretCAKey])
+	}
+}
+
+func parse(certificate []byte, key []byte, ca []byte) (*Bundle, error) {
+	bundle := &Bundle{}
+	if len(certificate) > 0 {
+		pair, err := tls.X509KeyPair(certificate, key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate: %w", err)
+		}
+		bundle.Certificate = &pair
+	}
+	if len(ca) > 0 {
+		bundle.CAs = x509.NewCertPool()
+		if !bundle.CAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("invalid CA bundle: no PEM certificates")
+		}
+	}
+	return bundle, nil
+}
+
+// Reloader keeps the latest Bundle that could be loaded
+type Reloader struct {
+	name   string
+	load   LoadFunc
+	bundle atomic.Pointer[Bundle]
+}
+
+// NewReloader loads the bundle, which must succeed. Name identifies the bundle in the logs.
+func NewReloader(ctx context.Context, name string, load LoadFunc) (*Reloader, error) {
+	reloader := &Reloader{name: name, load: load}
+	if err := reloader.reload(ctx); err != nil {
+		return nil, fmt.Errorf("could not load the %s certificates: %w", name, err)
+	}
+	return reloader, nil
+}
+
+func (r *Reloader) reload(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, loadTimeout)
+	defer cancel()
+	bundle, err := r.load(ctx)
+	if err != nil {
+		return err
+	}
+	r.bundle.Store(bundle)
+	return nil
+}
+
+// Start reloads the bundle every interval until ctx is done, keeping the previous bundle on errors.
+// It does not block.
+func (r *Reloader) Start(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := r.reload(ctx); err != nil {
+					log.Warn().Err(err).Msgf("could not reload the %s certificates, keeping the previous ones", r.name)
+				}
+			}
+		}
+	}()
+}
+
+// Bundle returns the latest bundle
+func (r *Reloader) Bundle() *Bundle {
+	return r.bundle.Load()
+}
+
+// ServerConfig returns the configuration of a server with the latest certificate, verifying the client
+// certificates against the latest CAs according to clientAuth
+func (r *Reloader) ServerConfig(clientAuth ClientAuth) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			bundle := r.Bundle()
+			if bundle.Certificate == nil {
+				return nil, fmt.Errorf("no %s certificate", r.name)
+			}
+			config := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*bundle.Certificate},
+				NextProtos:   []string{"h2", "http/1.1"},
+			}
+			switch clientAuth {
+			case ClientAuthOptional:
+				config.ClientAuth, config.ClientCAs = tls.VerifyClientCertIfGiven, bundle.CAs
+			case ClientAuthRequire:
+				config.ClientAuth, config.ClientCAs = tls.RequireAndVerifyClientCert, bundle.CAs
+			}
+			return config, nil
+		},
+	}
+}
+
+// ClientConfig returns the configuration of a client with the latest client certificate, if any. The server
+// certificates are verified against the CAs loaded first, or the system ones if there were none.
+func (r *Reloader) ClientConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    r.Bundle().CAs,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if certificate := r.Bundle().Certificate; certificate != nil {
+				return certificate, nil
+			}
+			// No certificate is sent
+			return &tls.Certificate{}, nil
+		},
+	}
+}
@@ -0,0 +1,184 @@
+package certificates
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type authority struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	pem         []byte
+}
+
+func newAuthority(t *testing.T) *authority {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, _ := x509.ParseCertificate(der)
+	return &authority{certificate: certificate, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns the PEM certificate and key of a leaf signed by the authority
+func (a *authority) issue(t *testing.T, name string, serial int64, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, a.certificate, &key.PublicKey, a.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func writeFile(t *testing.T, dir string, name string, content []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseClientAuth(t *testing.T) {
+	for value, expected := range map[string]ClientAuth{"": ClientAuthNone, "none": ClientAuthNone, "Optional": ClientAuthOptional, " require": ClientAuthRequire} {
+		if mode, err := ParseClientAuth(value); err != nil || mode != expected {
+			t.Errorf("%q: expected %s, got %s, %v", value, expected, mode, err)
+		}
+	}
+	if _, err := ParseClientAuth("verify"); err == nil {
+		t.Error("expected an error for an invalid mode")
+	}
+}
+
+func TestFromSecret(t *testing.T) {
+	ca := newAuthority(t)
+	certificate, key := ca.issue(t, "localhost", 2, x509.ExtKeyUsageServerAuth)
+	bundle, err := FromSecret(func(context.Context) (map[string][]byte, error) {
+		return map[string][]byte{SecretCertificateKey: certificate, SecretKeyKey: key, SecretCAKey: ca.pem}, nil
+	})(context.Background())
+	if err != nil || bundle.Certificate == nil || bundle.CAs == nil {
+		t.Fatalf("unexpected bundle %+v, %v", bundle, err)
+	}
+	if _, err := FromSecret(func(context.Context) (map[string][]byte, error) {
+		return map[string][]byte{SecretCAKey: ca.pem}, nil
+	})(context.Background()); err == nil {
+		t.Error("expected an error for a Secret without certificate")
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := newAuthority(t)
+	dir := t.TempDir()
+	serverCertificate, serverKey := ca.issue(t, "localhost", 2, x509.ExtKeyUsageServerAuth)
+	clientCertificate, clientKey := ca.issue(t, "eventrouter", 3, x509.ExtKeyUsageClientAuth)
+	caFile := writeFile(t, dir, "ca.crt", ca.pem)
+	serverCertFile := writeFile(t, dir, "tls.crt", serverCertificate)
+	serverKeyFile := writeFile(t, dir, "tls.key", serverKey)
+
+	server, err := NewReloader(context.Background(), "server", FromFiles(serverCertFile, serverKeyFile, caFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	listener.TLS = server.ServerConfig(ClientAuthRequire)
+	listener.StartTLS()
+	defer listener.Close()
+
+	get := func(reloader *Reloader) (*http.Response, error) {
+		transport := &http.Transport{TLSClientConfig: reloader.ClientConfig()}
+		defer transport.CloseIdleConnections()
+		return (&http.Client{Transport: transport}).Get(listener.URL)
+	}
+
+	client, err := NewReloader(context.Background(), "client", FromFiles(writeFile(t, dir, "client.crt", clientCertificate), writeFile(t, dir, "client.key", clientKey), caFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := get(client)
+	if err != nil {
+		t.Fatalf("expected the client certificate to be accepted: %v", err)
+	}
+	response.Body.Close()
+
+	anonymous, err := NewReloader(context.Background(), "anonymous", FromFiles("", "", caFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response, err := get(anonymous); err == nil {
+		response.Body.Close()
+		t.Error("expected the connection without client certificate to be rejected")
+	}
+
+	// The rotated certificate is served after the reload
+	rotated, rotatedKey := ca.issue(t, "localhost", 4, x509.ExtKeyUsageServerAuth)
+	writeFile(t, dir, "tls.crt", rotated)
+	writeFile(t, dir, "tls.key", rotatedKey)
+	if err := server.reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	connection, err := tls.Dial("tcp", listener.Listener.Addr().String(), client.ClientConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer connection.Close()
+	if serial := connection.ConnectionState().PeerCertificates[0].SerialNumber.Int64(); serial != 4 {
+		t.Errorf("expected the rotated certificate, got serial %d", serial)
+	}
+
+	// A broken file does not replace the loaded certificate
+	writeFile(t, dir, "tls.crt", []byte("broken"))
+	if err := server.reload(context.Background()); err == nil {
+		t.Error("expected an error for a broken certificate")
+	}
+	if server.Bundle().Certificate == nil {
+		t.Error("expected the previous certificate to be kept")
+	}
+}
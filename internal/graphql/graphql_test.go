@@ -0,0 +1,107 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	types "resource-tree-handler/apis"
+	cachehelper "resource-tree-handler/internal/cache"
+)
+
+// testCache caches a composition whose root has a healthy Release and an unhealthy Deployment owned by the Release
+func testCache() *cachehelper.ThreadSafeCache {
+	rootUid, releaseUid, deploymentUid := "root", "release", "deployment"
+	root := &types.ResourceNodeStatus{ResourceRefStatus: types.ResourceRefStatus{Version: "resourcetrees.krateo.io/v1", Kind: "CompositionReference", Namespace: "demo", Name: "demo"}, UID: &rootUid, Health: &types.Health{Type: "Ready", Status: "True"}}
+	release := &types.ResourceNodeStatus{ResourceRefStatus: types.ResourceRefStatus{Version: "helm.crossplane.io/v1beta1", Kind: "Release", Name: "demo"}, UID: &releaseUid, Health: &types.Health{Type: "Ready", Status: "True"}, ParentRefs: []*types.ResourceNodeStatus{root}}
+	deployment := &types.ResourceNodeStatus{ResourceRefStatus: types.ResourceRefStatus{Version: "apps/v1", Kind: "Deployment", Namespace: "demo", Name: "demo"}, UID: &deploymentUid, Health: &types.Health{Type: "Available", Status: "False", Reason: "MinimumReplicasUnavailable"}, ParentRefs: []*types.ResourceNodeStatus{release}}
+	resourceTree := types.ResourceTree{
+		CompositionId:     "a",
+		RootElementStatus: root,
+		Resources: types.ResourceTreeJson{
+			ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "demo", Labels: map[string]string{"team": "platform"}},
+			Status:     []*types.ResourceNodeStatus{root, release, deployment},
+		},
+	}
+	reference := types.Reference{ApiVersion: "composition.krateo.io/v1-2-0", Kind: "FireworksApp", Resource: "fireworksapps", Name: "demo", Namespace: "demo", Uid: "a"}
+	cache := cachehelper.NewThreadSafeCache()
+	cache.AddToCache(resourceTree, "a", reference, types.Filters{})
+	return cache
+}
+
+func execute(t *testing.T, handler *Handler, query string, variables map[string]any) (map[string]any, *Response, bool) {
+	t.Helper()
+	response, rejected := handler.Execute(context.Background(), Request{Query: query, Variables: variables})
+	var data map[string]any
+	if response.Data != nil {
+		if err := json.Unmarshal(response.Data, &data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return data, response, rejected
+}
+
+func TestQuery(t *testing.T) {
+	handler, err := NewHandler(testCache(), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, response, rejected := execute(t, handler, `query($health: HealthState) {
+		compositions(health: $health) { id kind healthState labels { key value } }
+		composition(id: "a") {
+			root { kind children { kind } }
+			resources(health: UNHEALTHY, leavesOnly: true) { uid health { reason } parents { kind } composition { name } }
+			node(uid: "release") { children { uid } }
+		}
+	}`, map[string]any{"health": "HEALTHY"})
+	if rejected || len(response.Errors) > 0 {
+		t.Fatalf("unexpected errors %v", response.Errors)
+	}
+	encoded, _ := json.Marshal(data)
+	expected := `{"composition":{"node":{"children":[{"uid":"deployment"}]},` +
+		`"resources":[{"composition":{"name":"demo"},"health":{"reason":"MinimumReplicasUnavailable"},"parents":[{"kind":"Release"}],"uid":"deployment"}],` +
+		`"root":{"children":[{"kind":"Release"}],"kind":"CompositionReference"}},` +
+		`"compositions":[{"healthState":"HEALTHY","id":"a","kind":"FireworksApp","labels":[{"key":"team","value":"platform"}]}]}`
+	if string(encoded) != expected {
+		t.Errorf("unexpected data %s", encoded)
+	}
+
+	data, _, _ = execute(t, handler, `{ compositions(health: UNHEALTHY) { id } composition(id: "missing") { id } }`, nil)
+	if encoded, _ := json.Marshal(data); string(encoded) != `{"composition":null,"compositions":[]}` {
+		t.Errorf("unexpected data %s", encoded)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	handler, err := NewHandler(testCache(), Options{MaxDepth: 4, MaxComplexity: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query     string
+		variables map[string]any
+		error     string
+	}{
+		{`{ composition(id: "a") { root { children { children { uid } } } } }`, nil, "depth 5 exceeds"},
+		{`fragment deep on ResourceNode { children { children { uid } } } { composition(id: "a") { root { ...deep } } }`, nil, "depth 5 exceeds"},
+		// 1 + 100 * (1 + 1)
+		{`{ compositions { id resourceCount } }`, nil, "complexity 201 exceeds"},
+		{`query($first: Int) { compositions(first: $first) { resources { uid } } }`, map[string]any{"first": float64(5)}, "complexity 506 exceeds"},
+		{`{ compositions { unknown } }`, nil, "Cannot query field"},
+	}
+	for _, tt := range tests {
+		_, response, rejected := execute(t, handler, tt.query, tt.variables)
+		if !rejected || len(response.Errors) != 1 || !strings.Contains(response.Errors[0].Message, tt.error) {
+			t.Errorf("%s: expected the error %q, got %v", tt.query, tt.error, response.Errors)
+		}
+	}
+
+	if _, response, rejected := execute(t, handler, `{ compositions(first: 10) { id children: resources(first: 4) { uid } } }`, nil); rejected {
+		t.Errorf("query rejected: %v", response.Errors)
+	}
+}
@@ -0,0 +1,75 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+
+	graphqlgo "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/errors"
+
+	types "resource-tree-handler/apis"
+	cachehelper "resource-tree-handler/internal/cache"
+)
+
+// Options are the limits of the queries, the defaults are used for the values lower than 1
+type Options struct {
+	MaxDepth      int
+	MaxComplexity int
+	// Filter returns the nodes of a resource tree visible to the request of the context, and whether its
+	// composition is visible at all. Everything is visible if nil.
+	Filter Filter
+}
+
+// Filter trims the nodes of a resource tree for the request of the context
+type Filter func(ctx context.Context, entry *cachehelper.ResourceTreeUpdate, nodes []*types.ResourceNodeStatus) ([]*types.ResourceNodeStatus, bool)
+
+// Request is a GraphQL request, as sent in the body of a POST
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+// Response is a GraphQL response, Data is nil when the query was rejected
+type Response struct {
+	Data   json.RawMessage      `json:"data,omitempty"`
+	Errors []*errors.QueryError `json:"errors,omitempty"`
+}
+
+// Handler executes the GraphQL queries against the cache
+type Handler struct {
+	schema *graphqlgo.Schema
+	limits *limits
+}
+
+func NewHandler(cache *cachehelper.ThreadSafeCache, options Options) (*Handler, error) {
+	if options.MaxDepth < 1 {
+		options.MaxDepth = DefaultMaxDepth
+	}
+	if options.MaxComplexity < 1 {
+		options.MaxComplexity = DefaultMaxComplexity
+	}
+	limits, err := newLimits(options.MaxDepth, options.MaxComplexity)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := graphqlgo.ParseSchema(Schema, &queryResolver{cache: cache, filter: options.Filter}, graphqlgo.UseStringDescriptions())
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{schema: schema, limits: limits}, nil
+}
+
+// Execute checks the limits of the query and executes it. The errors are returned in the response,
+// rejected reports whether the query was not executed.
+func (h *Handler) Execute(ctx context.Context, request Request) (response *Response, rejected bool) {
+	if errs := h.limits.check(request.Query, request.OperationName, request.Variables); len(errs) > 0 {
+		response = &Response{}
+		for _, err := range errs {
+			response.Errors = append(response.Errors, errors.Errorf("%s", err))
+		}
+		return response, true
+	}
+	result := h.schema.Exec(ctx, request.Query, request.OperationName, request.Variables)
+	return &Response{Data: result.Data, Errors: result.Errors}, false
+}
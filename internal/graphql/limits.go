@@ -0,0 +1,147 @@
+package graphql
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+const (
+	DefaultMaxDepth      = 10
+	DefaultMaxComplexity = 5000
+
+	// listSize is the estimated number of items of the lists without a first argument, e.g., the children of a node
+	listSize = 10
+
+	// saturation bounds the complexity, so that the products of absurd queries do not overflow
+	saturation = math.MaxInt32
+)
+
+// limits rejects the queries that are too deep or too complex before they are executed. The complexity
+// of a query is the number of fields it may resolve: every field costs 1, and the fields selected on the
+// items of a list are counted once per item, i.e., first times or listSize times when first is not an argument.
+type limits struct {
+	schema        *ast.Schema
+	maxDepth      int
+	maxComplexity int
+}
+
+func newLimits(maxDepth int, maxComplexity int) (*limits, error) {
+	schema, err := gqlparser.LoadSchema(&ast.Source{Name: "schema.graphql", Input: Schema})
+	if err != nil {
+		return nil, fmt.Errorf("could not load the schema: %w", err)
+	}
+	return &limits{schema: schema, maxDepth: maxDepth, maxComplexity: maxComplexity}, nil
+}
+
+// check returns the errors of the query, including the validation errors, or nil when it can be executed
+func (l *limits) check(query string, operationName string, variables map[string]any) []error {
+	document, errs := gqlparser.LoadQuery(l.schema, query)
+	if len(errs) > 0 {
+		result := []error{}
+		for _, err := range errs {
+			result = append(result, err)
+		}
+		return result
+	}
+
+	var operation *ast.OperationDefinition
+	switch {
+	case operationName != "":
+		operation = document.Operations.ForName(operationName)
+	case len(document.Operations) == 1:
+		operation = document.Operations[0]
+	}
+	if operation == nil {
+		// Reported by the executor
+		return nil
+	}
+
+	depth := l.depth(operation.SelectionSet, 0)
+	if depth > l.maxDepth {
+		return []error{fmt.Errorf("query depth %d exceeds the maximum of %d", depth, l.maxDepth)}
+	}
+	complexity, err := l.complexity(operation.SelectionSet, variables)
+	if err != nil {
+		return []error{err}
+	}
+	if complexity > l.maxComplexity {
+		return []error{fmt.Errorf("query complexity %d exceeds the maximum of %d", complexity, l.maxComplexity)}
+	}
+	return nil
+}
+
+// depth returns the depth of the deepest field of a selection set, fragments do not add to the depth
+func (l *limits) depth(selections ast.SelectionSet, depth int) int {
+	deepest := depth
+	for _, selection := range selections {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			deepest = max(deepest, l.depth(selection.SelectionSet, depth+1))
+		case *ast.InlineFragment:
+			deepest = max(deepest, l.depth(selection.SelectionSet, depth))
+		case *ast.FragmentSpread:
+			if selection.Definition != nil {
+				deepest = max(deepest, l.depth(selection.Definition.SelectionSet, depth))
+			}
+		}
+	}
+	return deepest
+}
+
+func (l *limits) complexity(selections ast.SelectionSet, variables map[string]any) (int, error) {
+	total := 0
+	for _, selection := range selections {
+		var complexity int
+		var err error
+		switch selection := selection.(type) {
+		case *ast.Field:
+			complexity, err = l.fieldComplexity(selection, variables)
+		case *ast.InlineFragment:
+			complexity, err = l.complexity(selection.SelectionSet, variables)
+		case *ast.FragmentSpread:
+			if selection.Definition != nil {
+				complexity, err = l.complexity(selection.Definition.SelectionSet, variables)
+			}
+		}
+		if err != nil {
+			return 0, err
+		}
+		total = min(total+complexity, saturation)
+	}
+	return total, nil
+}
+
+func (l *limits) fieldComplexity(field *ast.Field, variables map[string]any) (int, error) {
+	children, err := l.complexity(field.SelectionSet, variables)
+	if err != nil {
+		return 0, err
+	}
+	if field.Definition == nil || field.Definition.Type.Elem == nil {
+		return 1 + children, nil
+	}
+
+	size := listSize
+	if definition := field.Definition.Arguments.ForName("first"); definition != nil {
+		value := definition.DefaultValue
+		if argument := field.Arguments.ForName("first"); argument != nil {
+			value = argument.Value
+		}
+		first, err := value.Value(variables)
+		if err != nil {
+			return 0, fmt.Errorf("invalid first argument of %s: %w", field.Name, err)
+		}
+		switch first := first.(type) {
+		case int64:
+			size = int(max(first, 0))
+		case int:
+			size = max(first, 0)
+		case float64:
+			// Variables decoded from JSON
+			size = int(max(first, 0))
+		}
+	}
+	return min(1+min(size, saturation)*children, saturation), nil
+}
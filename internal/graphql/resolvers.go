@@ -0,0 +1,300 @@
+package graphql
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	graphqlgo "github.com/graph-gophers/graphql-go"
+
+	types "resource-tree-handler/apis"
+	cachehelper "resource-tree-handler/internal/cache"
+	resourcetreehelper "resource-tree-handler/internal/helpers/resourcetree"
+)
+
+const (
+	healthStateHealthy   = "HEALTHY"
+	healthStateUnhealthy = "UNHEALTHY"
+	healthStateUnknown   = "UNKNOWN"
+)
+
+// healthState returns the HealthState of a health, from the status of its condition
+func healthState(health *types.Health) string {
+	if health == nil {
+		return healthStateUnknown
+	}
+	switch health.Status {
+	case "True":
+		return healthStateHealthy
+	case "False":
+		return healthStateUnhealthy
+	}
+	return healthStateUnknown
+}
+
+// queryResolver resolves the Query type
+type queryResolver struct {
+	cache  *cachehelper.ThreadSafeCache
+	filter Filter
+}
+
+// resolve returns the resolver of a cached entry, nil if the composition is not visible
+func (r *queryResolver) resolve(ctx context.Context, compositionId string, entry *cachehelper.ResourceTreeUpdate) *compositionResolver {
+	nodes := cachehelper.FilterResourceTree(entry)
+	if r.filter != nil {
+		var visible bool
+		if nodes, visible = r.filter(ctx, entry, nodes); !visible {
+			return nil
+		}
+	}
+	return newCompositionResolver(compositionId, entry, nodes)
+}
+
+func (r *queryResolver) Composition(ctx context.Context, args struct{ ID graphqlgo.ID }) *compositionResolver {
+	entry, ok := r.cache.GetResourceTreeFromCache(string(args.ID))
+	if !ok {
+		return nil
+	}
+	return r.resolve(ctx, string(args.ID), entry)
+}
+
+func (r *queryResolver) Compositions(ctx context.Context, args struct {
+	Namespace *string
+	Kind      *string
+	Health    *string
+	First     int32
+}) []*compositionResolver {
+	type match struct{ id, namespace, name string }
+	matches := []match{}
+	r.cache.RangeCache(func(compositionId string, entry *cachehelper.ResourceTreeUpdate) bool {
+		reference := entry.CompositionReference
+		namespace := cmp.Or(reference.Namespace, entry.ResourceTree.Resources.Namespace)
+		if args.Namespace != nil && *args.Namespace != namespace {
+			return true
+		}
+		if args.Kind != nil && !strings.EqualFold(*args.Kind, reference.Kind) {
+			return true
+		}
+		if args.Health != nil && *args.Health != healthState(rootHealth(entry)) {
+			return true
+		}
+		matches = append(matches, match{compositionId, namespace, cmp.Or(reference.Name, entry.ResourceTree.Resources.Name)})
+		return true
+	})
+	slices.SortFunc(matches, func(a, b match) int {
+		return cmp.Or(cmp.Compare(a.namespace, b.namespace), cmp.Compare(a.name, b.name), cmp.Compare(a.id, b.id))
+	})
+
+	// The entries of RangeCache must not be retained, the resolvers get their own copies
+	compositions := []*compositionResolver{}
+	for _, match := range matches {
+		if len(compositions) >= int(args.First) {
+			break
+		}
+		if entry, ok := r.cache.GetResourceTreeFromCache(match.id); ok {
+			if composition := r.resolve(ctx, match.id, entry); composition != nil {
+				compositions = append(compositions, composition)
+			}
+		}
+	}
+	return compositions
+}
+
+func rootHealth(entry *cachehelper.ResourceTreeUpdate) *types.Health {
+	if entry.ResourceTree.RootElementStatus == nil {
+		return nil
+	}
+	return entry.ResourceTree.RootElementStatus.Health
+}
+
+// compositionResolver resolves a composition from its own copy of the cached entry. The fields are resolved
+// concurrently, so the relations between the nodes are computed once, when first needed.
+type compositionResolver struct {
+	id    string
+	entry *cachehelper.ResourceTreeUpdate
+	nodes []*resourceNodeResolver
+
+	once     sync.Once
+	byKey    map[resourcetreehelper.NodeKey]*resourceNodeResolver
+	children map[resourcetreehelper.NodeKey][]*resourceNodeResolver
+}
+
+func newCompositionResolver(compositionId string, entry *cachehelper.ResourceTreeUpdate, nodes []*types.ResourceNodeStatus) *compositionResolver {
+	composition := &compositionResolver{id: compositionId, entry: entry}
+	for _, node := range nodes {
+		if node != nil {
+			composition.nodes = append(composition.nodes, &resourceNodeResolver{node: node, composition: composition})
+		}
+	}
+	return composition
+}
+
+func (r *compositionResolver) relations() {
+	r.once.Do(func() {
+		r.byKey = map[resourcetreehelper.NodeKey]*resourceNodeResolver{}
+		r.children = map[resourcetreehelper.NodeKey][]*resourceNodeResolver{}
+		for _, node := range r.nodes {
+			r.byKey[resourcetreehelper.KeyOf(node.node)] = node
+		}
+		for _, node := range r.nodes {
+			for _, parent := range node.node.ParentRefs {
+				if parent != nil {
+					key := resourcetreehelper.KeyOf(parent)
+					r.children[key] = append(r.children[key], node)
+				}
+			}
+		}
+	})
+}
+
+func (r *compositionResolver) ID() graphqlgo.ID   { return graphqlgo.ID(r.id) }
+func (r *compositionResolver) ApiVersion() string { return r.entry.CompositionReference.ApiVersion }
+func (r *compositionResolver) Kind() string       { return r.entry.CompositionReference.Kind }
+func (r *compositionResolver) Resource() string   { return r.entry.CompositionReference.Resource }
+
+func (r *compositionResolver) Name() string {
+	return cmp.Or(r.entry.CompositionReference.Name, r.entry.ResourceTree.Resources.Name)
+}
+
+func (r *compositionResolver) Namespace() string {
+	return cmp.Or(r.entry.CompositionReference.Namespace, r.entry.ResourceTree.Resources.Namespace)
+}
+
+func (r *compositionResolver) Labels() []*labelResolver {
+	labels := []*labelResolver{}
+	for _, key := range slices.Sorted(maps.Keys(r.entry.ResourceTree.Resources.Labels)) {
+		labels = append(labels, &labelResolver{key: key, value: r.entry.ResourceTree.Resources.Labels[key]})
+	}
+	return labels
+}
+
+func (r *compositionResolver) Health() *healthResolver { return newHealthResolver(rootHealth(r.entry)) }
+func (r *compositionResolver) HealthState() string     { return healthState(rootHealth(r.entry)) }
+func (r *compositionResolver) Revision() string        { return strconv.FormatUint(r.entry.Revision, 10) }
+func (r *compositionResolver) LastUpdate() string {
+	return r.entry.LastUpdate.UTC().Format(time.RFC3339)
+}
+func (r *compositionResolver) ResourceCount() int32 { return int32(len(r.nodes)) }
+
+func (r *compositionResolver) Root() *resourceNodeResolver {
+	if r.entry.ResourceTree.RootElementStatus == nil {
+		return nil
+	}
+	r.relations()
+	return r.byKey[resourcetreehelper.KeyOf(r.entry.ResourceTree.RootElementStatus)]
+}
+
+func (r *compositionResolver) Resources(args struct {
+	Kind       *string
+	Health     *string
+	LeavesOnly bool
+	First      int32
+}) []*resourceNodeResolver {
+	r.relations()
+	nodes := []*resourceNodeResolver{}
+	for _, node := range r.nodes {
+		if len(nodes) >= int(args.First) {
+			break
+		}
+		if args.Kind != nil && !strings.EqualFold(*args.Kind, node.node.Kind) {
+			continue
+		}
+		if args.Health != nil && *args.Health != healthState(node.node.Health) {
+			continue
+		}
+		if args.LeavesOnly && len(r.children[resourcetreehelper.KeyOf(node.node)]) > 0 {
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+func (r *compositionResolver) Node(args struct{ UID graphqlgo.ID }) *resourceNodeResolver {
+	for _, node := range r.nodes {
+		if node.node.UID != nil && *node.node.UID == string(args.UID) {
+			return node
+		}
+	}
+	return nil
+}
+
+// resourceNodeResolver resolves a node of the resource tree of a composition
+type resourceNodeResolver struct {
+	node        *types.ResourceNodeStatus
+	composition *compositionResolver
+}
+
+func (r *resourceNodeResolver) UID() *graphqlgo.ID {
+	if r.node.UID == nil {
+		return nil
+	}
+	uid := graphqlgo.ID(*r.node.UID)
+	return &uid
+}
+
+func (r *resourceNodeResolver) ApiVersion() string                { return r.node.Version }
+func (r *resourceNodeResolver) Kind() string                      { return r.node.Kind }
+func (r *resourceNodeResolver) Namespace() string                 { return r.node.Namespace }
+func (r *resourceNodeResolver) Name() string                      { return r.node.Name }
+func (r *resourceNodeResolver) ResourceVersion() *string          { return r.node.ResourceVersion }
+func (r *resourceNodeResolver) Health() *healthResolver           { return newHealthResolver(r.node.Health) }
+func (r *resourceNodeResolver) HealthState() string               { return healthState(r.node.Health) }
+func (r *resourceNodeResolver) Composition() *compositionResolver { return r.composition }
+
+func (r *resourceNodeResolver) CreatedAt() *string {
+	if r.node.CreatedAt == nil || r.node.CreatedAt.IsZero() {
+		return nil
+	}
+	createdAt := r.node.CreatedAt.UTC().Format(time.RFC3339)
+	return &createdAt
+}
+
+// Parents returns the parents that are nodes of the tree, i.e., not excluded by the filters
+func (r *resourceNodeResolver) Parents() []*resourceNodeResolver {
+	r.composition.relations()
+	parents := []*resourceNodeResolver{}
+	for _, parent := range r.node.ParentRefs {
+		if parent == nil {
+			continue
+		}
+		if node, ok := r.composition.byKey[resourcetreehelper.KeyOf(parent)]; ok {
+			parents = append(parents, node)
+		}
+	}
+	return parents
+}
+
+func (r *resourceNodeResolver) Children() []*resourceNodeResolver {
+	r.composition.relations()
+	return append([]*resourceNodeResolver{}, r.composition.children[resourcetreehelper.KeyOf(r.node)]...)
+}
+
+type healthResolver struct {
+	health types.Health
+}
+
+func newHealthResolver(health *types.Health) *healthResolver {
+	if health == nil {
+		return nil
+	}
+	return &healthResolver{health: *health}
+}
+
+func (r *healthResolver) Type() string    { return r.health.Type }
+func (r *healthResolver) Status() string  { return r.health.Status }
+func (r *healthResolver) Reason() string  { return r.health.Reason }
+func (r *healthResolver) Message() string { return r.health.Message }
+
+type labelResolver struct {
+	key   string
+	value string
+}
+
+func (r *labelResolver) Key() string   { return r.key }
+func (r *labelResolver) Value() string { return r.value }
@@ -0,0 +1,74 @@
+// Package graphql serves the cached resource trees through a GraphQL schema, so that clients can
+// fetch exactly the slice of the trees they need in one request. Queries are limited in depth and
+// complexity before being executed, see limits.go.
+package graphql
+
+// Schema models the compositions and the nodes of their resource trees, with the edges between parents and children.
+// Revisions are strings since they do not fit in the 32-bit Int of GraphQL.
+const Schema = `
+schema {
+	query: Query
+}
+
+type Query {
+	"A composition with a cached resource tree"
+	composition(id: ID!): Composition
+	"The compositions with a cached resource tree, sorted by namespace and name"
+	compositions(namespace: String, kind: String, health: HealthState, first: Int = 100): [Composition!]!
+}
+
+enum HealthState {
+	HEALTHY
+	UNHEALTHY
+	UNKNOWN
+}
+
+type Health {
+	type: String!
+	status: String!
+	reason: String!
+	message: String!
+}
+
+type Label {
+	key: String!
+	value: String!
+}
+
+type Composition {
+	id: ID!
+	apiVersion: String!
+	kind: String!
+	resource: String!
+	name: String!
+	namespace: String!
+	labels: [Label!]!
+	"The health of the root of the resource tree"
+	health: Health
+	healthState: HealthState!
+	revision: String!
+	lastUpdate: String!
+	resourceCount: Int!
+	"The root of the resource tree: the CompositionReference"
+	root: ResourceNode
+	"The nodes of the resource tree, without the ones excluded by the filters. Leaves are the nodes without children."
+	resources(kind: String, health: HealthState, leavesOnly: Boolean = false, first: Int = 100): [ResourceNode!]!
+	"The node of the resource tree with the uid"
+	node(uid: ID!): ResourceNode
+}
+
+type ResourceNode {
+	uid: ID
+	apiVersion: String!
+	kind: String!
+	namespace: String!
+	name: String!
+	resourceVersion: String
+	createdAt: String
+	health: Health
+	healthState: HealthState!
+	parents: [ResourceNode!]!
+	children: [ResourceNode!]!
+	composition: Composition!
+}
+`
@@ -0,0 +1,290 @@
+package configuration
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/rs/zerolog"
+
+	"resource-tree-handler/internal/auth"
+	"resource-tree-handler/internal/certificates"
+	"resource-tree-handler/internal/ratelimit"
+)
+
+// option is a setting of the configuration, with its dotted key in the configuration file, its environment
+// variable and its flag, derived from the key
+type option struct {
+	key   string
+	env   string
+	usage string
+	field accessor
+}
+
+// accessor parses and reads a field of the configuration
+type accessor struct {
+	set func(c *Configuration, value string) error
+	get func(c *Configuration) any
+	// copy sets the field of dst to the one of src
+	copy func(dst *Configuration, src *Configuration)
+}
+
+// reloadableKeys are the keys of the options applied without restarting, with the rate limits, see Reloader
+var reloadableKeys = []string{"log.level", "workers.count", "resync.period", "resync.jitter", "health.conditionTypes"}
+
+// reloadable reports whether a change of the option is applied without restarting
+func (o option) reloadable() bool {
+	return slices.Contains(reloadableKeys, o.key) || strings.HasPrefix(o.key, "rateLimits.")
+}
+
+// flag returns the name of the flag of the option, the key in kebab case, e.g., cache.idleTTL is cache.idle-ttl
+func (o option) flag() string {
+	runes := []rune(o.key)
+	var result strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			previous := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(previous) || unicode.IsDigit(previous) || (unicode.IsUpper(previous) && nextLower) {
+				result.WriteRune('-')
+			}
+		}
+		result.WriteRune(unicode.ToLower(r))
+	}
+	return result.String()
+}
+
+// field returns the accessor of a field of the configuration, with the parser of its values
+func field[T any](parse func(string) (T, error), get func(c *Configuration) *T) accessor {
+	return accessor{
+		set: func(c *Configuration, value string) error {
+			result, err := parse(value)
+			if err != nil {
+				return err
+			}
+			*get(c) = result
+			return nil
+		},
+		get: func(c *Configuration) any {
+			return *get(c)
+		},
+		copy: func(dst *Configuration, src *Configuration) {
+			*get(dst) = *get(src)
+		},
+	}
+}
+
+var options = append([]option{
+	{"server.port", "RESOURCE_TREE_HANDLER_API_PORT", "port of the webservice", field(parseInt, func(c *Configuration) *int { return &c.WebServicePort })},
+	{"server.trustedProxies", "TRUSTED_PROXIES", "comma separated IPs or CIDRs of the proxies whose X-Forwarded-For header gives the client IP", field(parseList, func(c *Configuration) *[]string { return &c.TrustedProxies })},
+	{"server.tls.certFile", "TLS_CERT_FILE", "PEM certificate of the webservice", field(parseString, func(c *Configuration) *string { return &c.TLSCertFile })},
+	{"server.tls.keyFile", "TLS_KEY_FILE", "PEM key of the webservice", field(parseString, func(c *Configuration) *string { return &c.TLSKeyFile })},
+	{"server.tls.secretName", "TLS_SECRET_NAME", "kubernetes.io/tls Secret of the webservice", field(parseString, func(c *Configuration) *string { return &c.TLSSecretName })},
+	{"server.tls.secretNamespace", "TLS_SECRET_NAMESPACE", "namespace of the TLS Secret", field(parseString, func(c *Configuration) *string { return &c.TLSSecretNamespace })},
+	{"server.tls.clientAuth", "TLS_CLIENT_AUTH", "verification of the client certificates: none, optional or require", field(certificates.ParseClientAuth, func(c *Configuration) *certificates.ClientAuth { return &c.TLSClientAuth })},
+	{"server.tls.clientCAFile", "TLS_CLIENT_CA_FILE", "CA bundle of the client certificates", field(parseString, func(c *Configuration) *string { return &c.TLSClientCAFile })},
+	{"server.tls.reloadInterval", "TLS_RELOAD_INTERVAL", "period of the reloads of the certificates", field(parseDuration, func(c *Configuration) *time.Duration { return &c.TLSReloadInterval })},
+
+	{"log.level", "DEBUG_LEVEL", "log level: trace, debug, info, warn or error", field(parseLevel, func(c *Configuration) *zerolog.Level { return &c.DebugLevel })},
+
+	{"kube.kubeconfig", "KUBECONFIG", "kubeconfig files, separated as in $PATH, the in-cluster configuration if there is none", field(parseString, func(c *Configuration) *string { return &c.Kubeconfig })},
+	{"kube.context", "KUBE_CONTEXT", "context of the kubeconfig, the current one if empty", field(parseString, func(c *Configuration) *string { return &c.KubeContext })},
+
+	{"sse.url", "URL_SSE", "URL of the SSE endpoint of eventsse", field(parseString, func(c *Configuration) *string { return &c.SSEUrl })},
+	{"sse.caFile", "SSE_CA_FILE", "CA bundle of eventsse", field(parseString, func(c *Configuration) *string { return &c.SSECAFile })},
+	{"sse.certFile", "SSE_CERT_FILE", "PEM client certificate of the SSE client", field(parseString, func(c *Configuration) *string { return &c.SSECertFile })},
+	{"sse.keyFile", "SSE_KEY_FILE", "PEM client key of the SSE client", field(parseString, func(c *Configuration) *string { return &c.SSEKeyFile })},
+	{"sse.retry.initialDelay", "SSE_RETRY_INITIAL_DELAY", "delay before the first reconnection to eventsse, doubled at each failure", field(parseDuration, func(c *Configuration) *time.Duration { return &c.SSERetryInitialDelay })},
+	{"sse.retry.maxDelay", "SSE_RETRY_MAX_DELAY", "maximum delay between the reconnections to eventsse", field(parseDuration, func(c *Configuration) *time.Duration { return &c.SSERetryMaxDelay })},
+	{"sse.retry.maxAttempts", "SSE_RETRY_MAX_ATTEMPTS", "failed reconnections in a row before giving up, 0 never gives up", field(parseInt, func(c *Configuration) *int { return &c.SSERetryMaxAttempts })},
+	{"sse.waitTimeout", "SSE_WAIT_TIMEOUT", "maximum wait of an event for the resource tree being built", field(parseDuration, func(c *Configuration) *time.Duration { return &c.SSEWaitTimeout })},
+
+	{"workers.count", "WORKERS", "number of resource trees built concurrently", field(parseInt, func(c *Configuration) *int { return &c.Workers })},
+	{"workers.queueSize", "WORKER_QUEUE_SIZE", "pending jobs of each priority", field(parseInt, func(c *Configuration) *int { return &c.QueueSize })},
+
+	{"cache.maxEntries", "CACHE_MAX_ENTRIES", "maximum number of resource trees, 0 for no limit", field(parseInt, func(c *Configuration) *int { return &c.CacheMaxEntries })},
+	{"cache.maxBytes", "CACHE_MAX_BYTES", "approximate memory budget of the resource trees, 0 for no limit", field(parseInt64, func(c *Configuration) *int64 { return &c.CacheMaxBytes })},
+	{"cache.idleTTL", "CACHE_IDLE_TTL", "eviction of the resource trees not requested or updated within this window, 0 for no limit", field(parseDuration, func(c *Configuration) *time.Duration { return &c.CacheIdleTTL })},
+	{"cache.revisionHistory", "CACHE_REVISION_HISTORY", "previous revisions kept for each resource tree", field(parseInt, func(c *Configuration) *int { return &c.CacheRevisionHistory })},
+	{"cache.unknownCompositionTTL", "UNKNOWN_COMPOSITION_TTL", "period during which the composition ids not found are not looked up again", field(parseDuration, func(c *Configuration) *time.Duration { return &c.UnknownCompositionTTL })},
+
+	{"resync.period", "RESYNC_PERIOD", "period of the rebuild of the cached resource trees, 0 disables it", field(parseDuration, func(c *Configuration) *time.Duration { return &c.ResyncPeriod })},
+	{"resync.jitter", "RESYNC_JITTER", "maximum random variation of each resync period", field(parseDuration, func(c *Configuration) *time.Duration { return &c.ResyncJitter })},
+
+	{"graphql.maxDepth", "GRAPHQL_MAX_DEPTH", "maximum depth of the GraphQL queries", field(parseInt, func(c *Configuration) *int { return &c.GraphQLMaxDepth })},
+	{"graphql.maxComplexity", "GRAPHQL_MAX_COMPLEXITY", "maximum complexity of the GraphQL queries", field(parseInt, func(c *Configuration) *int { return &c.GraphQLMaxComplexity })},
+
+	{"auth.read.methods", "AUTH_READ_METHODS", "comma separated authentication methods of the read routes: tokenreview, static, jwt or none", field(parseMethods, func(c *Configuration) *[]auth.Method { return &c.AuthRead.Methods })},
+	{"auth.read.subjects", "AUTH_READ_SUBJECTS", "comma separated users and groups (group:<name>) allowed on the read routes", field(parseList, func(c *Configuration) *[]string { return &c.AuthRead.Subjects })},
+	{"auth.write.methods", "AUTH_WRITE_METHODS", "comma separated authentication methods of the write routes: tokenreview, static, jwt or none", field(parseMethods, func(c *Configuration) *[]auth.Method { return &c.AuthWrite.Methods })},
+	{"auth.write.subjects", "AUTH_WRITE_SUBJECTS", "comma separated users and groups (group:<name>) allowed on the write routes", field(parseList, func(c *Configuration) *[]string { return &c.AuthWrite.Subjects })},
+	{"auth.staticTokensFile", "AUTH_STATIC_TOKENS_FILE", "CSV file of the static tokens", field(parseString, func(c *Configuration) *string { return &c.AuthStaticTokensFile })},
+	{"auth.jwt.jwksFile", "AUTH_JWKS_FILE", "JSON Web Key Set of the JWTs", field(parseString, func(c *Configuration) *string { return &c.AuthJWT.JWKSFile })},
+	{"auth.jwt.issuer", "AUTH_JWT_ISSUER", "issuer of the JWTs", field(parseString, func(c *Configuration) *string { return &c.AuthJWT.Issuer })},
+	{"auth.jwt.audience", "AUTH_JWT_AUDIENCE", "audience of the JWTs", field(parseString, func(c *Configuration) *string { return &c.AuthJWT.Audience })},
+	{"auth.jwt.usernameClaim", "AUTH_JWT_USERNAME_CLAIM", "claim of the user of the JWTs", field(parseString, func(c *Configuration) *string { return &c.AuthJWT.UsernameClaim })},
+	{"auth.jwt.groupsClaim", "AUTH_JWT_GROUPS_CLAIM", "claim of the groups of the JWTs", field(parseString, func(c *Configuration) *string { return &c.AuthJWT.GroupsClaim })},
+	{"auth.tokenReview.audiences", "AUTH_TOKENREVIEW_AUDIENCES", "comma separated audiences of the reviewed tokens", field(parseList, func(c *Configuration) *[]string { return &c.AuthTokenReviewAudiences })},
+	{"auth.redaction", "AUTH_REDACTION", "nodes the users cannot get: off, redact or omit", field(auth.ParseRedactionMode, func(c *Configuration) *auth.RedactionMode { return &c.AuthRedaction })},
+
+	{"events.signature.secretName", "EVENTS_SIGNATURE_SECRET_NAME", "Secret with the keys of the signatures of the events", field(parseString, func(c *Configuration) *string { return &c.EventsSignatureSecret.Name })},
+	{"events.signature.secretNamespace", "EVENTS_SIGNATURE_SECRET_NAMESPACE", "namespace of the Secret of the signature keys", field(parseString, func(c *Configuration) *string { return &c.EventsSignatureSecret.Namespace })},
+	{"events.signature.secretKey", "EVENTS_SIGNATURE_SECRET_KEY", "key of the Secret of the signature keys", field(parseString, func(c *Configuration) *string { return &c.EventsSignatureSecret.Key })},
+	{"events.signature.tolerance", "EVENTS_SIGNATURE_TOLERANCE", "replay window of the signatures", field(parseDuration, func(c *Configuration) *time.Duration { return &c.EventsSignatureTolerance })},
+	{"events.signature.maxBodyBytes", "EVENTS_SIGNATURE_MAX_BODY_BYTES", "maximum size of the bodies of the signed events", field(parseInt64, func(c *Configuration) *int64 { return &c.EventsSignatureMaxBodyBytes })},
+
+	{"compositions.groups", "COMPOSITION_GROUPS", "comma separated API groups of the compositions", field(parseList, func(c *Configuration) *[]string { return &c.Schema.Compositions.Groups })},
+	{"compositionReferences.apiVersion", "COMPOSITION_REFERENCE_API_VERSION", "API version of the CompositionReferences, the roots of the resource trees", field(parseString, func(c *Configuration) *string { return &c.Schema.CompositionReference.APIVersion })},
+	{"compositionReferences.resource", "COMPOSITION_REFERENCE_RESOURCE", "resource of the CompositionReferences", field(parseString, func(c *Configuration) *string { return &c.Schema.CompositionReference.Resource })},
+	{"compositionReferences.kind", "COMPOSITION_REFERENCE_KIND", "kind of the CompositionReferences", field(parseString, func(c *Configuration) *string { return &c.Schema.CompositionReference.Kind })},
+	{"labels.id", "LABEL_COMPOSITION_ID", "label of the uid of the composition, on the CompositionReference and on the managed resources", field(parseString, func(c *Configuration) *string { return &c.Schema.Labels.Id })},
+	{"labels.group", "LABEL_COMPOSITION_GROUP", "label of the group of the composition, on the CompositionReference", field(parseString, func(c *Configuration) *string { return &c.Schema.Labels.Group })},
+	{"labels.installedVersion", "LABEL_COMPOSITION_INSTALLED_VERSION", "label of the version of the composition, on the CompositionReference", field(parseString, func(c *Configuration) *string { return &c.Schema.Labels.InstalledVersion })},
+	{"labels.resource", "LABEL_COMPOSITION_RESOURCE", "label of the resource of the composition, on the CompositionReference", field(parseString, func(c *Configuration) *string { return &c.Schema.Labels.Resource })},
+	{"labels.kind", "LABEL_COMPOSITION_KIND", "label of the kind of the composition, on the CompositionReference", field(parseString, func(c *Configuration) *string { return &c.Schema.Labels.Kind })},
+	{"labels.name", "LABEL_COMPOSITION_NAME", "label of the name of the composition, on the CompositionReference", field(parseString, func(c *Configuration) *string { return &c.Schema.Labels.Name })},
+	{"labels.namespace", "LABEL_COMPOSITION_NAMESPACE", "label of the namespace of the composition, on the CompositionReference", field(parseString, func(c *Configuration) *string { return &c.Schema.Labels.Namespace })},
+	{"labels.version", "LABEL_COMPOSITION_VERSION", "label of the installed version, on the composition", field(parseString, func(c *Configuration) *string { return &c.Schema.Labels.Version })},
+
+	{"metrics.authenticated", "METRICS_AUTHENTICATED", "require the authentication and the rate limits of the read routes on /metrics", field(parseBool, func(c *Configuration) *bool { return &c.MetricsAuthenticated })},
+	{"health.conditionTypes", "HEALTH_CONDITION_TYPES", "comma separated condition types evaluated for the readiness of the compositions, all if empty", field(parseList, func(c *Configuration) *[]string { return &c.HealthConditionTypes })},
+}, rateLimitOptions()...)
+
+// rateLimitOptions returns the options of the limits of each class of routes, e.g., rateLimits.read.client
+func rateLimitOptions() []option {
+	result := []option{}
+	for _, class := range ratelimit.Classes {
+		for _, scope := range []string{"client", "global"} {
+			// The limit of the scope in the limits of the class
+			limit := func(limits *ratelimit.Limits) *ratelimit.Limit {
+				if scope == "client" {
+					return &limits.Client
+				}
+				return &limits.Global
+			}
+			get := func(c *Configuration) ratelimit.Limit {
+				limits := c.RateLimits[class]
+				return *limit(&limits)
+			}
+			put := func(c *Configuration, value ratelimit.Limit) {
+				limits := c.RateLimits[class]
+				*limit(&limits) = value
+				c.RateLimits[class] = limits
+			}
+			result = append(result, option{
+				key:   fmt.Sprintf("rateLimits.%s.%s", class, scope),
+				env:   fmt.Sprintf("RATE_LIMIT_%s_%s", strings.ToUpper(string(class)), strings.ToUpper(scope)),
+				usage: fmt.Sprintf("rate limit of the %s routes %s, <requests per second>[:<burst>]", class, map[string]string{"client": "per client", "global": "of all the clients"}[scope]),
+				field: accessor{
+					set: func(c *Configuration, value string) error {
+						parsed, err := ratelimit.ParseLimit(value)
+						if err != nil {
+							return err
+						}
+						put(c, parsed)
+						return nil
+					},
+					get: func(c *Configuration) any {
+						return get(c)
+					},
+					copy: func(dst *Configuration, src *Configuration) {
+						put(dst, get(src))
+					},
+				},
+			})
+		}
+	}
+	return result
+}
+
+// lookup returns the option of a key of the configuration file
+func lookup(key string) (option, bool) {
+	for _, o := range options {
+		if o.key == key {
+			return o, true
+		}
+	}
+	return option{}, false
+}
+
+// describe returns the key of an option with its environment variable, for the errors
+func describe(key string) string {
+	o, _ := lookup(key)
+	return fmt.Sprintf("%s (%s)", key, o.env)
+}
+
+func parseString(value string) (string, error) {
+	return strings.TrimSpace(value), nil
+}
+
+// parseList splits the comma separated values, nil if there are none
+func parseList(value string) ([]string, error) {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+func parseBool(value string) (bool, error) {
+	result, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return false, fmt.Errorf("expected true or false, got %q", value)
+	}
+	return result, nil
+}
+
+// parseInt parses a non-negative integer
+func parseInt(value string) (int, error) {
+	result, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("expected an integer, got %q", value)
+	}
+	if result < 0 {
+		return 0, fmt.Errorf("cannot be negative")
+	}
+	return result, nil
+}
+
+// parseInt64 parses a non-negative integer
+func parseInt64(value string) (int64, error) {
+	result, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("expected an integer, got %q", value)
+	}
+	if result < 0 {
+		return 0, fmt.Errorf("cannot be negative")
+	}
+	return result, nil
+}
+
+// parseDuration parses a non-negative duration, e.g., 30m
+func parseDuration(value string) (time.Duration, error) {
+	result, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("expected a duration (e.g., 30s), got %q", value)
+	}
+	if result < 0 {
+		return 0, fmt.Errorf("cannot be negative")
+	}
+	return result, nil
+}
+
+func parseLevel(value string) (zerolog.Level, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	level, err := zerolog.ParseLevel(value)
+	if err != nil || value == "" {
+		return zerolog.NoLevel, fmt.Errorf("invalid log level %q, expected trace, debug, info, warn or error", value)
+	}
+	return level, nil
+}
+
+func parseMethods(value string) ([]auth.Method, error) {
+	requirement, err := auth.ParseRequirement(value, "")
+	return requirement.Methods, err
+}
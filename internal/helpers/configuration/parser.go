@@ -1,82 +1,440 @@
 package configuration
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"maps"
+	"net/url"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+
+	"resource-tree-handler/internal/auth"
+	"resource-tree-handler/internal/certificates"
+	schemahelper "resource-tree-handler/internal/helpers/kube/schema"
+	"resource-tree-handler/internal/helpers/kube/secrets"
+	"resource-tree-handler/internal/ratelimit"
 )
 
 type Configuration struct {
 	WebServicePort int           `json:"webServicePort" yaml:"webServicePort"`
 	SSEUrl         string        `json:"sseURL" yaml:"sseURL"`
 	DebugLevel     zerolog.Level `json:"debugLevel" yaml:"debugLevel"`
+
+	// Cache bounds, zero values disable the respective limit
+	CacheMaxEntries int           `json:"cacheMaxEntries" yaml:"cacheMaxEntries"`
+	CacheMaxBytes   int64         `json:"cacheMaxBytes" yaml:"cacheMaxBytes"`
+	CacheIdleTTL    time.Duration `json:"cacheIdleTTL" yaml:"cacheIdleTTL"`
+	// Number of previous revisions kept for each resource tree to answer delta requests, 0 disables the history
+	CacheRevisionHistory int `json:"cacheRevisionHistory" yaml:"cacheRevisionHistory"`
+
+	// Period of the background rebuild of all the cached resource trees, 0 disables it
+	ResyncPeriod time.Duration `json:"resyncPeriod" yaml:"resyncPeriod"`
+	// Maximum random variation of each resync period
+	ResyncJitter time.Duration `json:"resyncJitter" yaml:"resyncJitter"`
+
+	// Limits of the GraphQL queries
+	GraphQLMaxDepth      int `json:"graphqlMaxDepth" yaml:"graphqlMaxDepth"`
+	GraphQLMaxComplexity int `json:"graphqlMaxComplexity" yaml:"graphqlMaxComplexity"`
+
+	// Authentication of the read and write routes, anonymous if no method is required
+	AuthRead  auth.Requirement `json:"authRead" yaml:"authRead"`
+	AuthWrite auth.Requirement `json:"authWrite" yaml:"authWrite"`
+	// CSV file of the static tokens, required by the static method
+	AuthStaticTokensFile string `json:"authStaticTokensFile" yaml:"authStaticTokensFile"`
+	// Verification of the JWTs, the JWKS file is required by the jwt method
+	AuthJWT auth.JWTOptions `json:"authJWT" yaml:"authJWT"`
+	// Audiences of the tokens reviewed by the API server, the ones of the API server if empty
+	AuthTokenReviewAudiences []string `json:"authTokenReviewAudiences" yaml:"authTokenReviewAudiences"`
+	// What the users see of the nodes they cannot get in Kubernetes, requires the authentication of the read routes
+	AuthRedaction auth.RedactionMode `json:"authRedaction" yaml:"authRedaction"`
+
+	// Key of the Secret with the keys of the HMAC signatures of the events, one per line, not verified if the name is empty
+	EventsSignatureSecret secrets.SecretKeySelector `json:"eventsSignatureSecret" yaml:"eventsSignatureSecret"`
+	// Replay window of the signatures, auth.DefaultSignatureTolerance if 0
+	EventsSignatureTolerance time.Duration `json:"eventsSignatureTolerance" yaml:"eventsSignatureTolerance"`
+	// Maximum size of the bodies of the signed events, which are read whole to verify their signature
+	EventsSignatureMaxBodyBytes int64 `json:"eventsSignatureMaxBodyBytes" yaml:"eventsSignatureMaxBodyBytes"`
+
+	// Certificate of the webservice, from the files or from a kubernetes.io/tls Secret, plain HTTP if neither is set
+	TLSCertFile        string `json:"tlsCertFile" yaml:"tlsCertFile"`
+	TLSKeyFile         string `json:"tlsKeyFile" yaml:"tlsKeyFile"`
+	TLSSecretName      string `json:"tlsSecretName" yaml:"tlsSecretName"`
+	TLSSecretNamespace string `json:"tlsSecretNamespace" yaml:"tlsSecretNamespace"`
+	// Verification of the client certificates against the CA bundle file, or the ca.crt of the Secret
+	TLSClientAuth   certificates.ClientAuth `json:"tlsClientAuth" yaml:"tlsClientAuth"`
+	TLSClientCAFile string                  `json:"tlsClientCAFile" yaml:"tlsClientCAFile"`
+	// Period of the reloads of the certificates, for their rotation
+	TLSReloadInterval time.Duration `json:"tlsReloadInterval" yaml:"tlsReloadInterval"`
+	// CA bundle of eventsse and client certificate of the SSE client, the system CAs and no certificate if empty
+	SSECAFile   string `json:"sseCAFile" yaml:"sseCAFile"`
+	SSECertFile string `json:"sseCertFile" yaml:"sseCertFile"`
+	SSEKeyFile  string `json:"sseKeyFile" yaml:"sseKeyFile"`
+
+	// Rate limits of the classes of routes, per client IP and global, unlimited if missing
+	RateLimits map[ratelimit.Class]ratelimit.Limits `json:"rateLimits" yaml:"rateLimits"`
+	// Proxies whose X-Forwarded-For header gives the client IP, none if empty
+	TrustedProxies []string `json:"trustedProxies" yaml:"trustedProxies"`
+	// Period during which the composition ids not found in the cluster are not looked up again, 0 disables it
+	UnknownCompositionTTL time.Duration `json:"unknownCompositionTTL" yaml:"unknownCompositionTTL"`
+
+	// Size of the worker pool building the resource trees, and of the queue of pending jobs of each priority
+	Workers   int `json:"workers" yaml:"workers"`
+	QueueSize int `json:"queueSize" yaml:"queueSize"`
+	// Reconnection of the SSE client with an exponential backoff, it stops after SSERetryMaxAttempts failures
+	// in a row, never if 0
+	SSERetryInitialDelay time.Duration `json:"sseRetryInitialDelay" yaml:"sseRetryInitialDelay"`
+	SSERetryMaxDelay     time.Duration `json:"sseRetryMaxDelay" yaml:"sseRetryMaxDelay"`
+	SSERetryMaxAttempts  int           `json:"sseRetryMaxAttempts" yaml:"sseRetryMaxAttempts"`
+	// Maximum wait of an event for the resource tree of its composition, while it is being built
+	SSEWaitTimeout time.Duration `json:"sseWaitTimeout" yaml:"sseWaitTimeout"`
+	// Condition types evaluated for the readiness of the compositions, all if empty
+	HealthConditionTypes []string `json:"healthConditionTypes" yaml:"healthConditionTypes"`
+	// Kubeconfig files and context, the default loading rules of client-go, then the in-cluster configuration,
+	// if empty
+	Kubeconfig  string `json:"kubeKubeconfig" yaml:"kubeKubeconfig"`
+	KubeContext string `json:"kubeContext" yaml:"kubeContext"`
+	// API groups of the compositions, resource of the CompositionReferences and keys of the labels, the ones of
+	// the Krateo composition controller by default. Inline, as the compositions, compositionReferences and labels
+	// of the configuration file.
+	schemahelper.Schema `json:",inline" yaml:",inline"`
+	// MetricsAuthenticated requires the authentication and the rate limits of the read routes on /metrics
+	MetricsAuthenticated bool `json:"metricsAuthenticated" yaml:"metricsAuthenticated"`
+
+	// File is the configuration file loaded, if any
+	File string `json:"file" yaml:"file"`
 }
 
+// TLSEnabled reports whether the webservice serves HTTPS
+func (c *Configuration) TLSEnabled() bool {
+	return c.TLSCertFile != "" || c.TLSSecretName != ""
+}
+
+const (
+	defaultWebServicePort = 8085
+	defaultResyncPeriod   = 8 * time.Hour
+	defaultResyncJitter   = 30 * time.Minute
+	// Same as cache.DefaultHistorySize
+	defaultCacheRevisionHistory = 10
+	// Same as graphql.DefaultMaxDepth and graphql.DefaultMaxComplexity
+	defaultGraphQLMaxDepth      = 10
+	defaultGraphQLMaxComplexity = 5000
+
+	// Short, so that a composition created after a miss is found soon even without its event
+	defaultUnknownCompositionTTL = 30 * time.Second
+)
+
+const (
+	// Same as the defaults of webservice.Webservice and ssemanager.SSE
+	defaultWorkers              = 10
+	defaultQueueSize            = 1000
+	defaultMaxSignedBodyBytes   = 1 << 20
+	defaultSSERetryInitialDelay = time.Second
+	defaultSSERetryMaxDelay     = 30 * time.Second
+	defaultSSERetryMaxAttempts  = 10
+	defaultSSEWaitTimeout       = 30 * time.Second
+
+	// ConfigFileEnv is the environment variable of the configuration file, overridden by the --config flag
+	ConfigFileEnv = "CONFIG_FILE"
+)
+
+// Default sets the defaults of the settings, the SSE URL has none
 func (c *Configuration) Default() {
-	c.WebServicePort = 8085
-	c.DebugLevel = zerolog.DebugLevel
+	c.WebServicePort = defaultWebServicePort
+	c.DebugLevel = zerolog.InfoLevel
+	c.ResyncPeriod = defaultResyncPeriod
+	c.ResyncJitter = defaultResyncJitter
+	c.CacheRevisionHistory = defaultCacheRevisionHistory
+	c.GraphQLMaxDepth = defaultGraphQLMaxDepth
+	c.GraphQLMaxComplexity = defaultGraphQLMaxComplexity
+	c.AuthRedaction = auth.RedactionOff
+	c.EventsSignatureTolerance = auth.DefaultSignatureTolerance
+	c.EventsSignatureMaxBodyBytes = defaultMaxSignedBodyBytes
+	c.TLSClientAuth = certificates.ClientAuthNone
+	c.TLSReloadInterval = certificates.DefaultReloadInterval
+	c.RateLimits = map[ratelimit.Class]ratelimit.Limits{}
+	c.UnknownCompositionTTL = defaultUnknownCompositionTTL
+	c.Workers = defaultWorkers
+	c.QueueSize = defaultQueueSize
+	c.SSERetryInitialDelay = defaultSSERetryInitialDelay
+	c.SSERetryMaxDelay = defaultSSERetryMaxDelay
+	c.SSERetryMaxAttempts = defaultSSERetryMaxAttempts
+	c.SSEWaitTimeout = defaultSSEWaitTimeout
+	c.Schema = schemahelper.Default()
 }
 
-func ParseConfig() (Configuration, error) {
-	port, err := strconv.Atoi(os.Getenv("RESOURCE_TREE_HANDLER_API_PORT"))
-	if err != nil {
+// Load returns the configuration with the defaults, overridden by the configuration file (YAML or JSON) of the
+// --config flag or of CONFIG_FILE, then by the environment variables, then by the flags of args. Unknown keys,
+// invalid values and inconsistent settings are errors: the settings are never silently replaced by the defaults.
+// The flag.ErrHelp error is returned when args ask for the usage.
+func Load(args []string, lookupEnv func(string) (string, bool)) (Configuration, error) {
+	flags := flag.NewFlagSet("resource-tree-handler", flag.ContinueOnError)
+	configFile := flags.String("config", "", fmt.Sprintf("configuration file, YAML or JSON ($%s)", ConfigFileEnv))
+	type assignment struct {
+		option option
+		value  string
+	}
+	assignments := []assignment{}
+	for _, o := range options {
+		flags.Func(o.flag(), fmt.Sprintf("%s ($%s)", o.usage, o.env), func(value string) error {
+			assignments = append(assignments, assignment{option: o, value: value})
+			return nil
+		})
+	}
+	if err := flags.Parse(args); err != nil {
 		return Configuration{}, err
 	}
+	if flags.NArg() > 0 {
+		return Configuration{}, fmt.Errorf("unexpected arguments %v", flags.Args())
+	}
+
+	configuration := Configuration{}
+	configuration.Default()
+	errs := []error{}
 
-	sseUrl := os.Getenv("URL_SSE")
-	if sseUrl == "" {
-		return Configuration{}, fmt.Errorf("SSE URL cannot be empty")
+	if *configFile == "" {
+		*configFile, _ = lookupEnv(ConfigFileEnv)
+	}
+	if *configFile != "" {
+		configuration.File = *configFile
+		errs = append(errs, configuration.applyFile(*configFile)...)
+	}
+	for _, o := range options {
+		if value, ok := lookupEnv(o.env); ok && value != "" {
+			if err := o.field.set(&configuration, value); err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s: %w", o.env, err))
+			}
+		}
+	}
+	for _, a := range assignments {
+		if err := a.option.field.set(&configuration, a.value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid --%s: %w", a.option.flag(), err))
+		}
+	}
+	if len(errs) > 0 {
+		return Configuration{}, errors.Join(errs...)
 	}
 
-	debugLevel := zerolog.InfoLevel
-	switch strings.ToLower(os.Getenv("DEBUG_LEVEL")) {
-	case "debug":
-		debugLevel = zerolog.DebugLevel
-	case "info":
-		debugLevel = zerolog.InfoLevel
-	case "error":
-		debugLevel = zerolog.ErrorLevel
+	for class, limits := range configuration.RateLimits {
+		if !limits.Enabled() {
+			delete(configuration.RateLimits, class)
+		}
 	}
-	return Configuration{
-		WebServicePort: port,
-		SSEUrl:         sseUrl,
-		DebugLevel:     debugLevel,
-	}, nil
+	if err := configuration.Validate(); err != nil {
+		return Configuration{}, err
+	}
+	return configuration, nil
 }
 
-// func ParseConfigFile(ctx context.Context, rc *rest.Config, filePath string) (Configuration, error) {
-// 	fileReader, err := os.OpenFile(filePath, os.O_RDONLY, 0600)
-// 	if err != nil {
-// 		return Configuration{}, err
-// 	}
-// 	defer fileReader.Close()
-// 	data, err := io.ReadAll(fileReader)
-// 	if err != nil {
-// 		return Configuration{}, err
-// 	}
-
-// 	parse := configurationNotParsed{}
-
-// 	err = yaml.Unmarshal(data, &parse)
-// 	if err != nil {
-// 		return Configuration{}, err
-// 	}
-
-// 	secret, err := secrets.Get(ctx, rc, (*secrets.SecretKeySelector)(&parse.EtcdPassword))
-// 	if err != nil {
-// 		return Configuration{}, err
-// 	}
-
-// 	result := Configuration{
-// 		WebServicePort: parse.WebServicePort,
-// 		EtcdAddress:    parse.EtcdAddress,
-// 		EtcdPort:       parse.EtcdPort,
-// 		EtcdUsername:   parse.EtcdUsername,
-// 		EtcdPassword:   string(secret.Data[parse.EtcdPassword.Key]),
-// 	}
-
-// 	return result, nil
-// }
+// applyFile sets the keys of the configuration file, nested objects are flattened into dotted keys
+func (c *Configuration) applyFile(path string) []error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return []error{fmt.Errorf("could not read the configuration file: %w", err)}
+	}
+	// YAML is converted to JSON, JSON is left as is
+	document, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return []error{fmt.Errorf("could not parse the configuration file %s: %w", path, err)}
+	}
+	values := map[string]any{}
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return []error{fmt.Errorf("could not parse the configuration file %s: the document must be an object: %w", path, err)}
+	}
+
+	flattened := map[string]any{}
+	flatten("", values, flattened)
+	keys := slices.Sorted(maps.Keys(flattened))
+	errs := []error{}
+	for _, key := range keys {
+		o, ok := lookup(key)
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown key %s in the configuration file %s", key, path))
+			continue
+		}
+		value, err := scalar(flattened[key])
+		if err == nil && value == nil {
+			// null, the default is kept
+			continue
+		}
+		if err == nil {
+			err = o.field.set(c, *value)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s in the configuration file %s: %w", key, path, err))
+		}
+	}
+	return errs
+}
+
+// flatten sets the leaves of the nested objects of values in result, by dotted key
+func flatten(prefix string, values map[string]any, result map[string]any) {
+	for key, value := range values {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if object, ok := value.(map[string]any); ok {
+			flatten(key, object, result)
+			continue
+		}
+		result[key] = value
+	}
+}
+
+// scalar returns a value of the file as the value of an environment variable, the lists are comma separated.
+// It returns nil for null.
+func scalar(value any) (*string, error) {
+	var result string
+	switch value := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		result = value
+	case json.Number:
+		result = value.String()
+	case bool:
+		result = strconv.FormatBool(value)
+	case []any:
+		items := make([]string, 0, len(value))
+		for _, item := range value {
+			text, err := scalar(item)
+			if err != nil || text == nil {
+				return nil, fmt.Errorf("expected a list of strings or numbers")
+			}
+			items = append(items, *text)
+		}
+		result = strings.Join(items, ",")
+	default:
+		return nil, fmt.Errorf("unexpected value %v", value)
+	}
+	return &result, nil
+}
+
+// Validate checks that the settings are valid and consistent, reporting all the problems at once
+func (c *Configuration) Validate() error {
+	errs := []error{}
+	if c.WebServicePort < 1 || c.WebServicePort > 65535 {
+		errs = append(errs, fmt.Errorf("%s must be between 1 and 65535", describe("server.port")))
+	}
+	if c.SSEUrl == "" {
+		errs = append(errs, fmt.Errorf("%s is required", describe("sse.url")))
+	} else if sseUrl, err := url.Parse(c.SSEUrl); err != nil || (sseUrl.Scheme != "http" && sseUrl.Scheme != "https") || sseUrl.Host == "" {
+		errs = append(errs, fmt.Errorf("%s must be an http or https URL, got %q", describe("sse.url"), c.SSEUrl))
+	}
+	if c.Workers < 1 {
+		errs = append(errs, fmt.Errorf("%s must be at least 1", describe("workers.count")))
+	}
+	if c.QueueSize < 1 {
+		errs = append(errs, fmt.Errorf("%s must be at least 1", describe("workers.queueSize")))
+	}
+	if c.EventsSignatureMaxBodyBytes < 1 {
+		errs = append(errs, fmt.Errorf("%s must be at least 1", describe("events.signature.maxBodyBytes")))
+	}
+	if c.SSERetryInitialDelay <= 0 {
+		errs = append(errs, fmt.Errorf("%s must be positive", describe("sse.retry.initialDelay")))
+	}
+	if c.SSERetryMaxDelay < c.SSERetryInitialDelay {
+		errs = append(errs, fmt.Errorf("%s cannot be shorter than %s", describe("sse.retry.maxDelay"), describe("sse.retry.initialDelay")))
+	}
+	if c.SSEWaitTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("%s must be positive", describe("sse.waitTimeout")))
+	}
+
+	for _, requirement := range []struct {
+		name        string
+		requirement auth.Requirement
+	}{{"read", c.AuthRead}, {"write", c.AuthWrite}} {
+		if requirement.requirement.Anonymous() && len(requirement.requirement.Subjects) > 0 {
+			errs = append(errs, fmt.Errorf("%s requires %s", describe("auth."+requirement.name+".subjects"), describe("auth."+requirement.name+".methods")))
+		}
+	}
+	required := slices.Concat(c.AuthRead.Methods, c.AuthWrite.Methods)
+	if slices.Contains(required, auth.MethodStatic) && c.AuthStaticTokensFile == "" {
+		errs = append(errs, fmt.Errorf("the %s method requires %s", auth.MethodStatic, describe("auth.staticTokensFile")))
+	}
+	if slices.Contains(required, auth.MethodJWT) && c.AuthJWT.JWKSFile == "" {
+		errs = append(errs, fmt.Errorf("the %s method requires %s", auth.MethodJWT, describe("auth.jwt.jwksFile")))
+	}
+	if c.AuthRedaction != auth.RedactionOff && c.AuthRead.Anonymous() {
+		errs = append(errs, fmt.Errorf("%s requires %s, the users of anonymous requests are unknown", describe("auth.redaction"), describe("auth.read.methods")))
+	}
+
+	if secret := c.EventsSignatureSecret; secret.Name != "" && (secret.Namespace == "" || secret.Key == "") {
+		errs = append(errs, fmt.Errorf("%s requires %s and %s", describe("events.signature.secretName"), describe("events.signature.secretNamespace"), describe("events.signature.secretKey")))
+	}
+
+	errs = append(errs, c.validateTLS()...)
+	errs = append(errs, c.validateSchema()...)
+	return errors.Join(errs...)
+}
+
+// validateTLS checks that the TLS settings are complete and not conflicting
+func (c *Configuration) validateTLS() []error {
+	errs := []error{}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		errs = append(errs, fmt.Errorf("%s and %s must be set together", describe("server.tls.certFile"), describe("server.tls.keyFile")))
+	}
+	if c.TLSCertFile != "" && c.TLSSecretName != "" {
+		errs = append(errs, fmt.Errorf("%s and %s cannot be set together", describe("server.tls.certFile"), describe("server.tls.secretName")))
+	}
+	if c.TLSSecretName != "" && c.TLSSecretNamespace == "" {
+		errs = append(errs, fmt.Errorf("%s requires %s", describe("server.tls.secretName"), describe("server.tls.secretNamespace")))
+	}
+	if c.TLSSecretName != "" && c.TLSClientCAFile != "" {
+		errs = append(errs, fmt.Errorf("%s cannot be set with %s, the CA bundle is the ca.crt of the Secret", describe("server.tls.clientCAFile"), describe("server.tls.secretName")))
+	}
+	if c.TLSClientAuth != certificates.ClientAuthNone {
+		if !c.TLSEnabled() {
+			errs = append(errs, fmt.Errorf("%s requires %s or %s", describe("server.tls.clientAuth"), describe("server.tls.certFile"), describe("server.tls.secretName")))
+		} else if c.TLSCertFile != "" && c.TLSClientCAFile == "" {
+			errs = append(errs, fmt.Errorf("%s requires %s", describe("server.tls.clientAuth"), describe("server.tls.clientCAFile")))
+		}
+	}
+	if (c.SSECertFile == "") != (c.SSEKeyFile == "") {
+		errs = append(errs, fmt.Errorf("%s and %s must be set together", describe("sse.certFile"), describe("sse.keyFile")))
+	}
+	return errs
+}
+
+// validateSchema checks that the groups, the CompositionReferences and the labels are set and valid for Kubernetes
+func (c *Configuration) validateSchema() []error {
+	errs := []error{}
+	if len(c.Schema.Compositions.Groups) == 0 {
+		errs = append(errs, fmt.Errorf("%s requires at least one group", describe("compositions.groups")))
+	}
+	for _, group := range c.Schema.Compositions.Groups {
+		if problems := validation.IsDNS1123Subdomain(group); len(problems) > 0 {
+			errs = append(errs, fmt.Errorf("%s: invalid group %q: %s", describe("compositions.groups"), group, strings.Join(problems, ", ")))
+		}
+	}
+	if gv, err := schema.ParseGroupVersion(c.Schema.CompositionReference.APIVersion); err != nil || gv.Group == "" || gv.Version == "" {
+		errs = append(errs, fmt.Errorf("%s must be <group>/<version>, got %q", describe("compositionReferences.apiVersion"), c.Schema.CompositionReference.APIVersion))
+	}
+	if c.Schema.CompositionReference.Resource == "" {
+		errs = append(errs, fmt.Errorf("%s is required", describe("compositionReferences.resource")))
+	}
+	if c.Schema.CompositionReference.Kind == "" {
+		errs = append(errs, fmt.Errorf("%s is required", describe("compositionReferences.kind")))
+	}
+	for _, o := range options {
+		if !strings.HasPrefix(o.key, "labels.") {
+			continue
+		}
+		if problems := validation.IsQualifiedName(o.field.get(c).(string)); len(problems) > 0 {
+			errs = append(errs, fmt.Errorf("%s must be a label key: %s", describe(o.key), strings.Join(problems, ", ")))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,239 @@
+package configuration
+
+import (
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"resource-tree-handler/internal/auth"
+	"resource-tree-handler/internal/ratelimit"
+)
+
+func env(values map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := values[name]
+		return value, ok
+	}
+}
+
+func writeConfig(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	configuration, err := Load(nil, env(map[string]string{"URL_SSE": "http://eventsse:8080/notifications", "CACHE_MAX_ENTRIES": ""}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configuration.WebServicePort != defaultWebServicePort || configuration.DebugLevel != zerolog.InfoLevel || configuration.Workers != defaultWorkers ||
+		configuration.QueueSize != defaultQueueSize || configuration.SSEWaitTimeout != defaultSSEWaitTimeout || configuration.CacheMaxEntries != 0 ||
+		configuration.EventsSignatureMaxBodyBytes != defaultMaxSignedBodyBytes {
+		t.Errorf("unexpected defaults %+v", configuration)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeConfig(t, "config.yaml", `
+server:
+  port: 9000
+  trustedProxies: [10.0.0.0/8, 192.168.0.1]
+log:
+  level: debug
+sse:
+  url: http://eventsse:8080/notifications
+  retry:
+    maxAttempts: 0
+workers:
+  count: 4
+  queueSize: 50
+resync:
+  period: 1h
+rateLimits:
+  read:
+    client: "5:20"
+cache:
+  idleTTL: null
+`)
+	configuration, err := Load([]string{"--workers.count=8", "--sse.wait-timeout", "1m"}, env(map[string]string{
+		ConfigFileEnv:       file,
+		"WORKERS":           "6",
+		"WORKER_QUEUE_SIZE": "100",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configuration.WebServicePort != 9000 || configuration.DebugLevel != zerolog.DebugLevel || configuration.ResyncPeriod != time.Hour {
+		t.Errorf("expected the values of the file, got %+v", configuration)
+	}
+	if strings.Join(configuration.TrustedProxies, " ") != "10.0.0.0/8 192.168.0.1" {
+		t.Errorf("unexpected trusted proxies %v", configuration.TrustedProxies)
+	}
+	if configuration.SSERetryMaxAttempts != 0 || configuration.SSERetryMaxDelay != defaultSSERetryMaxDelay {
+		t.Errorf("unexpected retry policy %+v", configuration)
+	}
+	if configuration.QueueSize != 100 {
+		t.Errorf("expected the environment to override the file, got queue size %d", configuration.QueueSize)
+	}
+	if configuration.Workers != 8 || configuration.SSEWaitTimeout != time.Minute {
+		t.Errorf("expected the flags to override the environment, got %d workers and wait timeout %s", configuration.Workers, configuration.SSEWaitTimeout)
+	}
+	if limits := configuration.RateLimits[ratelimit.ClassRead]; limits.Client.Rate != 5 || limits.Client.Burst != 20 || limits.Global.Enabled() {
+		t.Errorf("unexpected rate limits %+v", configuration.RateLimits)
+	}
+	if _, ok := configuration.RateLimits[ratelimit.ClassEvents]; ok {
+		t.Error("expected no limits for the events")
+	}
+}
+
+func TestLoadJSONFile(t *testing.T) {
+	file := writeConfig(t, "config.json", `{"sse": {"url": "https://eventsse"}, "auth": {"read": {"methods": ["tokenreview"]}, "redaction": "omit"}}`)
+	configuration, err := Load([]string{"--config", file}, env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configuration.SSEUrl != "https://eventsse" || configuration.AuthRedaction != auth.RedactionOmit || len(configuration.AuthRead.Methods) != 1 {
+		t.Errorf("unexpected configuration %+v", configuration)
+	}
+}
+
+func TestLoadSchema(t *testing.T) {
+	file := writeConfig(t, "config.yaml", "sse:\n  url: http://eventsse\ncompositions:\n  groups: [composition.krateo.io, compositions.example.com]\nlabels:\n  id: example.com/composition-id\n")
+	// The flags override the environment, which overrides the file
+	args := []string{"--labels.name=example.com/composition-name"}
+	configuration, err := Load(args, env(map[string]string{ConfigFileEnv: file, "COMPOSITION_REFERENCE_KIND": "CompositionRef", "LABEL_COMPOSITION_NAME": "other.com/composition-name"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := configuration.Schema
+	if !schema.IsCompositionGroup("compositions.example.com") || schema.Labels.Id != "example.com/composition-id" || schema.CompositionReference.Kind != "CompositionRef" {
+		t.Errorf("unexpected schema %+v", schema)
+	}
+	if schema.Labels.Name != "example.com/composition-name" {
+		t.Errorf("expected the flag to override the environment, got %+v", schema.Labels)
+	}
+	if schema.Labels.Namespace != "krateo.io/composition-namespace" || schema.CompositionReference.GroupVersionResource().Group != "resourcetrees.krateo.io" {
+		t.Errorf("expected the defaults of the other settings, got %+v", schema)
+	}
+
+	// The schema is serialized with the keys of the configuration file
+	data, err := json.Marshal(configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var serialized map[string]any
+	if err := json.Unmarshal(data, &serialized); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"compositions", "compositionReferences", "labels"} {
+		if _, ok := serialized[key]; !ok {
+			t.Errorf("expected the key %s, got %v", key, slices.Collect(maps.Keys(serialized)))
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for name, test := range map[string]struct {
+		file     string
+		args     []string
+		env      map[string]string
+		expected []string
+	}{
+		"unknown key": {
+			file:     "sse:\n  url: http://eventsse\n  retries: 3\n",
+			expected: []string{"unknown key sse.retries"},
+		},
+		"invalid values": {
+			file:     "sse:\n  url: http://eventsse\nworkers:\n  count: many\n",
+			env:      map[string]string{"RESYNC_PERIOD": "-1h"},
+			args:     []string{"--log.level=verbose"},
+			expected: []string{"invalid workers.count", "invalid RESYNC_PERIOD: cannot be negative", "invalid --log.level"},
+		},
+		"invalid schema": {
+			env: map[string]string{
+				"URL_SSE":                           "http://eventsse",
+				"COMPOSITION_GROUPS":                "composition.krateo.io,Compositions",
+				"COMPOSITION_REFERENCE_API_VERSION": "v1",
+				"LABEL_COMPOSITION_ID":              "krateo.io/composition id",
+			},
+			expected: []string{
+				`compositions.groups (COMPOSITION_GROUPS): invalid group "Compositions"`,
+				"compositionReferences.apiVersion (COMPOSITION_REFERENCE_API_VERSION) must be <group>/<version>",
+				"labels.id (LABEL_COMPOSITION_ID) must be a label key",
+			},
+		},
+		"missing SSE URL": {
+			expected: []string{"sse.url (URL_SSE) is required"},
+		},
+		"inconsistent settings": {
+			env: map[string]string{
+				"URL_SSE":                        "eventsse:8080",
+				"WORKERS":                        "0",
+				"SSE_RETRY_MAX_DELAY":            "100ms",
+				"AUTH_REDACTION":                 "redact",
+				"TLS_CERT_FILE":                  "/etc/tls/tls.crt",
+				"AUTH_WRITE_SUBJECTS":            "eventrouter",
+				"RESOURCE_TREE_HANDLER_API_PORT": "70000",
+			},
+			expected: []string{
+				"server.port (RESOURCE_TREE_HANDLER_API_PORT) must be between 1 and 65535",
+				"sse.url (URL_SSE) must be an http or https URL",
+				"workers.count (WORKERS) must be at least 1",
+				"sse.retry.maxDelay (SSE_RETRY_MAX_DELAY) cannot be shorter",
+				"auth.redaction (AUTH_REDACTION) requires auth.read.methods",
+				"auth.write.subjects (AUTH_WRITE_SUBJECTS) requires auth.write.methods",
+				"server.tls.certFile (TLS_CERT_FILE) and server.tls.keyFile (TLS_KEY_FILE) must be set together",
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			values := map[string]string{}
+			for key, value := range test.env {
+				values[key] = value
+			}
+			if test.file != "" {
+				values[ConfigFileEnv] = writeConfig(t, "config.yaml", test.file)
+			}
+			_, err := Load(test.args, env(values))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, expected := range test.expected {
+				if !strings.Contains(err.Error(), expected) {
+					t.Errorf("expected %q in the error:\n%v", expected, err)
+				}
+			}
+		})
+	}
+}
+
+func TestOptionFlag(t *testing.T) {
+	for key, expected := range map[string]string{
+		"server.port":             "server.port",
+		"cache.idleTTL":           "cache.idle-ttl",
+		"server.tls.clientCAFile": "server.tls.client-ca-file",
+		"sse.retry.initialDelay":  "sse.retry.initial-delay",
+	} {
+		if flag := (option{key: key}).flag(); flag != expected {
+			t.Errorf("%s: expected %s, got %s", key, expected, flag)
+		}
+	}
+	seen := map[string]bool{}
+	for _, o := range options {
+		if seen[o.flag()] || seen[o.env] {
+			t.Errorf("duplicated flag or environment variable of %s", o.key)
+		}
+		seen[o.flag()], seen[o.env] = true, true
+	}
+}
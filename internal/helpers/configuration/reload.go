@@ -0,0 +1,186 @@
+package configuration
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultReloadInterval is the period of the checks of the configuration file
+const DefaultReloadInterval = 10 * time.Second
+
+// Reloader loads the configuration again when its file changes, e.g., a mounted ConfigMap, and applies the
+// reloadable settings: the log level, the number of workers, the rate limits, the resync period and the condition
+// types of the readiness. The changes of the other settings are reported, and applied only after a restart.
+type Reloader struct {
+	args      []string
+	lookupEnv func(string) (string, bool)
+	apply     func(Configuration)
+
+	mu       sync.Mutex
+	current  Configuration
+	checksum [sha256.Size]byte
+	loaded   time.Time
+	pending  []string
+	err      error
+}
+
+// Effective is the configuration applied, with the changes waiting for a restart
+type Effective struct {
+	// File is the configuration file, if any
+	File string `json:"file,omitempty"`
+	// Loaded is the time of the latest change applied
+	Loaded time.Time `json:"loaded"`
+	// Settings are the values applied, by key of the configuration file
+	Settings map[string]any `json:"settings"`
+	// PendingRestart are the keys changed in the file that are applied only after a restart
+	PendingRestart []string `json:"pendingRestart"`
+	// Error is the reason why the latest version of the file is not applied, if any
+	Error string `json:"error,omitempty"`
+}
+
+// NewReloader returns the reloader of the configuration loaded at startup with the same args and environment,
+// apply is called with the new configuration when reloadable settings change
+func NewReloader(args []string, lookupEnv func(string) (string, bool), current Configuration, apply func(Configuration)) *Reloader {
+	reloader := &Reloader{args: args, lookupEnv: lookupEnv, apply: apply, current: current, loaded: time.Now()}
+	if current.File != "" {
+		reloader.checksum, _ = checksum(current.File)
+	}
+	return reloader
+}
+
+// Start checks the configuration file every interval until ctx is done, it does not block.
+// Nothing is checked without a configuration file, the environment and the flags cannot change.
+func (r *Reloader) Start(ctx context.Context, interval time.Duration) {
+	if r.current.File == "" {
+		return
+	}
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+	log.Info().Msgf("watching the configuration file %s for changes", r.current.File)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := r.Reload(); err != nil {
+					log.Error().Err(err).Msg("the configuration is not reloaded, keeping the current one")
+				}
+			}
+		}
+	}()
+}
+
+// Reload loads the configuration again if its file changed, an invalid configuration is not applied at all
+func (r *Reloader) Reload() error {
+	sum, err := checksum(r.current.File)
+	r.mu.Lock()
+	if err != nil {
+		r.err = err
+		r.mu.Unlock()
+		return err
+	}
+	if sum == r.checksum {
+		r.mu.Unlock()
+		return nil
+	}
+	// Invalid versions are reported once
+	r.checksum = sum
+	loaded, err := Load(r.args, r.lookupEnv)
+	if err != nil {
+		r.err = err
+		r.mu.Unlock()
+		return err
+	}
+
+	effective := loaded
+	applied, pending := []string{}, []string{}
+	for _, o := range options {
+		changed := !reflect.DeepEqual(o.field.get(&r.current), o.field.get(&loaded))
+		if o.reloadable() {
+			if changed {
+				applied = append(applied, o.key)
+			}
+			continue
+		}
+		// The current value is the one of the startup, kept until the restart
+		o.field.copy(&effective, &r.current)
+		if changed {
+			pending = append(pending, o.key)
+		}
+	}
+	r.current, r.pending, r.err = effective, pending, nil
+	if len(applied) > 0 {
+		r.loaded = time.Now()
+	}
+	r.mu.Unlock()
+
+	if len(applied) > 0 {
+		log.Info().Msgf("configuration reloaded, applied the changes of %s", strings.Join(applied, ", "))
+		r.apply(effective)
+	}
+	if len(pending) > 0 {
+		log.Warn().Msgf("the changes of %s require a restart, they are not applied", strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// Effective returns the configuration applied
+func (r *Reloader) Effective() Effective {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	effective := Effective{File: r.current.File, Loaded: r.loaded, Settings: r.current.Settings(), PendingRestart: r.pending}
+	if effective.PendingRestart == nil {
+		effective.PendingRestart = []string{}
+	}
+	if r.err != nil {
+		effective.Error = r.err.Error()
+	}
+	return effective
+}
+
+// Settings returns the values of the options, nested by the dotted keys as in the configuration file.
+// The durations and the limits are formatted as strings.
+func (c *Configuration) Settings() map[string]any {
+	settings := map[string]any{}
+	for _, o := range options {
+		parts := strings.Split(o.key, ".")
+		parent := settings
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := parent[part].(map[string]any)
+			if !ok {
+				child = map[string]any{}
+				parent[part] = child
+			}
+			parent = child
+		}
+		value := o.field.get(c)
+		switch typed := value.(type) {
+		case time.Duration:
+			value = typed.String()
+		case fmt.Stringer:
+			value = typed.String()
+		}
+		parent[parts[len(parts)-1]] = value
+	}
+	return settings
+}
+
+func checksum(path string) ([sha256.Size]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return [sha256.Size]byte{}, fmt.Errorf("could not read the configuration file: %w", err)
+	}
+	return sha256.Sum256(data), nil
+}
@@ -0,0 +1,62 @@
+package configuration
+
+import (
+	"os"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestReloader(t *testing.T) {
+	file := writeConfig(t, "config.yaml", "sse:\n  url: http://eventsse\nserver:\n  port: 8085\nworkers:\n  count: 4\n")
+	lookupEnv := env(map[string]string{ConfigFileEnv: file})
+	initial, err := Load(nil, lookupEnv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied := []Configuration{}
+	reloader := NewReloader(nil, lookupEnv, initial, func(configuration Configuration) {
+		applied = append(applied, configuration)
+	})
+
+	// Unchanged file
+	if err := reloader.Reload(); err != nil || len(applied) > 0 {
+		t.Fatalf("expected nothing to be applied, got %v, %v", applied, err)
+	}
+
+	update := func(content string) {
+		if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	update("sse:\n  url: http://eventsse\nserver:\n  port: 9090\nworkers:\n  count: 8\nlog:\n  level: debug\n")
+	if err := reloader.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 || applied[0].Workers != 8 || applied[0].DebugLevel != zerolog.DebugLevel {
+		t.Fatalf("expected the workers and the log level to be applied, got %+v", applied)
+	}
+	if applied[0].WebServicePort != 8085 {
+		t.Errorf("expected the port of the startup, got %d", applied[0].WebServicePort)
+	}
+	effective := reloader.Effective()
+	if len(effective.PendingRestart) != 1 || effective.PendingRestart[0] != "server.port" {
+		t.Errorf("expected the port to wait for a restart, got %v", effective.PendingRestart)
+	}
+	if count := effective.Settings["workers"].(map[string]any)["count"]; count != 8 {
+		t.Errorf("expected 8 workers in the settings, got %v", count)
+	}
+	if level := effective.Settings["log"].(map[string]any)["level"]; level != "debug" {
+		t.Errorf("expected the level as a string, got %v", level)
+	}
+
+	// Invalid configurations are not applied at all
+	update("sse:\n  url: http://eventsse\nworkers:\n  count: 0\nlog:\n  level: error\n")
+	if err := reloader.Reload(); err == nil {
+		t.Fatal("expected an error")
+	}
+	effective = reloader.Effective()
+	if len(applied) != 1 || effective.Error == "" || effective.Settings["log"].(map[string]any)["level"] != "debug" {
+		t.Errorf("expected the previous configuration to be kept, got %+v", effective)
+	}
+}
@@ -3,6 +3,7 @@ package client
 import (
 	"context"
 	"fmt"
+	"path/filepath"
 	"strings"
 
 	"github.com/rs/zerolog/log"
@@ -12,7 +13,9 @@ import (
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 
+	"github.com/krateoplatformops/plumbing/cache"
 	"github.com/krateoplatformops/plumbing/kubeutil/plurals"
 
 	apitypes "resource-tree-handler/apis"
@@ -20,6 +23,30 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// NewConfig returns the configuration of the clients from the kubeconfig files, separated as in $PATH, or from
+// the default loading rules of client-go if empty (KUBECONFIG, then ~/.kube/config). The context is the current
+// one of the kubeconfig if empty. Without kubeconfig, e.g., in a pod, it is the in-cluster configuration.
+// The requests of the clients of the configuration are instrumented, see metrics.KubernetesRequests.
+func NewConfig(kubeconfig string, kubeContext string) (*rest.Config, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if paths := filepath.SplitList(kubeconfig); len(paths) == 1 {
+		// A missing explicit file is an error, unlike the files of the precedence
+		rules.ExplicitPath = paths[0]
+	} else if len(paths) > 1 {
+		rules.Precedence = paths
+	}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: kubeContext}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("could not load the kubeconfig or the in-cluster configuration: %w", err)
+	}
+	config.Wrap(instrument)
+	return config, nil
+}
+
+// pluralsCache avoids a discovery request every time a resource tree is filtered
+var pluralsCache = cache.NewTTL[string, plurals.Info]()
+
 func NewDynamicClient(rc *rest.Config) (*dynamic.DynamicClient, error) {
 	config := *rc
 	config.APIPath = "/api"
@@ -69,6 +96,7 @@ func InferGroupResource(a, k string) schema.GroupResource {
 
 	tmp, err := plurals.Get(gvk, plurals.GetOptions{
 		ResolverFunc: plurals.ResolveAPINames,
+		Cache:        pluralsCache,
 	})
 	if err != nil {
 		log.Error().Err(err).Msgf("could not obtain plural for %s %s %s", gvk.Group, gvk.Kind, gvk.Version)
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: dev
+  cluster:
+    server: https://dev.example.com:6443
+- name: kind
+  cluster:
+    server: https://127.0.0.1:35000
+contexts:
+- name: dev
+  context:
+    cluster: dev
+    user: developer
+- name: kind-krateo
+  context:
+    cluster: kind
+    user: developer
+users:
+- name: developer
+  user:
+    token: secret
+`
+
+func TestNewConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(testKubeconfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for kubeContext, expected := range map[string]string{"": "https://dev.example.com:6443", "kind-krateo": "https://127.0.0.1:35000"} {
+		config, err := NewConfig(path, kubeContext)
+		if err != nil {
+			t.Fatalf("context %q: %v", kubeContext, err)
+		}
+		if config.Host != expected || config.BearerToken != "secret" {
+			t.Errorf("context %q: unexpected host %s", kubeContext, config.Host)
+		}
+	}
+	if _, err := NewConfig(path, "missing"); err == nil {
+		t.Error("expected an error for a missing context")
+	}
+	if _, err := NewConfig(filepath.Join(t.TempDir(), "missing"), ""); err == nil {
+		t.Error("expected an error for a missing kubeconfig")
+	}
+}
+
+func TestRequestInfo(t *testing.T) {
+	for _, tt := range []struct {
+		method   string
+		url      string
+		expected string
+	}{
+		{http.MethodGet, "/api/v1/namespaces/demo/configmaps/app", "get  v1 configmaps"},
+		{http.MethodGet, "/apis/composition.krateo.io/v1-2-0/fireworksapps", "list composition.krateo.io v1-2-0 fireworksapps"},
+		{http.MethodGet, "/apis/apps/v1/namespaces/demo/deployments?watch=true", "watch apps v1 deployments"},
+		{http.MethodPut, "/apis/resourcetrees.krateo.io/v1/namespaces/demo/compositionreferences/app/status", "update resourcetrees.krateo.io v1 compositionreferences/status"},
+		{http.MethodGet, "/api/v1/namespaces/demo", "get  v1 namespaces"},
+		{http.MethodDelete, "/api/v1/namespaces/demo/secrets", "deletecollection  v1 secrets"},
+		{http.MethodGet, "/apis/composition.krateo.io/v1-2-0", "discovery composition.krateo.io v1-2-0 "},
+		{http.MethodGet, "/apis", "discovery   "},
+	} {
+		verb, group, version, resource := requestInfo(httptest.NewRequest(tt.method, tt.url, nil))
+		if got := strings.Join([]string{verb, group, version, resource}, " "); got != tt.expected {
+			t.Errorf("%s %s: expected %q, got %q", tt.method, tt.url, tt.expected, got)
+		}
+	}
+}
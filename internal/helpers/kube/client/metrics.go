@@ -0,0 +1,85 @@
+package client
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"resource-tree-handler/internal/metrics"
+)
+
+// instrumentedTransport counts the requests to the API server and measures their duration, see metrics.KubernetesRequests
+type instrumentedTransport struct {
+	next http.RoundTripper
+}
+
+func instrument(next http.RoundTripper) http.RoundTripper {
+	return &instrumentedTransport{next: next}
+}
+
+func (t *instrumentedTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	verb, group, version, resource := requestInfo(request)
+	start := time.Now()
+	response, err := t.next.RoundTrip(request)
+	metrics.KubernetesRequestDuration.WithLabelValues(verb, group, version, resource).Observe(time.Since(start).Seconds())
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(response.StatusCode)
+	}
+	metrics.KubernetesRequests.WithLabelValues(verb, group, version, resource, code).Inc()
+	return response, err
+}
+
+// requestInfo returns the Kubernetes verb and the resource of a request from its path, e.g.,
+// /apis/<group>/<version>/namespaces/<namespace>/<resource>/<name>/<subresource>. The subresource is appended to
+// the resource, e.g., compositionreferences/status. The other paths, e.g., /apis, are discovery requests.
+func requestInfo(request *http.Request) (verb string, group string, version string, resource string) {
+	parts := strings.Split(strings.Trim(request.URL.Path, "/"), "/")
+	switch {
+	case len(parts) >= 2 && parts[0] == "api":
+		version, parts = parts[1], parts[2:]
+	case len(parts) >= 3 && parts[0] == "apis":
+		group, version, parts = parts[1], parts[2], parts[3:]
+	default:
+		return "discovery", "", "", ""
+	}
+	// The namespaces are a resource only when there is nothing else after their name
+	if len(parts) >= 3 && parts[0] == "namespaces" {
+		parts = parts[2:]
+	}
+	if len(parts) == 0 {
+		return "discovery", group, version, ""
+	}
+	resource = parts[0]
+	named := len(parts) >= 2
+	if len(parts) >= 3 {
+		resource += "/" + parts[2]
+	}
+
+	switch request.Method {
+	case http.MethodGet, http.MethodHead:
+		switch {
+		case request.URL.Query().Get("watch") == "true" || request.URL.Query().Get("watch") == "1":
+			verb = "watch"
+		case named:
+			verb = "get"
+		default:
+			verb = "list"
+		}
+	case http.MethodPost:
+		verb = "create"
+	case http.MethodPut:
+		verb = "update"
+	case http.MethodPatch:
+		verb = "patch"
+	case http.MethodDelete:
+		verb = "delete"
+		if !named {
+			verb = "deletecollection"
+		}
+	default:
+		verb = strings.ToLower(request.Method)
+	}
+	return verb, group, version, resource
+}
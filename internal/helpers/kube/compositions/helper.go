@@ -2,6 +2,7 @@ package compositions
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"regexp"
 	types "resource-tree-handler/apis"
@@ -15,9 +16,13 @@ import (
 	"k8s.io/client-go/rest"
 
 	kubehelper "resource-tree-handler/internal/helpers/kube/client"
+	schemahelper "resource-tree-handler/internal/helpers/kube/schema"
 	"slices"
 )
 
+// ErrCompositionNotFound is returned by GetCompositionById when no composition has the id
+var ErrCompositionNotFound = errors.New("composition not found")
+
 func isFullMatch(pattern, str string) (bool, error) {
 	if !strings.HasSuffix(pattern, "$") {
 		pattern = pattern + "$"
@@ -90,23 +95,24 @@ func GetCompositionById(compositionId string, config *rest.Config) (*unstructure
 		return nil, nil, fmt.Errorf("failed to get server groups: %v", err)
 	}
 
-	// Find all versions for our group
-	var versions []string
+	// Find all versions of the composition groups
+	compositionSchema := schemahelper.Get()
+	var versions []schema.GroupVersion
 	for _, group := range groups.Groups {
-		if group.Name == "composition.krateo.io" {
+		if compositionSchema.IsCompositionGroup(group.Name) {
 			for _, version := range group.Versions {
-				versions = append(versions, version.Version)
+				versions = append(versions, schema.GroupVersion{Group: group.Name, Version: version.Version})
 			}
 		}
 	}
 
 	if len(versions) == 0 {
-		return nil, nil, fmt.Errorf("no versions found for group composition.krateo.io")
+		return nil, nil, fmt.Errorf("no versions found for the composition groups %s", strings.Join(compositionSchema.Compositions.Groups, ", "))
 	}
 
 	// Try each version
 	for _, version := range versions {
-		resources, err := discoveryClient.ServerResourcesForGroupVersion(fmt.Sprintf("composition.krateo.io/%s", version))
+		resources, err := discoveryClient.ServerResourcesForGroupVersion(version.String())
 		if err != nil {
 			log.Warn().Err(err).Msgf("error getting resources for version %s", version)
 			continue
@@ -119,11 +125,7 @@ func GetCompositionById(compositionId string, config *rest.Config) (*unstructure
 				continue
 			}
 
-			gvr := schema.GroupVersionResource{
-				Group:    "composition.krateo.io",
-				Version:  version,
-				Resource: r.Name,
-			}
+			gvr := version.WithResource(r.Name)
 
 			// List objects of this resource type
 			list, err := dynClient.Resource(gvr).List(context.TODO(), v1.ListOptions{})
@@ -142,9 +144,9 @@ func GetCompositionById(compositionId string, config *rest.Config) (*unstructure
 					if conditions[0].(map[string]interface{})["reason"].(string) == "Creating" {
 						return nil, nil, fmt.Errorf("composition is creating")
 					}
-					installedVersionString, ok := item.GetLabels()["krateo.io/composition-version"]
+					installedVersionString, ok := item.GetLabels()[compositionSchema.Labels.Version]
 					if !ok {
-						return nil, nil, fmt.Errorf("could not get label 'krateo.io/composition-version' of composition uid %s", compositionId)
+						return nil, nil, fmt.Errorf("could not get label '%s' of composition uid %s", compositionSchema.Labels.Version, compositionId)
 					}
 
 					gv, err := schema.ParseGroupVersion(item.GetAPIVersion())
@@ -167,5 +169,5 @@ func GetCompositionById(compositionId string, config *rest.Config) (*unstructure
 		}
 	}
 
-	return nil, nil, fmt.Errorf("did not find composition with id %s in any version or resource type", compositionId)
+	return nil, nil, fmt.Errorf("did not find composition with id %s in any version or resource type: %w", compositionId, ErrCompositionNotFound)
 }
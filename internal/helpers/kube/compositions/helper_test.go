@@ -91,3 +91,24 @@ func TestShouldItSkip(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestIsCompositionReady(t *testing.T) {
+	defer SetReadyConditionTypes(nil)
+	node := func(kind string, conditionType string, status string) *types.ResourceNodeStatus {
+		return &types.ResourceNodeStatus{ResourceRefStatus: types.ResourceRefStatus{Kind: kind}, Health: &types.Health{Type: conditionType, Status: status}}
+	}
+	resourceTree := &types.ResourceTree{}
+	resourceTree.Resources.Status = []*types.ResourceNodeStatus{
+		node("CompositionReference", "Ready", "False"),
+		node("Deployment", "Available", "True"),
+		node("Release", "Synced", "False"),
+	}
+
+	if ready, _ := IsCompositionReady(resourceTree); ready {
+		t.Error("expected every condition type to be evaluated by default")
+	}
+	SetReadyConditionTypes([]string{"Ready", "Available"})
+	if ready, message := IsCompositionReady(resourceTree); !ready {
+		t.Errorf("expected the Synced condition to be ignored, got %s", message)
+	}
+}
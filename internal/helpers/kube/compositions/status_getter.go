@@ -17,6 +17,7 @@ import (
 	types "resource-tree-handler/apis"
 	kubehelper "resource-tree-handler/internal/helpers/kube/client"
 	filtershelper "resource-tree-handler/internal/helpers/kube/filters"
+	schemahelper "resource-tree-handler/internal/helpers/kube/schema"
 )
 
 func GetCompositionResourcesStatus(config *rest.Config, obj *unstructured.Unstructured, compositionReference types.Reference, excludes []types.Exclude) (types.ResourceTree, error) {
@@ -30,14 +31,8 @@ func GetCompositionResourcesStatus(config *rest.Config, obj *unstructured.Unstru
 	if err != nil {
 		return types.ResourceTree{}, fmt.Errorf("could not obtain CompositionReference while building resource tree: %w", err)
 	}
-	compositionReference_reference := &types.Reference{
-		ApiVersion: "resourcetrees.krateo.io/v1",
-		Kind:       "CompositionReference",
-		Resource:   "compositionreferences",
-		Name:       unstructuredCompositionReference.GetName(),
-		Namespace:  unstructuredCompositionReference.GetNamespace(),
-	}
-	compositionReference_referenceJsonSpec, compositionReference_referenceJsonStatus, err := GetObjectStatus(dynClient, *compositionReference_reference, types.Reference{}, &types.ResourceNodeStatus{})
+	compositionReference_reference := schemahelper.Get().CompositionReference.Reference(unstructuredCompositionReference.GetName(), unstructuredCompositionReference.GetNamespace())
+	compositionReference_referenceJsonSpec, compositionReference_referenceJsonStatus, err := GetObjectStatus(dynClient, compositionReference_reference, types.Reference{}, &types.ResourceNodeStatus{})
 	if err != nil {
 		return types.ResourceTree{}, fmt.Errorf("could not obtain CompositionReference status while building resource tree: %w", err)
 	}
@@ -45,6 +40,10 @@ func GetCompositionResourcesStatus(config *rest.Config, obj *unstructured.Unstru
 	// Create data structures
 	resourceTreeJson := types.ResourceTreeJson{}
 	resourceTreeJson.CreationTimestamp = metav1.Now()
+	// The metadata of the resource tree mirrors the composition, to list and filter the compositions from the cache
+	resourceTreeJson.Name = obj.GetName()
+	resourceTreeJson.Namespace = obj.GetNamespace()
+	resourceTreeJson.Labels = obj.GetLabels()
 
 	resourceTreeJson.Spec.Tree = make([]types.ResourceNode, 0)
 	resourceTreeJson.Status = make([]*types.ResourceNodeStatus, 0)
@@ -89,7 +88,7 @@ func GetCompositionResourcesStatus(config *rest.Config, obj *unstructured.Unstru
 	managedResourceList = append(managedResourceList, compositionReference)
 
 	for _, managedResource := range managedResourceList {
-		resourceNodeJsonSpec, resourceNodeJsonStatus, err := GetObjectStatus(dynClient, managedResource, *compositionReference_reference, compositionReference_referenceJsonStatus)
+		resourceNodeJsonSpec, resourceNodeJsonStatus, err := GetObjectStatus(dynClient, managedResource, compositionReference_reference, compositionReference_referenceJsonStatus)
 		if err != nil {
 			log.Warn().Err(err).Msg("error retrieving object status, continuing...")
 			continue
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -13,11 +14,11 @@ import (
 
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
 
 	types "resource-tree-handler/apis"
 	filtershelper "resource-tree-handler/internal/helpers/kube/filters"
+	schemahelper "resource-tree-handler/internal/helpers/kube/schema"
 )
 
 func SetCompositionReferenceStatus(compositionObj *unstructured.Unstructured, compositionReference types.Reference, resourceTree *types.ResourceTree, dynClient *dynamic.DynamicClient) error {
@@ -47,13 +48,8 @@ func SetCompositionReferenceStatus(compositionObj *unstructured.Unstructured, co
 		},
 	}, "status", "conditions")
 
-	gvr := schema.GroupVersionResource{
-		Group:    "resourcetrees.krateo.io",
-		Version:  "v1",
-		Resource: "compositionreferences",
-	}
-
-	_, err = dynClient.Resource(gvr).
+	compositionReferenceResource := schemahelper.Get().CompositionReference
+	_, err = dynClient.Resource(compositionReferenceResource.GroupVersionResource()).
 		Namespace(unstructuredCompositionReference.GetNamespace()).
 		UpdateStatus(context.Background(), unstructuredCompositionReference, v1.UpdateOptions{})
 	if err != nil {
@@ -61,14 +57,8 @@ func SetCompositionReferenceStatus(compositionObj *unstructured.Unstructured, co
 	}
 
 	// Retrieve the new object, with the updated status, and update the root element of the tree
-	compositionReference_reference := &types.Reference{
-		ApiVersion: "resourcetrees.krateo.io/v1",
-		Kind:       "CompositionReference",
-		Resource:   "compositionreferences",
-		Name:       unstructuredCompositionReference.GetName(),
-		Namespace:  unstructuredCompositionReference.GetNamespace(),
-	}
-	_, compositionReference_referenceJsonStatus, err := GetObjectStatus(dynClient, *compositionReference_reference, types.Reference{}, &types.ResourceNodeStatus{})
+	compositionReference_reference := compositionReferenceResource.Reference(unstructuredCompositionReference.GetName(), unstructuredCompositionReference.GetNamespace())
+	_, compositionReference_referenceJsonStatus, err := GetObjectStatus(dynClient, compositionReference_reference, types.Reference{}, &types.ResourceNodeStatus{})
 	if err != nil {
 		return fmt.Errorf("could not obtain CompositionReference status while building resource tree: %w", err)
 	}
@@ -79,14 +69,30 @@ func SetCompositionReferenceStatus(compositionObj *unstructured.Unstructured, co
 
 }
 
+// readyConditionTypes are the condition types evaluated by IsCompositionReady, all if empty
+var readyConditionTypes atomic.Pointer[[]string]
+
+// SetReadyConditionTypes sets the condition types evaluated for the readiness of the compositions, matched
+// case-insensitively as substrings of the types, e.g., ready matches NodesReady. All are evaluated if empty.
+func SetReadyConditionTypes(conditionTypes []string) {
+	lowered := make([]string, 0, len(conditionTypes))
+	for _, conditionType := range conditionTypes {
+		lowered = append(lowered, strings.ToLower(conditionType))
+	}
+	readyConditionTypes.Store(&lowered)
+}
+
 func IsCompositionReady(resourceTree *types.ResourceTree) (bool, string) {
 	log.Info().Msg("Checking composition status...")
 	logging := "\n"
-	positives := []string{
-		"", "ready", "complete", "healthy", "active", "able",
+	// The empty string matches every type
+	positives := []string{""}
+	if conditionTypes := readyConditionTypes.Load(); conditionTypes != nil && len(*conditionTypes) > 0 {
+		positives = *conditionTypes
 	}
+	compositionReferenceKind := schemahelper.Get().CompositionReference.Kind
 	for _, status := range resourceTree.Resources.Status {
-		if status.Kind == "CompositionReference" {
+		if status.Kind == compositionReferenceKind {
 			continue
 		}
 		logging += fmt.Sprintf("resource %s health type %s value %s\n", status.Kind, status.Health.Type, status.Health.Status)
@@ -0,0 +1,63 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+
+	kubehelper "resource-tree-handler/internal/helpers/kube/client"
+)
+
+var eventsGVR = schema.GroupVersionResource{Version: "v1", Resource: "events"}
+
+// List returns the most recent events involving the object with the uid, at most limit, newest first.
+// The namespace is the one of the object, empty for cluster-scoped objects.
+func List(ctx context.Context, config *rest.Config, namespace string, uid string, limit int) ([]corev1.Event, error) {
+	dynClient, err := kubehelper.NewDynamicClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("obtaining dynamic client for kubernetes: %w", err)
+	}
+
+	list, err := dynClient.Resource(eventsGVR).Namespace(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("involvedObject.uid", uid).String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list events for object with uid %s: %w", uid, err)
+	}
+
+	events := make([]corev1.Event, 0, len(list.Items))
+	for _, item := range list.Items {
+		var event corev1.Event
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &event); err != nil {
+			return nil, fmt.Errorf("could not convert event %s: %w", item.GetName(), err)
+		}
+		events = append(events, event)
+	}
+
+	slices.SortFunc(events, func(a, b corev1.Event) int { return LastSeen(b).Compare(LastSeen(a)) })
+	if limit > 0 && len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+// LastSeen returns the last time an event occurred, whichever of its timestamps is set
+func LastSeen(event corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case event.Series != nil && !event.Series.LastObservedTime.IsZero():
+		return event.Series.LastObservedTime.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	}
+	return event.CreationTimestamp.Time
+}
@@ -14,24 +14,12 @@ import (
 	"k8s.io/client-go/rest"
 
 	kubehelper "resource-tree-handler/internal/helpers/kube/client"
-)
-
-const (
-	compositionGroup     = "krateo.io/composition-group"
-	compositionVersion   = "krateo.io/composition-installed-version"
-	compositionResource  = "krateo.io/composition-resource"
-	compositionKind      = "krateo.io/composition-kind"
-	compositionName      = "krateo.io/composition-name"
-	compositionNamespace = "krateo.io/composition-namespace"
-	compositionId        = "krateo.io/composition-id"
+	schemahelper "resource-tree-handler/internal/helpers/kube/schema"
 )
 
 func GetCompositionReference(dynClient *dynamic.DynamicClient, composition types.Reference) (*types.CompositionReference, *unstructured.Unstructured, error) {
-	gvr := schema.GroupVersionResource{
-		Group:    "resourcetrees.krateo.io",
-		Version:  "v1",
-		Resource: "compositionreferences",
-	}
+	compositionSchema := schemahelper.Get()
+	gvr := compositionSchema.CompositionReference.GroupVersionResource()
 
 	gv, err := schema.ParseGroupVersion(composition.ApiVersion)
 	if err != nil {
@@ -44,9 +32,9 @@ func GetCompositionReference(dynClient *dynamic.DynamicClient, composition types
 
 	labels := fmt.Sprintf(
 		"%s=%s,%s=%s",
-		compositionId,
+		compositionSchema.Labels.Id,
 		composition.Uid,
-		compositionVersion,
+		compositionSchema.Labels.InstalledVersion,
 		gv.Version,
 	)
 
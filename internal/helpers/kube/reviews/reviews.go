@@ -0,0 +1,67 @@
+package reviews
+
+import (
+	"context"
+	"fmt"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+
+	kubehelper "resource-tree-handler/internal/helpers/kube/client"
+)
+
+var (
+	tokenReviewsGVR         = authenticationv1.SchemeGroupVersion.WithResource("tokenreviews")
+	subjectAccessReviewsGVR = authorizationv1.SchemeGroupVersion.WithResource("subjectaccessreviews")
+)
+
+// Token asks the API server to authenticate a bearer token, e.g., the token of a ServiceAccount.
+// Audiences are the audiences the token must be valid for, the ones of the API server if empty.
+func Token(ctx context.Context, config *rest.Config, token string, audiences []string) (*authenticationv1.TokenReviewStatus, error) {
+	review := &authenticationv1.TokenReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: authenticationv1.SchemeGroupVersion.String(), Kind: "TokenReview"},
+		Spec:     authenticationv1.TokenReviewSpec{Token: token, Audiences: audiences},
+	}
+	result, err := create(ctx, config, tokenReviewsGVR, review)
+	if err != nil {
+		return nil, fmt.Errorf("unable to review token: %w", err)
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(result.Object, review); err != nil {
+		return nil, fmt.Errorf("could not convert token review: %w", err)
+	}
+	return &review.Status, nil
+}
+
+// Access asks the API server whether a user can perform the action of the spec
+func Access(ctx context.Context, config *rest.Config, spec authorizationv1.SubjectAccessReviewSpec) (*authorizationv1.SubjectAccessReviewStatus, error) {
+	review := &authorizationv1.SubjectAccessReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: authorizationv1.SchemeGroupVersion.String(), Kind: "SubjectAccessReview"},
+		Spec:     spec,
+	}
+	result, err := create(ctx, config, subjectAccessReviewsGVR, review)
+	if err != nil {
+		return nil, fmt.Errorf("unable to review access of %s: %w", spec.User, err)
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(result.Object, review); err != nil {
+		return nil, fmt.Errorf("could not convert subject access review: %w", err)
+	}
+	return &review.Status, nil
+}
+
+// create creates a review, which the API server answers with its status without storing it
+func create(ctx context.Context, config *rest.Config, gvr schema.GroupVersionResource, review runtime.Object) (*unstructured.Unstructured, error) {
+	dynClient, err := kubehelper.NewDynamicClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("obtaining dynamic client for kubernetes: %w", err)
+	}
+	object, err := runtime.DefaultUnstructuredConverter.ToUnstructured(review)
+	if err != nil {
+		return nil, err
+	}
+	return dynClient.Resource(gvr).Create(ctx, &unstructured.Unstructured{Object: object}, metav1.CreateOptions{})
+}
@@ -0,0 +1,110 @@
+// Package schema holds the API groups of the compositions, the resource of the CompositionReferences and the
+// keys of the labels linking them to the managed resources. The defaults are the ones of the Krateo composition
+// controller, a fork may serve its compositions under other groups and labels: Set is called once at startup,
+// every other package reads them with Get.
+package schema
+
+import (
+	"slices"
+	"sync/atomic"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	types "resource-tree-handler/apis"
+)
+
+// Labels are the keys of the labels of the compositions, of the CompositionReferences and of the managed resources
+type Labels struct {
+	// Id is the uid of the composition, on the CompositionReference and on the managed resources
+	Id string `json:"id" yaml:"id"`
+	// Labels of the CompositionReference with the composition it references
+	Group            string `json:"group" yaml:"group"`
+	InstalledVersion string `json:"installedVersion" yaml:"installedVersion"`
+	Resource         string `json:"resource" yaml:"resource"`
+	Kind             string `json:"kind" yaml:"kind"`
+	Name             string `json:"name" yaml:"name"`
+	Namespace        string `json:"namespace" yaml:"namespace"`
+	// Version is the installed version of the chart, on the composition itself
+	Version string `json:"version" yaml:"version"`
+}
+
+// Resource is a resource with its kind
+type Resource struct {
+	APIVersion string `json:"apiVersion" yaml:"apiVersion"`
+	Resource   string `json:"resource" yaml:"resource"`
+	Kind       string `json:"kind" yaml:"kind"`
+}
+
+// GroupVersionResource returns the resource for the dynamic client, the API version must be valid
+func (r Resource) GroupVersionResource() schema.GroupVersionResource {
+	gv, _ := schema.ParseGroupVersion(r.APIVersion)
+	return gv.WithResource(r.Resource)
+}
+
+// Reference returns the reference of the object of the resource
+func (r Resource) Reference(name string, namespace string) types.Reference {
+	return types.Reference{
+		ApiVersion: r.APIVersion,
+		Kind:       r.Kind,
+		Resource:   r.Resource,
+		Name:       name,
+		Namespace:  namespace,
+	}
+}
+
+// Compositions are the compositions served
+type Compositions struct {
+	// Groups are the API groups of the compositions, the events of other groups are ignored
+	Groups []string `json:"groups" yaml:"groups"`
+}
+
+// Schema is how the compositions, their CompositionReferences and their managed resources are found
+type Schema struct {
+	Compositions Compositions `json:"compositions" yaml:"compositions"`
+	// CompositionReference is the root of the resource trees, found through the Id and InstalledVersion labels
+	CompositionReference Resource `json:"compositionReferences" yaml:"compositionReferences"`
+	Labels               Labels   `json:"labels" yaml:"labels"`
+}
+
+// Default returns the schema of the Krateo composition controller
+func Default() Schema {
+	return Schema{
+		Compositions: Compositions{Groups: []string{"composition.krateo.io"}},
+		CompositionReference: Resource{
+			APIVersion: "resourcetrees.krateo.io/v1",
+			Resource:   "compositionreferences",
+			Kind:       "CompositionReference",
+		},
+		Labels: Labels{
+			Id:               "krateo.io/composition-id",
+			Group:            "krateo.io/composition-group",
+			InstalledVersion: "krateo.io/composition-installed-version",
+			Resource:         "krateo.io/composition-resource",
+			Kind:             "krateo.io/composition-kind",
+			Name:             "krateo.io/composition-name",
+			Namespace:        "krateo.io/composition-namespace",
+			Version:          "krateo.io/composition-version",
+		},
+	}
+}
+
+// IsCompositionGroup reports whether group is one of the groups of the compositions
+func (s Schema) IsCompositionGroup(group string) bool {
+	return slices.Contains(s.Compositions.Groups, group)
+}
+
+var current atomic.Pointer[Schema]
+
+// Set replaces the schema, it is called at startup before the first composition is looked up
+func Set(s Schema) {
+	s.Compositions.Groups = slices.Clone(s.Compositions.Groups)
+	current.Store(&s)
+}
+
+// Get returns the schema set, the default one if none
+func Get() Schema {
+	if s := current.Load(); s != nil {
+		return *s
+	}
+	return Default()
+}
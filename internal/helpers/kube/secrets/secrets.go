@@ -4,11 +4,26 @@ import (
 	"context"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 )
 
+// restClientFor returns a client of the core API, rc is usually configured for the dynamic client only
+func restClientFor(rc *rest.Config) (*rest.RESTClient, error) {
+	config := *rc
+	config.APIPath = "/api"
+	config.GroupVersion = &corev1.SchemeGroupVersion
+	if config.NegotiatedSerializer == nil {
+		config.NegotiatedSerializer = scheme.Codecs.WithoutConversion()
+	}
+	if config.UserAgent == "" {
+		config.UserAgent = rest.DefaultKubernetesUserAgent()
+	}
+	return rest.RESTClientFor(&config)
+}
+
 func Get(ctx context.Context, rc *rest.Config, sel *SecretKeySelector) (*corev1.Secret, error) {
-	cli, err := rest.RESTClientFor(rc)
+	cli, err := restClientFor(rc)
 	if err != nil {
 		return nil, err
 	}
@@ -24,7 +39,7 @@ func Get(ctx context.Context, rc *rest.Config, sel *SecretKeySelector) (*corev1.
 }
 
 func Create(ctx context.Context, rc *rest.Config, secret *corev1.Secret) error {
-	cli, err := rest.RESTClientFor(rc)
+	cli, err := restClientFor(rc)
 	if err != nil {
 		return err
 	}
@@ -38,7 +53,7 @@ func Create(ctx context.Context, rc *rest.Config, secret *corev1.Secret) error {
 }
 
 func Update(ctx context.Context, rc *rest.Config, secret *corev1.Secret) error {
-	cli, err := rest.RESTClientFor(rc)
+	cli, err := restClientFor(rc)
 	if err != nil {
 		return err
 	}
@@ -52,7 +67,7 @@ func Update(ctx context.Context, rc *rest.Config, secret *corev1.Secret) error {
 }
 
 func Delete(ctx context.Context, rc *rest.Config, sel *SecretKeySelector) error {
-	cli, err := rest.RESTClientFor(rc)
+	cli, err := restClientFor(rc)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,93 @@
+package resourcetree
+
+import (
+	types "resource-tree-handler/apis"
+)
+
+// ChangeType is the type of change of a node between two versions of a resource tree
+type ChangeType string
+
+const (
+	NodeAdded   ChangeType = "added"
+	NodeUpdated ChangeType = "updated"
+	NodeRemoved ChangeType = "removed"
+)
+
+// NodeKey identifies a node of the resource tree across rebuilds
+type NodeKey struct {
+	Version   string
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+// NodeChange is a node that differs between two versions of a resource tree
+type NodeChange struct {
+	Type ChangeType
+	// Node is the new node, nil for NodeRemoved
+	Node *types.ResourceNodeStatus
+	// Previous is the old node, nil for NodeAdded
+	Previous *types.ResourceNodeStatus
+}
+
+func KeyOf(node *types.ResourceNodeStatus) NodeKey {
+	return NodeKey{
+		Version:   node.Version,
+		Kind:      node.Kind,
+		Namespace: node.Namespace,
+		Name:      node.Name,
+	}
+}
+
+// Diff returns the nodes added, updated (different resourceVersion or health) and removed between
+// the old and the new status of a resource tree. Added and updated nodes follow the order of the new
+// status, removed nodes follow the order of the old one.
+func Diff(old []*types.ResourceNodeStatus, new []*types.ResourceNodeStatus) []NodeChange {
+	oldNodes := make(map[NodeKey]*types.ResourceNodeStatus, len(old))
+	for _, node := range old {
+		if node != nil {
+			oldNodes[KeyOf(node)] = node
+		}
+	}
+
+	changes := []NodeChange{}
+	seen := make(map[NodeKey]bool, len(new))
+	for _, node := range new {
+		if node == nil {
+			continue
+		}
+		key := KeyOf(node)
+		seen[key] = true
+		previous, ok := oldNodes[key]
+		if !ok {
+			changes = append(changes, NodeChange{Type: NodeAdded, Node: node})
+		} else if deref(previous.ResourceVersion) != deref(node.ResourceVersion) || HealthChanged(previous, node) {
+			changes = append(changes, NodeChange{Type: NodeUpdated, Node: node, Previous: previous})
+		}
+	}
+	for _, node := range old {
+		if node != nil && !seen[KeyOf(node)] {
+			changes = append(changes, NodeChange{Type: NodeRemoved, Previous: node})
+		}
+	}
+	return changes
+}
+
+// HealthChanged returns true if the health of the two nodes differs
+func HealthChanged(old *types.ResourceNodeStatus, new *types.ResourceNodeStatus) bool {
+	var oldHealth, newHealth types.Health
+	if old.Health != nil {
+		oldHealth = *old.Health
+	}
+	if new.Health != nil {
+		newHealth = *new.Health
+	}
+	return oldHealth != newHealth
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
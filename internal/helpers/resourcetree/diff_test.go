@@ -0,0 +1,62 @@
+package resourcetree
+
+import (
+	types "resource-tree-handler/apis"
+	"testing"
+)
+
+func node(kind string, name string, resourceVersion string, healthStatus string) *types.ResourceNodeStatus {
+	return &types.ResourceNodeStatus{
+		ResourceRefStatus: types.ResourceRefStatus{Version: "v1", Kind: kind, Name: name, Namespace: "default"},
+		ResourceVersion:   &resourceVersion,
+		Health:            &types.Health{Type: "Ready", Status: healthStatus},
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old := []*types.ResourceNodeStatus{
+		node("ConfigMap", "unchanged", "1", "True"),
+		node("ConfigMap", "removed", "1", "True"),
+		node("Deployment", "health", "1", "True"),
+		node("Service", "version", "1", "True"),
+	}
+	new := []*types.ResourceNodeStatus{
+		node("ConfigMap", "unchanged", "1", "True"),
+		node("Deployment", "health", "1", "False"),
+		node("Service", "version", "2", "True"),
+		node("Secret", "added", "1", ""),
+	}
+
+	changes := Diff(old, new)
+	expected := []struct {
+		changeType ChangeType
+		name       string
+	}{
+		{NodeUpdated, "health"},
+		{NodeUpdated, "version"},
+		{NodeAdded, "added"},
+		{NodeRemoved, "removed"},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %d changes, got %d", len(expected), len(changes))
+	}
+	for i, change := range changes {
+		n := change.Node
+		if n == nil {
+			n = change.Previous
+		}
+		if change.Type != expected[i].changeType || n.Name != expected[i].name {
+			t.Errorf("change %d: expected %s %s, got %s %s", i, expected[i].changeType, expected[i].name, change.Type, n.Name)
+		}
+	}
+
+	if !HealthChanged(changes[0].Previous, changes[0].Node) {
+		t.Error("health change not detected")
+	}
+	if HealthChanged(changes[1].Previous, changes[1].Node) {
+		t.Error("resourceVersion change reported as health change")
+	}
+	if len(Diff(new, new)) != 0 {
+		t.Error("identical trees reported as different")
+	}
+}
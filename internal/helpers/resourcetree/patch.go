@@ -0,0 +1,102 @@
+package resourcetree
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	types "resource-tree-handler/apis"
+)
+
+// PatchOperation is a JSON Patch (RFC 6902) operation
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+type patchItem struct {
+	key  NodeKey
+	data []byte
+}
+
+// Patch returns the JSON Patch that transforms the JSON array of the old nodes into the JSON array of
+// the new nodes. Nodes are matched by KeyOf: removed nodes are removed first, from the last one, then
+// the array is walked in the new order, moving, adding and replacing the nodes that differ.
+func Patch(old []*types.ResourceNodeStatus, new []*types.ResourceNodeStatus) ([]PatchOperation, error) {
+	target, err := patchItems(new)
+	if err != nil {
+		return nil, err
+	}
+	work, err := patchItems(old)
+	if err != nil {
+		return nil, err
+	}
+
+	needed := make(map[NodeKey]int, len(target))
+	for _, item := range target {
+		needed[item.key]++
+	}
+	keep := make([]bool, len(work))
+	for i, item := range work {
+		if needed[item.key] > 0 {
+			needed[item.key]--
+			keep[i] = true
+		}
+	}
+
+	operations := []PatchOperation{}
+	for i := len(work) - 1; i >= 0; i-- {
+		if !keep[i] {
+			operations = append(operations, PatchOperation{Op: "remove", Path: patchPath(i)})
+			work = append(work[:i], work[i+1:]...)
+		}
+	}
+
+	for i, item := range target {
+		if i < len(work) && work[i].key == item.key {
+			if !bytes.Equal(work[i].data, item.data) {
+				operations = append(operations, PatchOperation{Op: "replace", Path: patchPath(i), Value: item.data})
+			}
+			continue
+		}
+
+		j := i + 1
+		for j < len(work) && work[j].key != item.key {
+			j++
+		}
+		if j < len(work) {
+			moved := work[j]
+			copy(work[i+1:j+1], work[i:j])
+			work[i] = moved
+			operations = append(operations, PatchOperation{Op: "move", From: patchPath(j), Path: patchPath(i)})
+			if !bytes.Equal(moved.data, item.data) {
+				operations = append(operations, PatchOperation{Op: "replace", Path: patchPath(i), Value: item.data})
+			}
+			continue
+		}
+
+		work = append(work, patchItem{})
+		copy(work[i+1:], work[i:])
+		work[i] = item
+		operations = append(operations, PatchOperation{Op: "add", Path: patchPath(i), Value: item.data})
+	}
+	return operations, nil
+}
+
+func patchItems(nodes []*types.ResourceNodeStatus) ([]patchItem, error) {
+	items := make([]patchItem, 0, len(nodes))
+	for _, node := range nodes {
+		data, err := json.Marshal(node)
+		if err != nil {
+			return nil, fmt.Errorf("could not marshal node %s %s: %w", node.Kind, node.Name, err)
+		}
+		items = append(items, patchItem{key: KeyOf(node), data: data})
+	}
+	return items, nil
+}
+
+func patchPath(index int) string {
+	return fmt.Sprintf("/%d", index)
+}
@@ -0,0 +1,77 @@
+package resourcetree
+
+import (
+	"encoding/json"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+
+	types "resource-tree-handler/apis"
+)
+
+func TestPatch(t *testing.T) {
+	tests := []struct {
+		name string
+		old  []*types.ResourceNodeStatus
+		new  []*types.ResourceNodeStatus
+		ops  int
+	}{
+		{
+			name: "identical",
+			old:  []*types.ResourceNodeStatus{node("ConfigMap", "a", "1", "True"), node("Service", "b", "1", "True")},
+			new:  []*types.ResourceNodeStatus{node("ConfigMap", "a", "1", "True"), node("Service", "b", "1", "True")},
+			ops:  0,
+		},
+		{
+			name: "replace, add and remove",
+			old:  []*types.ResourceNodeStatus{node("ConfigMap", "a", "1", "True"), node("ConfigMap", "removed", "1", "True"), node("Service", "b", "1", "True")},
+			new:  []*types.ResourceNodeStatus{node("ConfigMap", "a", "1", "True"), node("Service", "b", "2", "False"), node("Secret", "added", "1", "")},
+			ops:  3,
+		},
+		{
+			name: "reorder",
+			old:  []*types.ResourceNodeStatus{node("ConfigMap", "a", "1", "True"), node("ConfigMap", "b", "1", "True"), node("ConfigMap", "c", "1", "True")},
+			new:  []*types.ResourceNodeStatus{node("ConfigMap", "c", "1", "True"), node("ConfigMap", "a", "2", "True"), node("ConfigMap", "b", "1", "True")},
+			ops:  2,
+		},
+		{
+			name: "from empty",
+			old:  []*types.ResourceNodeStatus{},
+			new:  []*types.ResourceNodeStatus{node("ConfigMap", "a", "1", "True"), node("ConfigMap", "b", "1", "True")},
+			ops:  2,
+		},
+		{
+			name: "to empty",
+			old:  []*types.ResourceNodeStatus{node("ConfigMap", "a", "1", "True"), node("ConfigMap", "b", "1", "True")},
+			new:  []*types.ResourceNodeStatus{},
+			ops:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			operations, err := Patch(tt.old, tt.new)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(operations) != tt.ops {
+				t.Errorf("expected %d operations, got %d: %+v", tt.ops, len(operations), operations)
+			}
+
+			oldJSON, _ := json.Marshal(tt.old)
+			newJSON, _ := json.Marshal(tt.new)
+			patchJSON, _ := json.Marshal(operations)
+			patch, err := jsonpatch.DecodePatch(patchJSON)
+			if err != nil {
+				t.Fatal(err)
+			}
+			patched, err := patch.Apply(oldJSON)
+			if err != nil {
+				t.Fatalf("could not apply %s: %v", patchJSON, err)
+			}
+			if !jsonpatch.Equal(patched, newJSON) {
+				t.Errorf("patched document differs:\n%s\n%s", patched, newJSON)
+			}
+		})
+	}
+}
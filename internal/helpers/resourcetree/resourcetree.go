@@ -3,9 +3,11 @@ package resourcetree
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/rest"
 
 	types "resource-tree-handler/apis"
@@ -13,19 +15,81 @@ import (
 	kubeHelper "resource-tree-handler/internal/helpers/kube/client"
 	compositionHelper "resource-tree-handler/internal/helpers/kube/compositions"
 	filtersHelper "resource-tree-handler/internal/helpers/kube/filters"
+	schemaHelper "resource-tree-handler/internal/helpers/kube/schema"
+	"resource-tree-handler/internal/metrics"
 )
 
+// HandleCreate builds the resource tree of the composition and caches it
 func HandleCreate(obj *unstructured.Unstructured, composition types.Reference, cacheObj *cacheHelper.ThreadSafeCache, config *rest.Config) error {
-	dynClient, err := kubeHelper.NewDynamicClient(config)
+	resourceTree, exclude, err := buildResourceTree(obj, composition, config)
 	if err != nil {
-		return fmt.Errorf("obtaining dynamic client for kubernetes: %w", err)
+		return err
 	}
+	return cacheResourceTree(obj, composition, resourceTree, exclude, cacheObj, config)
+}
 
-	exclude := filtersHelper.GetFilters(config, composition)
-	resourceTree, err := compositionHelper.GetCompositionResourcesStatus(config, obj, composition, exclude)
+// HandleResync rebuilds the resource tree like HandleCreate, and returns the drift between the
+// cached resource tree and the rebuilt one: the nodes added, removed or with a different health.
+// A drift means that some events were not received while the resource tree was cached.
+// The rebuilt resource tree is cached whenever it differs from the cached one, e.g., with newer
+// resourceVersions or root status, while the CompositionReference status is only written on a drift.
+func HandleResync(obj *unstructured.Unstructured, composition types.Reference, cacheObj *cacheHelper.ThreadSafeCache, config *rest.Config) ([]NodeChange, error) {
+	resourceTree, exclude, err := buildResourceTree(obj, composition, config)
+	if err != nil {
+		return nil, err
+	}
+
+	previous, found := cacheObj.GetResourceTreeFromCache(string(obj.GetUID()))
+	if !found {
+		return nil, cacheResourceTree(obj, composition, resourceTree, exclude, cacheObj, config)
+	}
+
+	changes := Diff(previous.ResourceTree.Resources.Status, resourceTree.Resources.Status)
+	rootChanges := Diff([]*types.ResourceNodeStatus{previous.ResourceTree.RootElementStatus}, []*types.ResourceNodeStatus{resourceTree.RootElementStatus})
+	drift := []NodeChange{}
+	for _, change := range changes {
+		// A new resourceVersion alone is not a drift, e.g., the CompositionReference status is rewritten on every update
+		if change.Type == NodeUpdated && !HealthChanged(change.Previous, change.Node) {
+			continue
+		}
+		drift = append(drift, change)
+	}
+
+	switch {
+	case len(drift) > 0:
+		return drift, cacheResourceTree(obj, composition, resourceTree, exclude, cacheObj, config)
+	case len(changes) > 0 || len(rootChanges) > 0:
+		// The readiness of the composition did not change, its status is not written again
+		cacheObj.AddToCache(resourceTree, string(obj.GetUID()), composition, types.Filters{Exclude: exclude})
+	}
+	return drift, nil
+}
+
+// buildResourceTree retrieves the resources of the composition, excluding the filtered ones
+func buildResourceTree(obj *unstructured.Unstructured, composition types.Reference, config *rest.Config) (resourceTree types.ResourceTree, exclude []types.Exclude, err error) {
+	start := time.Now()
+	defer func() {
+		kind := obj.GetKind()
+		metrics.TreeBuildDuration.WithLabelValues(kind).Observe(time.Since(start).Seconds())
+		if err != nil {
+			metrics.TreeBuildErrors.WithLabelValues(kind).Inc()
+		}
+	}()
+
+	exclude = filtersHelper.GetFilters(config, composition)
+	resourceTree, err = compositionHelper.GetCompositionResourcesStatus(config, obj, composition, exclude)
 	if err != nil {
 		log.Error().Err(err).Msg("retrieving managed array statuses")
-		return fmt.Errorf("error while retrieving managed array statuses: %w", err)
+		return resourceTree, exclude, fmt.Errorf("error while retrieving managed array statuses: %w", err)
+	}
+	return resourceTree, exclude, nil
+}
+
+// cacheResourceTree updates the CompositionReference status from the resource tree, then caches it
+func cacheResourceTree(obj *unstructured.Unstructured, composition types.Reference, resourceTree types.ResourceTree, exclude []types.Exclude, cacheObj *cacheHelper.ThreadSafeCache, config *rest.Config) error {
+	dynClient, err := kubeHelper.NewDynamicClient(config)
+	if err != nil {
+		return fmt.Errorf("obtaining dynamic client for kubernetes: %w", err)
 	}
 
 	err = compositionHelper.SetCompositionReferenceStatus(obj, composition, &resourceTree, dynClient)
@@ -45,27 +109,40 @@ func HandleUpdate(newObjectReference types.Reference, newObjectKind string, comp
 		return
 	}
 
-	updateOp := func(resourceTree *cacheHelper.ResourceTreeUpdate) error {
-		// Get the resource tree root element: CompositionReference, through labels
-		_, unstructuredCompositionReference, err := filtersHelper.GetCompositionReference(dynClient, resourceTree.CompositionReference)
-		if err != nil {
-			return fmt.Errorf("could not obtain CompositionReference while building resource tree: %w", err)
-		}
+	start := time.Now()
+	err = updateResourceTree(newObjectReference, newObjectKind, compositionId, cacheObj, dynClient, config)
+	metrics.TreeUpdateDuration.Observe(time.Since(start).Seconds())
+	metrics.TreeUpdates.WithLabelValues(metrics.Result(err)).Inc()
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to update resource tree for composition id %s", compositionId)
+	}
+}
 
-		compositionReference_reference := types.Reference{
-			ApiVersion: "resourcetrees.krateo.io/v1",
-			Kind:       "CompositionReference",
-			Resource:   "compositionreferences",
-			Name:       unstructuredCompositionReference.GetName(),
-			Namespace:  unstructuredCompositionReference.GetNamespace(),
-		}
+// updateResourceTree replaces the node of the object in the cached resource tree, and updates the status of the
+// CompositionReference accordingly. The objects are read and the status is written once, before the update of the
+// cache, which only applies their results: it may run more than once, and it commits a single revision.
+func updateResourceTree(newObjectReference types.Reference, newObjectKind string, compositionId string, cacheObj *cacheHelper.ThreadSafeCache, dynClient *dynamic.DynamicClient, config *rest.Config) error {
+	resourceTree, ok := cacheObj.GetResourceTreeFromCache(compositionId)
+	if !ok {
+		return fmt.Errorf("resource tree not in cache")
+	}
 
-		resourceNodeJsonSpec, resourceNodeJsonStatus, err := compositionHelper.GetObjectStatus(dynClient, newObjectReference, compositionReference_reference, resourceTree.ResourceTree.RootElementStatus)
-		if err != nil {
-			return fmt.Errorf("error retrieving object status: %w", err)
-		}
+	// Get the resource tree root element: CompositionReference, through labels
+	_, unstructuredCompositionReference, err := filtersHelper.GetCompositionReference(dynClient, resourceTree.CompositionReference)
+	if err != nil {
+		return fmt.Errorf("could not obtain CompositionReference while building resource tree: %w", err)
+	}
+
+	compositionReference_reference := schemaHelper.Get().CompositionReference.Reference(unstructuredCompositionReference.GetName(), unstructuredCompositionReference.GetNamespace())
 
+	resourceNodeJsonSpec, resourceNodeJsonStatus, err := compositionHelper.GetObjectStatus(dynClient, newObjectReference, compositionReference_reference, resourceTree.ResourceTree.RootElementStatus)
+	if err != nil {
+		return fmt.Errorf("error retrieving object status: %w", err)
+	}
+
+	replaceNode := func(resourceTree *cacheHelper.ResourceTreeUpdate) {
 		// Update spec
+		spec := resourceNodeJsonSpec
 		found := false
 		for i, obj := range resourceTree.ResourceTree.Resources.Spec.Tree {
 			if obj.APIVersion == newObjectReference.ApiVersion &&
@@ -73,10 +150,10 @@ func HandleUpdate(newObjectReference types.Reference, newObjectKind string, comp
 				obj.Name == newObjectReference.Name &&
 				obj.Namespace == newObjectReference.Namespace {
 
-				resourceNodeJsonSpec.ParentRefs = obj.ParentRefs
+				spec.ParentRefs = obj.ParentRefs
 				resourceTree.ResourceTree.Resources.Spec.Tree = append(
 					resourceTree.ResourceTree.Resources.Spec.Tree[:i],
-					append([]types.ResourceNode{resourceNodeJsonSpec},
+					append([]types.ResourceNode{spec},
 						resourceTree.ResourceTree.Resources.Spec.Tree[i+1:]...)...)
 				found = true
 				break
@@ -85,11 +162,15 @@ func HandleUpdate(newObjectReference types.Reference, newObjectKind string, comp
 		if !found {
 			resourceTree.ResourceTree.Resources.Spec.Tree = append(
 				resourceTree.ResourceTree.Resources.Spec.Tree,
-				resourceNodeJsonSpec)
+				spec)
 			log.Info().Msgf("Object missing in data spec, adding object %s %s %s %s in composition_id %s", newObjectReference.ApiVersion, newObjectReference.Resource, newObjectReference.Name, newObjectReference.Namespace, compositionId)
 		}
 
-		// Update status (similar pattern)
+		// Update status (similar pattern), with a copy of the node, whose parents are the ones of this resource tree
+		status := *resourceNodeJsonStatus
+		if len(status.ParentRefs) > 0 {
+			status.ParentRefs = []*types.ResourceNodeStatus{resourceTree.ResourceTree.RootElementStatus}
+		}
 		found = false
 		for i, obj := range resourceTree.ResourceTree.Resources.Status {
 			if obj.Kind == newObjectKind &&
@@ -97,10 +178,10 @@ func HandleUpdate(newObjectReference types.Reference, newObjectKind string, comp
 				obj.Name == newObjectReference.Name &&
 				obj.Namespace == newObjectReference.Namespace {
 
-				resourceNodeJsonStatus.ParentRefs = obj.ParentRefs
+				status.ParentRefs = obj.ParentRefs
 				resourceTree.ResourceTree.Resources.Status = append(
 					resourceTree.ResourceTree.Resources.Status[:i],
-					append([]*types.ResourceNodeStatus{resourceNodeJsonStatus},
+					append([]*types.ResourceNodeStatus{&status},
 						resourceTree.ResourceTree.Resources.Status[i+1:]...)...)
 				found = true
 				break
@@ -109,29 +190,37 @@ func HandleUpdate(newObjectReference types.Reference, newObjectKind string, comp
 		if !found {
 			resourceTree.ResourceTree.Resources.Status = append(
 				resourceTree.ResourceTree.Resources.Status,
-				resourceNodeJsonStatus)
+				&status)
 			log.Info().Msgf("Object missing in data status, adding object %s %s %s %s in composition_id %s", newObjectReference.ApiVersion, newObjectReference.Resource, newObjectReference.Name, newObjectReference.Namespace, compositionId)
 		}
 
 		for _, obj := range resourceTree.ResourceTree.Resources.Status {
 			log.Debug().Msgf("objects in resource tree status %s %s %s %s for composition_id %s", obj.Version, obj.Kind, obj.Name, obj.Namespace, compositionId)
 		}
+	}
 
-		// Update composition status
-		compositionUnstructured, err := kubeHelper.GetObj(context.Background(), &resourceTree.CompositionReference, config)
-		if err != nil {
-			return fmt.Errorf("retrieving object, could not update composition status: %w", err)
-		}
-
+	// Update composition status, from the resource tree with the new node
+	replaceNode(resourceTree)
+	var rootElementStatus *types.ResourceNodeStatus
+	compositionUnstructured, err := kubeHelper.GetObj(context.Background(), &resourceTree.CompositionReference, config)
+	if err == nil {
 		err = compositionHelper.SetCompositionReferenceStatus(compositionUnstructured, resourceTree.CompositionReference, &resourceTree.ResourceTree, dynClient)
-		if err != nil {
-			return fmt.Errorf("error while updating the composition status: %w", err)
-		}
-
-		return nil
 	}
-
-	if err := cacheObj.QueueUpdate(compositionId, updateOp); err != nil {
-		log.Error().Err(err).Msgf("failed to update resource tree for composition id %s", compositionId)
+	if err != nil {
+		// The node is cached anyway, the status is written again on the next update
+		log.Error().Err(err).Msgf("error while updating the composition status for composition id %s", compositionId)
+	} else {
+		rootElementStatus = resourceTree.ResourceTree.RootElementStatus
 	}
+
+	return cacheObj.QueueUpdate(compositionId, func(resourceTree *cacheHelper.ResourceTreeUpdate) error {
+		replaceNode(resourceTree)
+		// The root is updated in place, it is the parent of the other nodes
+		if root := resourceTree.ResourceTree.RootElementStatus; root != nil && rootElementStatus != nil {
+			*root = *rootElementStatus
+		} else if rootElementStatus != nil {
+			resourceTree.ResourceTree.RootElementStatus = rootElementStatus
+		}
+		return nil
+	})
 }
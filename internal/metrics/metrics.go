@@ -0,0 +1,109 @@
+// Package metrics declares the Prometheus metrics of the resource-tree-handler, registered in Registry with the
+// metrics of the Go runtime and of the process. The metrics derived from the state of the webservice, e.g., the
+// size of the cache, are collected by the webservice itself when scraped.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Namespace prefixes the names of all the metrics
+const Namespace = "resource_tree_handler"
+
+// Values of the priority and result labels
+const (
+	PriorityHigh = "high"
+	PriorityLow  = "low"
+
+	ResultSuccess = "success"
+	ResultError   = "error"
+)
+
+// Registry holds the metrics of this package, it is served with the metrics of the webservice
+var Registry = prometheus.NewRegistry()
+
+var (
+	// TreeBuildDuration is the duration of the builds of whole resource trees, including the resyncs
+	TreeBuildDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "tree_build_duration_seconds",
+		Help:      "Duration of the builds of the resource trees, by kind of composition.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"kind"})
+	TreeBuildErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "tree_build_errors_total",
+		Help:      "Failed builds of the resource trees, by kind of composition.",
+	}, []string{"kind"})
+
+	// TreeUpdates are the incremental updates of a node of a cached resource tree, on the events of eventsse
+	TreeUpdates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "tree_updates_total",
+		Help:      "Incremental updates of the resource trees, by result: success or error.",
+	}, []string{"result"})
+	TreeUpdateDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "tree_update_duration_seconds",
+		Help:      "Duration of the incremental updates of the resource trees.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	// JobQueueWait is the time between the queueing of a job and its start by a worker
+	JobQueueWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "job_queue_wait_seconds",
+		Help:      "Wait of the jobs in the queue before a worker starts them, by priority: high or low.",
+		Buckets:   []float64{0.01, 0.1, 0.5, 1, 5, 15, 60, 300, 900},
+	}, []string{"priority"})
+
+	SSEConnected = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "sse_connected",
+		Help:      "1 while connected to eventsse, 0 otherwise.",
+	})
+	SSEReconnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "sse_reconnects_total",
+		Help:      "Failed connections to eventsse followed by a reconnection attempt.",
+	})
+	// SSEEvents are the events received by topic, i.e., by composition id, the series are deleted on unsubscription
+	SSEEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "sse_events_total",
+		Help:      "Events received from eventsse, by topic.",
+	}, []string{"topic"})
+
+	KubernetesRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "kubernetes_requests_total",
+		Help:      "Requests to the Kubernetes API server, by verb, group, version, resource and status code.",
+	}, []string{"verb", "group", "version", "resource", "code"})
+	KubernetesRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "kubernetes_request_duration_seconds",
+		Help:      "Duration of the requests to the Kubernetes API server, by verb, group, version and resource.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"verb", "group", "version", "resource"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		TreeBuildDuration, TreeBuildErrors,
+		TreeUpdates, TreeUpdateDuration,
+		JobQueueWait,
+		SSEConnected, SSEReconnects, SSEEvents,
+		KubernetesRequests, KubernetesRequestDuration,
+	)
+}
+
+// Result returns the value of the result label of an operation that returned err
+func Result(err error) string {
+	if err != nil {
+		return ResultError
+	}
+	return ResultSuccess
+}
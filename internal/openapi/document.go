@@ -0,0 +1,190 @@
+// Package openapi generates an OpenAPI 3 document from the description of the routes and the Go types
+// of their requests and responses, so that the document cannot drift from the code.
+package openapi
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	MediaTypeJSON = "application/json"
+	Version       = "3.0.3"
+)
+
+// Route describes an operation of the API. Request and response bodies are example values of their
+// Go types (e.g., MyResponse{}), only their types are used.
+type Route struct {
+	Method      string
+	Path        string // gin syntax, e.g., /compositions/:compositionId
+	OperationId string
+	Summary     string
+	Description string
+	Tags        []string
+	Deprecated  bool
+	// Query parameters, path parameters are derived from Path
+	Query       []Parameter
+	Headers     []Parameter
+	RequestBody *Body
+	Responses   []Response
+}
+
+// Body is the content of a request or a response
+type Body struct {
+	ContentType string // MediaTypeJSON if empty
+	Value       any
+	Required    bool
+}
+
+type Response struct {
+	Status      int
+	Description string // http.StatusText(Status) if empty
+	// Bodies are the alternative contents of the response, none if empty
+	Bodies []Body
+	// Headers are the response headers, only Name, Description and Schema are used
+	Headers []Parameter
+}
+
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty"`
+}
+
+// PathItem maps the lower case HTTP methods to their operations
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationId string                     `json:"operationId,omitempty"`
+	Summary     string                     `json:"summary,omitempty"`
+	Description string                     `json:"description,omitempty"`
+	Tags        []string                   `json:"tags,omitempty"`
+	Deprecated  bool                       `json:"deprecated,omitempty"`
+	Parameters  []Parameter                `json:"parameters,omitempty"`
+	RequestBody *RequestBody               `json:"requestBody,omitempty"`
+	Responses   map[string]*ResponseObject `json:"responses"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema,omitempty"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required,omitempty"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+type ResponseObject struct {
+	Description string                `json:"description"`
+	Headers     map[string]*Header    `json:"headers,omitempty"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema,omitempty"`
+}
+
+// QueryParameter returns an optional query parameter of the given type (e.g., "string", "integer", "boolean")
+func QueryParameter(name string, schemaType string, description string) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Schema: &Schema{Type: schemaType}}
+}
+
+// HeaderParameter returns an optional string header
+func HeaderParameter(name string, description string) Parameter {
+	return Parameter{Name: name, In: "header", Description: description, Schema: &Schema{Type: "string"}}
+}
+
+var pathParameter = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+// Generate returns the document describing the routes
+func Generate(info Info, routes []Route) *Document {
+	generator := newSchemas()
+	document := &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   map[string]PathItem{},
+	}
+
+	for _, route := range routes {
+		path := pathParameter.ReplaceAllString(route.Path, "{$1}")
+		item, ok := document.Paths[path]
+		if !ok {
+			item = PathItem{}
+			document.Paths[path] = item
+		}
+
+		operation := &Operation{
+			OperationId: route.OperationId,
+			Summary:     route.Summary,
+			Description: route.Description,
+			Tags:        route.Tags,
+			Deprecated:  route.Deprecated,
+			Responses:   map[string]*ResponseObject{},
+		}
+		for _, match := range pathParameter.FindAllStringSubmatch(route.Path, -1) {
+			operation.Parameters = append(operation.Parameters, Parameter{Name: match[1], In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		}
+		operation.Parameters = append(operation.Parameters, route.Query...)
+		operation.Parameters = append(operation.Parameters, route.Headers...)
+
+		if route.RequestBody != nil {
+			operation.RequestBody = &RequestBody{
+				Required: route.RequestBody.Required,
+				Content:  map[string]*MediaType{contentType(*route.RequestBody): {Schema: generator.Of(route.RequestBody.Value)}},
+			}
+		}
+
+		for _, response := range route.Responses {
+			object := &ResponseObject{Description: response.Description}
+			if object.Description == "" {
+				object.Description = http.StatusText(response.Status)
+			}
+			for _, body := range response.Bodies {
+				if object.Content == nil {
+					object.Content = map[string]*MediaType{}
+				}
+				object.Content[contentType(body)] = &MediaType{Schema: generator.Of(body.Value)}
+			}
+			for _, header := range response.Headers {
+				if object.Headers == nil {
+					object.Headers = map[string]*Header{}
+				}
+				object.Headers[header.Name] = &Header{Description: header.Description, Schema: header.Schema}
+			}
+			operation.Responses[strconv.Itoa(response.Status)] = object
+		}
+		item[strings.ToLower(route.Method)] = operation
+	}
+
+	document.Components.Schemas = generator.components
+	return document
+}
+
+func contentType(body Body) string {
+	if body.ContentType == "" {
+		return MediaTypeJSON
+	}
+	return body.ContentType
+}
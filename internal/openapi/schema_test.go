@@ -0,0 +1,53 @@
+package openapi
+
+import (
+	"testing"
+	"time"
+)
+
+type embedded struct {
+	Inline string `json:"inline"`
+}
+
+type node struct {
+	embedded `json:",inline"`
+	Name     string            `json:"name"`
+	Optional *string           `json:"optional"`
+	Children []*node           `json:"children,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Created  time.Time         `json:"created"`
+	Ignored  string            `json:"-"`
+	hidden   string
+}
+
+func TestSchema(t *testing.T) {
+	s := newSchemas()
+	root := s.Of([]node{})
+	if root.Type != "array" || root.Items.Ref != "#/components/schemas/node" {
+		t.Fatalf("unexpected schema %+v", root)
+	}
+
+	component := s.components["node"]
+	for _, name := range []string{"inline", "name", "optional", "children", "labels", "created"} {
+		if _, ok := component.Properties[name]; !ok {
+			t.Errorf("property %s missing", name)
+		}
+	}
+	if len(component.Properties) != 6 {
+		t.Errorf("expected 6 properties, got %d", len(component.Properties))
+	}
+	if children := component.Properties["children"]; children.Items.Ref != "#/components/schemas/node" {
+		t.Errorf("recursive property not referenced: %+v", children)
+	}
+	if created := component.Properties["created"]; created.Format != "date-time" {
+		t.Errorf("time not generated as date-time: %+v", created)
+	}
+
+	required := map[string]bool{}
+	for _, name := range component.Required {
+		required[name] = true
+	}
+	if !required["inline"] || !required["name"] || required["optional"] || required["children"] {
+		t.Errorf("unexpected required properties %v", component.Required)
+	}
+}
@@ -0,0 +1,160 @@
+// Package ratelimit limits the requests to the HTTP API per client and globally, with token buckets.
+// The routes are grouped in classes with their own limits, see Class.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Class is a group of routes sharing the same limits
+type Class string
+
+const (
+	// ClassRead are the routes reading the resource trees, creating them on a cache miss
+	ClassRead Class = "read"
+	// ClassRefresh are the routes rebuilding the resource trees
+	ClassRefresh Class = "refresh"
+	// ClassEvents is the route of the events of the eventrouter
+	ClassEvents Class = "events"
+)
+
+// Classes are all the classes of routes
+var Classes = []Class{ClassRead, ClassRefresh, ClassEvents}
+
+const (
+	// Clients idle for clientIdle are forgotten, checked at most every sweepInterval
+	clientIdle    = 10 * time.Minute
+	sweepInterval = time.Minute
+)
+
+// Limit is a rate of requests per second with a burst, disabled if Rate is 0
+type Limit struct {
+	Rate  float64 `json:"rate" yaml:"rate"`
+	Burst int     `json:"burst" yaml:"burst"`
+}
+
+// ParseLimit parses "<requests per second>[:<burst>]", the burst is the rate rounded up if missing.
+// An empty value, or 0, disables the limit.
+func ParseLimit(value string) (Limit, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return Limit{}, nil
+	}
+	rateValue, burstValue, hasBurst := strings.Cut(value, ":")
+	limit := Limit{}
+	var err error
+	if limit.Rate, err = strconv.ParseFloat(rateValue, 64); err != nil || limit.Rate < 0 || math.IsInf(limit.Rate, 0) || math.IsNaN(limit.Rate) {
+		return Limit{}, fmt.Errorf("invalid rate %q, expected a non-negative number of requests per second", rateValue)
+	}
+	limit.Burst = max(int(math.Ceil(limit.Rate)), 1)
+	if hasBurst {
+		if limit.Burst, err = strconv.Atoi(burstValue); err != nil || limit.Burst < 1 {
+			return Limit{}, fmt.Errorf("invalid burst %q, expected a positive integer", burstValue)
+		}
+	}
+	if limit.Rate == 0 {
+		return Limit{}, nil
+	}
+	return limit, nil
+}
+
+func (l Limit) Enabled() bool {
+	return l.Rate > 0
+}
+
+func (l Limit) String() string {
+	if !l.Enabled() {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%g/s, burst %d", l.Rate, l.Burst)
+}
+
+// Limits are the limits of a class of routes
+type Limits struct {
+	// Client is the limit of each client
+	Client Limit `json:"client" yaml:"client"`
+	// Global is the limit of all the clients together
+	Global Limit `json:"global" yaml:"global"`
+}
+
+func (l Limits) Enabled() bool {
+	return l.Client.Enabled() || l.Global.Enabled()
+}
+
+// Limiter applies the Limits of a class of routes
+type Limiter struct {
+	limits Limits
+	global *rate.Limiter
+
+	mu      sync.Mutex
+	clients map[string]*client
+	swept   time.Time
+}
+
+type client struct {
+	limiter *rate.Limiter
+	seen    time.Time
+}
+
+func NewLimiter(limits Limits) *Limiter {
+	limiter := &Limiter{limits: limits, clients: map[string]*client{}, swept: time.Now()}
+	if limits.Global.Enabled() {
+		limiter.global = rate.NewLimiter(rate.Limit(limits.Global.Rate), limits.Global.Burst)
+	}
+	return limiter
+}
+
+// Allow reports whether a request of the client is allowed now, otherwise after how long it may be retried.
+// Denied requests do not consume the tokens of the other limit.
+func (l *Limiter) Allow(clientId string) (bool, time.Duration) {
+	now := time.Now()
+	limiters := []*rate.Limiter{}
+	if l.limits.Client.Enabled() {
+		limiters = append(limiters, l.clientLimiter(clientId, now))
+	}
+	if l.global != nil {
+		limiters = append(limiters, l.global)
+	}
+
+	reservations := make([]*rate.Reservation, 0, len(limiters))
+	for _, limiter := range limiters {
+		reservation := limiter.ReserveN(now, 1)
+		if delay := reservation.DelayFrom(now); delay > 0 {
+			reservation.CancelAt(now)
+			for _, previous := range reservations {
+				previous.CancelAt(now)
+			}
+			return false, delay
+		}
+		reservations = append(reservations, reservation)
+	}
+	return true, 0
+}
+
+// clientLimiter returns the limiter of the client, forgetting the idle clients from time to time
+func (l *Limiter) clientLimiter(clientId string, now time.Time) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.swept) > sweepInterval {
+		for id, client := range l.clients {
+			if now.Sub(client.seen) > clientIdle {
+				delete(l.clients, id)
+			}
+		}
+		l.swept = now
+	}
+	entry, ok := l.clients[clientId]
+	if !ok {
+		entry = &client{limiter: rate.NewLimiter(rate.Limit(l.limits.Client.Rate), l.limits.Client.Burst)}
+		l.clients[clientId] = entry
+	}
+	entry.seen = now
+	return entry.limiter
+}
@@ -0,0 +1,48 @@
+package ratelimit
+
+import (
+	"testing"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value string
+		limit Limit
+		valid bool
+	}{
+		{"", Limit{}, true},
+		{"0", Limit{}, true},
+		{"10", Limit{Rate: 10, Burst: 10}, true},
+		{"0.5", Limit{Rate: 0.5, Burst: 1}, true},
+		{"2:20", Limit{Rate: 2, Burst: 20}, true},
+		{"-1", Limit{}, false},
+		{"fast", Limit{}, false},
+		{"2:0", Limit{}, false},
+	}
+	for _, tt := range tests {
+		limit, err := ParseLimit(tt.value)
+		if (err == nil) != tt.valid || limit != tt.limit {
+			t.Errorf("%q: expected %+v, got %+v, %v", tt.value, tt.limit, limit, err)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	limiter := NewLimiter(Limits{Client: Limit{Rate: 0.001, Burst: 2}, Global: Limit{Rate: 0.001, Burst: 3}})
+	for i, expected := range []bool{true, true, false} {
+		if allowed, delay := limiter.Allow("a"); allowed != expected || (!allowed && delay <= 0) {
+			t.Errorf("request %d of a: expected %t, got %t after %s", i, expected, allowed, delay)
+		}
+	}
+	// The requests denied to a did not consume the global tokens
+	if allowed, _ := limiter.Allow("b"); !allowed {
+		t.Error("expected the first request of b to be allowed")
+	}
+	if allowed, _ := limiter.Allow("c"); allowed {
+		t.Error("expected the global limit to deny c")
+	}
+	// The request denied by the global limit did not consume the tokens of c
+	if tokens := limiter.clients["c"].limiter.Tokens(); tokens < 1.9 {
+		t.Errorf("expected c to keep its tokens, got %f", tokens)
+	}
+}
@@ -2,6 +2,7 @@ package ssemanager
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -17,7 +18,9 @@ import (
 	cachehelper "resource-tree-handler/internal/cache"
 	kubehelper "resource-tree-handler/internal/helpers/kube/client"
 	filtershelper "resource-tree-handler/internal/helpers/kube/filters"
+	schemahelper "resource-tree-handler/internal/helpers/kube/schema"
 	resourcetreehelper "resource-tree-handler/internal/helpers/resourcetree"
+	"resource-tree-handler/internal/metrics"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -36,13 +39,32 @@ type SSE struct {
 	isConnected   bool
 	isConnectedMu sync.RWMutex // Mutex for thread-safe access to isConnected
 	ctx           context.Context
+
+	// TLSConfig of the connections to eventsse, the default one if nil
+	TLSConfig *tls.Config
+
+	// Retry is the reconnection policy, DefaultRetryPolicy if zero
+	Retry RetryPolicy
+	// WaitTimeout is the maximum wait of an event for the resource tree of its composition, DefaultWaitTimeout if 0
+	WaitTimeout time.Duration
 }
 
-const (
-	initialRetryDelay = 1 * time.Second
-	maxRetryDelay     = 30 * time.Second
-	maxRetryAttempts  = 10
-)
+// RetryPolicy is the exponential backoff of the reconnections to eventsse
+type RetryPolicy struct {
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	// MaxAttempts is the number of failed reconnections in a row before giving up, never if 0
+	MaxAttempts int
+}
+
+// DefaultRetryPolicy gives up after about 4 minutes
+var DefaultRetryPolicy = RetryPolicy{
+	InitialDelay: 1 * time.Second,
+	MaxDelay:     30 * time.Second,
+	MaxAttempts:  10,
+}
+
+const DefaultWaitTimeout = 30 * time.Second
 
 func (r *SSE) Spinup(endpoint string) {
 	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, endpoint, http.NoBody)
@@ -50,11 +72,25 @@ func (r *SSE) Spinup(endpoint string) {
 		log.Error().Err(err).Msg("error while initializing request with http package")
 	}
 	r.ctx = context.Background()
-	r.connection = sse.DefaultClient.NewConnection(req)
+	if r.Retry == (RetryPolicy{}) {
+		r.Retry = DefaultRetryPolicy
+	}
+	if r.WaitTimeout <= 0 {
+		r.WaitTimeout = DefaultWaitTimeout
+	}
+	client := sse.DefaultClient
+	if r.TLSConfig != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = r.TLSConfig
+		// The unset fields are taken from the default client
+		client = &sse.Client{HTTPClient: &http.Client{Transport: transport}}
+	}
+	r.connection = client.NewConnection(req)
 	r.setConnected(false)
 	go r.maintainConnection()
 
 	r.unsubscribe = make(map[string]sse.EventCallbackRemover)
+	go r.unsubscribeEvicted()
 	logger_instance := log.Output(zerolog.ConsoleWriter{Out: os.Stderr}).With().Str("Client", "SSE Spinup").Logger()
 	logger_instance.Debug().Msg("End of spinup")
 }
@@ -74,15 +110,16 @@ func (r *SSE) maintainConnection() {
 			}
 
 			retryAttempt++
-			if retryAttempt > maxRetryAttempts {
-				logger_instance.Error().Err(fmt.Errorf("maximum number of retry attempts (%d) reached, stopping reconnection attempts", maxRetryAttempts)).Msg("the resource tree will NOT be updated with managed resources' events, use the /refresh endpoint manually to update the resource tree or restart the service")
+			if r.Retry.MaxAttempts > 0 && retryAttempt > r.Retry.MaxAttempts {
+				logger_instance.Error().Err(fmt.Errorf("maximum number of retry attempts (%d) reached, stopping reconnection attempts", r.Retry.MaxAttempts)).Msg("the resource tree will NOT be updated with managed resources' events, use the /refresh endpoint manually to update the resource tree or restart the service")
 				return
 			}
+			metrics.SSEReconnects.Inc()
 
 			// Calculate delay with exponential backoff
 			delay := time.Duration(math.Min(
-				float64(initialRetryDelay)*math.Pow(2, float64(retryAttempt-1)),
-				float64(maxRetryDelay),
+				float64(r.Retry.InitialDelay)*math.Pow(2, float64(retryAttempt-1)),
+				float64(r.Retry.MaxDelay),
 			))
 
 			logger_instance.Warn().Err(err).Msgf("Connection attempt %d failed. Retrying in %v...", retryAttempt, delay)
@@ -110,7 +147,8 @@ func (r *SSE) SubscribeTo(compositionId string) {
 	log.Info().Msgf("Subscribing to notificaitons for compositionId %s", compositionId)
 
 	callback := func(event sse.Event) {
-		sseEventHandlerFunction(event, r.Config, r.Cache)
+		metrics.SSEEvents.WithLabelValues(compositionId).Inc()
+		sseEventHandlerFunction(event, r.Config, r.Cache, r.WaitTimeout)
 	}
 
 	if !r.IsConnected() {
@@ -131,9 +169,25 @@ func (r *SSE) UnsubscribeFrom(compositionId string) {
 		delete(r.unsubscribe, compositionId)
 	}
 	r.unsubscribeMu.Unlock()
+	metrics.SSEEvents.DeleteLabelValues(compositionId)
+}
+
+// unsubscribeEvicted stops receiving events for the compositions evicted from the cache,
+// the subscription is created again when the resource tree is rebuilt
+func (r *SSE) unsubscribeEvicted() {
+	for r.ctx.Err() == nil {
+		for event := range r.Cache.Store().Watch(r.ctx) {
+			if event.Type == cachehelper.EventEvicted {
+				r.UnsubscribeFrom(event.CompositionId)
+			}
+		}
+		if r.ctx.Err() == nil {
+			log.Warn().Msg("Cache watch dropped, evictions may have been missed")
+		}
+	}
 }
 
-func sseEventHandlerFunction(eventObj sse.Event, config *rest.Config, cacheObj *cachehelper.ThreadSafeCache) {
+func sseEventHandlerFunction(eventObj sse.Event, config *rest.Config, cacheObj *cachehelper.ThreadSafeCache, waitTimeout time.Duration) {
 	logger := log.Output(zerolog.ConsoleWriter{Out: os.Stderr}).With().Str("Client", "SSE Connection Checker").Logger()
 	logger.Info().Msgf("Function callback for event %s", eventObj.LastEventID)
 
@@ -159,8 +213,8 @@ func sseEventHandlerFunction(eventObj sse.Event, config *rest.Config, cacheObj *
 		return
 	}
 	labels := objectUnstructured.GetLabels()
-	if compositionId, ok := labels["krateo.io/composition-id"]; ok {
-		resourceTree, ok, discarded := cacheObj.GetResourceTreeFromCacheWithTimeout(compositionId, string(event.InvolvedObject.UID), 30*time.Second)
+	if compositionId, ok := labels[schemahelper.Get().Labels.Id]; ok {
+		resourceTree, ok, discarded := cacheObj.GetResourceTreeFromCacheWithTimeout(compositionId, string(event.InvolvedObject.UID), waitTimeout)
 		if !ok {
 			logger.Error().Msgf("timeout waiting for resource tree for compositionId: %s", compositionId)
 			return
@@ -202,4 +256,9 @@ func (r *SSE) setConnected(connected bool) {
 	r.isConnectedMu.Lock()
 	defer r.isConnectedMu.Unlock()
 	r.isConnected = connected
+	if connected {
+		metrics.SSEConnected.Set(1)
+	} else {
+		metrics.SSEConnected.Set(0)
+	}
 }
@@ -0,0 +1,237 @@
+// Package streaming turns the changes of the cached resource trees into a stream of revisioned events,
+// so that clients can follow a resource tree without polling it.
+package streaming
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	types "resource-tree-handler/apis"
+	cachehelper "resource-tree-handler/internal/cache"
+	resourcetreehelper "resource-tree-handler/internal/helpers/resourcetree"
+)
+
+const (
+	// Number of events kept to resume the streams after a reconnection
+	historySize = 1000
+	// Number of events buffered for each subscriber, slower subscribers are disconnected
+	subscriberBufferSize = 256
+)
+
+// EventType is the type of a stream event
+type EventType string
+
+const (
+	// EventSnapshot contains all the nodes of a resource tree
+	EventSnapshot          EventType = "snapshot"
+	EventNodeAdded         EventType = "nodeAdded"
+	EventNodeUpdated       EventType = "nodeUpdated"
+	EventNodeRemoved       EventType = "nodeRemoved"
+	EventRootStatusChanged EventType = "rootStatusChanged"
+	// EventCompositionDeleted is sent when the composition is deleted and its resource tree removed
+	EventCompositionDeleted EventType = "compositionDeleted"
+)
+
+// Event is a change of a resource tree. Revisions are shared by all the compositions, and increase monotonically.
+type Event struct {
+	Revision      uint64    `json:"revision"`
+	Type          EventType `json:"type"`
+	CompositionId string    `json:"compositionId"`
+	// TreeRevision is the revision of the resource tree after the event, see cache.ResourceTreeUpdate.Revision
+	TreeRevision uint64                      `json:"treeRevision,omitempty"`
+	Node         *types.ResourceNodeStatus   `json:"node,omitempty"`
+	Nodes        []*types.ResourceNodeStatus `json:"nodes,omitempty"`
+}
+
+// Hub receives the changes of the cache and fans them out to the subscribers.
+type Hub struct {
+	cache *cachehelper.ThreadSafeCache
+
+	mu          sync.Mutex
+	revision    uint64
+	history     []Event
+	subscribers map[*Subscription]struct{}
+}
+
+func NewHub(cache *cachehelper.ThreadSafeCache) *Hub {
+	return &Hub{
+		cache:       cache,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Start watches the cache and converts its changes into events until ctx is done, it does not block
+func (h *Hub) Start(ctx context.Context) {
+	changes := h.cache.Store().Watch(ctx)
+	go func() {
+		for {
+			for change := range changes {
+				h.publish(eventsFor(change))
+			}
+			h.reset()
+			if ctx.Err() != nil {
+				return
+			}
+			// The watch was dropped and some changes were lost, the subscribers start again from a snapshot
+			log.Warn().Msg("Cache watch dropped, restarting the streams from a snapshot")
+			changes = h.cache.Store().Watch(ctx)
+		}
+	}()
+}
+
+// reset closes all the subscriptions and forgets the history, so that they cannot resume from an earlier revision
+func (h *Hub) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for subscription := range h.subscribers {
+		h.closeSubscription(subscription)
+	}
+	h.history = nil
+	h.revision++
+}
+
+// Revision returns the revision of the last event
+func (h *Hub) Revision() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.revision
+}
+
+func eventsFor(change cachehelper.WatchEvent) []Event {
+	switch change.Type {
+	case cachehelper.EventAdded:
+		return []Event{{Type: EventSnapshot, CompositionId: change.CompositionId, TreeRevision: change.Entry.Revision, Nodes: cachehelper.FilterResourceTree(change.Entry)}}
+	case cachehelper.EventDeleted:
+		return []Event{{Type: EventCompositionDeleted, CompositionId: change.CompositionId}}
+	case cachehelper.EventUpdated:
+		events := []Event{}
+		for _, nodeChange := range resourcetreehelper.Diff(cachehelper.FilterResourceTree(change.Previous), cachehelper.FilterResourceTree(change.Entry)) {
+			switch nodeChange.Type {
+			case resourcetreehelper.NodeAdded:
+				events = append(events, Event{Type: EventNodeAdded, CompositionId: change.CompositionId, TreeRevision: change.Entry.Revision, Node: nodeChange.Node})
+			case resourcetreehelper.NodeUpdated:
+				events = append(events, Event{Type: EventNodeUpdated, CompositionId: change.CompositionId, TreeRevision: change.Entry.Revision, Node: nodeChange.Node})
+			case resourcetreehelper.NodeRemoved:
+				events = append(events, Event{Type: EventNodeRemoved, CompositionId: change.CompositionId, TreeRevision: change.Entry.Revision, Node: nodeChange.Previous})
+			}
+		}
+		previousRoot, root := change.Previous.ResourceTree.RootElementStatus, change.Entry.ResourceTree.RootElementStatus
+		if root != nil && (previousRoot == nil || resourcetreehelper.HealthChanged(previousRoot, root)) {
+			events = append(events, Event{Type: EventRootStatusChanged, CompositionId: change.CompositionId, TreeRevision: change.Entry.Revision, Node: root})
+		}
+		return events
+	}
+	// Evicted resource trees did not change, they are sent again as a snapshot when rebuilt
+	return nil
+}
+
+func (h *Hub) publish(events []Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, event := range events {
+		h.revision++
+		event.Revision = h.revision
+		h.history = append(h.history, event)
+		if len(h.history) > historySize {
+			h.history[0] = Event{}
+			h.history = h.history[1:]
+		}
+		for subscription := range h.subscribers {
+			subscription.send(h, event)
+		}
+	}
+}
+
+// Subscription receives the events of one composition, or of all compositions.
+// The channel is closed when the subscription is cancelled, or when the subscriber is too slow:
+// in that case the client should resume from the last revision received.
+type Subscription struct {
+	compositionId string
+	events        chan Event
+	closed        bool
+}
+
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// send must be called while holding h.mu
+func (s *Subscription) send(h *Hub, event Event) {
+	if s.compositionId != "" && s.compositionId != event.CompositionId {
+		return
+	}
+	select {
+	case s.events <- event:
+	default:
+		log.Warn().Msgf("Stream subscriber for composition id '%s' too slow, disconnecting at revision %d", s.compositionId, event.Revision)
+		h.closeSubscription(s)
+	}
+}
+
+// Subscribe starts a subscription for compositionId, or for all compositions if compositionId is empty.
+// If sinceRevision is not 0 and the following events are still available, they are replayed; otherwise,
+// a snapshot of the cached resource trees is sent first. Events after a snapshot may repeat changes
+// already included in it, clients should apply nodeAdded and nodeUpdated as upserts.
+func (h *Hub) Subscribe(compositionId string, sinceRevision uint64) *Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	initial := []Event{}
+	if sinceRevision > 0 && h.canResumeFrom(sinceRevision) {
+		for _, event := range h.history {
+			if event.Revision > sinceRevision && (compositionId == "" || event.CompositionId == compositionId) {
+				initial = append(initial, event)
+			}
+		}
+	} else {
+		compositionIds := []string{compositionId}
+		if compositionId == "" {
+			compositionIds = h.cache.ListKeysFromCache()
+		}
+		for _, id := range compositionIds {
+			if resourceTreeUpdate, ok := h.cache.GetResourceTreeFromCache(id); ok {
+				initial = append(initial, Event{Revision: h.revision, Type: EventSnapshot, CompositionId: id, TreeRevision: resourceTreeUpdate.Revision, Nodes: cachehelper.FilterResourceTree(resourceTreeUpdate)})
+			}
+		}
+	}
+
+	subscription := &Subscription{
+		compositionId: compositionId,
+		events:        make(chan Event, len(initial)+subscriberBufferSize),
+	}
+	for _, event := range initial {
+		subscription.events <- event
+	}
+	h.subscribers[subscription] = struct{}{}
+	return subscription
+}
+
+// canResumeFrom must be called while holding h.mu
+func (h *Hub) canResumeFrom(revision uint64) bool {
+	if revision > h.revision {
+		return false
+	}
+	if len(h.history) == 0 {
+		return revision == h.revision
+	}
+	return revision+1 >= h.history[0].Revision
+}
+
+// Unsubscribe cancels the subscription and closes its channel
+func (h *Hub) Unsubscribe(subscription *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closeSubscription(subscription)
+}
+
+// closeSubscription must be called while holding h.mu
+func (h *Hub) closeSubscription(subscription *Subscription) {
+	if subscription.closed {
+		return
+	}
+	subscription.closed = true
+	delete(h.subscribers, subscription)
+	close(subscription.events)
+}
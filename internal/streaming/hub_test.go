@@ -0,0 +1,119 @@
+package streaming
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	types "resource-tree-handler/apis"
+	cachehelper "resource-tree-handler/internal/cache"
+	"resource-tree-handler/internal/cache/cachetest"
+)
+
+func TestMain(m *testing.M) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	os.Exit(m.Run())
+}
+
+func receive(t *testing.T, subscription *Subscription) Event {
+	t.Helper()
+	select {
+	case event, ok := <-subscription.Events():
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for event")
+	}
+	return Event{}
+}
+
+// waitRevision waits until the hub processed the given number of events
+func waitRevision(t *testing.T, hub *Hub, revision uint64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for hub.Revision() < revision {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for revision %d", revision)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHub(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := cachehelper.NewThreadSafeCache()
+	hub := NewHub(cache)
+	hub.Start(ctx)
+
+	entry := cachetest.NewEntry("a")
+	entry.Filters = types.Filters{}
+
+	all := hub.Subscribe("", 0)
+	cache.AddToCache(entry.ResourceTree, "a", entry.CompositionReference, entry.Filters)
+
+	event := receive(t, all)
+	if event.Type != EventSnapshot || event.CompositionId != "a" || len(event.Nodes) != 2 || event.Revision != 1 {
+		t.Fatalf("unexpected snapshot %+v", event)
+	}
+
+	err := cache.QueueUpdate("a", func(update *cachehelper.ResourceTreeUpdate) error {
+		update.ResourceTree.Resources.Status[1].Health.Status = "False"
+		update.ResourceTree.RootElementStatus.Health.Status = "False"
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The root element is also the first node of the status
+	expected := []EventType{EventNodeUpdated, EventNodeUpdated, EventRootStatusChanged}
+	for i, eventType := range expected {
+		event = receive(t, all)
+		if event.Type != eventType || event.Revision != uint64(i+2) {
+			t.Fatalf("expected %s with revision %d, got %+v", eventType, i+2, event)
+		}
+	}
+
+	// A new subscription for the composition starts from a snapshot
+	single := hub.Subscribe("a", 0)
+	event = receive(t, single)
+	if event.Type != EventSnapshot || event.Revision != 4 || event.Nodes[1].Health.Status != "False" {
+		t.Fatalf("unexpected snapshot %+v", event)
+	}
+
+	// Resuming replays the events after the revision
+	resumed := hub.Subscribe("a", 2)
+	for _, revision := range []uint64{3, 4} {
+		if event = receive(t, resumed); event.Revision != revision {
+			t.Fatalf("expected revision %d, got %+v", revision, event)
+		}
+	}
+
+	cache.DeleteFromCache("a")
+	waitRevision(t, hub, 5)
+	for _, subscription := range []*Subscription{all, single, resumed} {
+		if event = receive(t, subscription); event.Type != EventCompositionDeleted || event.Revision != 5 {
+			t.Fatalf("unexpected event %+v", event)
+		}
+	}
+
+	// A revision from the future (e.g., before a restart) falls back to a snapshot
+	cache.AddToCache(entry.ResourceTree, "b", entry.CompositionReference, entry.Filters)
+	waitRevision(t, hub, 6)
+	future := hub.Subscribe("b", 100)
+	if event = receive(t, future); event.Type != EventSnapshot || event.CompositionId != "b" {
+		t.Fatalf("unexpected event %+v", event)
+	}
+
+	hub.Unsubscribe(future)
+	if _, ok := <-future.Events(); ok {
+		t.Fatal("subscription not closed")
+	}
+}
@@ -0,0 +1,76 @@
+package webservice
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	resourcetreehelper "resource-tree-handler/internal/helpers/resourcetree"
+)
+
+// ErrorCode identifies the kind of error in the ErrorResponse, so that clients do not have to parse the messages
+type ErrorCode string
+
+const (
+	ErrorCodeBadRequest     ErrorCode = "BAD_REQUEST"
+	ErrorCodeNotFound       ErrorCode = "NOT_FOUND"
+	ErrorCodeBusy           ErrorCode = "BUSY"
+	ErrorCodeInternal       ErrorCode = "INTERNAL"
+	ErrorCodeNotImplemented ErrorCode = "NOT_IMPLEMENTED"
+	ErrorCodeRouteNotFound  ErrorCode = "ROUTE_NOT_FOUND"
+	ErrorCodeAmbiguous      ErrorCode = "AMBIGUOUS"
+	ErrorCodeUnauthorized   ErrorCode = "UNAUTHORIZED"
+	ErrorCodeForbidden      ErrorCode = "FORBIDDEN"
+	ErrorCodeRateLimited    ErrorCode = "RATE_LIMITED"
+	ErrorCodeTooLarge       ErrorCode = "PAYLOAD_TOO_LARGE"
+)
+
+// ErrorResponse is the body of every error response
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+type ErrorDetail struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+// StatusResponse is the body of the home endpoint
+type StatusResponse struct {
+	Status string `json:"status"`
+}
+
+// MessageResponse is the body of the successful responses without data, e.g., a job was queued
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// LegacyListResponse is the body of the legacy list endpoint, the composition ids are separated by spaces
+type LegacyListResponse struct {
+	CompositionIds string `json:"composition_ids"`
+}
+
+// ResyncStatsResponse reports the background resync, see resyncStats
+type ResyncStatsResponse struct {
+	Period       string                                   `json:"period"`
+	Jitter       string                                   `json:"jitter"`
+	Cycles       uint64                                   `json:"cycles"`
+	Enqueued     uint64                                   `json:"enqueued"`
+	Skipped      uint64                                   `json:"skipped"`
+	Resynced     uint64                                   `json:"resynced"`
+	Drifted      uint64                                   `json:"drifted"`
+	DriftedNodes map[resourcetreehelper.ChangeType]uint64 `json:"driftedNodes"`
+	LastCycle    time.Time                                `json:"lastCycle"`
+	LastDrift    time.Time                                `json:"lastDrift"`
+}
+
+// writeError aborts the request with the error envelope
+func writeError(c *gin.Context, status int, code ErrorCode, format string, args ...any) {
+	c.AbortWithStatusJSON(status, ErrorResponse{Error: ErrorDetail{Code: code, Message: fmt.Sprintf(format, args...)}})
+}
+
+func handleRouteNotFound(c *gin.Context) {
+	writeError(c, http.StatusNotFound, ErrorCodeRouteNotFound, "no route for %s %s", c.Request.Method, c.Request.URL.Path)
+}
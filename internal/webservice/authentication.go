@@ -0,0 +1,66 @@
+package webservice
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"resource-tree-handler/internal/auth"
+)
+
+// userContextKey is the key of the authenticated user in the gin context
+const userContextKey = "resource-tree-handler/user"
+
+// authenticate returns the middleware checking the requests against the read or write requirement.
+// The user is stored in the context for the handlers, see userFrom.
+func (r *Webservice) authenticate(write bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requirement := r.ReadRequirement
+		if write {
+			requirement = r.WriteRequirement
+		}
+		if requirement.Anonymous() {
+			return
+		}
+
+		var user *auth.User
+		token, ok := bearerToken(c.GetHeader("Authorization"))
+		err := fmt.Errorf("%w: missing bearer token", auth.ErrUnauthenticated)
+		if ok {
+			user, err = r.Authenticators.Authenticate(c.Request.Context(), token, requirement)
+		}
+		switch {
+		case errors.Is(err, auth.ErrForbidden):
+			log.Warn().Msgf("%s %s: %s", c.Request.Method, c.Request.URL.Path, err)
+			writeError(c, http.StatusForbidden, ErrorCodeForbidden, "%s", err)
+			return
+		case err != nil:
+			log.Debug().Msgf("%s %s: %s", c.Request.Method, c.Request.URL.Path, err)
+			c.Header("WWW-Authenticate", `Bearer realm="`+apiTitle+`"`)
+			writeError(c, http.StatusUnauthorized, ErrorCodeUnauthorized, "%s", err)
+			return
+		}
+		c.Set(userContextKey, user)
+	}
+}
+
+// bearerToken returns the token of an Authorization header with the Bearer scheme, the scheme is case-insensitive.
+// Other schemes, e.g., Basic, and bare tokens are not accepted.
+func bearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// userFrom returns the authenticated user of the request, nil for anonymous requests
+func userFrom(c *gin.Context) *auth.User {
+	user, _ := c.Value(userContextKey).(*auth.User)
+	return user
+}
@@ -0,0 +1,66 @@
+package webservice
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"resource-tree-handler/internal/auth"
+)
+
+// tokenAuthenticator authenticates the token "<name>" as the user <name>
+type tokenAuthenticator struct{}
+
+func (tokenAuthenticator) Method() auth.Method { return auth.MethodStatic }
+
+func (tokenAuthenticator) Authenticate(_ context.Context, token string) (*auth.User, error) {
+	return &auth.User{Name: token, Method: auth.MethodStatic}, nil
+}
+
+func TestAuthenticate(t *testing.T) {
+	engine, r := testEngine()
+	r.Authenticators = auth.Authenticators{tokenAuthenticator{}}
+	r.ReadRequirement = auth.Requirement{Methods: []auth.Method{auth.MethodStatic}}
+	r.WriteRequirement = auth.Requirement{Methods: []auth.Method{auth.MethodStatic}, Subjects: []string{"eventrouter"}}
+
+	tests := []struct {
+		method string
+		path   string
+		token  string
+		status int
+		// header replaces the Authorization header with the token
+		header string
+	}{
+		{http.MethodGet, homeEndpoint, "", http.StatusOK, ""},
+		{http.MethodGet, apiV1Prefix + compositionsEndpoint, "", http.StatusUnauthorized, ""},
+		{http.MethodGet, apiV1Prefix + compositionsEndpoint, "frontend", http.StatusOK, ""},
+		{http.MethodGet, apiV1Prefix + compositionsEndpoint, "", http.StatusOK, "bearer frontend"},
+		// Only the Bearer scheme is accepted, the other schemes and the bare tokens are never passed to the authenticators
+		{http.MethodGet, apiV1Prefix + compositionsEndpoint, "", http.StatusUnauthorized, "Basic frontend"},
+		{http.MethodGet, apiV1Prefix + compositionsEndpoint, "", http.StatusUnauthorized, "frontend"},
+		{http.MethodGet, apiV1Prefix + compositionsEndpoint, "", http.StatusUnauthorized, "Bearer "},
+		{http.MethodGet, legacyListEndpoint, "", http.StatusUnauthorized, ""},
+		{http.MethodPost, apiV1Prefix + eventsEndpoint, "frontend", http.StatusForbidden, ""},
+		{http.MethodPost, legacyAllEventsEndpoint, "", http.StatusUnauthorized, ""},
+		// Authenticated, then rejected for the missing body
+		{http.MethodPost, apiV1Prefix + eventsEndpoint, "eventrouter", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		request := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.token != "" {
+			request.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		if tt.header != "" {
+			request.Header.Set("Authorization", tt.header)
+		}
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, request)
+		if recorder.Code != tt.status {
+			t.Errorf("%s %s with token %q and header %q: expected status %d, got %d", tt.method, tt.path, tt.token, tt.header, tt.status, recorder.Code)
+		}
+		if recorder.Code == http.StatusUnauthorized && recorder.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s %s: WWW-Authenticate header missing", tt.method, tt.path)
+		}
+	}
+}
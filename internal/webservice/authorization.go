@@ -0,0 +1,199 @@
+package webservice
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	types "resource-tree-handler/apis"
+	"resource-tree-handler/internal/auth"
+	cachehelper "resource-tree-handler/internal/cache"
+	kubehelper "resource-tree-handler/internal/helpers/kube/client"
+	resourcetreehelper "resource-tree-handler/internal/helpers/resourcetree"
+	"resource-tree-handler/internal/streaming"
+)
+
+// redactedKind is the kind of the placeholders of the nodes the user cannot see
+const redactedKind = "Redacted"
+
+// nodeAuthorizer trims the resource trees to the nodes the user of a request can get in Kubernetes.
+// A nil nodeAuthorizer, i.e., redaction off or anonymous request, sees everything.
+type nodeAuthorizer struct {
+	ctx        context.Context
+	user       *auth.User
+	authorizer *auth.Authorizer
+	mode       auth.RedactionMode
+}
+
+// redacting reports whether the resource trees are trimmed to the permissions of the users
+func (r *Webservice) redacting() bool {
+	return r.Authorizer != nil && r.Redaction != "" && r.Redaction != auth.RedactionOff
+}
+
+// varyByUser marks the response as depending on the user, so that the caches never share it between users
+func (r *Webservice) varyByUser(c *gin.Context) {
+	if r.redacting() {
+		c.Header("Vary", "Authorization")
+	}
+}
+
+// nodeAuthorizer returns the authorizer of the user of the request, nil if the resource trees are not trimmed
+func (r *Webservice) nodeAuthorizer(c *gin.Context) *nodeAuthorizer {
+	user := userFrom(c)
+	if !r.redacting() || user == nil {
+		return nil
+	}
+	return &nodeAuthorizer{ctx: c.Request.Context(), user: user, authorizer: r.Authorizer, mode: r.Redaction}
+}
+
+// canGet reports whether the user can get the objects of the resource in the namespace
+func (a *nodeAuthorizer) canGet(apiVersion string, resource string, namespace string) bool {
+	if a == nil {
+		return true
+	}
+	gv, _ := schema.ParseGroupVersion(apiVersion)
+	return a.authorizer.CanGet(a.ctx, a.user, auth.Attributes{Group: gv.Group, Resource: resource, Namespace: namespace})
+}
+
+// canReadComposition reports whether the user can get the composition itself
+func (a *nodeAuthorizer) canReadComposition(reference types.Reference) bool {
+	if a == nil {
+		return true
+	}
+	resource := reference.Resource
+	if resource == "" {
+		resource = kubehelper.InferGroupResource(reference.ApiVersion, reference.Kind).Resource
+	}
+	return a.canGet(reference.ApiVersion, resource, reference.Namespace)
+}
+
+// canSee reports whether the user can get the object of a node, the resource is inferred from the kind if empty
+func (a *nodeAuthorizer) canSee(node *types.ResourceNodeStatus, resource string) bool {
+	if a == nil {
+		return true
+	}
+	if resource == "" {
+		resource = kubehelper.InferGroupResource(node.Version, node.Kind).Resource
+	}
+	return a.canGet(node.Version, resource, node.Namespace)
+}
+
+// filter returns the nodes the user can see, the others are replaced by placeholders or omitted according to
+// the redaction mode. The root of a resource tree is the composition, so it is hidden unless the user can get
+// the composition. The resources of the nodes are looked up in the spec of the entry, if any, or inferred.
+// The nodes are never modified, the ones with hidden parents are copied.
+func (a *nodeAuthorizer) filter(entry *cachehelper.ResourceTreeUpdate, nodes []*types.ResourceNodeStatus) []*types.ResourceNodeStatus {
+	if a == nil {
+		return nodes
+	}
+	return a.filterWith(a.mode, entry, nodes)
+}
+
+// visibleOnly returns the nodes the user can see, omitting the others whatever the redaction mode
+func (a *nodeAuthorizer) visibleOnly(entry *cachehelper.ResourceTreeUpdate, nodes []*types.ResourceNodeStatus) []*types.ResourceNodeStatus {
+	if a == nil {
+		return nodes
+	}
+	return a.filterWith(auth.RedactionOmit, entry, nodes)
+}
+
+func (a *nodeAuthorizer) filterWith(mode auth.RedactionMode, entry *cachehelper.ResourceTreeUpdate, nodes []*types.ResourceNodeStatus) []*types.ResourceNodeStatus {
+	// Nil for the nodes of the events, whose resources are inferred
+	var resources map[string]string
+	if entry != nil {
+		resources = specResources(entry)
+	}
+	visible := map[resourcetreehelper.NodeKey]bool{}
+	isVisible := func(node *types.ResourceNodeStatus) bool {
+		key := resourcetreehelper.KeyOf(node)
+		if result, ok := visible[key]; ok {
+			return result
+		}
+		visible[key] = a.canSee(node, resources[specKey(node)])
+		return visible[key]
+	}
+
+	result := make([]*types.ResourceNodeStatus, 0, len(nodes))
+	for _, node := range nodes {
+		if node == nil {
+			continue
+		}
+		if !isVisible(node) {
+			if mode != auth.RedactionOmit {
+				result = append(result, redactedNode(node))
+			}
+			continue
+		}
+		parents := make([]*types.ResourceNodeStatus, 0, len(node.ParentRefs))
+		changed := false
+		for _, parent := range node.ParentRefs {
+			if parent == nil || isVisible(parent) {
+				parents = append(parents, parent)
+				continue
+			}
+			changed = true
+			if mode != auth.RedactionOmit {
+				parents = append(parents, redactedNode(parent))
+			}
+		}
+		if changed {
+			copied := *node
+			copied.ParentRefs = parents
+			node = &copied
+		}
+		result = append(result, node)
+	}
+	return result
+}
+
+// filterEvent trims the nodes of an event, visible is false when the event must not be sent at all. The
+// compositions are reviewed once per stream, those deleted before their first event are not sent.
+func (a *nodeAuthorizer) filterEvent(cache *cachehelper.ThreadSafeCache, compositions map[string]bool, event streaming.Event) (streaming.Event, bool) {
+	if a == nil {
+		return event, true
+	}
+	visible, ok := compositions[event.CompositionId]
+	if !ok {
+		if entry, cached := cache.GetResourceTreeFromCache(event.CompositionId); cached {
+			visible = a.canReadComposition(entry.CompositionReference)
+		}
+		compositions[event.CompositionId] = visible
+	}
+	if !visible {
+		return event, false
+	}
+	event.Nodes = a.filter(nil, event.Nodes)
+	if event.Node != nil {
+		nodes := a.filter(nil, []*types.ResourceNodeStatus{event.Node})
+		if len(nodes) == 0 {
+			return event, false
+		}
+		event.Node = nodes[0]
+	}
+	return event, true
+}
+
+// redactedNode returns the placeholder of a node, with an opaque uid that is the same wherever the node
+// appears, so that the relations between the nodes are kept
+func redactedNode(node *types.ResourceNodeStatus) *types.ResourceNodeStatus {
+	hash := sha256.Sum256([]byte(node.Version + "/" + node.Kind + "/" + node.Namespace + "/" + node.Name))
+	id := "redacted-" + hex.EncodeToString(hash[:8])
+	return &types.ResourceNodeStatus{ResourceRefStatus: types.ResourceRefStatus{Kind: redactedKind, Name: id}, UID: &id}
+}
+
+// specResources returns the resources of the nodes of the spec of a resource tree, by specKey
+func specResources(entry *cachehelper.ResourceTreeUpdate) map[string]string {
+	resources := map[string]string{}
+	for _, node := range entry.ResourceTree.Resources.Spec.Tree {
+		resources[node.APIVersion+"/"+node.Namespace+"/"+node.Name] = node.Resource
+	}
+	return resources
+}
+
+// specKey returns the key of a node in the resources of the spec
+func specKey(node *types.ResourceNodeStatus) string {
+	return node.Version + "/" + node.Namespace + "/" + node.Name
+}
@@ -0,0 +1,215 @@
+package webservice
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	types "resource-tree-handler/apis"
+	"resource-tree-handler/internal/auth"
+	cachehelper "resource-tree-handler/internal/cache"
+)
+
+// withAuthorizer requires the users of tokenAuthenticator for the read routes, the admin can get everything,
+// the viewer only the secrets and the fireworksapps of the demo namespace
+func withAuthorizer(r *Webservice, mode auth.RedactionMode) {
+	r.Authenticators = auth.Authenticators{tokenAuthenticator{}}
+	r.ReadRequirement = auth.Requirement{Methods: []auth.Method{auth.MethodStatic}}
+	r.Redaction = mode
+	r.Authorizer = auth.NewAuthorizer(func(_ context.Context, user *auth.User, attributes auth.Attributes) (bool, error) {
+		if user.Name == "admin" {
+			return true, nil
+		}
+		return attributes.Namespace == "demo" && (attributes.Resource == "secrets" || attributes.Resource == "fireworksapps"), nil
+	})
+}
+
+func serveAs(engine http.Handler, path string, user string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, path, nil)
+	request.Header.Set("Authorization", "Bearer "+user)
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestResourceTreeRedaction(t *testing.T) {
+	tests := []struct {
+		mode  auth.RedactionMode
+		user  string
+		kinds []string
+	}{
+		{auth.RedactionPlaceholder, "admin", []string{"Secret", "Release"}},
+		{auth.RedactionPlaceholder, "viewer", []string{"Secret", redactedKind}},
+		{auth.RedactionOmit, "viewer", []string{"Secret"}},
+		{auth.RedactionOff, "viewer", []string{"Secret", "Release"}},
+	}
+	for _, tt := range tests {
+		engine, r := testEngine()
+		withAuthorizer(r, tt.mode)
+		addTree(r, "a", "shared", "secret-uid", "release-uid")
+
+		recorder := serveAs(engine, apiV1Prefix+"/compositions/a", tt.user)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("%s %s: unexpected status %d", tt.mode, tt.user, recorder.Code)
+		}
+		var nodes []*types.ResourceNodeStatus
+		if err := json.Unmarshal(recorder.Body.Bytes(), &nodes); err != nil {
+			t.Fatal(err)
+		}
+		kinds := []string{}
+		for _, node := range nodes {
+			kinds = append(kinds, node.Kind)
+			if node.Kind == redactedKind && (!strings.HasPrefix(node.Name, "redacted-") || *node.UID != node.Name) {
+				t.Errorf("%s %s: the placeholder reveals the node: %+v", tt.mode, tt.user, node)
+			}
+		}
+		if strings.Join(kinds, ",") != strings.Join(tt.kinds, ",") {
+			t.Errorf("%s %s: expected %v, got %v", tt.mode, tt.user, tt.kinds, kinds)
+		}
+	}
+
+	// The resource tree of a composition the user cannot read is not found, whatever its nodes
+	engine, r := testEngine()
+	withAuthorizer(r, auth.RedactionPlaceholder)
+	addTree(r, "a", "shared", "secret-uid", "release-uid")
+	entry, _ := r.Cache.GetResourceTreeFromCache("a")
+	entry.CompositionReference.Namespace = "other"
+	r.Cache.AddToCache(entry.ResourceTree, "a", entry.CompositionReference, entry.Filters)
+	for _, path := range []string{"/compositions/a", "/compositions/a/export", "/compositions/a/resources/secret-uid"} {
+		if recorder := serveAs(engine, apiV1Prefix+path, "viewer"); recorder.Code != http.StatusNotFound {
+			t.Errorf("%s: expected status %d, got %d", path, http.StatusNotFound, recorder.Code)
+		}
+	}
+	if recorder := serveAs(engine, apiV1Prefix+"/compositions/a", "admin"); recorder.Code != http.StatusOK {
+		t.Errorf("unexpected status %d for the admin", recorder.Code)
+	}
+}
+
+func TestFilterParents(t *testing.T) {
+	_, r := testEngine()
+	withAuthorizer(r, auth.RedactionPlaceholder)
+	root := &types.ResourceNodeStatus{ResourceRefStatus: types.ResourceRefStatus{Version: "composition.krateo.io/v1-2-0", Kind: "FireworksApp", Namespace: "other", Name: "app"}}
+	secret := &types.ResourceNodeStatus{ResourceRefStatus: types.ResourceRefStatus{Version: "v1", Kind: "Secret", Namespace: "demo", Name: "shared"}, ParentRefs: []*types.ResourceNodeStatus{root}}
+	authorizer := &nodeAuthorizer{ctx: context.Background(), user: &auth.User{Name: "viewer"}, authorizer: r.Authorizer, mode: r.Redaction}
+
+	nodes := authorizer.filter(nil, []*types.ResourceNodeStatus{root, secret})
+	if len(nodes) != 2 || nodes[0].Kind != redactedKind || nodes[1].ParentRefs[0].UID == nil || *nodes[1].ParentRefs[0].UID != *nodes[0].UID {
+		t.Errorf("expected the hidden root and parent to be the same placeholder, got %+v", nodes)
+	}
+	if secret.ParentRefs[0] != root {
+		t.Error("the cached node was modified")
+	}
+
+	nodes = authorizer.visibleOnly(nil, []*types.ResourceNodeStatus{root, secret})
+	if len(nodes) != 1 || len(nodes[0].ParentRefs) != 0 {
+		t.Errorf("expected only the secret without parents, got %+v", nodes)
+	}
+}
+
+func TestListingAuthorization(t *testing.T) {
+	engine, r := testEngine()
+	withAuthorizer(r, auth.RedactionOmit)
+	addComposition(r, "a", "demo", "FireworksApp", "True", nil)
+	addComposition(r, "b", "other", "FireworksApp", "True", nil)
+
+	for user, expected := range map[string]int{"admin": 2, "viewer": 1} {
+		recorder := serveAs(engine, apiV1Prefix+compositionsEndpoint, user)
+		var response ListResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		if len(response.Items) != expected || response.Total != expected {
+			t.Errorf("%s: expected %d compositions, got %+v", user, expected, response)
+		}
+	}
+}
+
+func TestResolveAuthorization(t *testing.T) {
+	engine, r := testEngine()
+	withAuthorizer(r, auth.RedactionOmit)
+	addComposition(r, "a", "demo", "FireworksApp", "True", nil)
+	addComposition(r, "b", "other", "FireworksApp", "True", nil)
+	// Same name as "a" in another namespace
+	r.Cache.QueueUpdate("b", func(update *cachehelper.ResourceTreeUpdate) error {
+		update.CompositionReference.Name = "a"
+		return nil
+	})
+
+	tests := []struct {
+		user     string
+		query    url.Values
+		status   int
+		expected string
+	}{
+		{"admin", url.Values{"name": {"a"}}, http.StatusConflict, ""},
+		// The composition the viewer cannot get is not a candidate
+		{"viewer", url.Values{"name": {"a"}}, http.StatusOK, "a"},
+		{"viewer", url.Values{"namespace": {"other"}, "name": {"a"}}, http.StatusNotFound, ""},
+		{"admin", url.Values{"namespace": {"other"}, "name": {"a"}}, http.StatusOK, "b"},
+	}
+	for _, tt := range tests {
+		recorder := serveAs(engine, apiV1Prefix+resolveEndpoint+"?"+tt.query.Encode(), tt.user)
+		if recorder.Code != tt.status {
+			t.Errorf("%s %v: expected status %d, got %d: %s", tt.user, tt.query, tt.status, recorder.Code, recorder.Body)
+			continue
+		}
+		if tt.status == http.StatusOK {
+			var response ResolveResponse
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if response.CompositionId != tt.expected {
+				t.Errorf("%s %v: expected %s, got %+v", tt.user, tt.query, tt.expected, response)
+			}
+		}
+	}
+
+	for user, expected := range map[string]int{"admin": 2, "viewer": 1} {
+		var response LegacyListResponse
+		if err := json.Unmarshal(serveAs(engine, legacyListEndpoint, user).Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		if ids := strings.Fields(response.CompositionIds); len(ids) != expected {
+			t.Errorf("%s: expected %d composition ids, got %v", user, expected, ids)
+		}
+	}
+}
+
+func TestResourceTreeValidators(t *testing.T) {
+	engine, r := testEngine()
+	withAuthorizer(r, auth.RedactionPlaceholder)
+	addTree(r, "a", "shared", "secret-uid", "release-uid")
+	path := apiV1Prefix + "/compositions/a"
+
+	admin, viewer := serveAs(engine, path, "admin"), serveAs(engine, path, "viewer")
+	if admin.Header().Get("ETag") == viewer.Header().Get("ETag") {
+		t.Fatal("the users with different permissions share the ETag")
+	}
+
+	tests := []struct {
+		user        string
+		ifNoneMatch string
+		status      int
+	}{
+		{"viewer", admin.Header().Get("ETag"), http.StatusOK},
+		{"viewer", viewer.Header().Get("ETag"), http.StatusNotModified},
+		{"admin", admin.Header().Get("ETag"), http.StatusNotModified},
+	}
+	for _, tt := range tests {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		request.Header.Set("Authorization", "Bearer "+tt.user)
+		request.Header.Set("If-None-Match", tt.ifNoneMatch)
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, request)
+		if recorder.Code != tt.status {
+			t.Errorf("%s with %s: expected status %d, got %d", tt.user, tt.ifNoneMatch, tt.status, recorder.Code)
+		}
+		if recorder.Header().Get("Vary") != "Authorization" {
+			t.Errorf("%s with %s: Vary header missing", tt.user, tt.ifNoneMatch)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package webservice
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	types "resource-tree-handler/apis"
+	cachehelper "resource-tree-handler/internal/cache"
+	resourcetreehelper "resource-tree-handler/internal/helpers/resourcetree"
+)
+
+const (
+	revisionHeaderName = "X-Resource-Tree-Revision"
+	jsonPatchMediaType = "application/json-patch+json"
+)
+
+// writeResourceTree writes the resource tree, honouring the conditional and delta requests of polling clients:
+//   - If-None-Match with the current ETag returns 304 Not Modified without a body;
+//   - the sinceRevision query parameter returns a JSON Patch (RFC 6902) from that revision to the current one,
+//     or the whole resource tree if that revision is no longer in the history of the cache.
+func (r *Webservice) writeResourceTree(c *gin.Context, compositionId string, resourceTreeUpdate *cachehelper.ResourceTreeUpdate) {
+	// The nodes depend on the permissions of the user, and so do the validators
+	r.varyByUser(c)
+	authorizer := r.nodeAuthorizer(c)
+	if !authorizer.canReadComposition(resourceTreeUpdate.CompositionReference) {
+		// Not found rather than forbidden, so that the existence of the composition is not disclosed
+		writeError(c, http.StatusNotFound, ErrorCodeNotFound, "resource tree for composition id %s not cached", compositionId)
+		return
+	}
+	nodes := authorizer.filter(resourceTreeUpdate, cachehelper.FilterResourceTree(resourceTreeUpdate))
+	etag, err := viewETag(resourceTreeUpdate, authorizer, nodes)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, ErrorCodeInternal, "%s", err)
+		return
+	}
+	c.Header("ETag", etag)
+	c.Header(revisionHeaderName, strconv.FormatUint(resourceTreeUpdate.Revision, 10))
+
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	value := c.Query("sinceRevision")
+	if value == "" {
+		c.JSON(http.StatusOK, nodes)
+		return
+	}
+
+	since, err := parseRevision(value)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, ErrorCodeBadRequest, "%s", err)
+		return
+	}
+	previous, ok := r.Cache.GetRevisionFromCache(compositionId, since)
+	if !ok {
+		log.Info().Msgf("revision %d of composition id %s not in history, sending the whole resource tree", since, compositionId)
+		c.JSON(http.StatusOK, nodes)
+		return
+	}
+
+	operations, err := resourcetreehelper.Patch(authorizer.filter(previous, cachehelper.FilterResourceTree(previous)), nodes)
+	if err != nil {
+		log.Error().Err(err).Msgf("could not compute patch for composition id %s since revision %d", compositionId, since)
+		c.JSON(http.StatusOK, nodes)
+		return
+	}
+	data, err := json.Marshal(operations)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, ErrorCodeInternal, "%s", err)
+		return
+	}
+	c.Data(http.StatusOK, jsonPatchMediaType, data)
+}
+
+// viewETag returns the ETag of the nodes of the resource tree seen by the user. Without authorizer, the user sees
+// all the nodes and it is the ETag of the revision; otherwise, it also includes a hash of the filtered nodes, so that
+// the users with different permissions never share a validator.
+func viewETag(resourceTreeUpdate *cachehelper.ResourceTreeUpdate, authorizer *nodeAuthorizer, nodes []*types.ResourceNodeStatus) (string, error) {
+	etag := resourceTreeUpdate.ETag()
+	if authorizer == nil {
+		return etag, nil
+	}
+	data, err := json.Marshal(nodes)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(data)
+	return strings.TrimSuffix(etag, `"`) + "-" + hex.EncodeToString(hash[:8]) + `"`, nil
+}
+
+// etagMatches reports whether the If-None-Match header matches the etag, comparing weakly as RFC 9110 requires
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
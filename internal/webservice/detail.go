@@ -0,0 +1,224 @@
+package webservice
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	types "resource-tree-handler/apis"
+	cachehelper "resource-tree-handler/internal/cache"
+	kubehelper "resource-tree-handler/internal/helpers/kube/client"
+	eventshelper "resource-tree-handler/internal/helpers/kube/events"
+)
+
+const (
+	defaultNodeEvents = 20
+	maxNodeEvents     = 100
+
+	// lastAppliedAnnotation holds the whole object as applied by kubectl, including the data of Secrets
+	lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+)
+
+// NodeRef identifies a node of a resource tree
+type NodeRef struct {
+	types.ResourceRefStatus `json:",inline"`
+	UID                     string `json:"uid,omitempty"`
+}
+
+// NodeDetail describes a node of a resource tree with its live object and its recent events
+type NodeDetail struct {
+	CompositionId string  `json:"compositionId"`
+	Node          NodeRef `json:"node"`
+	Resource      string  `json:"resource"`
+	// Health is the health computed for the node, Condition is the condition of the live object it was computed from
+	Health    *types.Health  `json:"health,omitempty"`
+	Condition map[string]any `json:"condition,omitempty"`
+	Parents   []NodeRef      `json:"parents"`
+	Children  []NodeRef      `json:"children"`
+	// Object is the live object. The data of Secrets is never returned: RedactedKeys lists the keys removed.
+	Object       map[string]any `json:"object,omitempty"`
+	RedactedKeys []string       `json:"redactedKeys,omitempty"`
+	// ObjectError is set when the live object could not be retrieved, or has been recreated with another uid
+	ObjectError string         `json:"objectError,omitempty"`
+	Events      []corev1.Event `json:"events"`
+	EventsError string         `json:"eventsError,omitempty"`
+}
+
+func (r *Webservice) handleNodeDetail(c *gin.Context) {
+	compositionId := c.Param("compositionId")
+	uid := c.Param("uid")
+
+	stripManagedFields := false
+	if value := c.Query("stripManagedFields"); value != "" {
+		var err error
+		if stripManagedFields, err = strconv.ParseBool(value); err != nil {
+			writeError(c, http.StatusBadRequest, ErrorCodeBadRequest, "invalid stripManagedFields %q, expected true or false", value)
+			return
+		}
+	}
+	eventLimit := defaultNodeEvents
+	if value := c.Query("events"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 || limit > maxNodeEvents {
+			writeError(c, http.StatusBadRequest, ErrorCodeBadRequest, "invalid events %q, expected a number between 0 and %d", value, maxNodeEvents)
+			return
+		}
+		eventLimit = limit
+	}
+
+	entry, ok := r.Cache.GetResourceTreeFromCache(compositionId)
+	authorizer := r.nodeAuthorizer(c)
+	if !ok || !authorizer.canReadComposition(entry.CompositionReference) {
+		// Not found also when the user cannot read the composition, so that its existence is not disclosed
+		writeError(c, http.StatusNotFound, ErrorCodeNotFound, "resource tree for composition id %s not cached", compositionId)
+		return
+	}
+	// The nodes the user cannot see are not described, and are placeholders among the parents and children
+	nodes := authorizer.filter(entry, cachehelper.FilterResourceTree(entry))
+	detail, ok := describeNode(compositionId, entry, nodes, uid)
+	if !ok {
+		writeError(c, http.StatusNotFound, ErrorCodeNotFound, "no node with uid %s in the resource tree of composition id %s", uid, compositionId)
+		return
+	}
+
+	reference := types.Reference{
+		ApiVersion: detail.Node.Version,
+		Kind:       detail.Node.Kind,
+		Resource:   detail.Resource,
+		Name:       detail.Node.Name,
+		Namespace:  detail.Node.Namespace,
+	}
+	obj, err := kubehelper.GetObj(c.Request.Context(), &reference, r.Config)
+	if err != nil {
+		log.Warn().Err(err).Msgf("could not retrieve node %s of composition id %s", uid, compositionId)
+		detail.ObjectError = err.Error()
+	} else {
+		if string(obj.GetUID()) != uid {
+			detail.ObjectError = fmt.Sprintf("the object has been recreated with uid %s", obj.GetUID())
+		}
+		if stripManagedFields {
+			obj.SetManagedFields(nil)
+		}
+		detail.RedactedKeys = redactSecret(obj)
+		detail.Object = obj.Object
+		detail.Condition = drivingCondition(obj, detail.Health)
+	}
+
+	if eventLimit > 0 {
+		events, err := eventshelper.List(c.Request.Context(), r.Config, detail.Node.Namespace, uid, eventLimit)
+		if err != nil {
+			log.Warn().Err(err).Msgf("could not list events of node %s of composition id %s", uid, compositionId)
+			detail.EventsError = err.Error()
+		}
+		detail.Events = append(detail.Events, events...)
+	}
+	c.JSON(http.StatusOK, detail)
+}
+
+// describeNode returns the detail of the node with the uid among the nodes of the cached resource tree: the node,
+// its health and its relations
+func describeNode(compositionId string, entry *cachehelper.ResourceTreeUpdate, nodes []*types.ResourceNodeStatus, uid string) (NodeDetail, bool) {
+	index := slices.IndexFunc(nodes, func(node *types.ResourceNodeStatus) bool {
+		return node != nil && node.UID != nil && *node.UID == uid
+	})
+	if index < 0 {
+		return NodeDetail{}, false
+	}
+	node := nodes[index]
+
+	detail := NodeDetail{
+		CompositionId: compositionId,
+		Node:          nodeRef(node),
+		Health:        node.Health,
+		Parents:       []NodeRef{},
+		Children:      []NodeRef{},
+		Events:        []corev1.Event{},
+	}
+	for _, spec := range entry.ResourceTree.Resources.Spec.Tree {
+		if spec.APIVersion == node.Version && spec.Namespace == node.Namespace && spec.Name == node.Name {
+			detail.Resource = spec.Resource
+			break
+		}
+	}
+	if detail.Resource == "" {
+		detail.Resource = kubehelper.InferGroupResource(node.Version, node.Kind).Resource
+	}
+
+	for _, parent := range node.ParentRefs {
+		if parent != nil {
+			detail.Parents = append(detail.Parents, nodeRef(parent))
+		}
+	}
+	for _, other := range nodes {
+		if other == nil || other == node {
+			continue
+		}
+		if slices.ContainsFunc(other.ParentRefs, func(parent *types.ResourceNodeStatus) bool { return sameNode(parent, node) }) {
+			detail.Children = append(detail.Children, nodeRef(other))
+		}
+	}
+	return detail, true
+}
+
+func nodeRef(node *types.ResourceNodeStatus) NodeRef {
+	ref := NodeRef{ResourceRefStatus: node.ResourceRefStatus}
+	if node.UID != nil {
+		ref.UID = *node.UID
+	}
+	return ref
+}
+
+// sameNode compares the nodes by uid when both have one, since the parent refs may be copies of the parents
+func sameNode(a *types.ResourceNodeStatus, b *types.ResourceNodeStatus) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	if a.UID != nil && b.UID != nil {
+		return *a.UID == *b.UID
+	}
+	return a.ResourceRefStatus == b.ResourceRefStatus
+}
+
+// redactSecret removes the data of a Secret, including the copy in the last applied configuration,
+// and returns the keys removed. Other objects are left untouched.
+func redactSecret(obj *unstructured.Unstructured) []string {
+	if obj.GroupVersionKind().GroupKind() != corev1.SchemeGroupVersion.WithKind("Secret").GroupKind() {
+		return nil
+	}
+	keys := []string{}
+	for _, field := range []string{"data", "stringData"} {
+		values, _, _ := unstructured.NestedMap(obj.Object, field)
+		for key := range values {
+			if !slices.Contains(keys, key) {
+				keys = append(keys, key)
+			}
+		}
+		unstructured.RemoveNestedField(obj.Object, field)
+	}
+	if annotations := obj.GetAnnotations(); annotations[lastAppliedAnnotation] != "" {
+		delete(annotations, lastAppliedAnnotation)
+		obj.SetAnnotations(annotations)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// drivingCondition returns the condition of the object the health was computed from, see compositionhelper.GetObjectStatus
+func drivingCondition(obj *unstructured.Unstructured, health *types.Health) map[string]any {
+	if health == nil || health.Type == "" {
+		return nil
+	}
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, item := range conditions {
+		if condition, ok := item.(map[string]any); ok && condition["type"] == health.Type {
+			return condition
+		}
+	}
+	return nil
+}
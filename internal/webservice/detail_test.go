@@ -0,0 +1,84 @@
+package webservice
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	types "resource-tree-handler/apis"
+	cachehelper "resource-tree-handler/internal/cache"
+)
+
+func TestDescribeNode(t *testing.T) {
+	rootUid, secretUid, releaseUid := "root", "secret", "release"
+	root := &types.ResourceNodeStatus{ResourceRefStatus: types.ResourceRefStatus{Version: "resourcetrees.krateo.io/v1", Kind: "CompositionReference", Name: "demo"}, UID: &rootUid}
+	secret := &types.ResourceNodeStatus{ResourceRefStatus: types.ResourceRefStatus{Version: "v1", Kind: "Secret", Namespace: "demo", Name: "credentials"}, UID: &secretUid, ParentRefs: []*types.ResourceNodeStatus{root}}
+	// Parent refs are copies of the parents after a deep copy of the resource tree
+	release := &types.ResourceNodeStatus{ResourceRefStatus: types.ResourceRefStatus{Version: "helm.crossplane.io/v1beta1", Kind: "Release", Name: "demo"}, UID: &releaseUid, ParentRefs: []*types.ResourceNodeStatus{root.DeepCopy()}}
+	entry := &cachehelper.ResourceTreeUpdate{ResourceTree: types.ResourceTree{Resources: types.ResourceTreeJson{
+		Spec: types.ResourceTreeSpec{Tree: []types.ResourceNode{
+			{ResourceRef: types.ResourceRef{APIVersion: "v1", Resource: "secrets", Namespace: "demo", Name: "credentials"}},
+		}},
+		Status: []*types.ResourceNodeStatus{root, secret, release},
+	}}}
+
+	detail, ok := describeNode("a", entry, cachehelper.FilterResourceTree(entry), rootUid)
+	if !ok || len(detail.Parents) != 0 || fmt.Sprint(detail.Children) != fmt.Sprint([]NodeRef{nodeRef(secret), nodeRef(release)}) {
+		t.Errorf("unexpected root detail %+v", detail)
+	}
+	detail, ok = describeNode("a", entry, cachehelper.FilterResourceTree(entry), secretUid)
+	if !ok || detail.Resource != "secrets" || len(detail.Parents) != 1 || detail.Parents[0].UID != rootUid || len(detail.Children) != 0 {
+		t.Errorf("unexpected secret detail %+v", detail)
+	}
+	if _, ok := describeNode("a", entry, cachehelper.FilterResourceTree(entry), "missing"); ok {
+		t.Error("unknown uid described")
+	}
+}
+
+func TestRedactSecret(t *testing.T) {
+	secret := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]any{
+			"name":        "credentials",
+			"annotations": map[string]any{lastAppliedAnnotation: `{"data":{"password":"c2VjcmV0"}}`, "team": "platform"},
+		},
+		"data":       map[string]any{"password": "c2VjcmV0", "username": "YWRtaW4="},
+		"stringData": map[string]any{"token": "secret"},
+	}}
+	keys := redactSecret(secret)
+	if fmt.Sprint(keys) != "[password token username]" {
+		t.Errorf("unexpected redacted keys %v", keys)
+	}
+	if _, ok := secret.Object["data"]; ok {
+		t.Error("data not removed")
+	}
+	if _, ok := secret.Object["stringData"]; ok {
+		t.Error("stringData not removed")
+	}
+	if annotations := secret.GetAnnotations(); annotations[lastAppliedAnnotation] != "" || annotations["team"] != "platform" {
+		t.Errorf("unexpected annotations %v", annotations)
+	}
+
+	configMap := &unstructured.Unstructured{Object: map[string]any{"apiVersion": "v1", "kind": "ConfigMap", "data": map[string]any{"key": "value"}}}
+	if keys := redactSecret(configMap); keys != nil || configMap.Object["data"] == nil {
+		t.Error("object other than a Secret redacted")
+	}
+}
+
+func TestNodeDetailNotFound(t *testing.T) {
+	engine, r := testEngine()
+	addComposition(r, "a", "dev", "FireworksApp", "True", nil)
+	for path, expected := range map[string]int{
+		"/compositions/missing/resources/uid":                  http.StatusNotFound,
+		"/compositions/a/resources/missing":                    http.StatusNotFound,
+		"/compositions/a/resources/x?events=-1":                http.StatusBadRequest,
+		"/compositions/a/resources/x?stripManagedFields=maybe": http.StatusBadRequest,
+	} {
+		if recorder := serve(engine, http.MethodGet, apiV1Prefix+path); recorder.Code != expected {
+			t.Errorf("%s: expected status %d, got %d", path, expected, recorder.Code)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package webservice
+
+import (
+	"bytes"
+	"cmp"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	cachehelper "resource-tree-handler/internal/cache"
+	"resource-tree-handler/pkg/render"
+)
+
+func (r *Webservice) handleExport(c *gin.Context) {
+	compositionId := c.Param("compositionId")
+	format, err := render.ParseFormat(c.DefaultQuery("format", string(render.FormatDOT)))
+	if err != nil {
+		writeError(c, http.StatusBadRequest, ErrorCodeBadRequest, "%s", err)
+		return
+	}
+
+	entry, ok := r.Cache.GetResourceTreeFromCache(compositionId)
+	if !ok {
+		writeError(c, http.StatusNotFound, ErrorCodeNotFound, "resource tree for composition id %s not cached", compositionId)
+		return
+	}
+	r.varyByUser(c)
+	authorizer := r.nodeAuthorizer(c)
+	if !authorizer.canReadComposition(entry.CompositionReference) {
+		// Not found rather than forbidden, so that the existence of the composition is not disclosed
+		writeError(c, http.StatusNotFound, ErrorCodeNotFound, "resource tree for composition id %s not cached", compositionId)
+		return
+	}
+	title := cmp.Or(entry.CompositionReference.Name, entry.ResourceTree.Resources.Name, compositionId)
+	nodes := authorizer.filter(entry, cachehelper.FilterResourceTree(entry))
+	etag, err := viewETag(entry, authorizer, nodes)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, ErrorCodeInternal, "%s", err)
+		return
+	}
+	graph := render.NewGraph(title, nodes)
+
+	var buffer bytes.Buffer
+	if err := render.Render(&buffer, format, graph); err != nil {
+		writeError(c, http.StatusInternalServerError, ErrorCodeInternal, "%s", err)
+		return
+	}
+	c.Header("ETag", etag)
+	c.Data(http.StatusOK, format.ContentType(), buffer.Bytes())
+}
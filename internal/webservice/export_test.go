@@ -0,0 +1,28 @@
+package webservice
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExportResourceTree(t *testing.T) {
+	engine, r := testEngine()
+	addComposition(r, "a", "dev", "FireworksApp", "True", nil)
+
+	recorder := serve(engine, http.MethodGet, apiV1Prefix+"/compositions/a/export?format=mermaid")
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `n0["CompositionReference<br/>a"]:::healthy`) {
+		t.Errorf("unexpected response %d:\n%s", recorder.Code, recorder.Body)
+	}
+	if recorder := serve(engine, http.MethodGet, apiV1Prefix+"/compositions/a/export"); !strings.HasPrefix(recorder.Body.String(), `digraph "a"`) {
+		t.Errorf("expected DOT by default, got\n%s", recorder.Body)
+	}
+	for path, expected := range map[string]int{
+		"/compositions/a/export?format=svg": http.StatusBadRequest,
+		"/compositions/missing/export":      http.StatusNotFound,
+	} {
+		if recorder := serve(engine, http.MethodGet, apiV1Prefix+path); recorder.Code != expected {
+			t.Errorf("%s: expected status %d, got %d", path, expected, recorder.Code)
+		}
+	}
+}
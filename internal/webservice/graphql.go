@@ -0,0 +1,76 @@
+package webservice
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	types "resource-tree-handler/apis"
+	cachehelper "resource-tree-handler/internal/cache"
+	"resource-tree-handler/internal/graphql"
+)
+
+// nodeAuthorizerKey is the key of the nodeAuthorizer in the context of the GraphQL queries
+type nodeAuthorizerKey struct{}
+
+// newGraphQLHandler returns the handler of the GraphQL queries, nil if the schema is invalid
+func (r *Webservice) newGraphQLHandler() *graphql.Handler {
+	handler, err := graphql.NewHandler(r.Cache, graphql.Options{
+		MaxDepth:      r.GraphQLMaxDepth,
+		MaxComplexity: r.GraphQLMaxComplexity,
+		Filter:        filterGraphQL,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("could not create the GraphQL handler")
+		return nil
+	}
+	return handler
+}
+
+// filterGraphQL trims the resource trees with the nodeAuthorizer of the query, see handleGraphQL
+func filterGraphQL(ctx context.Context, entry *cachehelper.ResourceTreeUpdate, nodes []*types.ResourceNodeStatus) ([]*types.ResourceNodeStatus, bool) {
+	authorizer, _ := ctx.Value(nodeAuthorizerKey{}).(*nodeAuthorizer)
+	if !authorizer.canReadComposition(entry.CompositionReference) {
+		return nil, false
+	}
+	return authorizer.filter(entry, nodes), true
+}
+
+// handleGraphQL executes a GraphQL query, from the body of a POST or from the parameters of a GET.
+// Queries rejected before being executed, e.g., because they exceed the limits, are answered with 400.
+func (r *Webservice) handleGraphQL(c *gin.Context) {
+	if r.graphql == nil {
+		writeError(c, http.StatusServiceUnavailable, ErrorCodeInternal, "the GraphQL endpoint is not available")
+		return
+	}
+
+	var request graphql.Request
+	if c.Request.Method == http.MethodGet {
+		request.Query = c.Query("query")
+		request.OperationName = c.Query("operationName")
+		if variables := c.Query("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &request.Variables); err != nil {
+				writeError(c, http.StatusBadRequest, ErrorCodeBadRequest, "could not parse variables: %s", err)
+				return
+			}
+		}
+	} else if err := c.ShouldBindJSON(&request); err != nil {
+		writeError(c, http.StatusBadRequest, ErrorCodeBadRequest, "could not parse the GraphQL request: %s", err)
+		return
+	}
+	if request.Query == "" {
+		writeError(c, http.StatusBadRequest, ErrorCodeBadRequest, "query is required")
+		return
+	}
+
+	ctx := context.WithValue(c.Request.Context(), nodeAuthorizerKey{}, r.nodeAuthorizer(c))
+	response, rejected := r.graphql.Execute(ctx, request)
+	if rejected {
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
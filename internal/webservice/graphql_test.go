@@ -0,0 +1,52 @@
+package webservice
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"resource-tree-handler/internal/graphql"
+)
+
+func TestGraphQL(t *testing.T) {
+	engine, r := testEngine()
+	addComposition(r, "a", "dev", "FireworksApp", "True", nil)
+	addComposition(r, "b", "dev", "FireworksApp", "False", nil)
+
+	recorder := httptest.NewRecorder()
+	body := `{"query": "query($health: HealthState) { compositions(health: $health) { id } }", "variables": {"health": "UNHEALTHY"}}`
+	engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, apiV1Prefix+graphqlEndpoint, strings.NewReader(body)))
+	if recorder.Code != http.StatusOK || recorder.Body.String() != `{"data":{"compositions":[{"id":"b"}]}}` {
+		t.Errorf("unexpected response %d %s", recorder.Code, recorder.Body)
+	}
+
+	query := url.Values{"query": {`{ composition(id: "a") { resources { kind } } }`}}
+	recorder = serve(engine, http.MethodGet, apiV1Prefix+graphqlEndpoint+"?"+query.Encode())
+	if recorder.Code != http.StatusOK || recorder.Body.String() != `{"data":{"composition":{"resources":[{"kind":"CompositionReference"},{"kind":"ConfigMap"}]}}}` {
+		t.Errorf("unexpected response %d %s", recorder.Code, recorder.Body)
+	}
+
+	for _, query := range []url.Values{
+		{},
+		{"query": {"{ compositions { id } }"}, "variables": {"{"}},
+		{"query": {"{ compositions(first: 100000) { resources(first: 100000) { uid } } }"}},
+	} {
+		if recorder := serve(engine, http.MethodGet, apiV1Prefix+graphqlEndpoint+"?"+query.Encode()); recorder.Code != http.StatusBadRequest {
+			t.Errorf("%v: expected status 400, got %d", query, recorder.Code)
+		}
+	}
+
+	// Queries exceeding the limits are answered with GraphQL errors
+	query = url.Values{"query": {`{ compositions { resources { children { children { children { children { children { children { children { children { uid } } } } } } } } } } }`}}
+	recorder = serve(engine, http.MethodGet, apiV1Prefix+graphqlEndpoint+"?"+query.Encode())
+	var response graphql.Response
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if recorder.Code != http.StatusBadRequest || response.Data != nil || len(response.Errors) != 1 || !strings.Contains(response.Errors[0].Message, "depth") {
+		t.Errorf("unexpected response %d %s", recorder.Code, recorder.Body)
+	}
+}
@@ -0,0 +1,169 @@
+package webservice
+
+import (
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	types "resource-tree-handler/apis"
+	cachehelper "resource-tree-handler/internal/cache"
+)
+
+const (
+	inventoryFormatNDJSON = "ndjson"
+	inventoryFormatCSV    = "csv"
+
+	ndjsonMediaType = "application/x-ndjson"
+	csvMediaType    = "text/csv; charset=utf-8"
+)
+
+// InventoryRow is a resource of a cached resource tree, with its composition
+type InventoryRow struct {
+	CompositionId        string `json:"compositionId"`
+	CompositionName      string `json:"compositionName"`
+	CompositionNamespace string `json:"compositionNamespace"`
+	ApiVersion           string `json:"apiVersion"`
+	Kind                 string `json:"kind"`
+	Namespace            string `json:"namespace"`
+	Name                 string `json:"name"`
+	Uid                  string `json:"uid"`
+	HealthType           string `json:"healthType"`
+	HealthStatus         string `json:"healthStatus"`
+	HealthReason         string `json:"healthReason"`
+	// CreatedAt is empty when unknown, in RFC 3339 otherwise
+	CreatedAt       string `json:"createdAt"`
+	ResourceVersion string `json:"resourceVersion"`
+}
+
+// inventoryColumns is the header of the CSV inventory, in the order of InventoryRow.values
+var inventoryColumns = []string{
+	"compositionId", "compositionName", "compositionNamespace",
+	"apiVersion", "kind", "namespace", "name", "uid",
+	"healthType", "healthStatus", "healthReason",
+	"createdAt", "resourceVersion",
+}
+
+func (row *InventoryRow) values() []string {
+	return []string{
+		row.CompositionId, row.CompositionName, row.CompositionNamespace,
+		row.ApiVersion, row.Kind, row.Namespace, row.Name, row.Uid,
+		row.HealthType, row.HealthStatus, row.HealthReason,
+		row.CreatedAt, row.ResourceVersion,
+	}
+}
+
+// inventoryRows returns the rows of the nodes of a cached resource tree, without the ones excluded by the filters
+func inventoryRows(compositionId string, entry *cachehelper.ResourceTreeUpdate, nodes []*types.ResourceNodeStatus, health []HealthState) []InventoryRow {
+	rows := []InventoryRow{}
+	for _, node := range nodes {
+		if node == nil || (len(health) > 0 && !slices.Contains(health, healthStateOf(node.Health))) {
+			continue
+		}
+		row := InventoryRow{
+			CompositionId:        compositionId,
+			CompositionName:      cmp.Or(entry.CompositionReference.Name, entry.ResourceTree.Resources.Name),
+			CompositionNamespace: cmp.Or(entry.CompositionReference.Namespace, entry.ResourceTree.Resources.Namespace),
+			ApiVersion:           node.Version,
+			Kind:                 node.Kind,
+			Namespace:            node.Namespace,
+			Name:                 node.Name,
+		}
+		if node.UID != nil {
+			row.Uid = *node.UID
+		}
+		if node.Health != nil {
+			row.HealthType = node.Health.Type
+			row.HealthStatus = node.Health.Status
+			row.HealthReason = node.Health.Reason
+		}
+		if node.CreatedAt != nil && !node.CreatedAt.IsZero() {
+			row.CreatedAt = node.CreatedAt.UTC().Format(time.RFC3339)
+		}
+		if node.ResourceVersion != nil {
+			row.ResourceVersion = *node.ResourceVersion
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// handleInventory streams the resources of all the cached resource trees, one composition at a time,
+// so that the response is never buffered whole
+func (r *Webservice) handleInventory(c *gin.Context) {
+	format := c.DefaultQuery("format", inventoryFormatNDJSON)
+	if format != inventoryFormatNDJSON && format != inventoryFormatCSV {
+		writeError(c, http.StatusBadRequest, ErrorCodeBadRequest, "invalid format %q, expected %s or %s", format, inventoryFormatNDJSON, inventoryFormatCSV)
+		return
+	}
+	health, err := parseHealthStates(c.QueryArray("health"))
+	if err != nil {
+		writeError(c, http.StatusBadRequest, ErrorCodeBadRequest, "%s", err)
+		return
+	}
+	namespaces := splitQuery(c.QueryArray("namespace"))
+
+	var write func(row *InventoryRow) error
+	var flush func() error
+	if format == inventoryFormatCSV {
+		c.Header("Content-Type", csvMediaType)
+		c.Header("Content-Disposition", `attachment; filename="inventory.csv"`)
+		writer := csv.NewWriter(c.Writer)
+		write = func(row *InventoryRow) error { return writer.Write(row.values()) }
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+		if err := writer.Write(inventoryColumns); err != nil {
+			log.Warn().Err(err).Msg("could not write the inventory")
+			return
+		}
+	} else {
+		c.Header("Content-Type", ndjsonMediaType)
+		encoder := json.NewEncoder(c.Writer)
+		write = func(row *InventoryRow) error { return encoder.Encode(row) }
+		flush = func() error { return nil }
+	}
+	c.Status(http.StatusOK)
+
+	authorizer := r.nodeAuthorizer(c)
+	compositionIds := r.Cache.ListKeysFromCache()
+	slices.Sort(compositionIds)
+	for _, compositionId := range compositionIds {
+		if c.Request.Context().Err() != nil {
+			return
+		}
+		entry, ok := r.Cache.GetResourceTreeFromCache(compositionId)
+		if !ok {
+			continue
+		}
+		if len(namespaces) > 0 && !slices.Contains(namespaces, cmp.Or(entry.CompositionReference.Namespace, entry.ResourceTree.Resources.Namespace)) {
+			continue
+		}
+		if !authorizer.canReadComposition(entry.CompositionReference) {
+			continue
+		}
+		// Placeholders have nothing to list
+		nodes := authorizer.visibleOnly(entry, cachehelper.FilterResourceTree(entry))
+		for _, row := range inventoryRows(compositionId, entry, nodes, health) {
+			if err := write(&row); err != nil {
+				log.Warn().Err(err).Msg("could not write the inventory")
+				return
+			}
+		}
+		if err := flush(); err != nil {
+			log.Warn().Err(err).Msg("could not write the inventory")
+			return
+		}
+		c.Writer.Flush()
+	}
+	// The CSV header is still buffered when no composition matches
+	if err := flush(); err != nil {
+		log.Warn().Err(err).Msg("could not write the inventory")
+	}
+}
@@ -0,0 +1,49 @@
+package webservice
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestInventory(t *testing.T) {
+	engine, r := testEngine()
+	addComposition(r, "a", "dev", "FireworksApp", "True", nil)
+	addComposition(r, "b", "prod", "FireworksApp", "False", nil)
+
+	recorder := serve(engine, http.MethodGet, apiV1Prefix+inventoryEndpoint)
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != ndjsonMediaType {
+		t.Fatalf("unexpected response %d %s", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+	rows := []InventoryRow{}
+	scanner := bufio.NewScanner(recorder.Body)
+	for scanner.Scan() {
+		var row InventoryRow
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, row)
+	}
+	// Two resources per composition, sorted by composition id
+	if len(rows) != 4 || rows[0].CompositionId != "a" || rows[0].HealthStatus != "True" || rows[1].Kind != "ConfigMap" || rows[3].CompositionNamespace != "prod" {
+		t.Errorf("unexpected rows %+v", rows)
+	}
+
+	recorder = serve(engine, http.MethodGet, apiV1Prefix+inventoryEndpoint+"?format=csv&namespace=prod&health=unhealthy")
+	records, err := csv.NewReader(strings.NewReader(recorder.Body.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || strings.Join(records[0], ",") != strings.Join(inventoryColumns, ",") || records[1][0] != "b" || records[1][4] != "CompositionReference" {
+		t.Errorf("unexpected records %v", records)
+	}
+
+	for _, query := range []string{"?format=xml", "?health=sick"} {
+		if recorder := serve(engine, http.MethodGet, apiV1Prefix+inventoryEndpoint+query); recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, recorder.Code)
+		}
+	}
+}
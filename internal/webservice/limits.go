@@ -0,0 +1,97 @@
+package webservice
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/krateoplatformops/plumbing/cache"
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	types "resource-tree-handler/apis"
+	compositionhelper "resource-tree-handler/internal/helpers/kube/compositions"
+	"resource-tree-handler/internal/ratelimit"
+)
+
+// limiters are the limiters of the classes of routes, created from RateLimits when first needed
+type limiters struct {
+	mu      sync.Mutex
+	byClass map[ratelimit.Class]*ratelimit.Limiter
+}
+
+// limiter returns the limiter of the class, nil if the class is unlimited
+func (r *Webservice) limiter(class ratelimit.Class) *ratelimit.Limiter {
+	r.settingsMu.RLock()
+	limits, ok := r.RateLimits[class]
+	r.settingsMu.RUnlock()
+	if !ok || !limits.Enabled() {
+		return nil
+	}
+	r.limiters.mu.Lock()
+	defer r.limiters.mu.Unlock()
+	if r.limiters.byClass == nil {
+		r.limiters.byClass = map[ratelimit.Class]*ratelimit.Limiter{}
+	}
+	limiter, ok := r.limiters.byClass[class]
+	if !ok {
+		limiter = ratelimit.NewLimiter(limits)
+		r.limiters.byClass[class] = limiter
+	}
+	return limiter
+}
+
+// rateLimit returns the middleware limiting the requests of the class, per client IP and globally.
+// It runs before the authentication, so that rejected tokens cannot be used to flood the API server.
+func (r *Webservice) rateLimit(class ratelimit.Class) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limiter := r.limiter(class)
+		if limiter == nil {
+			return
+		}
+		if allowed, delay := limiter.Allow(c.ClientIP()); !allowed {
+			log.Debug().Msgf("%s %s from %s: rate limited for %s", c.Request.Method, c.Request.URL.Path, c.ClientIP(), delay)
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			writeError(c, http.StatusTooManyRequests, ErrorCodeRateLimited, "too many %s requests, retry in %s", class, delay.Round(time.Millisecond))
+		}
+	}
+}
+
+// unknownCompositions are the ids recently not found in the cluster
+type unknownCompositions struct {
+	once sync.Once
+	ids  *cache.TTLCache[string, struct{}]
+}
+
+func (u *unknownCompositions) cache() *cache.TTLCache[string, struct{}] {
+	u.once.Do(func() { u.ids = cache.NewTTL[string, struct{}]() })
+	return u.ids
+}
+
+// compositionById looks up a composition in the cluster, see compositionhelper.GetCompositionById. The ids not
+// found are remembered for UnknownCompositionTTL, so that repeated misses, e.g., of random ids, do not run the
+// discovery and list all the compositions again.
+func (r *Webservice) compositionById(compositionId string) (*unstructured.Unstructured, *types.Reference, error) {
+	if r.UnknownCompositionTTL > 0 {
+		if _, ok := r.unknownCompositions.cache().Get(compositionId); ok {
+			return nil, nil, fmt.Errorf("composition id %s was not found recently: %w", compositionId, compositionhelper.ErrCompositionNotFound)
+		}
+	}
+	obj, reference, err := compositionhelper.GetCompositionById(compositionId, r.Config)
+	if r.UnknownCompositionTTL > 0 && errors.Is(err, compositionhelper.ErrCompositionNotFound) {
+		r.unknownCompositions.cache().Set(compositionId, struct{}{}, r.UnknownCompositionTTL)
+	}
+	return obj, reference, err
+}
+
+// forgetUnknownComposition looks up the id again at the next miss, e.g., when an event shows that it exists
+func (r *Webservice) forgetUnknownComposition(compositionId string) {
+	if r.UnknownCompositionTTL > 0 {
+		r.unknownCompositions.cache().Remove(compositionId)
+	}
+}
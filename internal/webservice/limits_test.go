@@ -0,0 +1,56 @@
+package webservice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"resource-tree-handler/internal/ratelimit"
+)
+
+func TestRateLimit(t *testing.T) {
+	engine, r := testEngine()
+	r.RateLimits = map[ratelimit.Class]ratelimit.Limits{
+		ratelimit.ClassRead: {Client: ratelimit.Limit{Rate: 0.001, Burst: 2}},
+	}
+
+	request := func(path string, client string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		request.RemoteAddr = client + ":1234"
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, request)
+		return recorder
+	}
+	for i := 0; i < 2; i++ {
+		if recorder := request(apiV1Prefix+compositionsEndpoint, "10.0.0.1"); recorder.Code != http.StatusOK {
+			t.Fatalf("request %d: unexpected status %d", i, recorder.Code)
+		}
+	}
+	recorder := request(apiV1Prefix+compositionsEndpoint, "10.0.0.1")
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") == "" {
+		t.Errorf("expected 429 with Retry-After, got %d %v", recorder.Code, recorder.Header())
+	}
+	if recorder := request(apiV1Prefix+compositionsEndpoint, "10.0.0.2"); recorder.Code != http.StatusOK {
+		t.Errorf("another client: unexpected status %d", recorder.Code)
+	}
+	// The health probe is never limited
+	if recorder := request(homeEndpoint, "10.0.0.1"); recorder.Code != http.StatusOK {
+		t.Errorf("health probe: unexpected status %d", recorder.Code)
+	}
+}
+
+func TestUnknownCompositions(t *testing.T) {
+	engine, r := testEngine()
+	r.UnknownCompositionTTL = time.Minute
+	// Not looked up in the cluster, which is not available in the tests
+	r.unknownCompositions.cache().Set("missing", struct{}{}, time.Minute)
+
+	if recorder := serve(engine, http.MethodGet, apiV1Prefix+"/compositions/missing"); recorder.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", recorder.Code)
+	}
+	r.forgetUnknownComposition("missing")
+	if _, ok := r.unknownCompositions.cache().Get("missing"); ok {
+		t.Error("expected the id to be forgotten")
+	}
+}
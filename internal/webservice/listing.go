@@ -0,0 +1,334 @@
+package webservice
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	types "resource-tree-handler/apis"
+	cachehelper "resource-tree-handler/internal/cache"
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+	defaultListSort  = "namespace,name"
+)
+
+// HealthState summarizes the health of a composition, from the status of the root of its resource tree
+type HealthState string
+
+const (
+	HealthStateHealthy   HealthState = "healthy"
+	HealthStateUnhealthy HealthState = "unhealthy"
+	HealthStateUnknown   HealthState = "unknown"
+)
+
+// CompositionSummary describes a composition with a cached resource tree
+type CompositionSummary struct {
+	CompositionId string `json:"compositionId"`
+	ApiVersion    string `json:"apiVersion"`
+	Kind          string `json:"kind"`
+	Resource      string `json:"resource"`
+	Name          string `json:"name"`
+	Namespace     string `json:"namespace"`
+	// Version is the installed version of the composition
+	Version       string            `json:"version"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	Health        *types.Health     `json:"health,omitempty"`
+	HealthState   HealthState       `json:"healthState"`
+	ResourceCount int               `json:"resourceCount"`
+	LastUpdate    time.Time         `json:"lastUpdate"`
+	Revision      uint64            `json:"revision"`
+}
+
+// ListResponse is a page of the compositions with a cached resource tree
+type ListResponse struct {
+	Items []CompositionSummary `json:"items"`
+	// Total is the number of compositions matching the filters, in all the pages
+	Total int `json:"total"`
+	// NextCursor returns the next page when passed as the cursor parameter, empty on the last page
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// listOptions are the filters, the sorting and the page of a listing
+type listOptions struct {
+	namespaces []string
+	kinds      []string
+	health     []HealthState
+	selector   labels.Selector
+	sort       []sortField
+	limit      int
+	after      *CompositionSummary
+}
+
+type sortField struct {
+	name       string
+	descending bool
+}
+
+// listCursor is the opaque position of a page: the last item returned, compared with the same sort
+type listCursor struct {
+	Sort string             `json:"sort"`
+	Last CompositionSummary `json:"last"`
+}
+
+// summaryComparators compare two summaries by the sortable fields
+var summaryComparators = map[string]func(a, b *CompositionSummary) int{
+	"compositionId": func(a, b *CompositionSummary) int { return cmp.Compare(a.CompositionId, b.CompositionId) },
+	"name":          func(a, b *CompositionSummary) int { return cmp.Compare(a.Name, b.Name) },
+	"namespace":     func(a, b *CompositionSummary) int { return cmp.Compare(a.Namespace, b.Namespace) },
+	"kind":          func(a, b *CompositionSummary) int { return cmp.Compare(a.Kind, b.Kind) },
+	"version":       func(a, b *CompositionSummary) int { return cmp.Compare(a.Version, b.Version) },
+	"health":        func(a, b *CompositionSummary) int { return cmp.Compare(a.HealthState, b.HealthState) },
+	"resourceCount": func(a, b *CompositionSummary) int { return cmp.Compare(a.ResourceCount, b.ResourceCount) },
+	"lastUpdate":    func(a, b *CompositionSummary) int { return a.LastUpdate.Compare(b.LastUpdate) },
+}
+
+// summarize returns the summary of a cached resource tree
+func summarize(compositionId string, entry *cachehelper.ResourceTreeUpdate) CompositionSummary {
+	reference := entry.CompositionReference
+	metadata := entry.ResourceTree.Resources.ObjectMeta
+	summary := CompositionSummary{
+		CompositionId: compositionId,
+		ApiVersion:    reference.ApiVersion,
+		Kind:          reference.Kind,
+		Resource:      reference.Resource,
+		Name:          cmp.Or(reference.Name, metadata.Name),
+		Namespace:     cmp.Or(reference.Namespace, metadata.Namespace),
+		Labels:        metadata.Labels,
+		HealthState:   HealthStateUnknown,
+		ResourceCount: len(cachehelper.FilterResourceTree(entry)),
+		LastUpdate:    entry.LastUpdate,
+		Revision:      entry.Revision,
+	}
+	if gv, err := schema.ParseGroupVersion(reference.ApiVersion); err == nil {
+		summary.Version = gv.Version
+	}
+	if root := entry.ResourceTree.RootElementStatus; root != nil {
+		summary.Health = root.Health
+		summary.HealthState = healthStateOf(root.Health)
+	}
+	return summary
+}
+
+// healthStateOf summarizes the health of a node from the status of its condition
+func healthStateOf(health *types.Health) HealthState {
+	if health == nil {
+		return HealthStateUnknown
+	}
+	switch health.Status {
+	case "True":
+		return HealthStateHealthy
+	case "False":
+		return HealthStateUnhealthy
+	}
+	return HealthStateUnknown
+}
+
+func (r *Webservice) handleList(c *gin.Context) {
+	options, err := parseListOptions(c)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, ErrorCodeBadRequest, "%s", err)
+		return
+	}
+
+	summaries := []CompositionSummary{}
+	r.Cache.RangeCache(func(compositionId string, entry *cachehelper.ResourceTreeUpdate) bool {
+		summary := summarize(compositionId, entry)
+		if options.matches(&summary) {
+			summaries = append(summaries, summary)
+		}
+		return true
+	})
+	// The access reviews are not done while ranging over the cache
+	authorizer := r.nodeAuthorizer(c)
+	summaries = slices.DeleteFunc(summaries, func(summary CompositionSummary) bool {
+		reference := types.Reference{ApiVersion: summary.ApiVersion, Kind: summary.Kind, Resource: summary.Resource, Namespace: summary.Namespace, Name: summary.Name}
+		return !authorizer.canReadComposition(reference)
+	})
+
+	response, err := options.page(summaries)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, ErrorCodeInternal, "%s", err)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func parseListOptions(c *gin.Context) (listOptions, error) {
+	options := listOptions{
+		namespaces: splitQuery(c.QueryArray("namespace")),
+		kinds:      splitQuery(c.QueryArray("kind")),
+		selector:   labels.Everything(),
+		limit:      defaultListLimit,
+	}
+
+	health, err := parseHealthStates(c.QueryArray("health"))
+	if err != nil {
+		return listOptions{}, err
+	}
+	options.health = health
+
+	if value := c.Query("labelSelector"); value != "" {
+		selector, err := labels.Parse(value)
+		if err != nil {
+			return listOptions{}, fmt.Errorf("invalid labelSelector: %w", err)
+		}
+		options.selector = selector
+	}
+
+	for _, field := range strings.Split(c.DefaultQuery("sort", defaultListSort), ",") {
+		field = strings.TrimSpace(field)
+		descending := strings.HasPrefix(field, "-")
+		field = strings.TrimPrefix(field, "-")
+		if _, ok := summaryComparators[field]; !ok {
+			return listOptions{}, fmt.Errorf("invalid sort field %q", field)
+		}
+		options.sort = append(options.sort, sortField{name: field, descending: descending})
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxListLimit {
+			return listOptions{}, fmt.Errorf("invalid limit %q, expected a number between 1 and %d", value, maxListLimit)
+		}
+		options.limit = limit
+	}
+
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := decodeCursor(value)
+		if err != nil {
+			return listOptions{}, err
+		}
+		if cursor.Sort != options.sortString() {
+			return listOptions{}, fmt.Errorf("the cursor was returned for sort %q, not %q", cursor.Sort, options.sortString())
+		}
+		options.after = &cursor.Last
+	}
+	return options, nil
+}
+
+// parseHealthStates parses the repeated or comma separated health query parameters
+func parseHealthStates(values []string) ([]HealthState, error) {
+	states := []HealthState{}
+	for _, health := range splitQuery(values) {
+		state := HealthState(strings.ToLower(health))
+		if state != HealthStateHealthy && state != HealthStateUnhealthy && state != HealthStateUnknown {
+			return nil, fmt.Errorf("invalid health %q, expected %s, %s or %s", health, HealthStateHealthy, HealthStateUnhealthy, HealthStateUnknown)
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// splitQuery splits the comma separated values of repeated query parameters
+func splitQuery(values []string) []string {
+	result := []string{}
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				result = append(result, item)
+			}
+		}
+	}
+	return result
+}
+
+func (o listOptions) matches(summary *CompositionSummary) bool {
+	if len(o.namespaces) > 0 && !slices.Contains(o.namespaces, summary.Namespace) {
+		return false
+	}
+	if len(o.kinds) > 0 && !slices.ContainsFunc(o.kinds, func(kind string) bool { return strings.EqualFold(kind, summary.Kind) }) {
+		return false
+	}
+	if len(o.health) > 0 && !slices.Contains(o.health, summary.HealthState) {
+		return false
+	}
+	return o.selector.Matches(labels.Set(summary.Labels))
+}
+
+// compare orders the summaries by the sort fields, then by composition id so that the order is total
+func (o listOptions) compare(a, b *CompositionSummary) int {
+	for _, field := range o.sort {
+		result := summaryComparators[field.name](a, b)
+		if field.descending {
+			result = -result
+		}
+		if result != 0 {
+			return result
+		}
+	}
+	return cmp.Compare(a.CompositionId, b.CompositionId)
+}
+
+// page sorts the summaries matching the filters and returns the page after the cursor
+func (o listOptions) page(summaries []CompositionSummary) (ListResponse, error) {
+	slices.SortFunc(summaries, func(a, b CompositionSummary) int { return o.compare(&a, &b) })
+
+	start := 0
+	if o.after != nil {
+		start, _ = slices.BinarySearchFunc(summaries, o.after, func(item CompositionSummary, after *CompositionSummary) int {
+			if o.compare(&item, after) <= 0 {
+				return -1
+			}
+			return 1
+		})
+	}
+	end := min(start+o.limit, len(summaries))
+
+	response := ListResponse{Items: summaries[start:end], Total: len(summaries)}
+	if end < len(summaries) {
+		cursor, err := encodeCursor(o.sortString(), summaries[end-1])
+		if err != nil {
+			return ListResponse{}, err
+		}
+		response.NextCursor = cursor
+	}
+	return response, nil
+}
+
+func (o listOptions) sortString() string {
+	fields := make([]string, 0, len(o.sort))
+	for _, field := range o.sort {
+		if field.descending {
+			fields = append(fields, "-"+field.name)
+		} else {
+			fields = append(fields, field.name)
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+func encodeCursor(sort string, last CompositionSummary) (string, error) {
+	// Only the sortable fields are needed to find the position
+	last.Labels = nil
+	last.Health = nil
+	data, err := json.Marshal(listCursor{Sort: sort, Last: last})
+	if err != nil {
+		return "", fmt.Errorf("could not encode cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(value string) (listCursor, error) {
+	var cursor listCursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err == nil {
+		err = json.Unmarshal(data, &cursor)
+	}
+	if err != nil {
+		return listCursor{}, fmt.Errorf("invalid cursor: %w", err)
+	}
+	return cursor, nil
+}
@@ -0,0 +1,129 @@
+package webservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	types "resource-tree-handler/apis"
+)
+
+func addComposition(r *Webservice, id string, namespace string, kind string, health string, labels map[string]string) {
+	root := &types.ResourceNodeStatus{ResourceRefStatus: types.ResourceRefStatus{Kind: "CompositionReference", Name: id}, Health: &types.Health{Type: "Ready", Status: health}}
+	resourceTree := types.ResourceTree{
+		CompositionId:     id,
+		RootElementStatus: root,
+		Resources: types.ResourceTreeJson{
+			ObjectMeta: metav1.ObjectMeta{Name: id, Namespace: namespace, Labels: labels},
+			Status:     []*types.ResourceNodeStatus{root, {ResourceRefStatus: types.ResourceRefStatus{Kind: "ConfigMap", Name: id}}},
+		},
+	}
+	reference := types.Reference{ApiVersion: "composition.krateo.io/v1-2-0", Kind: kind, Name: id, Namespace: namespace, Uid: id}
+	r.Cache.AddToCache(resourceTree, id, reference, types.Filters{})
+}
+
+func list(t *testing.T, engine *gin.Engine, query url.Values) (ListResponse, int) {
+	t.Helper()
+	recorder := serve(engine, http.MethodGet, apiV1Prefix+compositionsEndpoint+"?"+query.Encode())
+	var response ListResponse
+	if recorder.Code == http.StatusOK {
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return response, recorder.Code
+}
+
+func ids(response ListResponse) []string {
+	result := []string{}
+	for _, item := range response.Items {
+		result = append(result, item.CompositionId)
+	}
+	return result
+}
+
+func TestListCompositions(t *testing.T) {
+	engine, r := testEngine()
+	addComposition(r, "a", "dev", "FireworksApp", "True", map[string]string{"env": "dev"})
+	addComposition(r, "b", "prod", "FireworksApp", "False", map[string]string{"env": "prod", "tier": "web"})
+	addComposition(r, "c", "prod", "PostgreSQL", "", map[string]string{"env": "prod", "tier": "db"})
+	addComposition(r, "d", "prod", "FireworksApp", "True", nil)
+
+	tests := []struct {
+		query    url.Values
+		expected []string
+	}{
+		{url.Values{}, []string{"a", "b", "c", "d"}},
+		{url.Values{"namespace": {"prod"}}, []string{"b", "c", "d"}},
+		{url.Values{"kind": {"fireworksapp"}}, []string{"a", "b", "d"}},
+		{url.Values{"health": {"healthy,unknown"}}, []string{"a", "c", "d"}},
+		{url.Values{"labelSelector": {"env=prod,tier!=db"}}, []string{"b"}},
+		{url.Values{"sort": {"-health,-name"}}, []string{"c", "b", "d", "a"}},
+		{url.Values{"namespace": {"prod"}, "kind": {"FireworksApp"}, "health": {"healthy"}}, []string{"d"}},
+	}
+	for _, tt := range tests {
+		response, status := list(t, engine, tt.query)
+		if status != http.StatusOK {
+			t.Errorf("%v: unexpected status %d", tt.query, status)
+			continue
+		}
+		if fmt.Sprint(ids(response)) != fmt.Sprint(tt.expected) || response.Total != len(tt.expected) {
+			t.Errorf("%v: expected %v, got %v (total %d)", tt.query, tt.expected, ids(response), response.Total)
+		}
+	}
+
+	summary := func() CompositionSummary {
+		response, _ := list(t, engine, url.Values{"namespace": {"prod"}, "kind": {"PostgreSQL"}})
+		return response.Items[0]
+	}()
+	if summary.Version != "v1-2-0" || summary.ResourceCount != 2 || summary.HealthState != HealthStateUnknown || summary.Labels["tier"] != "db" {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+
+	for _, query := range []url.Values{{"health": {"sick"}}, {"sort": {"size"}}, {"limit": {"0"}}, {"labelSelector": {"env in"}}, {"cursor": {"!"}}} {
+		if _, status := list(t, engine, query); status != http.StatusBadRequest {
+			t.Errorf("%v: expected status 400, got %d", query, status)
+		}
+	}
+}
+
+func TestListCompositionsPagination(t *testing.T) {
+	engine, r := testEngine()
+	for i := range 7 {
+		addComposition(r, fmt.Sprintf("composition-%d", i), "default", "FireworksApp", "True", nil)
+	}
+
+	query := url.Values{"limit": {"3"}, "sort": {"-name"}}
+	pages := []string{}
+	for {
+		response, status := list(t, engine, query)
+		if status != http.StatusOK {
+			t.Fatalf("unexpected status %d", status)
+		}
+		pages = append(pages, fmt.Sprint(ids(response)))
+		if response.NextCursor == "" {
+			break
+		}
+		query.Set("cursor", response.NextCursor)
+	}
+
+	expected := []string{
+		"[composition-6 composition-5 composition-4]",
+		"[composition-3 composition-2 composition-1]",
+		"[composition-0]",
+	}
+	if fmt.Sprint(pages) != fmt.Sprint(expected) {
+		t.Errorf("expected pages %v, got %v", expected, pages)
+	}
+
+	// A cursor cannot be used with another sort
+	query.Set("sort", "name")
+	if _, status := list(t, engine, query); status != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", status)
+	}
+}
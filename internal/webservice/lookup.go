@@ -0,0 +1,197 @@
+package webservice
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	types "resource-tree-handler/apis"
+	cachehelper "resource-tree-handler/internal/cache"
+)
+
+const (
+	matchExact   = "exact"
+	matchPartial = "partial"
+)
+
+// ResourceMatch is a node of a cached resource tree matching a lookup, with the composition owning it
+type ResourceMatch struct {
+	CompositionId        string                    `json:"compositionId"`
+	CompositionKind      string                    `json:"compositionKind"`
+	CompositionName      string                    `json:"compositionName"`
+	CompositionNamespace string                    `json:"compositionNamespace"`
+	Resource             string                    `json:"resource,omitempty"`
+	Node                 *types.ResourceNodeStatus `json:"node"`
+}
+
+// LookupResponse are the nodes of the cached resource trees matching a lookup
+type LookupResponse struct {
+	Items []ResourceMatch `json:"items"`
+	// Total is the number of matching nodes, Items is truncated to the limit
+	Total int `json:"total"`
+	// CompositionIds are the compositions owning the matching nodes, including the ones not in Items
+	CompositionIds []string `json:"compositionIds"`
+}
+
+// resourceQuery are the fields of the nodes to look up, empty fields match everything
+type resourceQuery struct {
+	uid        string
+	apiVersion string
+	resource   string
+	kind       string
+	namespace  string
+	name       string
+	// partial matches kind and name as case insensitive substrings
+	partial bool
+	limit   int
+}
+
+func parseResourceQuery(c *gin.Context) (resourceQuery, error) {
+	query := resourceQuery{
+		uid:        c.Query("uid"),
+		apiVersion: c.Query("apiVersion"),
+		resource:   c.Query("resource"),
+		kind:       c.Query("kind"),
+		namespace:  c.Query("namespace"),
+		name:       c.Query("name"),
+		limit:      defaultListLimit,
+	}
+	switch match := c.DefaultQuery("match", matchExact); match {
+	case matchExact:
+	case matchPartial:
+		query.partial = true
+	default:
+		return resourceQuery{}, fmt.Errorf("invalid match %q, expected %s or %s", match, matchExact, matchPartial)
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxListLimit {
+			return resourceQuery{}, fmt.Errorf("invalid limit %q, expected a number between 1 and %d", value, maxListLimit)
+		}
+		query.limit = limit
+	}
+	if query == (resourceQuery{limit: query.limit, partial: query.partial}) {
+		return resourceQuery{}, fmt.Errorf("at least one of uid, apiVersion, resource, kind, namespace and name is required")
+	}
+	return query, nil
+}
+
+// candidates returns the ids of the cached compositions that may own matching nodes, through the reverse
+// indexes. It returns false when the query is not exact enough to use them, and the cache must be scanned.
+func (q resourceQuery) candidates(cache *cachehelper.ThreadSafeCache) ([]string, bool) {
+	switch {
+	case q.uid != "":
+		return cache.ByIndexFromCache(cachehelper.IndexByNodeUID, q.uid), true
+	case !q.partial && q.apiVersion != "" && q.resource != "" && q.name != "":
+		return cache.ByIndexFromCache(cachehelper.IndexByNodeResource, cachehelper.NodeIndexKey(q.apiVersion, q.resource, q.namespace, q.name)), true
+	}
+	return nil, false
+}
+
+// matches reports whether a node satisfies the query, the resource of the node is only known from the spec
+func (q resourceQuery) matches(node *types.ResourceNodeStatus, resource string) bool {
+	if node == nil {
+		return false
+	}
+	if q.uid != "" && (node.UID == nil || *node.UID != q.uid) {
+		return false
+	}
+	if q.apiVersion != "" && q.apiVersion != node.Version {
+		return false
+	}
+	if q.resource != "" && !strings.EqualFold(q.resource, resource) {
+		return false
+	}
+	if q.namespace != "" && q.namespace != node.Namespace {
+		return false
+	}
+	return q.matchesText(q.kind, node.Kind) && q.matchesText(q.name, node.Name)
+}
+
+func (q resourceQuery) matchesText(expected string, value string) bool {
+	if expected == "" {
+		return true
+	}
+	if q.partial {
+		return strings.Contains(strings.ToLower(value), strings.ToLower(expected))
+	}
+	return strings.EqualFold(expected, value)
+}
+
+// lookup returns the nodes of a cached resource tree matching the query, without the ones excluded by the filters
+func (q resourceQuery) lookup(compositionId string, entry *cachehelper.ResourceTreeUpdate) []ResourceMatch {
+	resources := specResources(entry)
+	matches := []ResourceMatch{}
+	for _, node := range cachehelper.FilterResourceTree(entry) {
+		resource := resources[specKey(node)]
+		if !q.matches(node, resource) {
+			continue
+		}
+		matches = append(matches, ResourceMatch{
+			CompositionId:        compositionId,
+			CompositionKind:      entry.CompositionReference.Kind,
+			CompositionName:      cmp.Or(entry.CompositionReference.Name, entry.ResourceTree.Resources.Name),
+			CompositionNamespace: cmp.Or(entry.CompositionReference.Namespace, entry.ResourceTree.Resources.Namespace),
+			Resource:             resource,
+			// The entries of RangeCache must not be retained
+			Node: node.DeepCopy(),
+		})
+	}
+	return matches
+}
+
+func (r *Webservice) handleLookup(c *gin.Context) {
+	query, err := parseResourceQuery(c)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, ErrorCodeBadRequest, "%s", err)
+		return
+	}
+
+	matches := map[string][]ResourceMatch{}
+	references := map[string]types.Reference{}
+	if candidates, ok := query.candidates(r.Cache); ok {
+		for _, compositionId := range candidates {
+			if entry, ok := r.Cache.GetResourceTreeFromCache(compositionId); ok {
+				matches[compositionId] = query.lookup(compositionId, entry)
+				references[compositionId] = entry.CompositionReference
+			}
+		}
+	} else {
+		r.Cache.RangeCache(func(compositionId string, entry *cachehelper.ResourceTreeUpdate) bool {
+			matches[compositionId] = query.lookup(compositionId, entry)
+			references[compositionId] = entry.CompositionReference
+			return true
+		})
+	}
+
+	// Checked out of RangeCache, since the access reviews may call the API server. The compositions the
+	// user cannot get are not returned, like the nodes the user cannot see.
+	if authorizer := r.nodeAuthorizer(c); authorizer != nil {
+		for compositionId, compositionMatches := range matches {
+			if len(compositionMatches) == 0 || !authorizer.canReadComposition(references[compositionId]) {
+				delete(matches, compositionId)
+				continue
+			}
+			matches[compositionId] = slices.DeleteFunc(compositionMatches, func(match ResourceMatch) bool {
+				return !authorizer.canSee(match.Node, match.Resource)
+			})
+		}
+	}
+
+	response := LookupResponse{Items: []ResourceMatch{}, CompositionIds: []string{}}
+	for _, compositionId := range slices.Sorted(maps.Keys(matches)) {
+		if len(matches[compositionId]) == 0 {
+			continue
+		}
+		response.CompositionIds = append(response.CompositionIds, compositionId)
+		response.Total += len(matches[compositionId])
+		response.Items = append(response.Items, matches[compositionId][:min(len(matches[compositionId]), query.limit-len(response.Items))]...)
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,69 @@
+package webservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	types "resource-tree-handler/apis"
+)
+
+// addTree caches a composition whose resource tree contains a Secret and a helm release with the given uids
+func addTree(r *Webservice, id string, secretName string, secretUid string, releaseUid string) {
+	secret := &types.ResourceNodeStatus{ResourceRefStatus: types.ResourceRefStatus{Version: "v1", Kind: "Secret", Namespace: "demo", Name: secretName}, UID: &secretUid}
+	release := &types.ResourceNodeStatus{ResourceRefStatus: types.ResourceRefStatus{Version: "helm.crossplane.io/v1beta1", Kind: "Release", Name: id + "-release"}, UID: &releaseUid}
+	resourceTree := types.ResourceTree{
+		CompositionId: id,
+		Resources: types.ResourceTreeJson{
+			Spec: types.ResourceTreeSpec{Tree: []types.ResourceNode{
+				{ResourceRef: types.ResourceRef{APIVersion: "v1", Resource: "secrets", Namespace: "demo", Name: secretName}},
+				{ResourceRef: types.ResourceRef{APIVersion: "helm.crossplane.io/v1beta1", Resource: "releases", Name: id + "-release"}},
+			}},
+			Status: []*types.ResourceNodeStatus{secret, release},
+		},
+	}
+	reference := types.Reference{ApiVersion: "composition.krateo.io/v1-2-0", Kind: "FireworksApp", Name: id, Namespace: "demo", Uid: id}
+	r.Cache.AddToCache(resourceTree, id, reference, types.Filters{})
+}
+
+func TestLookupResources(t *testing.T) {
+	engine, r := testEngine()
+	addTree(r, "a", "shared", "secret-uid", "release-a")
+	addTree(r, "b", "shared", "secret-uid", "release-b")
+	addTree(r, "c", "other", "other-uid", "release-c")
+
+	tests := []struct {
+		query        url.Values
+		items        int
+		compositions []string
+	}{
+		{url.Values{"uid": {"secret-uid"}}, 2, []string{"a", "b"}},
+		{url.Values{"apiVersion": {"v1"}, "resource": {"Secrets"}, "namespace": {"demo"}, "name": {"shared"}}, 2, []string{"a", "b"}},
+		{url.Values{"kind": {"release"}}, 3, []string{"a", "b", "c"}},
+		{url.Values{"name": {"C-REL"}, "match": {"partial"}}, 1, []string{"c"}},
+		{url.Values{"kind": {"secr"}, "match": {"partial"}, "limit": {"1"}}, 1, []string{"a", "b", "c"}},
+		{url.Values{"name": {"shared"}, "kind": {"Release"}}, 0, []string{}},
+	}
+	for _, tt := range tests {
+		recorder := serve(engine, http.MethodGet, apiV1Prefix+resourcesLookupEndpoint+"?"+tt.query.Encode())
+		if recorder.Code != http.StatusOK {
+			t.Errorf("%v: unexpected status %d", tt.query, recorder.Code)
+			continue
+		}
+		var response LookupResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		if len(response.Items) != tt.items || fmt.Sprint(response.CompositionIds) != fmt.Sprint(tt.compositions) {
+			t.Errorf("%v: expected %d items of %v, got %+v", tt.query, tt.items, tt.compositions, response)
+		}
+	}
+
+	for _, query := range []url.Values{{}, {"match": {"partial"}}, {"name": {"x"}, "match": {"fuzzy"}}, {"name": {"x"}, "limit": {"0"}}} {
+		if recorder := serve(engine, http.MethodGet, apiV1Prefix+resourcesLookupEndpoint+"?"+query.Encode()); recorder.Code != http.StatusBadRequest {
+			t.Errorf("%v: expected status 400, got %d", query, recorder.Code)
+		}
+	}
+}
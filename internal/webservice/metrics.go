@@ -0,0 +1,96 @@
+package webservice
+
+import (
+	"cmp"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	cachehelper "resource-tree-handler/internal/cache"
+	"resource-tree-handler/internal/metrics"
+)
+
+var (
+	jobQueueDepthDesc = prometheus.NewDesc(prometheus.BuildFQName(metrics.Namespace, "", "job_queue_depth"),
+		"Jobs waiting in the queue, by priority: high or low.", []string{"priority"}, nil)
+	cacheEntriesDesc = prometheus.NewDesc(prometheus.BuildFQName(metrics.Namespace, "", "cache_entries"),
+		"Resource trees in the cache.", nil, nil)
+	cacheSizeDesc = prometheus.NewDesc(prometheus.BuildFQName(metrics.Namespace, "", "cache_size_bytes"),
+		"Approximate size of the resource trees in the cache.", nil, nil)
+	cacheEvictionsDesc = prometheus.NewDesc(prometheus.BuildFQName(metrics.Namespace, "", "cache_evictions_total"),
+		"Resource trees evicted from the cache, by reason: maxEntries, maxBytes or idleTTL.", []string{"reason"}, nil)
+	compositionHealthDesc = prometheus.NewDesc(prometheus.BuildFQName(metrics.Namespace, "", "composition_health"),
+		"Health of the cached compositions: 1 healthy, 0 unhealthy, -1 unknown.",
+		[]string{"namespace", "name", "kind"}, nil)
+)
+
+// healthGaugeValues are the values of the composition health, a single series for each composition
+var healthGaugeValues = map[HealthState]float64{HealthStateHealthy: 1, HealthStateUnhealthy: 0, HealthStateUnknown: -1}
+
+// metricsCollector collects the metrics derived from the state of the webservice when scraped
+type metricsCollector struct {
+	r *Webservice
+}
+
+func (m metricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{jobQueueDepthDesc, cacheEntriesDesc, cacheSizeDesc, cacheEvictionsDesc, compositionHealthDesc} {
+		ch <- desc
+	}
+}
+
+func (m metricsCollector) Collect(ch chan<- prometheus.Metric) {
+	r := m.r
+	r.settingsMu.RLock()
+	high, low := len(r.jobQueue), len(r.lowPriorityJobQueue)
+	r.settingsMu.RUnlock()
+	ch <- prometheus.MustNewConstMetric(jobQueueDepthDesc, prometheus.GaugeValue, float64(high), metrics.PriorityHigh)
+	ch <- prometheus.MustNewConstMetric(jobQueueDepthDesc, prometheus.GaugeValue, float64(low), metrics.PriorityLow)
+
+	// Sent after the walk, so that the cache is not locked while the metrics are written
+	health, entries := []prometheus.Metric{}, 0
+	seen := map[[3]string]struct{}{}
+	r.Cache.RangeCache(func(compositionId string, entry *cachehelper.ResourceTreeUpdate) bool {
+		entries++
+		reference := entry.CompositionReference
+		metadata := entry.ResourceTree.Resources.ObjectMeta
+		state := HealthStateUnknown
+		if root := entry.ResourceTree.RootElementStatus; root != nil {
+			state = healthStateOf(root.Health)
+		}
+		// A composition recreated with another id may be cached twice for a while, the series must be unique
+		labels := [3]string{cmp.Or(reference.Namespace, metadata.Namespace), cmp.Or(reference.Name, metadata.Name, compositionId), reference.Kind}
+		if _, ok := seen[labels]; !ok {
+			seen[labels] = struct{}{}
+			health = append(health, prometheus.MustNewConstMetric(compositionHealthDesc, prometheus.GaugeValue, healthGaugeValues[state], labels[:]...))
+		}
+		return true
+	})
+	for _, metric := range health {
+		ch <- metric
+	}
+
+	// The stores without statistics report only the number of entries
+	stats, ok := r.Cache.Stats()
+	if !ok {
+		ch <- prometheus.MustNewConstMetric(cacheEntriesDesc, prometheus.GaugeValue, float64(entries))
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(cacheEntriesDesc, prometheus.GaugeValue, float64(stats.Entries))
+	ch <- prometheus.MustNewConstMetric(cacheSizeDesc, prometheus.GaugeValue, float64(stats.Bytes))
+	for _, reason := range []string{cachehelper.EvictionReasonMaxEntries, cachehelper.EvictionReasonMaxBytes, cachehelper.EvictionReasonIdleTTL} {
+		ch <- prometheus.MustNewConstMetric(cacheEvictionsDesc, prometheus.CounterValue, float64(stats.Evictions[reason]), reason)
+	}
+}
+
+// newMetricsHandler returns the handler of the metrics of the metrics package and of the webservice
+func (r *Webservice) newMetricsHandler() http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metricsCollector{r: r})
+	return promhttp.HandlerFor(prometheus.Gatherers{metrics.Registry, registry}, promhttp.HandlerOpts{})
+}
+
+func (r *Webservice) handleMetrics(c *gin.Context) {
+	r.metrics.ServeHTTP(c.Writer, c.Request)
+}
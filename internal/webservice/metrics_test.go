@@ -0,0 +1,70 @@
+package webservice
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"resource-tree-handler/internal/auth"
+	"resource-tree-handler/internal/ratelimit"
+)
+
+func TestMetrics(t *testing.T) {
+	engine, r := testEngine()
+	addComposition(r, "a", "dev", "FireworksApp", "True", nil)
+	addComposition(r, "b", "prod", "FireworksApp", "False", nil)
+
+	// The wait of a job is recorded when a worker takes it
+	r.jobQueue, r.lowPriorityJobQueue = make(chan CreateJobRequest, 2), make(chan CreateJobRequest, 2)
+	r.lowPriorityJobQueue <- CreateJobRequest{CompositionID: "a", QueuedAt: time.Now()}
+	r.lowPriorityJobQueue <- CreateJobRequest{CompositionID: "b", QueuedAt: time.Now()}
+	if _, ok := r.nextJob(make(chan struct{})); !ok {
+		t.Fatal("expected a job")
+	}
+
+	recorder := serve(engine, http.MethodGet, metricsEndpoint)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", recorder.Code)
+	}
+	body := recorder.Body.String()
+	for _, expected := range []string{
+		`resource_tree_handler_composition_health{kind="FireworksApp",name="a",namespace="dev"} 1`,
+		`resource_tree_handler_composition_health{kind="FireworksApp",name="b",namespace="prod"} 0`,
+		`resource_tree_handler_cache_entries 2`,
+		`resource_tree_handler_job_queue_depth{priority="high"} 0`,
+		`resource_tree_handler_job_queue_depth{priority="low"} 1`,
+		`resource_tree_handler_job_queue_wait_seconds_count{priority="low"}`,
+		`resource_tree_handler_sse_connected`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected %s in the metrics", expected)
+		}
+	}
+}
+
+func TestMetricsAuthentication(t *testing.T) {
+	for _, authenticated := range []bool{false, true} {
+		_, r := testEngine()
+		r.Authenticators = auth.Authenticators{tokenAuthenticator{}}
+		r.ReadRequirement = auth.Requirement{Methods: []auth.Method{auth.MethodStatic}}
+		r.RateLimits = map[ratelimit.Class]ratelimit.Limits{ratelimit.ClassRead: {Client: ratelimit.Limit{Rate: 1, Burst: 1}}}
+		r.MetricsAuthenticated = authenticated
+		engine := gin.New()
+		r.registerRoutes(engine)
+
+		// Public by default: scraped without a token, and more often than the read rate limits allow
+		expected := []int{http.StatusOK, http.StatusOK, http.StatusOK}
+		if authenticated {
+			expected = []int{http.StatusUnauthorized, http.StatusTooManyRequests, http.StatusTooManyRequests}
+		}
+		for _, status := range expected {
+			if recorder := serve(engine, http.MethodGet, metricsEndpoint); recorder.Code != status {
+				t.Errorf("authenticated %t: expected status %d, got %d", authenticated, status, recorder.Code)
+			}
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package webservice
+
+import (
+	"cmp"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/labels"
+
+	cachehelper "resource-tree-handler/internal/cache"
+)
+
+// Maximum number of bulk refreshes kept to be polled, the oldest completed ones are forgotten first
+const maxRefreshes = 100
+
+// RefreshSelector selects the cached compositions to rebuild. The fields are combined, repeated values are
+// alternatives. All must be set to rebuild every cached composition, so that an empty selector is not a mistake.
+type RefreshSelector struct {
+	Namespaces    []string      `json:"namespaces,omitempty"`
+	Kinds         []string      `json:"kinds,omitempty"`
+	LabelSelector string        `json:"labelSelector,omitempty"`
+	Health        []HealthState `json:"health,omitempty"`
+	All           bool          `json:"all,omitempty"`
+}
+
+type RefreshState string
+
+const (
+	RefreshStateRunning   RefreshState = "running"
+	RefreshStateCompleted RefreshState = "completed"
+)
+
+type RefreshItemState string
+
+const (
+	RefreshItemQueued    RefreshItemState = "queued"
+	RefreshItemSucceeded RefreshItemState = "succeeded"
+	RefreshItemFailed    RefreshItemState = "failed"
+	// Skipped compositions were busy or queued, or the job queue was full
+	RefreshItemSkipped RefreshItemState = "skipped"
+)
+
+// RefreshItem is the progress of the rebuild of a composition in a bulk refresh
+type RefreshItem struct {
+	CompositionId string           `json:"compositionId"`
+	State         RefreshItemState `json:"state"`
+	Error         string           `json:"error,omitempty"`
+}
+
+// RefreshStatus is the progress of a bulk refresh
+type RefreshStatus struct {
+	Id          string          `json:"id"`
+	Selector    RefreshSelector `json:"selector"`
+	State       RefreshState    `json:"state"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	CompletedAt *time.Time      `json:"completedAt,omitempty"`
+	// Total is the number of compositions matching the selector, including the skipped ones
+	Total        int           `json:"total"`
+	Queued       int           `json:"queued"`
+	Succeeded    int           `json:"succeeded"`
+	Failed       int           `json:"failed"`
+	Skipped      int           `json:"skipped"`
+	Compositions []RefreshItem `json:"compositions"`
+}
+
+// refreshes tracks the bulk refreshes, the jobs of a refresh report their result through the RefreshId of the job
+type refreshes struct {
+	mu         sync.Mutex
+	operations map[string]*refreshOperation
+	// order are the ids of the operations, oldest first
+	order []string
+}
+
+type refreshOperation struct {
+	id          string
+	selector    RefreshSelector
+	createdAt   time.Time
+	completedAt time.Time
+	items       map[string]*RefreshItem
+	pending     int
+}
+
+// add starts tracking a refresh, forgetting the oldest ones beyond maxRefreshes
+func (r *refreshes) add(operation *refreshOperation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.operations == nil {
+		r.operations = make(map[string]*refreshOperation)
+	}
+	for len(r.order) >= maxRefreshes {
+		index := slices.IndexFunc(r.order, func(id string) bool { return r.operations[id].pending == 0 })
+		if index < 0 {
+			index = 0
+		}
+		delete(r.operations, r.order[index])
+		r.order = slices.Delete(r.order, index, index+1)
+	}
+	if operation.pending == 0 {
+		operation.completedAt = operation.createdAt
+	}
+	r.operations[operation.id] = operation
+	r.order = append(r.order, operation.id)
+}
+
+// complete records the result of the job of a composition, refreshes forgotten in the meantime are ignored
+func (r *refreshes) complete(refreshId string, compositionId string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	operation, ok := r.operations[refreshId]
+	if !ok {
+		return
+	}
+	item, ok := operation.items[compositionId]
+	if !ok || item.State != RefreshItemQueued {
+		return
+	}
+	item.State = RefreshItemSucceeded
+	if err != nil {
+		item.State = RefreshItemFailed
+		item.Error = err.Error()
+	}
+	if operation.pending--; operation.pending == 0 {
+		operation.completedAt = time.Now()
+		log.Info().Msgf("Bulk refresh %s completed", refreshId)
+	}
+}
+
+// skip records a composition of a refresh that could not be queued
+func (r *refreshes) skip(refreshId string, compositionId string, reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	operation, ok := r.operations[refreshId]
+	if !ok {
+		return
+	}
+	if item, ok := operation.items[compositionId]; ok && item.State == RefreshItemQueued {
+		item.State = RefreshItemSkipped
+		item.Error = reason
+		if operation.pending--; operation.pending == 0 {
+			operation.completedAt = time.Now()
+		}
+	}
+}
+
+func (r *refreshes) status(refreshId string) (RefreshStatus, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	operation, ok := r.operations[refreshId]
+	if !ok {
+		return RefreshStatus{}, false
+	}
+	return operation.status(), true
+}
+
+func (o *refreshOperation) status() RefreshStatus {
+	status := RefreshStatus{
+		Id:           o.id,
+		Selector:     o.selector,
+		State:        RefreshStateRunning,
+		CreatedAt:    o.createdAt,
+		Total:        len(o.items),
+		Compositions: []RefreshItem{},
+	}
+	if o.pending == 0 {
+		status.State = RefreshStateCompleted
+		status.CompletedAt = &o.completedAt
+	}
+	for _, compositionId := range slices.Sorted(maps.Keys(o.items)) {
+		item := *o.items[compositionId]
+		switch item.State {
+		case RefreshItemQueued:
+			status.Queued++
+		case RefreshItemSucceeded:
+			status.Succeeded++
+		case RefreshItemFailed:
+			status.Failed++
+		case RefreshItemSkipped:
+			status.Skipped++
+		}
+		status.Compositions = append(status.Compositions, item)
+	}
+	return status
+}
+
+// listOptions returns the filters of the listing equivalent to the selector
+func (s RefreshSelector) listOptions() (listOptions, error) {
+	empty := len(s.Namespaces) == 0 && len(s.Kinds) == 0 && s.LabelSelector == "" && len(s.Health) == 0
+	if s.All != empty {
+		return listOptions{}, fmt.Errorf("either all or at least one of namespaces, kinds, labelSelector and health is required")
+	}
+	health, err := parseHealthStates(healthValues(s.Health))
+	if err != nil {
+		return listOptions{}, err
+	}
+	selector, err := labels.Parse(s.LabelSelector)
+	if err != nil {
+		return listOptions{}, fmt.Errorf("invalid labelSelector: %w", err)
+	}
+	return listOptions{namespaces: s.Namespaces, kinds: s.Kinds, health: health, selector: selector}, nil
+}
+
+func healthValues(states []HealthState) []string {
+	values := []string{}
+	for _, state := range states {
+		values = append(values, string(state))
+	}
+	return values
+}
+
+func newRefreshId() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// handleBulkRefresh queues the rebuild of the cached compositions matching the selector and returns the
+// refresh to poll. The jobs go through the job queue like the other rebuilds: the compositions already
+// busy or queued, and the ones that do not fit in the queue, are skipped.
+func (r *Webservice) handleBulkRefresh(c *gin.Context) {
+	var selector RefreshSelector
+	if err := c.ShouldBindJSON(&selector); err != nil {
+		writeError(c, http.StatusBadRequest, ErrorCodeBadRequest, "could not parse the selector: %s", err)
+		return
+	}
+	options, err := selector.listOptions()
+	if err != nil {
+		writeError(c, http.StatusBadRequest, ErrorCodeBadRequest, "%s", err)
+		return
+	}
+
+	jobs := []CreateJobRequest{}
+	r.Cache.RangeCache(func(compositionId string, entry *cachehelper.ResourceTreeUpdate) bool {
+		summary := summarize(compositionId, entry)
+		if options.matches(&summary) {
+			jobs = append(jobs, CreateJobRequest{CompositionReference: entry.CompositionReference, CompositionID: compositionId})
+		}
+		return true
+	})
+	slices.SortFunc(jobs, func(a, b CreateJobRequest) int { return cmp.Compare(a.CompositionID, b.CompositionID) })
+
+	operation := &refreshOperation{
+		id:        newRefreshId(),
+		selector:  selector,
+		createdAt: time.Now(),
+		items:     make(map[string]*RefreshItem),
+	}
+	for _, job := range jobs {
+		operation.items[job.CompositionID] = &RefreshItem{CompositionId: job.CompositionID, State: RefreshItemQueued}
+	}
+	operation.pending = len(jobs)
+	// Tracked before queueing the jobs, so that the workers find it
+	r.refreshes.add(operation)
+
+	for _, job := range jobs {
+		job.RefreshId = operation.id
+		if !r.continueOperationsWithComposition(job.CompositionID) {
+			r.refreshes.skip(operation.id, job.CompositionID, "busy or queued")
+			continue
+		}
+		r.setContinueOperationsWithComposition(job.CompositionID, queuedString)
+		job.QueuedAt = time.Now()
+		select {
+		case r.jobQueue <- job:
+		default:
+			r.setContinueOperationsWithComposition(job.CompositionID, freeString)
+			r.refreshes.skip(operation.id, job.CompositionID, "the job queue is full")
+		}
+	}
+
+	status, _ := r.refreshes.status(operation.id)
+	log.Info().Msgf("Bulk refresh %s: %d resource trees queued for rebuild, %d skipped", operation.id, status.Total-status.Skipped, status.Skipped)
+	c.Header("Location", apiV1Prefix+refreshesEndpoint+"/"+operation.id)
+	c.JSON(http.StatusAccepted, status)
+}
+
+func (r *Webservice) handleRefreshStatus(c *gin.Context) {
+	refreshId := c.Param("refreshId")
+	status, ok := r.refreshes.status(refreshId)
+	if !ok {
+		writeError(c, http.StatusNotFound, ErrorCodeNotFound, "no bulk refresh with id %s", refreshId)
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
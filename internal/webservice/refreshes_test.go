@@ -0,0 +1,88 @@
+package webservice
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func bulkRefresh(t *testing.T, engine *gin.Engine, body string) (RefreshStatus, *httptest.ResponseRecorder) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, apiV1Prefix+refreshesEndpoint, strings.NewReader(body)))
+	var status RefreshStatus
+	if recorder.Code == http.StatusAccepted {
+		if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return status, recorder
+}
+
+func TestBulkRefresh(t *testing.T) {
+	engine, r := testEngine()
+	r.jobQueue = make(chan CreateJobRequest, 1)
+	addComposition(r, "a", "dev", "FireworksApp", "True", nil)
+	addComposition(r, "b", "dev", "FireworksApp", "False", nil)
+	addComposition(r, "c", "dev", "FireworksApp", "False", nil)
+	addComposition(r, "d", "prod", "FireworksApp", "False", nil)
+	r.setContinueOperationsWithComposition("a", busyString)
+
+	// a is busy, b is queued and c does not fit in the queue
+	status, recorder := bulkRefresh(t, engine, `{"namespaces": ["dev"]}`)
+	if recorder.Code != http.StatusAccepted || recorder.Header().Get("Location") != apiV1Prefix+refreshesEndpoint+"/"+status.Id {
+		t.Fatalf("unexpected response %d %s", recorder.Code, recorder.Body)
+	}
+	if status.State != RefreshStateRunning || status.Total != 3 || status.Queued != 1 || status.Skipped != 2 || status.Compositions[1].State != RefreshItemQueued {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if job := <-r.jobQueue; job.CompositionID != "b" || job.RefreshId != status.Id || job.Resync {
+		t.Errorf("unexpected job %+v", job)
+	}
+
+	r.refreshes.complete(status.Id, "b", errors.New("boom"))
+	recorder = serve(engine, http.MethodGet, apiV1Prefix+refreshesEndpoint+"/"+status.Id)
+	if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.State != RefreshStateCompleted || status.CompletedAt == nil || status.Failed != 1 || status.Compositions[1].Error != "boom" {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	status, _ = bulkRefresh(t, engine, `{"health": ["Unhealthy"], "labelSelector": "team=platform"}`)
+	if status.State != RefreshStateCompleted || status.Total != 0 {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	for _, body := range []string{`{}`, `{"all": true, "namespaces": ["dev"]}`, `{"health": ["sick"]}`, `{"labelSelector": "a in"}`, `[`} {
+		if _, recorder := bulkRefresh(t, engine, body); recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", body, recorder.Code)
+		}
+	}
+	if recorder := serve(engine, http.MethodGet, apiV1Prefix+refreshesEndpoint+"/missing"); recorder.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", recorder.Code)
+	}
+}
+
+func TestRefreshesRetention(t *testing.T) {
+	var refreshes refreshes
+	refreshes.add(&refreshOperation{id: "running", items: map[string]*RefreshItem{"a": {CompositionId: "a", State: RefreshItemQueued}}, pending: 1})
+	for i := range maxRefreshes {
+		refreshes.add(&refreshOperation{id: string(rune('A' + i))})
+	}
+	// The oldest completed refresh is forgotten first
+	if _, ok := refreshes.status("running"); !ok {
+		t.Error("running refresh forgotten")
+	}
+	if _, ok := refreshes.status("A"); ok {
+		t.Error("oldest completed refresh kept")
+	}
+	if len(refreshes.order) != maxRefreshes {
+		t.Errorf("expected %d refreshes, got %d", maxRefreshes, len(refreshes.order))
+	}
+}
@@ -0,0 +1,99 @@
+package webservice
+
+import (
+	"cmp"
+	"maps"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"resource-tree-handler/internal/ratelimit"
+)
+
+// Settings changed at runtime when the configuration is reloaded, see configuration.Reloader. They can be called
+// before Spinup.
+
+// SetWorkers resizes the worker pool, the workers in excess stop after their current job
+func (r *Webservice) SetWorkers(workers int) {
+	r.settingsMu.Lock()
+	defer r.settingsMu.Unlock()
+	if workers == r.Workers {
+		return
+	}
+	r.Workers = workers
+	if r.jobQueue == nil {
+		// Started by initWorkerPool
+		return
+	}
+	r.resizeWorkerPool()
+	log.Info().Msgf("Resized the worker pool to %d workers", len(r.workerStops))
+}
+
+// resizeWorkerPool starts or stops workers until there are Workers, called with settingsMu held
+func (r *Webservice) resizeWorkerPool() {
+	workers := cmp.Or(r.Workers, defaultWorkers)
+	for len(r.workerStops) < workers {
+		stop := make(chan struct{})
+		r.workerStops = append(r.workerStops, stop)
+		r.workersWg.Add(1)
+		go r.startWorker(len(r.workerStops)-1, stop)
+	}
+	for len(r.workerStops) > workers {
+		last := len(r.workerStops) - 1
+		close(r.workerStops[last])
+		r.workerStops = r.workerStops[:last]
+	}
+}
+
+// SetRateLimits replaces the rate limits, the limiters of the classes start over with full buckets
+func (r *Webservice) SetRateLimits(limits map[ratelimit.Class]ratelimit.Limits) {
+	r.settingsMu.Lock()
+	if maps.Equal(r.RateLimits, limits) {
+		r.settingsMu.Unlock()
+		return
+	}
+	r.RateLimits = maps.Clone(limits)
+	r.settingsMu.Unlock()
+
+	r.limiters.mu.Lock()
+	r.limiters.byClass = nil
+	r.limiters.mu.Unlock()
+}
+
+// SetResync changes the period and the jitter of the background resync, from the next period
+func (r *Webservice) SetResync(period time.Duration, jitter time.Duration) {
+	r.settingsMu.Lock()
+	if period == r.ResyncPeriod && jitter == r.ResyncJitter {
+		r.settingsMu.Unlock()
+		return
+	}
+	r.ResyncPeriod, r.ResyncJitter = period, jitter
+	r.settingsMu.Unlock()
+
+	select {
+	case r.resyncWakeup() <- struct{}{}:
+	default:
+		// A change is already pending, runResync reads the latest settings
+	}
+}
+
+// resyncWakeup returns the channel waking runResync up when the settings change
+func (r *Webservice) resyncWakeup() chan struct{} {
+	r.settingsMu.Lock()
+	defer r.settingsMu.Unlock()
+	if r.resyncChanged == nil {
+		r.resyncChanged = make(chan struct{}, 1)
+	}
+	return r.resyncChanged
+}
+
+// handleConfig returns the configuration applied, with the changes waiting for a restart
+func (r *Webservice) handleConfig(c *gin.Context) {
+	if r.ConfigReloader == nil {
+		writeError(c, http.StatusNotImplemented, ErrorCodeNotImplemented, "the configuration is not available")
+		return
+	}
+	c.JSON(http.StatusOK, r.ConfigReloader.Effective())
+}
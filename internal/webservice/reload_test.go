@@ -0,0 +1,69 @@
+package webservice
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"resource-tree-handler/internal/ratelimit"
+)
+
+func TestSetWorkers(t *testing.T) {
+	_, r := testEngine()
+	r.Workers = 2
+	r.initWorkerPool()
+	if len(r.workerStops) != 2 {
+		t.Fatalf("expected 2 workers, got %d", len(r.workerStops))
+	}
+	r.SetWorkers(5)
+	if len(r.workerStops) != 5 {
+		t.Fatalf("expected 5 workers, got %d", len(r.workerStops))
+	}
+	stopped := r.workerStops[1:]
+	r.SetWorkers(1)
+	if len(r.workerStops) != 1 {
+		t.Fatalf("expected 1 worker, got %d", len(r.workerStops))
+	}
+	for _, stop := range stopped {
+		if _, open := <-stop; open {
+			t.Error("expected the workers in excess to be stopped")
+		}
+	}
+}
+
+func TestSetRateLimits(t *testing.T) {
+	engine, r := testEngine()
+	path := apiV1Prefix + compositionsEndpoint
+	if recorder := serve(engine, http.MethodGet, path); recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", recorder.Code)
+	}
+	r.SetRateLimits(map[ratelimit.Class]ratelimit.Limits{ratelimit.ClassRead: {Global: ratelimit.Limit{Rate: 0.001, Burst: 1}}})
+	serve(engine, http.MethodGet, path)
+	if recorder := serve(engine, http.MethodGet, path); recorder.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the new limits to be applied, got %d", recorder.Code)
+	}
+	r.SetRateLimits(nil)
+	if recorder := serve(engine, http.MethodGet, path); recorder.Code != http.StatusOK {
+		t.Errorf("expected the limits to be removed, got %d", recorder.Code)
+	}
+}
+
+func TestSetResync(t *testing.T) {
+	_, r := testEngine()
+	r.SetResync(time.Hour, time.Minute)
+	if period, jitter := r.resyncSettings(); period != time.Hour || jitter != time.Minute {
+		t.Errorf("unexpected settings %s %s", period, jitter)
+	}
+	select {
+	case <-r.resyncWakeup():
+	default:
+		t.Error("expected the resync to be woken up")
+	}
+}
+
+func TestConfigNotAvailable(t *testing.T) {
+	engine, _ := testEngine()
+	if recorder := serve(engine, http.MethodGet, apiV1Prefix+configEndpoint); recorder.Code != http.StatusNotImplemented {
+		t.Errorf("expected 501, got %d", recorder.Code)
+	}
+}
@@ -0,0 +1,276 @@
+package webservice
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
+
+	types "resource-tree-handler/apis"
+	cachehelper "resource-tree-handler/internal/cache"
+	kubehelper "resource-tree-handler/internal/helpers/kube/client"
+	schemahelper "resource-tree-handler/internal/helpers/kube/schema"
+)
+
+// ResolveResponse identifies the composition matching the parameters of the resolve endpoints
+type ResolveResponse struct {
+	CompositionId string `json:"compositionId"`
+	ApiVersion    string `json:"apiVersion"`
+	Kind          string `json:"kind"`
+	Resource      string `json:"resource"`
+	Name          string `json:"name"`
+	Namespace     string `json:"namespace"`
+	// Cached is false when the composition was found through the Kubernetes API
+	Cached bool `json:"cached"`
+}
+
+// AmbiguousResponse is the body of the resolve endpoints when more than one composition matches
+type AmbiguousResponse struct {
+	Error      ErrorDetail          `json:"error"`
+	Candidates []CompositionSummary `json:"candidates"`
+}
+
+// compositionQuery is the composition to resolve, from the query parameters or the composition labels
+type compositionQuery struct {
+	uid       string
+	group     string
+	version   string
+	kind      string
+	resource  string
+	namespace string
+	name      string
+}
+
+// compositionLabels maps the labels of the CompositionReferences, krateo.io/composition-* by default, to the fields
+// of a compositionQuery
+func compositionLabels() map[string]func(query *compositionQuery) *string {
+	labels := schemahelper.Get().Labels
+	return map[string]func(query *compositionQuery) *string{
+		labels.Id:               func(query *compositionQuery) *string { return &query.uid },
+		labels.Group:            func(query *compositionQuery) *string { return &query.group },
+		labels.InstalledVersion: func(query *compositionQuery) *string { return &query.version },
+		labels.Kind:             func(query *compositionQuery) *string { return &query.kind },
+		labels.Resource:         func(query *compositionQuery) *string { return &query.resource },
+		labels.Namespace:        func(query *compositionQuery) *string { return &query.namespace },
+		labels.Name:             func(query *compositionQuery) *string { return &query.name },
+	}
+}
+
+// errAmbiguous is returned by resolve when more than one cached composition matches
+var errAmbiguous = errors.New("more than one composition matches")
+
+func parseCompositionQuery(c *gin.Context) (compositionQuery, error) {
+	query := compositionQuery{
+		uid:       c.Query("uid"),
+		kind:      c.Query("kind"),
+		resource:  c.Query("resource"),
+		namespace: c.Query("namespace"),
+		name:      c.Query("name"),
+	}
+	if apiVersion := c.Query("apiVersion"); apiVersion != "" {
+		// Either group/version or only the group, unlike schema.ParseGroupVersion
+		query.group, query.version, _ = strings.Cut(apiVersion, "/")
+	}
+
+	if value := c.Query("labelSelector"); value != "" {
+		selector, err := labels.Parse(value)
+		if err != nil {
+			return compositionQuery{}, fmt.Errorf("invalid labelSelector: %w", err)
+		}
+		requirements, _ := selector.Requirements()
+		fields := compositionLabels()
+		for _, requirement := range requirements {
+			field, ok := fields[requirement.Key()]
+			if !ok {
+				return compositionQuery{}, fmt.Errorf("invalid labelSelector: %s is not a label of the compositions", requirement.Key())
+			}
+			values := requirement.Values().List()
+			if operator := requirement.Operator(); (operator != selection.Equals && operator != selection.DoubleEquals && operator != selection.In) || len(values) != 1 {
+				return compositionQuery{}, fmt.Errorf("invalid labelSelector: only equality is supported on %s", requirement.Key())
+			}
+			if current := field(&query); *current != "" && *current != values[0] {
+				return compositionQuery{}, fmt.Errorf("invalid labelSelector: %s conflicts with the query parameters", requirement.Key())
+			}
+			*field(&query) = values[0]
+		}
+	}
+
+	if query.uid == "" && query.name == "" {
+		return compositionQuery{}, fmt.Errorf("either uid or name is required")
+	}
+	return query, nil
+}
+
+// matches reports whether the reference of a cached composition satisfies the query
+func (q compositionQuery) matches(compositionId string, reference types.Reference) bool {
+	gv, _ := schema.ParseGroupVersion(reference.ApiVersion)
+	return (q.uid == "" || q.uid == compositionId) &&
+		(q.group == "" || q.group == gv.Group) &&
+		(q.version == "" || q.version == gv.Version) &&
+		(q.kind == "" || strings.EqualFold(q.kind, reference.Kind)) &&
+		(q.resource == "" || strings.EqualFold(q.resource, reference.Resource)) &&
+		(q.namespace == "" || q.namespace == reference.Namespace) &&
+		(q.name == "" || q.name == reference.Name)
+}
+
+// candidates returns the ids of the cached compositions matching the query, through the most selective index.
+// The index keys include the namespace, so the cache is scanned when it is missing.
+func (q compositionQuery) candidates(cache *cachehelper.ThreadSafeCache) []string {
+	matching := []string{}
+	if q.uid == "" && q.namespace == "" {
+		cache.RangeCache(func(compositionId string, entry *cachehelper.ResourceTreeUpdate) bool {
+			if q.matches(compositionId, entry.CompositionReference) {
+				matching = append(matching, compositionId)
+			}
+			return true
+		})
+		slices.Sort(matching)
+		return matching
+	}
+
+	var compositionIds []string
+	switch {
+	case q.uid != "":
+		compositionIds = []string{q.uid}
+	case q.group != "" && q.kind != "":
+		compositionIds = cache.ByIndexFromCache(cachehelper.IndexByKind, cachehelper.ObjectIndexKey(q.group, q.kind, q.namespace, q.name))
+	case q.group != "" && q.resource != "":
+		compositionIds = cache.ByIndexFromCache(cachehelper.IndexByResource, cachehelper.ObjectIndexKey(q.group, q.resource, q.namespace, q.name))
+	default:
+		compositionIds = cache.ByIndexFromCache(cachehelper.IndexByName, cachehelper.NameIndexKey(q.namespace, q.name))
+	}
+	for _, compositionId := range compositionIds {
+		entry, ok := cache.GetResourceTreeFromCache(compositionId)
+		if ok && q.matches(compositionId, entry.CompositionReference) {
+			matching = append(matching, compositionId)
+		}
+	}
+	slices.Sort(matching)
+	return matching
+}
+
+// resolve returns the id and the reference of the composition matching the query. Cached compositions
+// are preferred; otherwise, the composition is retrieved from the Kubernetes API when the query is complete.
+func (r *Webservice) resolve(c *gin.Context, query compositionQuery) (ResolveResponse, []string, error) {
+	// The compositions the user cannot get are neither resolved nor listed as candidates
+	authorizer := r.nodeAuthorizer(c)
+	candidates := slices.DeleteFunc(query.candidates(r.Cache), func(compositionId string) bool {
+		entry, ok := r.Cache.GetResourceTreeFromCache(compositionId)
+		return !ok || !authorizer.canReadComposition(entry.CompositionReference)
+	})
+	if len(candidates) > 1 {
+		return ResolveResponse{}, candidates, errAmbiguous
+	}
+	if len(candidates) == 1 {
+		entry, _ := r.Cache.GetResourceTreeFromCache(candidates[0])
+		return newResolveResponse(candidates[0], entry.CompositionReference, true), nil, nil
+	}
+
+	if query.uid != "" {
+		_, reference, err := r.compositionById(query.uid)
+		if err != nil {
+			return ResolveResponse{}, nil, err
+		}
+		if !query.matches(query.uid, *reference) {
+			return ResolveResponse{}, nil, fmt.Errorf("composition %s does not match the query", query.uid)
+		}
+		return newResolveResponse(query.uid, *reference, false), nil, nil
+	}
+	if query.group == "" || query.version == "" || query.name == "" || (query.kind == "" && query.resource == "") {
+		return ResolveResponse{}, nil, fmt.Errorf("no cached composition matches, apiVersion with a version, kind or resource, and name are required to look it up in the cluster")
+	}
+	reference := types.Reference{
+		ApiVersion: schema.GroupVersion{Group: query.group, Version: query.version}.String(),
+		Kind:       query.kind,
+		Resource:   query.resource,
+		Name:       query.name,
+		Namespace:  query.namespace,
+	}
+	if reference.Resource == "" {
+		reference.Resource = kubehelper.InferGroupResource(reference.ApiVersion, reference.Kind).Resource
+	}
+	obj, err := kubehelper.GetObj(c.Request.Context(), &reference, r.Config)
+	if err != nil {
+		log.Warn().Err(err).Msgf("could not resolve composition %s %s %s/%s", reference.ApiVersion, reference.Resource, reference.Namespace, reference.Name)
+		return ResolveResponse{}, nil, err
+	}
+	reference.Kind = obj.GetKind()
+	return newResolveResponse(string(obj.GetUID()), reference, false), nil, nil
+}
+
+func newResolveResponse(compositionId string, reference types.Reference, cached bool) ResolveResponse {
+	return ResolveResponse{
+		CompositionId: compositionId,
+		ApiVersion:    reference.ApiVersion,
+		Kind:          reference.Kind,
+		Resource:      reference.Resource,
+		Name:          reference.Name,
+		Namespace:     reference.Namespace,
+		Cached:        cached,
+	}
+}
+
+// resolveOrAbort resolves the composition of the request, writing the error response when it cannot be resolved
+func (r *Webservice) resolveOrAbort(c *gin.Context) (ResolveResponse, bool) {
+	query, err := parseCompositionQuery(c)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, ErrorCodeBadRequest, "%s", err)
+		return ResolveResponse{}, false
+	}
+	resolved, candidates, err := r.resolve(c, query)
+	switch {
+	case errors.Is(err, errAmbiguous):
+		response := AmbiguousResponse{Error: ErrorDetail{Code: ErrorCodeAmbiguous, Message: fmt.Sprintf("%d compositions match, add apiVersion, kind or namespace", len(candidates))}}
+		for _, compositionId := range candidates {
+			if entry, ok := r.Cache.GetResourceTreeFromCache(compositionId); ok {
+				response.Candidates = append(response.Candidates, summarize(compositionId, entry))
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusConflict, response)
+		return ResolveResponse{}, false
+	case err != nil:
+		writeError(c, http.StatusNotFound, ErrorCodeNotFound, "%s", err)
+		return ResolveResponse{}, false
+	case !r.nodeAuthorizer(c).canReadComposition(*resolved.reference()):
+		// Not found rather than forbidden, so that the existence of the composition is not disclosed
+		writeError(c, http.StatusNotFound, ErrorCodeNotFound, "no composition matches the query")
+		return ResolveResponse{}, false
+	}
+	return resolved, true
+}
+
+func (resolved ResolveResponse) reference() *types.Reference {
+	return &types.Reference{
+		ApiVersion: resolved.ApiVersion,
+		Kind:       resolved.Kind,
+		Resource:   resolved.Resource,
+		Name:       resolved.Name,
+		Namespace:  resolved.Namespace,
+		Uid:        resolved.CompositionId,
+	}
+}
+
+func (r *Webservice) handleResolve(c *gin.Context) {
+	if resolved, ok := r.resolveOrAbort(c); ok {
+		c.JSON(http.StatusOK, resolved)
+	}
+}
+
+func (r *Webservice) handleResolveTree(c *gin.Context) {
+	if resolved, ok := r.resolveOrAbort(c); ok {
+		r.serveResourceTree(c, resolved.CompositionId, resolved.reference())
+	}
+}
+
+func (r *Webservice) handleResolveRefresh(c *gin.Context) {
+	if resolved, ok := r.resolveOrAbort(c); ok {
+		r.refresh(c, resolved.CompositionId, resolved.reference())
+	}
+}
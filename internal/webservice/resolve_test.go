@@ -0,0 +1,103 @@
+package webservice
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	cachehelper "resource-tree-handler/internal/cache"
+	schemahelper "resource-tree-handler/internal/helpers/kube/schema"
+)
+
+func TestResolveComposition(t *testing.T) {
+	engine, r := testEngine()
+	addComposition(r, "a", "dev", "FireworksApp", "True", nil)
+	addComposition(r, "b", "prod", "FireworksApp", "True", nil)
+	addComposition(r, "c", "prod", "PostgreSQL", "True", nil)
+	// Same name as "b" in another namespace
+	addComposition(r, "b-dev", "dev", "FireworksApp", "True", nil)
+	r.Cache.QueueUpdate("b-dev", func(update *cachehelper.ResourceTreeUpdate) error {
+		update.CompositionReference.Name = "b"
+		return nil
+	})
+
+	tests := []struct {
+		query    url.Values
+		status   int
+		expected string
+	}{
+		{url.Values{"namespace": {"dev"}, "name": {"a"}}, http.StatusOK, "a"},
+		{url.Values{"apiVersion": {"composition.krateo.io"}, "kind": {"fireworksapp"}, "namespace": {"prod"}, "name": {"b"}}, http.StatusOK, "b"},
+		{url.Values{"apiVersion": {"composition.krateo.io/v1-2-0"}, "name": {"c"}}, http.StatusOK, "c"},
+		{url.Values{"labelSelector": {"krateo.io/composition-name=b,krateo.io/composition-namespace=dev"}}, http.StatusOK, "b-dev"},
+		{url.Values{"uid": {"c"}, "namespace": {"prod"}}, http.StatusOK, "c"},
+		{url.Values{"name": {"b"}}, http.StatusConflict, ""},
+		{url.Values{"namespace": {"dev"}, "name": {"missing"}}, http.StatusNotFound, ""},
+		{url.Values{"apiVersion": {"composition.krateo.io/v2"}, "name": {"c"}}, http.StatusNotFound, ""},
+		{url.Values{"namespace": {"dev"}}, http.StatusBadRequest, ""},
+		{url.Values{"labelSelector": {"env=prod"}}, http.StatusBadRequest, ""},
+		{url.Values{"labelSelector": {"krateo.io/composition-name!=b"}}, http.StatusBadRequest, ""},
+		{url.Values{"name": {"a"}, "labelSelector": {"krateo.io/composition-name=b"}}, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		recorder := serve(engine, http.MethodGet, apiV1Prefix+resolveEndpoint+"?"+tt.query.Encode())
+		if recorder.Code != tt.status {
+			t.Errorf("%v: expected status %d, got %d: %s", tt.query, tt.status, recorder.Code, recorder.Body)
+			continue
+		}
+		switch tt.status {
+		case http.StatusOK:
+			var response ResolveResponse
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if response.CompositionId != tt.expected || !response.Cached {
+				t.Errorf("%v: expected %s, got %+v", tt.query, tt.expected, response)
+			}
+		case http.StatusConflict:
+			var response AmbiguousResponse
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if response.Error.Code != ErrorCodeAmbiguous || len(response.Candidates) != 2 {
+				t.Errorf("%v: unexpected response %+v", tt.query, response)
+			}
+		}
+	}
+
+	recorder := serve(engine, http.MethodGet, apiV1Prefix+resolveTreeEndpoint+"?namespace=prod&name=c")
+	entry, _ := r.Cache.GetResourceTreeFromCache("c")
+	if recorder.Code != http.StatusOK || recorder.Header().Get("ETag") != entry.ETag() {
+		t.Errorf("unexpected tree response %d with ETag %q", recorder.Code, recorder.Header().Get("ETag"))
+	}
+}
+
+func TestCompositionSchema(t *testing.T) {
+	custom := schemahelper.Default()
+	custom.Compositions.Groups = []string{"compositions.example.com"}
+	custom.Labels.Name, custom.Labels.Namespace = "example.com/name", "example.com/namespace"
+	schemahelper.Set(custom)
+	t.Cleanup(func() { schemahelper.Set(schemahelper.Default()) })
+
+	engine, r := testEngine()
+	addComposition(r, "a", "dev", "FireworksApp", "True", nil)
+	if recorder := serve(engine, http.MethodGet, apiV1Prefix+resolveEndpoint+"?labelSelector="+url.QueryEscape("example.com/name=a,example.com/namespace=dev")); recorder.Code != http.StatusOK {
+		t.Errorf("expected the configured labels to resolve, got %d: %s", recorder.Code, recorder.Body)
+	}
+	if recorder := serve(engine, http.MethodGet, apiV1Prefix+resolveEndpoint+"?labelSelector="+url.QueryEscape("krateo.io/composition-name=a")); recorder.Code != http.StatusBadRequest {
+		t.Errorf("expected the default labels to be rejected, got %d", recorder.Code)
+	}
+
+	// Only the events of the configured groups are handled, the one without uid is rejected
+	for apiVersion, expected := range map[string]int{"composition.krateo.io/v1-2-0": http.StatusOK, "compositions.example.com/v1": http.StatusBadRequest} {
+		body := `{"involvedObject":{"apiVersion":"` + apiVersion + `","kind":"FireworksApp"},"reason":"CompositionCreated"}`
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, apiV1Prefix+eventsEndpoint, strings.NewReader(body)))
+		if recorder.Code != expected {
+			t.Errorf("%s: expected status %d, got %d: %s", apiVersion, expected, recorder.Code, recorder.Body)
+		}
+	}
+}
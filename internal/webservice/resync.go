@@ -0,0 +1,166 @@
+package webservice
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	resourcetreehelper "resource-tree-handler/internal/helpers/resourcetree"
+)
+
+// resyncStats counts the resyncs and the drift detected, to help tuning the resync period
+type resyncStats struct {
+	mu sync.Mutex
+	// Cycles is the number of completed walks over the cache
+	Cycles uint64
+	// Enqueued is the number of resync jobs enqueued
+	Enqueued uint64
+	// Skipped is the number of compositions not resynced because busy, queued or the queue was full
+	Skipped uint64
+	// Resynced is the number of resource trees rebuilt
+	Resynced uint64
+	// Drifted is the number of rebuilt resource trees that differed from the cached one
+	Drifted uint64
+	// DriftedNodes counts the nodes that differed, by type of change
+	DriftedNodes map[resourcetreehelper.ChangeType]uint64
+	LastCycle    time.Time
+	LastDrift    time.Time
+}
+
+// runResync periodically enqueues a low priority rebuild for every cached resource tree, until ctx is done.
+// Each period is randomly shortened or extended by up to ResyncJitter, so that replicas do not resync together.
+// A new period, see SetResync, applies from the next one.
+func (r *Webservice) runResync(ctx context.Context) {
+	changed := r.resyncWakeup()
+	for {
+		period, jitter := r.resyncSettings()
+		if period <= 0 {
+			log.Info().Msg("Background resync of the resource trees disabled")
+			select {
+			case <-ctx.Done():
+				return
+			case <-changed:
+				continue
+			}
+		}
+		log.Info().Msgf("Background resync of the resource trees every %s (jitter %s)", period, jitter)
+
+	wait:
+		for {
+			timer := time.NewTimer(nextResyncDelay(period, jitter))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-changed:
+				timer.Stop()
+				break wait
+			case <-timer.C:
+				r.resyncAll()
+			}
+		}
+	}
+}
+
+// resyncSettings returns the period and the jitter of the resync
+func (r *Webservice) resyncSettings() (time.Duration, time.Duration) {
+	r.settingsMu.RLock()
+	defer r.settingsMu.RUnlock()
+	return r.ResyncPeriod, r.ResyncJitter
+}
+
+func nextResyncDelay(period time.Duration, jitter time.Duration) time.Duration {
+	delay := period
+	if jitter > 0 {
+		delay += time.Duration(rand.Int64N(int64(2*jitter))) - jitter
+	}
+	return max(delay, time.Second)
+}
+
+// resyncAll walks the cache and enqueues a low priority rebuild for every composition that is not busy or queued
+func (r *Webservice) resyncAll() {
+	enqueued, skipped := 0, 0
+	for _, compositionId := range r.Cache.ListKeysFromCache() {
+		resourceTreeUpdate, ok := r.Cache.GetResourceTreeFromCache(compositionId)
+		if !ok {
+			continue
+		}
+
+		if !r.continueOperationsWithComposition(compositionId) {
+			skipped++
+			continue
+		}
+		r.setContinueOperationsWithComposition(compositionId, queuedString)
+
+		job := CreateJobRequest{
+			CompositionReference: resourceTreeUpdate.CompositionReference,
+			CompositionID:        compositionId,
+			Resync:               true,
+			QueuedAt:             time.Now(),
+		}
+		select {
+		case r.lowPriorityJobQueue <- job:
+			enqueued++
+		default:
+			// Do not block on a full queue, the composition is resynced in the next cycle
+			r.setContinueOperationsWithComposition(compositionId, freeString)
+			skipped++
+		}
+	}
+
+	r.resyncStats.mu.Lock()
+	r.resyncStats.Cycles++
+	r.resyncStats.Enqueued += uint64(enqueued)
+	r.resyncStats.Skipped += uint64(skipped)
+	r.resyncStats.LastCycle = time.Now()
+	r.resyncStats.mu.Unlock()
+
+	log.Info().Msgf("Resync: %d resource trees queued for rebuild, %d skipped", enqueued, skipped)
+}
+
+func (r *Webservice) recordDrift(compositionId string, drift []resourcetreehelper.NodeChange) {
+	r.resyncStats.mu.Lock()
+	defer r.resyncStats.mu.Unlock()
+	r.resyncStats.Resynced++
+	if len(drift) == 0 {
+		return
+	}
+
+	r.resyncStats.Drifted++
+	r.resyncStats.LastDrift = time.Now()
+	if r.resyncStats.DriftedNodes == nil {
+		r.resyncStats.DriftedNodes = make(map[resourcetreehelper.ChangeType]uint64)
+	}
+	for _, change := range drift {
+		r.resyncStats.DriftedNodes[change.Type]++
+		node := change.Node
+		if node == nil {
+			node = change.Previous
+		}
+		log.Warn().Msgf("Resync drift for composition id %s: %s %s %s %s %s", compositionId, change.Type, node.Version, node.Kind, node.Name, node.Namespace)
+	}
+	log.Warn().Msgf("Resync detected %d drifted nodes for composition id %s, some events were missed", len(drift), compositionId)
+}
+
+func (r *Webservice) handleResyncStats(c *gin.Context) {
+	period, jitter := r.resyncSettings()
+	r.resyncStats.mu.Lock()
+	defer r.resyncStats.mu.Unlock()
+	c.JSON(http.StatusOK, ResyncStatsResponse{
+		Period:       period.String(),
+		Jitter:       jitter.String(),
+		Cycles:       r.resyncStats.Cycles,
+		Enqueued:     r.resyncStats.Enqueued,
+		Skipped:      r.resyncStats.Skipped,
+		Resynced:     r.resyncStats.Resynced,
+		Drifted:      r.resyncStats.Drifted,
+		DriftedNodes: r.resyncStats.DriftedNodes,
+		LastCycle:    r.resyncStats.LastCycle,
+		LastDrift:    r.resyncStats.LastDrift,
+	})
+}
@@ -0,0 +1,564 @@
+package webservice
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+
+	types "resource-tree-handler/apis"
+	"resource-tree-handler/internal/auth"
+	cachehelper "resource-tree-handler/internal/cache"
+	"resource-tree-handler/internal/graphql"
+	"resource-tree-handler/internal/helpers/configuration"
+	resourcetreehelper "resource-tree-handler/internal/helpers/resourcetree"
+	"resource-tree-handler/internal/openapi"
+	"resource-tree-handler/internal/ratelimit"
+	"resource-tree-handler/internal/streaming"
+	"resource-tree-handler/pkg/render"
+)
+
+const (
+	apiV1Prefix = "/api/v1"
+	apiTitle    = "resource-tree-handler"
+	apiVersion  = "v1"
+)
+
+// route is an endpoint of the webservice with its OpenAPI description.
+// Path is relative to apiV1Prefix, unless the route is unversioned.
+type route struct {
+	openapi.Route
+	handler gin.HandlerFunc
+	// unversioned routes are served outside of apiV1Prefix
+	unversioned bool
+	// legacyPaths are the paths that served the route before the API was versioned, kept as aliases
+	legacyPaths []string
+	// write routes modify the cache or trigger rebuilds, they have their own authentication requirement.
+	// public routes, e.g., the health probe, are never authenticated.
+	write  bool
+	public bool
+	// signed routes verify the HMAC signature of the body, when configured
+	signed bool
+	// rateClass is the class of the rate limits, ratelimit.ClassRefresh for the write routes and
+	// ratelimit.ClassRead for the others if empty. Public routes are not limited.
+	rateClass ratelimit.Class
+}
+
+// limitedAs returns the class of the rate limits of the route
+func (route *route) limitedAs() ratelimit.Class {
+	switch {
+	case route.rateClass != "":
+		return route.rateClass
+	case route.write:
+		return ratelimit.ClassRefresh
+	}
+	return ratelimit.ClassRead
+}
+
+var (
+	etagHeader     = openapi.Parameter{Name: "ETag", Description: "Entity tag of the revision of the resource tree", Schema: &openapi.Schema{Type: "string"}}
+	revisionHeader = openapi.Parameter{Name: revisionHeaderName, Description: "Revision of the resource tree", Schema: &openapi.Schema{Type: "integer", Format: "int64"}}
+)
+
+const resolveDescription = "Cached compositions are looked up first; otherwise, the composition is retrieved from the cluster, " +
+	"which requires apiVersion with a version, kind or resource, and name. The labels of the CompositionReferences, krateo.io/composition-* " +
+	"by default, can be used instead of the parameters, as equality requirements of labelSelector."
+
+const graphqlDescription = "The schema is served at " + apiV1Prefix + graphqlEndpoint + " through introspection. " +
+	"Queries deeper or more complex than the configured limits are rejected before being executed: the complexity " +
+	"is the number of fields the query may resolve, counting the fields of list items once per item requested with first."
+
+var graphqlResponses = []openapi.Response{
+	{Status: http.StatusOK, Description: "Query executed, errors of the resolvers are in errors", Bodies: []openapi.Body{{Value: graphql.Response{}}}},
+	// Requests that are not GraphQL requests, e.g., without a query, are answered with the error envelope instead
+	{Status: http.StatusBadRequest, Description: "Invalid query, or query exceeding the limits", Bodies: []openapi.Body{{Value: graphql.Response{}}}},
+	errorResponse(http.StatusServiceUnavailable, "GraphQL not available"),
+}
+
+// resolveQuery are the parameters identifying the composition on the resolve routes
+var resolveQuery = []openapi.Parameter{
+	openapi.QueryParameter("apiVersion", "string", "Group of the composition, optionally followed by /version"),
+	openapi.QueryParameter("kind", "string", "Kind of the composition, case insensitive"),
+	openapi.QueryParameter("resource", "string", "Resource of the composition, case insensitive"),
+	openapi.QueryParameter("namespace", "string", "Namespace of the composition"),
+	openapi.QueryParameter("name", "string", "Name of the composition"),
+	openapi.QueryParameter("uid", "string", "Id of the composition"),
+	openapi.QueryParameter("labelSelector", "string", "Equality requirements on the composition labels, e.g., krateo.io/composition-name=demo"),
+}
+
+// errorResponse describes an error response with the error envelope
+func errorResponse(status int, description string) openapi.Response {
+	return openapi.Response{Status: status, Description: description, Bodies: []openapi.Body{{Value: ErrorResponse{}}}}
+}
+
+// routes returns all the routes of the webservice, the OpenAPI document is generated from them
+func (r *Webservice) routes() []route {
+	eventStream := openapi.Body{ContentType: "text/event-stream", Value: streaming.Event{}}
+	return []route{
+		{
+			Route: openapi.Route{
+				Method: http.MethodGet, Path: homeEndpoint, OperationId: "getStatus", Tags: []string{"status"},
+				Summary:   "Reports that the webservice is running",
+				Responses: []openapi.Response{{Status: http.StatusOK, Bodies: []openapi.Body{{Value: StatusResponse{}}}}},
+			},
+			handler:     r.handleHome,
+			public:      true,
+			unversioned: true,
+		},
+		{
+			Route: openapi.Route{
+				Method: http.MethodGet, Path: openAPIEndpoint, OperationId: "getOpenAPI", Tags: []string{"status"},
+				Summary:   "Returns this OpenAPI document",
+				Responses: []openapi.Response{{Status: http.StatusOK, Bodies: []openapi.Body{{Value: map[string]any{}}}}},
+			},
+			handler: r.handleOpenAPI,
+		},
+		{
+			Route: openapi.Route{
+				Method: http.MethodGet, Path: compositionsEndpoint, OperationId: "listCompositions", Tags: []string{"compositions"},
+				Summary: "Lists the compositions with a cached resource tree",
+				Description: "Filters on different parameters are combined, the values of a repeated or comma separated parameter are alternatives. " +
+					"Pass the nextCursor of a page as the cursor parameter, with the same sort, to get the next page.",
+				Query: []openapi.Parameter{
+					openapi.QueryParameter("namespace", "string", "Namespace of the compositions"),
+					openapi.QueryParameter("kind", "string", "Kind of the compositions, case insensitive"),
+					openapi.QueryParameter("health", "string", "Health of the compositions: healthy, unhealthy or unknown"),
+					openapi.QueryParameter("labelSelector", "string", "Kubernetes label selector on the labels of the compositions, e.g., env=prod,tier!=db"),
+					openapi.QueryParameter("sort", "string", "Comma separated fields to sort by, descending if prefixed by '-': compositionId, name, namespace, kind, version, health, resourceCount, lastUpdate. Default namespace,name"),
+					openapi.QueryParameter("limit", "integer", "Maximum number of items in the page, between 1 and 1000. Default 100"),
+					openapi.QueryParameter("cursor", "string", "Position of the page, from the nextCursor of the previous page"),
+				},
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Bodies: []openapi.Body{{Value: ListResponse{}}}},
+					errorResponse(http.StatusBadRequest, "Invalid parameters"),
+				},
+			},
+			handler: r.handleList,
+		},
+		{
+			Route: openapi.Route{
+				Method: http.MethodGet, Path: legacyListEndpoint, OperationId: "listCompositionsLegacy", Tags: []string{"compositions"},
+				Summary:    "Lists the compositions with a cached resource tree, separated by spaces",
+				Deprecated: true,
+				Responses:  []openapi.Response{{Status: http.StatusOK, Bodies: []openapi.Body{{Value: LegacyListResponse{}}}}},
+			},
+			handler:     r.handleLegacyList,
+			unversioned: true,
+		},
+		{
+			Route: openapi.Route{
+				Method: http.MethodGet, Path: compositionEndpoint, OperationId: "getResourceTree", Tags: []string{"compositions"},
+				Summary: "Returns the resource tree of a composition",
+				Description: "If the resource tree is not cached, its creation is queued and 202 is returned. " +
+					"With sinceRevision, only the changes since that revision are returned as a JSON Patch, " +
+					"unless that revision is no longer available.",
+				Query: []openapi.Parameter{
+					openapi.QueryParameter("sinceRevision", "integer", "Revision of the resource tree already known by the client"),
+				},
+				Headers: []openapi.Parameter{
+					openapi.HeaderParameter("If-None-Match", "Entity tag of the resource tree already known by the client"),
+				},
+				Responses: []openapi.Response{
+					{
+						Status:  http.StatusOK,
+						Headers: []openapi.Parameter{etagHeader, revisionHeader},
+						Bodies: []openapi.Body{
+							{Value: []*types.ResourceNodeStatus{}},
+							{ContentType: jsonPatchMediaType, Value: []resourcetreehelper.PatchOperation{}},
+						},
+					},
+					{Status: http.StatusAccepted, Description: "Creation of the resource tree queued", Bodies: []openapi.Body{{Value: MessageResponse{}}}},
+					{Status: http.StatusNotModified, Headers: []openapi.Parameter{etagHeader, revisionHeader}},
+					errorResponse(http.StatusBadRequest, "Invalid revision"),
+					errorResponse(http.StatusNotFound, "Composition not found"),
+					errorResponse(http.StatusTooManyRequests, "Resource tree already being created"),
+				},
+			},
+			handler:     r.handleRequest,
+			legacyPaths: []string{compositionEndpoint},
+		},
+		{
+			Route: openapi.Route{
+				Method: http.MethodGet, Path: compositionNodeEndpoint, OperationId: "getResourceTreeNode", Tags: []string{"compositions"},
+				Summary: "Returns a node of the resource tree of a composition with its live object, recent events and relations",
+				Description: "The data of Secrets is never returned. The response is returned even if the live object or the events " +
+					"cannot be retrieved, with objectError or eventsError set.",
+				Query: []openapi.Parameter{
+					openapi.QueryParameter("stripManagedFields", "boolean", "Removes the managedFields of the live object. Default false"),
+					openapi.QueryParameter("events", "integer", "Maximum number of recent events, between 0 and 100. Default 20"),
+				},
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Bodies: []openapi.Body{{Value: NodeDetail{}}}},
+					errorResponse(http.StatusBadRequest, "Invalid parameters"),
+					errorResponse(http.StatusNotFound, "Resource tree not cached or node not found"),
+				},
+			},
+			handler: r.handleNodeDetail,
+		},
+		{
+			Route: openapi.Route{
+				Method: http.MethodGet, Path: compositionExportEndpoint, OperationId: "exportResourceTree", Tags: []string{"compositions"},
+				Summary: "Renders the cached resource tree of a composition as a diagram, with the nodes coloured by health",
+				Query: []openapi.Parameter{
+					openapi.QueryParameter("format", "string", "Diagram language: dot, mermaid or plantuml. Default dot"),
+				},
+				Responses: []openapi.Response{
+					{
+						Status:  http.StatusOK,
+						Headers: []openapi.Parameter{etagHeader},
+						Bodies:  []openapi.Body{{ContentType: render.FormatDOT.ContentType(), Value: ""}, {ContentType: render.FormatMermaid.ContentType(), Value: ""}},
+					},
+					errorResponse(http.StatusBadRequest, "Invalid format"),
+					errorResponse(http.StatusNotFound, "Resource tree not cached"),
+				},
+			},
+			handler: r.handleExport,
+		},
+		{
+			Route: openapi.Route{
+				Method: http.MethodGet, Path: resolveEndpoint, OperationId: "resolveComposition", Tags: []string{"compositions"},
+				Summary:     "Returns the id of a composition from its apiVersion, kind or resource, namespace and name",
+				Description: resolveDescription,
+				Query:       resolveQuery,
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Bodies: []openapi.Body{{Value: ResolveResponse{}}}},
+					errorResponse(http.StatusBadRequest, "Invalid parameters"),
+					errorResponse(http.StatusNotFound, "Composition not found"),
+					{Status: http.StatusConflict, Description: "More than one composition matches", Bodies: []openapi.Body{{Value: AmbiguousResponse{}}}},
+				},
+			},
+			handler: r.handleResolve,
+		},
+		{
+			Route: openapi.Route{
+				Method: http.MethodGet, Path: resolveTreeEndpoint, OperationId: "getResolvedResourceTree", Tags: []string{"compositions"},
+				Summary:     "Returns the resource tree of a composition from its apiVersion, kind or resource, namespace and name",
+				Description: resolveDescription + " The resource tree is served as by getResourceTree.",
+				Query: append(slices.Clone(resolveQuery),
+					openapi.QueryParameter("sinceRevision", "integer", "Revision of the resource tree already known by the client"),
+				),
+				Headers: []openapi.Parameter{
+					openapi.HeaderParameter("If-None-Match", "Entity tag of the resource tree already known by the client"),
+				},
+				Responses: []openapi.Response{
+					{
+						Status:  http.StatusOK,
+						Headers: []openapi.Parameter{etagHeader, revisionHeader},
+						Bodies: []openapi.Body{
+							{Value: []*types.ResourceNodeStatus{}},
+							{ContentType: jsonPatchMediaType, Value: []resourcetreehelper.PatchOperation{}},
+						},
+					},
+					{Status: http.StatusAccepted, Description: "Creation of the resource tree queued", Bodies: []openapi.Body{{Value: MessageResponse{}}}},
+					{Status: http.StatusNotModified, Headers: []openapi.Parameter{etagHeader, revisionHeader}},
+					errorResponse(http.StatusBadRequest, "Invalid parameters"),
+					errorResponse(http.StatusNotFound, "Composition not found"),
+					{Status: http.StatusConflict, Description: "More than one composition matches", Bodies: []openapi.Body{{Value: AmbiguousResponse{}}}},
+					errorResponse(http.StatusTooManyRequests, "Resource tree already being created"),
+				},
+			},
+			handler: r.handleResolveTree,
+		},
+		{
+			Route: openapi.Route{
+				Method: http.MethodPost, Path: resolveRefreshEndpoint, OperationId: "refreshResolvedResourceTree", Tags: []string{"compositions"},
+				Summary:     "Rebuilds the resource tree of a composition from its apiVersion, kind or resource, namespace and name",
+				Description: resolveDescription,
+				Query:       resolveQuery,
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Bodies: []openapi.Body{{Value: MessageResponse{}}}},
+					errorResponse(http.StatusBadRequest, "Invalid parameters"),
+					errorResponse(http.StatusNotFound, "Composition not found"),
+					{Status: http.StatusConflict, Description: "More than one composition matches", Bodies: []openapi.Body{{Value: AmbiguousResponse{}}}},
+					errorResponse(http.StatusTooManyRequests, "Resource tree already being created"),
+					errorResponse(http.StatusInternalServerError, "Resource tree could not be built"),
+				},
+			},
+			handler: r.handleResolveRefresh,
+			write:   true,
+		},
+		{
+			Route: openapi.Route{
+				Method: http.MethodPost, Path: compositionRefreshEndpoint, OperationId: "refreshResourceTree", Tags: []string{"compositions"},
+				Summary:     "Rebuilds the resource tree of a composition from scratch",
+				Description: "Without a body, the composition is resolved by id, from the cache or else from the cluster.",
+				RequestBody: &openapi.Body{Value: types.Reference{}},
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Bodies: []openapi.Body{{Value: MessageResponse{}}}},
+					errorResponse(http.StatusBadRequest, "Invalid reference"),
+					errorResponse(http.StatusNotFound, "Composition not found"),
+					errorResponse(http.StatusTooManyRequests, "Resource tree already being created"),
+					errorResponse(http.StatusInternalServerError, "Resource tree could not be built"),
+				},
+			},
+			handler:     r.handleRefresh,
+			write:       true,
+			legacyPaths: []string{legacyRefreshEndpoint},
+		},
+		{
+			Route: openapi.Route{
+				Method: http.MethodPost, Path: refreshesEndpoint, OperationId: "refreshResourceTrees", Tags: []string{"compositions"},
+				Summary: "Queues the rebuild of the cached resource trees matching a selector",
+				Description: "The fields of the selector are combined, all is required to rebuild every cached resource tree. " +
+					"The rebuilds go through the job queue: the compositions busy or queued, and the ones that do not fit in the queue, are skipped. " +
+					"The progress of the refresh is returned at the path in the Location header.",
+				RequestBody: &openapi.Body{Value: RefreshSelector{}, Required: true},
+				Responses: []openapi.Response{
+					{Status: http.StatusAccepted, Bodies: []openapi.Body{{Value: RefreshStatus{}}}, Headers: []openapi.Parameter{{Name: "Location", Description: "Path of the progress of the refresh", Schema: &openapi.Schema{Type: "string"}}}},
+					errorResponse(http.StatusBadRequest, "Invalid selector"),
+				},
+			},
+			handler: r.handleBulkRefresh,
+			write:   true,
+		},
+		{
+			Route: openapi.Route{
+				Method: http.MethodGet, Path: refreshStatusEndpoint, OperationId: "getRefresh", Tags: []string{"compositions"},
+				Summary: "Returns the progress of a bulk refresh",
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Bodies: []openapi.Body{{Value: RefreshStatus{}}}},
+					errorResponse(http.StatusNotFound, "Refresh not found, or forgotten"),
+				},
+			},
+			handler: r.handleRefreshStatus,
+		},
+		{
+			Route: openapi.Route{
+				Method: http.MethodGet, Path: resourcesLookupEndpoint, OperationId: "lookupResources", Tags: []string{"resources"},
+				Summary: "Returns the nodes of the cached resource trees matching the parameters, with the compositions owning them",
+				Description: "Filters on different parameters are combined. Lookups by uid, or by apiVersion, resource, namespace and name " +
+					"with exact matching, use the reverse indexes of the cache; the other lookups scan all the cached resource trees.",
+				Query: []openapi.Parameter{
+					openapi.QueryParameter("uid", "string", "Uid of the object"),
+					openapi.QueryParameter("apiVersion", "string", "ApiVersion of the object"),
+					openapi.QueryParameter("resource", "string", "Resource of the object, case insensitive"),
+					openapi.QueryParameter("kind", "string", "Kind of the object, case insensitive"),
+					openapi.QueryParameter("namespace", "string", "Namespace of the object"),
+					openapi.QueryParameter("name", "string", "Name of the object"),
+					openapi.QueryParameter("match", "string", "How kind and name are matched: exact or partial, i.e., as case insensitive substrings. Default exact"),
+					openapi.QueryParameter("limit", "integer", "Maximum number of items, between 1 and 1000. Default 100"),
+				},
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Bodies: []openapi.Body{{Value: LookupResponse{}}}},
+					errorResponse(http.StatusBadRequest, "Invalid parameters"),
+				},
+			},
+			handler: r.handleLookup,
+		},
+		{
+			Route: openapi.Route{
+				Method: http.MethodGet, Path: inventoryEndpoint, OperationId: "getInventory", Tags: []string{"resources"},
+				Summary: "Streams the resources of all the cached resource trees, one row per resource",
+				Description: "The rows are streamed one composition at a time, sorted by composition id. " +
+					"CSV starts with a header row with the JSON field names of the NDJSON rows.",
+				Query: []openapi.Parameter{
+					openapi.QueryParameter("format", "string", "ndjson or csv. Default ndjson"),
+					openapi.QueryParameter("namespace", "string", "Namespace of the compositions, repeated or comma separated values are alternatives"),
+					openapi.QueryParameter("health", "string", "Health of the resources: healthy, unhealthy or unknown, repeated or comma separated values are alternatives"),
+				},
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Bodies: []openapi.Body{{ContentType: ndjsonMediaType, Value: InventoryRow{}}, {ContentType: csvMediaType, Value: ""}}},
+					errorResponse(http.StatusBadRequest, "Invalid parameters"),
+				},
+			},
+			handler: r.handleInventory,
+		},
+		{
+			Route: openapi.Route{
+				Method: http.MethodPost, Path: graphqlEndpoint, OperationId: "queryGraphQL", Tags: []string{"graphql"},
+				Summary:     "Executes a GraphQL query on the cached resource trees",
+				Description: graphqlDescription,
+				RequestBody: &openapi.Body{Value: graphql.Request{}, Required: true},
+				Responses:   graphqlResponses,
+			},
+			handler: r.handleGraphQL,
+		},
+		{
+			Route: openapi.Route{
+				Method: http.MethodGet, Path: graphqlEndpoint, OperationId: "queryGraphQLGet", Tags: []string{"graphql"},
+				Summary:     "Executes a GraphQL query on the cached resource trees, from the parameters",
+				Description: graphqlDescription,
+				Query: []openapi.Parameter{
+					openapi.QueryParameter("query", "string", "GraphQL query"),
+					openapi.QueryParameter("operationName", "string", "Operation to execute when the query has more than one"),
+					openapi.QueryParameter("variables", "string", "Variables of the query, as a JSON object"),
+				},
+				Responses: graphqlResponses,
+			},
+			handler: r.handleGraphQL,
+		},
+		{
+			Route: openapi.Route{
+				Method: http.MethodGet, Path: compositionWatchEndpoint, OperationId: "watchResourceTree", Tags: []string{"watch"},
+				Summary: "Streams the changes of the resource tree of a composition as server-sent events",
+				Query: []openapi.Parameter{
+					openapi.QueryParameter("sinceRevision", "integer", "Revision of the last event received, to resume the stream"),
+				},
+				Headers: []openapi.Parameter{
+					openapi.HeaderParameter("Last-Event-ID", "Revision of the last event received, to resume the stream"),
+				},
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Bodies: []openapi.Body{eventStream}},
+					errorResponse(http.StatusBadRequest, "Invalid revision"),
+					errorResponse(http.StatusNotFound, "Composition not found"),
+				},
+			},
+			handler: r.handleWatch,
+		},
+		{
+			Route: openapi.Route{
+				Method: http.MethodGet, Path: watchEndpoint, OperationId: "watchResourceTrees", Tags: []string{"watch"},
+				Summary: "Streams the changes of all the cached resource trees as server-sent events",
+				Query: []openapi.Parameter{
+					openapi.QueryParameter("sinceRevision", "integer", "Revision of the last event received, to resume the stream"),
+				},
+				Headers: []openapi.Parameter{
+					openapi.HeaderParameter("Last-Event-ID", "Revision of the last event received, to resume the stream"),
+				},
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Bodies: []openapi.Body{eventStream}},
+					errorResponse(http.StatusBadRequest, "Invalid revision"),
+				},
+			},
+			handler: r.handleWatchAll,
+		},
+		{
+			Route: openapi.Route{
+				Method: http.MethodPost, Path: eventsEndpoint, OperationId: "handleEvent", Tags: []string{"events"},
+				Summary:     "Receives the Kubernetes events of the compositions, registered on the eventrouter",
+				Description: "When the signatures are configured, the body must be signed with HMAC-SHA256 on \"<timestamp>.<body>\".",
+				Headers: []openapi.Parameter{
+					openapi.HeaderParameter(auth.SignatureHeader, "Signatures of the body, sha256=<hex>, comma separated"),
+					openapi.HeaderParameter(auth.SignatureTimestampHeader, "Unix time of the signatures, in seconds"),
+				},
+				RequestBody: &openapi.Body{Value: corev1.Event{}, Required: true},
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Description: "Event handled or ignored", Bodies: []openapi.Body{{Value: MessageResponse{}}}},
+					{Status: http.StatusAccepted, Description: "Creation of the resource tree queued", Bodies: []openapi.Body{{Value: MessageResponse{}}}},
+					errorResponse(http.StatusBadRequest, "Invalid event"),
+					errorResponse(http.StatusUnauthorized, "Missing, expired or invalid signature"),
+					errorResponse(http.StatusTooManyRequests, "Resource tree already being created"),
+					errorResponse(http.StatusInternalServerError, "Composition could not be retrieved"),
+				},
+			},
+			handler:     r.handleAllEvents,
+			write:       true,
+			signed:      true,
+			rateClass:   ratelimit.ClassEvents,
+			legacyPaths: []string{legacyAllEventsEndpoint},
+		},
+		{
+			Route: openapi.Route{
+				Method: http.MethodGet, Path: cacheStatsEndpoint, OperationId: "getCacheStats", Tags: []string{"status"},
+				Summary: "Returns the size and the evictions of the cache",
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Bodies: []openapi.Body{{Value: cachehelper.EvictionStats{}}}},
+					errorResponse(http.StatusNotImplemented, "The cache does not report statistics"),
+				},
+			},
+			handler: r.handleCacheStats,
+		},
+		{
+			Route: openapi.Route{
+				Method: http.MethodGet, Path: resyncStatsEndpoint, OperationId: "getResyncStats", Tags: []string{"status"},
+				Summary:   "Returns the statistics of the background resync",
+				Responses: []openapi.Response{{Status: http.StatusOK, Bodies: []openapi.Body{{Value: ResyncStatsResponse{}}}}},
+			},
+			handler: r.handleResyncStats,
+		},
+		{
+			Route: openapi.Route{
+				Method: http.MethodGet, Path: configEndpoint, OperationId: "getConfig", Tags: []string{"status"},
+				Summary: "Returns the configuration applied",
+				Description: "The reloadable settings changed in the configuration file are applied without restarting, " +
+					"the keys of the other changes are listed in pendingRestart. The route has the authentication requirement of the write routes.",
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Bodies: []openapi.Body{{Value: configuration.Effective{}}}},
+					errorResponse(http.StatusNotImplemented, "The configuration is not available"),
+				},
+			},
+			handler:   r.handleConfig,
+			write:     true,
+			rateClass: ratelimit.ClassRead,
+		},
+		{
+			Route: openapi.Route{
+				Method: http.MethodGet, Path: metricsEndpoint, OperationId: "getMetrics", Tags: []string{"status"},
+				Summary: "Returns the Prometheus metrics",
+				Description: "Builds and incremental updates of the resource trees, job queues, cache, SSE client, requests to the " +
+					"Kubernetes API server and health of the cached compositions, in the Prometheus text format.",
+				Responses: []openapi.Response{{Status: http.StatusOK, Bodies: []openapi.Body{{ContentType: "text/plain", Value: ""}}}},
+			},
+			handler:     r.handleMetrics,
+			public:      !r.MetricsAuthenticated,
+			unversioned: true,
+		},
+	}
+}
+
+// registerRoutes serves the routes under apiV1Prefix, and their legacy paths
+func (r *Webservice) registerRoutes(engine *gin.Engine) {
+	r.graphql = r.newGraphQLHandler()
+	r.metrics = r.newMetricsHandler()
+	routes := r.routes()
+	v1 := engine.Group(apiV1Prefix)
+	for _, route := range routes {
+		handlers := []gin.HandlerFunc{route.handler}
+		if route.signed {
+			handlers = append([]gin.HandlerFunc{r.verifySignature}, handlers...)
+		}
+		if !route.public {
+			handlers = append([]gin.HandlerFunc{r.rateLimit(route.limitedAs()), r.authenticate(route.write)}, handlers...)
+		}
+		if route.unversioned {
+			engine.Handle(route.Method, route.Path, handlers...)
+		} else {
+			v1.Handle(route.Method, route.Path, handlers...)
+		}
+		for _, legacyPath := range route.legacyPaths {
+			engine.Handle(route.Method, legacyPath, handlers...)
+		}
+	}
+	engine.NoRoute(handleRouteNotFound)
+
+	document, err := json.Marshal(openapi.Generate(openapi.Info{
+		Title:       apiTitle,
+		Description: "Resource trees of the Krateo compositions",
+		Version:     apiVersion,
+	}, documentedRoutes(routes)))
+	if err != nil {
+		log.Error().Err(err).Msg("could not generate the OpenAPI document")
+	}
+	r.openAPIDocument = document
+}
+
+// documentedRoutes returns the routes with their absolute paths, including the legacy paths as deprecated operations
+func documentedRoutes(routes []route) []openapi.Route {
+	documented := []openapi.Route{}
+	for _, route := range routes {
+		operation := route.Route
+		if !route.unversioned {
+			operation.Path = apiV1Prefix + route.Path
+		}
+		documented = append(documented, operation)
+		for _, legacyPath := range route.legacyPaths {
+			legacy := route.Route
+			legacy.Path = legacyPath
+			legacy.OperationId += "Legacy"
+			legacy.Deprecated = true
+			documented = append(documented, legacy)
+		}
+	}
+	return documented
+}
+
+func (r *Webservice) handleOpenAPI(c *gin.Context) {
+	if r.openAPIDocument == nil {
+		writeError(c, http.StatusInternalServerError, ErrorCodeInternal, "the OpenAPI document could not be generated")
+		return
+	}
+	c.Data(http.StatusOK, openapi.MediaTypeJSON, r.openAPIDocument)
+}
@@ -0,0 +1,100 @@
+package webservice
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+
+	cachehelper "resource-tree-handler/internal/cache"
+	"resource-tree-handler/internal/openapi"
+)
+
+func TestMain(m *testing.M) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+func testEngine() (*gin.Engine, *Webservice) {
+	r := &Webservice{
+		Cache:             cachehelper.NewThreadSafeCache(),
+		compositionStatus: make(map[string]string),
+	}
+	engine := gin.New()
+	r.registerRoutes(engine)
+	return engine, r
+}
+
+func serve(engine *gin.Engine, method string, path string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+	return recorder
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	engine, _ := testEngine()
+	recorder := serve(engine, http.MethodGet, apiV1Prefix+openAPIEndpoint)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", recorder.Code)
+	}
+
+	var document openapi.Document
+	if err := json.Unmarshal(recorder.Body.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"/":                                    "get",
+		"/api/v1/compositions":                 "get",
+		"/api/v1/compositions/{compositionId}": "get",
+		"/api/v1/compositions/{compositionId}/refresh": "post",
+		"/api/v1/compositions/resolve":                 "get",
+		"/api/v1/events":                               "post",
+		"/api/v1/graphql":                              "post",
+		"/api/v1/openapi.json":                         "get",
+		"/compositions/{compositionId}":                "get",
+		"/refresh/{compositionId}":                     "post",
+		"/handle":                                      "post",
+		"/list":                                        "get",
+	}
+	for path, method := range expected {
+		operation, ok := document.Paths[path][method]
+		if !ok {
+			t.Errorf("operation %s %s not documented", method, path)
+			continue
+		}
+		if legacy := !strings.HasPrefix(path, apiV1Prefix) && path != homeEndpoint; operation.Deprecated != legacy {
+			t.Errorf("operation %s %s: expected deprecated %t", method, path, legacy)
+		}
+	}
+	// Only the routes served before the API was versioned have legacy aliases
+	for _, path := range []string{"/watch", "/compositions/{compositionId}/watch", "/cache/stats", "/resync/stats"} {
+		if _, ok := document.Paths[path]; ok {
+			t.Errorf("unexpected legacy alias %s", path)
+		}
+	}
+	for _, name := range []string{"ResourceNodeStatus", "ErrorResponse", "Event"} {
+		if _, ok := document.Components.Schemas[name]; !ok {
+			t.Errorf("schema %s not generated", name)
+		}
+	}
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	engine, _ := testEngine()
+	for _, path := range []string{"/unknown", apiV1Prefix + "/watch?sinceRevision=abc"} {
+		recorder := serve(engine, http.MethodGet, path)
+		var response ErrorResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if recorder.Code < 400 || response.Error.Code == "" || response.Error.Message == "" {
+			t.Errorf("%s: unexpected response %d %s", path, recorder.Code, recorder.Body)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package webservice
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"resource-tree-handler/internal/auth"
+)
+
+// verifySignature rejects the requests whose body is not signed with an active key, when the signatures are
+// configured. The body is read whole, up to MaxSignedBodyBytes, and restored for the handler.
+func (r *Webservice) verifySignature(c *gin.Context) {
+	if r.SignatureVerifier == nil {
+		return
+	}
+	limit := cmp.Or(r.MaxSignedBodyBytes, defaultMaxSignedBodyBytes)
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, limit))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(c, http.StatusRequestEntityTooLarge, ErrorCodeTooLarge, "request body larger than %d bytes", limit)
+		return
+	}
+	if err != nil {
+		writeError(c, http.StatusBadRequest, ErrorCodeBadRequest, "could not read request body: %s", err)
+		return
+	}
+	c.Request.Body.Close()
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	err = r.SignatureVerifier.Verify(c.Request.Context(), c.GetHeader(auth.SignatureTimestampHeader), c.GetHeader(auth.SignatureHeader), body)
+	switch {
+	case errors.Is(err, auth.ErrInvalidSignature):
+		log.Warn().Msgf("%s %s from %s: %s", c.Request.Method, c.Request.URL.Path, c.ClientIP(), err)
+		writeError(c, http.StatusUnauthorized, ErrorCodeUnauthorized, "%s", err)
+	case err != nil:
+		log.Error().Err(err).Msgf("could not verify the signature of %s %s", c.Request.Method, c.Request.URL.Path)
+		writeError(c, http.StatusServiceUnavailable, ErrorCodeInternal, "could not verify the signature")
+	}
+}
@@ -0,0 +1,59 @@
+package webservice
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"resource-tree-handler/internal/auth"
+)
+
+func TestVerifySignature(t *testing.T) {
+	engine, r := testEngine()
+	r.SignatureVerifier = auth.NewSignatureVerifier(func(context.Context) ([][]byte, error) {
+		return [][]byte{[]byte("secret")}, nil
+	}, time.Minute)
+	// Events of other groups are ignored after the verification
+	body := `{"involvedObject":{"apiVersion":"v1","kind":"ConfigMap","uid":"a"},"reason":"CompositionDeleted"}`
+	now := time.Now().Unix()
+
+	tests := []struct {
+		timestamp int64
+		key       string
+		status    int
+	}{
+		{now, "secret", http.StatusOK},
+		{now, "other", http.StatusUnauthorized},
+		{now - 600, "secret", http.StatusUnauthorized},
+		{0, "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		for _, path := range []string{apiV1Prefix + eventsEndpoint, legacyAllEventsEndpoint} {
+			request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+			if tt.key != "" {
+				request.Header.Set(auth.SignatureTimestampHeader, strconv.FormatInt(tt.timestamp, 10))
+				request.Header.Set(auth.SignatureHeader, auth.Sign([]byte(tt.key), tt.timestamp, []byte(body)))
+			}
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, request)
+			if recorder.Code != tt.status {
+				t.Errorf("%s signed with %q at %d: expected status %d, got %d: %s", path, tt.key, tt.timestamp, tt.status, recorder.Code, recorder.Body.String())
+			}
+		}
+	}
+
+	// The bodies larger than the limit are rejected before the verification, even when signed
+	r.MaxSignedBodyBytes = int64(len(body) - 1)
+	request := httptest.NewRequest(http.MethodPost, apiV1Prefix+eventsEndpoint, strings.NewReader(body))
+	request.Header.Set(auth.SignatureTimestampHeader, strconv.FormatInt(now, 10))
+	request.Header.Set(auth.SignatureHeader, auth.Sign([]byte("secret"), now, []byte(body)))
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusRequestEntityTooLarge || !strings.Contains(recorder.Body.String(), string(ErrorCodeTooLarge)) {
+		t.Errorf("expected status %d, got %d: %s", http.StatusRequestEntityTooLarge, recorder.Code, recorder.Body.String())
+	}
+}
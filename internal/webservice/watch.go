@@ -0,0 +1,119 @@
+package webservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"resource-tree-handler/internal/streaming"
+)
+
+const (
+	// Interval between the comments sent to keep idle streams open through proxies
+	streamKeepAlive = 30 * time.Second
+)
+
+// handleWatch streams the changes of the resource tree of one composition as server-sent events.
+// If the resource tree is not cached, it is created and its snapshot is sent as soon as it is ready.
+func (r *Webservice) handleWatch(c *gin.Context) {
+	compositionId := c.Param("compositionId")
+	if !r.Cache.IsUidInCache(compositionId) {
+		// StatusTooManyRequests means that the resource tree is already being created
+		if status, err := r.queueCreate(compositionId, nil); status == http.StatusNotFound {
+			writeError(c, http.StatusNotFound, ErrorCodeNotFound, "%s", err)
+			return
+		}
+	}
+	r.stream(c, compositionId)
+}
+
+// handleWatchAll streams the changes of all the cached resource trees as server-sent events
+func (r *Webservice) handleWatchAll(c *gin.Context) {
+	r.stream(c, "")
+}
+
+// stream writes the events of the subscription as server-sent events, until the client disconnects.
+// The event id is the revision, so that clients can resume with the Last-Event-ID header
+// (or the sinceRevision query parameter) after a reconnection.
+func (r *Webservice) stream(c *gin.Context, compositionId string) {
+	since, err := sinceRevision(c)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, ErrorCodeBadRequest, "%s", err)
+		return
+	}
+
+	subscription := r.hub.Subscribe(compositionId, since)
+	defer r.hub.Unsubscribe(subscription)
+	log.Info().Msgf("Streaming resource tree changes for composition id '%s' since revision %d", compositionId, since)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	authorizer := r.nodeAuthorizer(c)
+	compositions := map[string]bool{}
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-subscription.Events():
+			if !ok {
+				return
+			}
+			if event, ok = authorizer.filterEvent(r.Cache, compositions, event); !ok {
+				continue
+			}
+			if err := writeEvent(c, event); err != nil {
+				log.Warn().Err(err).Msgf("could not write event to stream for composition id '%s'", compositionId)
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(c.Writer, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+func writeEvent(c *gin.Context, event streaming.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.Revision, event.Type, data); err != nil {
+		return err
+	}
+	c.Writer.Flush()
+	return nil
+}
+
+// sinceRevision returns the revision to resume the stream from, 0 to start with a snapshot
+func sinceRevision(c *gin.Context) (uint64, error) {
+	value := c.Query("sinceRevision")
+	if value == "" {
+		value = c.GetHeader("Last-Event-ID")
+	}
+	if value == "" {
+		return 0, nil
+	}
+	return parseRevision(value)
+}
+
+func parseRevision(value string) (uint64, error) {
+	revision, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid revision %q: %w", value, err)
+	}
+	return revision, nil
+}
@@ -1,7 +1,10 @@
 package webservice
 
 import (
+	"bytes"
+	"cmp"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -23,34 +26,75 @@ import (
 	corev1 "k8s.io/api/core/v1"
 
 	types "resource-tree-handler/apis"
+	"resource-tree-handler/internal/auth"
 	cachehelper "resource-tree-handler/internal/cache"
+	"resource-tree-handler/internal/graphql"
+	"resource-tree-handler/internal/helpers/configuration"
 	kubehelper "resource-tree-handler/internal/helpers/kube/client"
 	compositionhelper "resource-tree-handler/internal/helpers/kube/compositions"
 	filtershelper "resource-tree-handler/internal/helpers/kube/filters"
+	schemahelper "resource-tree-handler/internal/helpers/kube/schema"
 	resourcetreehelper "resource-tree-handler/internal/helpers/resourcetree"
+	"resource-tree-handler/internal/metrics"
+	"resource-tree-handler/internal/ratelimit"
 	ssehelper "resource-tree-handler/internal/ssemanager"
+	"resource-tree-handler/internal/streaming"
 )
 
 const (
-	homeEndpoint      = "/"
-	listEndpoint      = "/list"
-	allEventsEndpoint = "/handle"
-	requestEndpoint   = "/compositions/:compositionId"
-	refreshEndpoint   = "/refresh/:compositionId"
+	// Paths of the routes, relative to apiV1Prefix unless unversioned, see routes.go
+	homeEndpoint               = "/"
+	openAPIEndpoint            = "/openapi.json"
+	compositionsEndpoint       = "/compositions"
+	compositionEndpoint        = "/compositions/:compositionId"
+	resolveEndpoint            = "/compositions/resolve"
+	resolveTreeEndpoint        = "/compositions/resolve/tree"
+	resolveRefreshEndpoint     = "/compositions/resolve/refresh"
+	compositionRefreshEndpoint = "/compositions/:compositionId/refresh"
+	compositionNodeEndpoint    = "/compositions/:compositionId/resources/:uid"
+	compositionExportEndpoint  = "/compositions/:compositionId/export"
+	compositionWatchEndpoint   = "/compositions/:compositionId/watch"
+	resourcesLookupEndpoint    = "/resources/lookup"
+	inventoryEndpoint          = "/inventory"
+	graphqlEndpoint            = "/graphql"
+	refreshesEndpoint          = "/refreshes"
+	refreshStatusEndpoint      = "/refreshes/:refreshId"
+	watchEndpoint              = "/watch"
+	eventsEndpoint             = "/events"
+	cacheStatsEndpoint         = "/cache/stats"
+	resyncStatsEndpoint        = "/resync/stats"
+	configEndpoint             = "/admin/config"
+	metricsEndpoint            = "/metrics"
+
+	// Paths served before the API was versioned
+	legacyListEndpoint      = "/list"
+	legacyAllEventsEndpoint = "/handle"
+	legacyRefreshEndpoint   = "/refresh/:compositionId"
 
 	busyString   = "busy"
 	freeString   = "free"
 	queuedString = "queued"
 
-	// Maximum number of concurrent resource tree creations
-	maxConcurrentJobs = 10
+	// Default maximum number of concurrent resource tree creations
+	defaultWorkers = 10
+	// Default size of the buffer of pending jobs, for each priority
+	defaultQueueSize = 1000
+	// Default maximum size of the bodies of the signed requests, read whole before the handlers
+	defaultMaxSignedBodyBytes = 1 << 20
 )
 
 // CreateJobRequest represents a job to create a resource tree
 type CreateJobRequest struct {
+	// CompositionUnstructured is retrieved through CompositionReference when nil
 	CompositionUnstructured *unstructured.Unstructured
 	CompositionReference    types.Reference
 	CompositionID           string
+	// Resync jobs rebuild a cached resource tree and report the drift from the cached one
+	Resync bool
+	// RefreshId is the bulk refresh the job belongs to, if any, see refreshes.go
+	RefreshId string
+	// QueuedAt is when the job was queued, for the wait time in the queue
+	QueuedAt time.Time
 }
 
 type Webservice struct {
@@ -61,20 +105,83 @@ type Webservice struct {
 	compositionStatus   map[string]string
 	compositionStatusMu sync.Mutex
 
-	// Job queue for resource tree creation
-	jobQueue  chan CreateJobRequest
-	workersWg sync.WaitGroup
+	// TLSConfig serves HTTPS instead of HTTP when set, see certificates.Reloader.ServerConfig
+	TLSConfig *tls.Config
+
+	// Background resync of the cached resource trees, disabled if ResyncPeriod is 0
+	ResyncPeriod time.Duration
+	ResyncJitter time.Duration
+	resyncStats  resyncStats
+
+	// Bulk refreshes that can be polled, see refreshes.go
+	refreshes refreshes
+
+	// Authentication of the requests, anonymous requests are allowed by the zero requirements, see authentication.go
+	Authenticators   auth.Authenticators
+	ReadRequirement  auth.Requirement
+	WriteRequirement auth.Requirement
+	// Trimming of the resource trees to what the users can get in Kubernetes, see authorization.go
+	Authorizer *auth.Authorizer
+	Redaction  auth.RedactionMode
+	// Verification of the HMAC signatures of the events, not signed if nil, see signature.go
+	SignatureVerifier *auth.SignatureVerifier
+	// Maximum size of the bodies of the signed requests, defaultMaxSignedBodyBytes if 0
+	MaxSignedBodyBytes int64
+
+	// Rate limits of the classes of routes, unlimited if missing, see limits.go
+	RateLimits map[ratelimit.Class]ratelimit.Limits
+	limiters   limiters
+	// TrustedProxies are the proxies whose X-Forwarded-For header gives the client IP, none if empty
+	TrustedProxies []string
+	// Period during which the ids not found in the cluster are not looked up again, disabled if 0
+	UnknownCompositionTTL time.Duration
+	unknownCompositions   unknownCompositions
+
+	// Limits of the GraphQL queries, the defaults of the graphql package are used if 0
+	GraphQLMaxDepth      int
+	GraphQLMaxComplexity int
+	graphql              *graphql.Handler
+
+	// MetricsAuthenticated requires the read authentication and rate limits on /metrics, public if false so that
+	// Prometheus can scrape it without a token
+	MetricsAuthenticated bool
+
+	// Size of the worker pool and of the queue of each priority, the defaults if 0
+	Workers   int
+	QueueSize int
+
+	// settingsMu guards the settings changed at runtime: Workers, RateLimits, ResyncPeriod and ResyncJitter,
+	// see reload.go
+	settingsMu    sync.RWMutex
+	workerStops   []chan struct{}
+	resyncChanged chan struct{}
+	// ConfigReloader reports the configuration applied, see handleConfig
+	ConfigReloader *configuration.Reloader
+
+	// Stream of the resource tree changes, see watch.go
+	hub *streaming.Hub
+
+	// Generated from the routes when they are registered, see routes.go
+	openAPIDocument []byte
+	// Prometheus metrics of the metrics package and of the state of the webservice, see metrics.go
+	metrics http.Handler
+
+	// Job queues for resource tree creation, workers always prefer jobQueue over lowPriorityJobQueue
+	jobQueue            chan CreateJobRequest
+	lowPriorityJobQueue chan CreateJobRequest
+	workersWg           sync.WaitGroup
 }
 
 func (r *Webservice) handleHome(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	c.JSON(http.StatusOK, StatusResponse{Status: "ok"})
 }
 
 func (r *Webservice) handleAllEvents(c *gin.Context) {
-	log.Debug().Msg("received event on /handle")
+	log.Debug().Msgf("received event on %s", c.FullPath())
 	body, err := io.ReadAll(c.Request.Body)
 	if err != nil {
 		log.Error().Err(err).Msg("error reading request body")
+		writeError(c, http.StatusBadRequest, ErrorCodeBadRequest, "could not read request body: %s", err)
 		return
 	}
 	defer c.Request.Body.Close()
@@ -83,46 +190,51 @@ func (r *Webservice) handleAllEvents(c *gin.Context) {
 	err = json.Unmarshal(body, &event)
 	if err != nil {
 		log.Error().Err(err).Msg("error parsing JSON")
+		writeError(c, http.StatusBadRequest, ErrorCodeBadRequest, "could not parse event: %s", err)
 		return
 	}
 
 	gv, err := schema.ParseGroupVersion(event.InvolvedObject.APIVersion)
 	if err != nil {
 		log.Error().Err(err).Msg("could not parse Group Version from ApiVersion")
+		writeError(c, http.StatusBadRequest, ErrorCodeBadRequest, "could not parse apiVersion %q of the involved object: %s", event.InvolvedObject.APIVersion, err)
 		return
 	}
 
-	if gv.Group != "composition.krateo.io" {
+	if !schemahelper.Get().IsCompositionGroup(gv.Group) {
+		c.JSON(http.StatusOK, MessageResponse{Message: fmt.Sprintf("Event for group %s ignored", gv.Group)})
 		return
 	}
 
 	compositionId := string(event.InvolvedObject.UID)
+	if compositionId == "" {
+		writeError(c, http.StatusBadRequest, ErrorCodeBadRequest, "event %s without the uid of the involved object", event.Reason)
+		return
+	}
 
 	log.Info().Msgf("Event %s received for composition id %s", event.Reason, compositionId)
 	log.Info().Msgf("IsUidInCache(%s): %t", compositionId, r.Cache.IsUidInCache(compositionId))
 
 	if !r.continueOperationsWithComposition(compositionId) {
-		c.String(http.StatusTooManyRequests, "composition id %s is busy or queued", compositionId)
+		writeError(c, http.StatusTooManyRequests, ErrorCodeBusy, "composition id %s is busy or queued", compositionId)
 		return
 	}
 	r.setContinueOperationsWithComposition(compositionId, busyString)
 
 	if event.Reason == "CompositionDeleted" {
-		if compositionId == "" {
-			log.Error().Err(fmt.Errorf("could not find composition id in cache by composition reference")).Msgf("error deleting composition resources")
-			c.String(http.StatusInternalServerError, "DELETE for CompositionId %s not executed", compositionId)
-			return
-		}
 		r.Cache.DeleteFromCache(compositionId)
 		r.SSE.UnsubscribeFrom(compositionId)
-		c.String(http.StatusOK, "DELETE for CompositionId %s executed", compositionId)
+		r.setContinueOperationsWithComposition(compositionId, freeString)
+		c.JSON(http.StatusOK, MessageResponse{Message: fmt.Sprintf("DELETE for CompositionId %s executed", compositionId)})
 		return
 	}
 
-	compositionUnstructured, compositionReferece, err := compositionhelper.GetCompositionById(compositionId, r.Config)
+	// The event shows that the composition exists, even if it was not found recently
+	r.forgetUnknownComposition(compositionId)
+	compositionUnstructured, compositionReferece, err := r.compositionById(compositionId)
 	if err != nil {
 		log.Error().Err(err).Msgf("could not get composition with id %s", compositionId)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error while handling %s event: %s", event.Reason, err)})
+		writeError(c, http.StatusInternalServerError, ErrorCodeInternal, "error while handling %s event: %s", event.Reason, err)
 		r.setContinueOperationsWithComposition(compositionId, freeString)
 		return
 	}
@@ -143,9 +255,10 @@ func (r *Webservice) handleAllEvents(c *gin.Context) {
 		}
 
 		// Respond to client immediately with 202 Accepted
-		c.JSON(http.StatusAccepted, gin.H{"message": fmt.Sprintf("Job for composition %s has been queued", compositionId)})
+		c.JSON(http.StatusAccepted, MessageResponse{Message: fmt.Sprintf("Job for composition %s has been queued", compositionId)})
 
 		// Submit job to queue after responding to client
+		job.QueuedAt = time.Now()
 		go func() {
 			r.jobQueue <- job
 		}()
@@ -153,7 +266,7 @@ func (r *Webservice) handleAllEvents(c *gin.Context) {
 		log.Info().Msgf("Job for composition %s has been queued", compositionId)
 	} else {
 		// If we got here, nothing needed to be done
-		c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("No action needed for composition %s", compositionId)})
+		c.JSON(http.StatusOK, MessageResponse{Message: fmt.Sprintf("No action needed for composition %s", compositionId)})
 		// Free the resource if there is nothing to do
 		if !r.continueOperationsWithComposition(compositionId) {
 			r.setContinueOperationsWithComposition(compositionId, freeString)
@@ -166,132 +279,170 @@ func (r *Webservice) handleRefresh(c *gin.Context) {
 	body, err := io.ReadAll(c.Request.Body)
 	if err != nil {
 		log.Error().Err(err).Msg("error reading request body")
+		writeError(c, http.StatusBadRequest, ErrorCodeBadRequest, "could not read request body: %s", err)
 		return
 	}
 	defer c.Request.Body.Close()
 
+	// Without a body, the composition is resolved by id
 	var reference *types.Reference
+	if len(bytes.TrimSpace(body)) == 0 {
+		if reference, err = r.referenceById(compositionId); err != nil {
+			writeError(c, http.StatusNotFound, ErrorCodeNotFound, "%s", err)
+			return
+		}
+		r.refresh(c, compositionId, reference)
+		return
+	}
 	err = json.Unmarshal(body, &reference)
-	if err != nil {
+	if err != nil || reference == nil {
 		log.Error().Err(err).Msg("error parsing JSON")
+		writeError(c, http.StatusBadRequest, ErrorCodeBadRequest, "could not parse composition reference: %v", err)
 		return
 	}
 	reference.Uid = compositionId
+	r.refresh(c, compositionId, reference)
+}
+
+// referenceById returns the reference of a composition, from the cache or else from the cluster
+func (r *Webservice) referenceById(compositionId string) (*types.Reference, error) {
+	if entry, ok := r.Cache.GetResourceTreeFromCache(compositionId); ok {
+		reference := entry.CompositionReference
+		return &reference, nil
+	}
+	_, reference, err := r.compositionById(compositionId)
+	if err != nil {
+		log.Error().Err(err).Msgf("could not obtain composition object with composition id %s", compositionId)
+		return nil, fmt.Errorf("could not obtain composition object with composition id %s: %v", compositionId, err)
+	}
+	return reference, nil
+}
 
+// refresh rebuilds the resource tree of the composition synchronously and caches it
+func (r *Webservice) refresh(c *gin.Context, compositionId string, reference *types.Reference) {
 	log.Info().Msgf("'CompositionCreated' event for composition %s %s %s %s", reference.ApiVersion, reference.Resource, reference.Name, reference.Namespace)
 
 	obj, err := kubehelper.GetObj(c.Request.Context(), reference, r.Config)
 	if err != nil {
 		log.Error().Err(err).Msg("retrieving object")
+		writeError(c, http.StatusNotFound, ErrorCodeNotFound, "could not retrieve composition %s %s %s/%s: %s", reference.ApiVersion, reference.Resource, reference.Namespace, reference.Name, err)
+		return
 	}
-	exclude := filtershelper.GetFilters(r.Config, *reference)
-	if r.continueOperationsWithComposition(compositionId) {
-		r.setContinueOperationsWithComposition(compositionId, busyString)
-		resourceTree, err := compositionhelper.GetCompositionResourcesStatus(r.Config, obj, *reference, exclude)
-		if err != nil {
-			log.Error().Err(err).Msg("retrieving managed array statuses")
-		}
+	if reference.Kind == "" {
+		reference.Kind = obj.GetKind()
+	}
+	if !r.continueOperationsWithComposition(compositionId) {
+		writeError(c, http.StatusTooManyRequests, ErrorCodeBusy, "composition id %s is busy or queued", compositionId)
+		return
+	}
+	r.setContinueOperationsWithComposition(compositionId, busyString)
+	defer r.setContinueOperationsWithComposition(compositionId, freeString)
 
-		r.Cache.AddToCache(resourceTree, string(obj.GetUID()), *reference, types.Filters{Exclude: exclude})
-		r.setContinueOperationsWithComposition(compositionId, freeString)
+	exclude := filtershelper.GetFilters(r.Config, *reference)
+	resourceTree, err := compositionhelper.GetCompositionResourcesStatus(r.Config, obj, *reference, exclude)
+	if err != nil {
+		log.Error().Err(err).Msg("retrieving managed array statuses")
+		writeError(c, http.StatusInternalServerError, ErrorCodeInternal, "could not build resource tree for composition id %s: %s", compositionId, err)
+		return
 	}
-}
 
-func (r *Webservice) handleList(c *gin.Context) {
-	keys := r.Cache.ListKeysFromCache()
-	c.JSON(http.StatusOK, gin.H{"composition_ids": strings.Join(keys, " ")})
+	r.Cache.AddToCache(resourceTree, string(obj.GetUID()), *reference, types.Filters{Exclude: exclude})
+	c.JSON(http.StatusOK, MessageResponse{Message: fmt.Sprintf("Resource tree for composition %s refreshed", compositionId)})
 }
 
-func (r *Webservice) handleRequest(c *gin.Context) {
-	compositionId := c.Param("compositionId")
-	resourceTreeStatusObj, okJSON := r.Cache.GetJSONFromCache(compositionId)
-
-	if !okJSON {
-		log.Warn().Msgf("could not find resource tree for CompositionId %s", compositionId)
-		compositionUnstructured, compositionReferece, err := compositionhelper.GetCompositionById(compositionId, r.Config)
-		if err != nil {
-			log.Error().Err(err).Msgf("could not obtain composition object with composition id %s", compositionId)
-			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Error parsing GET request: %s", fmt.Errorf("could not obtain composition object with composition id %s: %v", compositionId, err))})
-			return
-		}
-
-		if !r.continueOperationsWithComposition(compositionId) {
-			log.Warn().Msgf("composition id %s is busy or queued", compositionId)
-			c.String(http.StatusTooManyRequests, "composition id %s is busy or queued", compositionId)
-			return
+func (r *Webservice) handleLegacyList(c *gin.Context) {
+	references := map[string]types.Reference{}
+	r.Cache.RangeCache(func(compositionId string, entry *cachehelper.ResourceTreeUpdate) bool {
+		references[compositionId] = entry.CompositionReference
+		return true
+	})
+	// The access reviews are not done while ranging over the cache
+	authorizer := r.nodeAuthorizer(c)
+	keys := []string{}
+	for compositionId, reference := range references {
+		if authorizer.canReadComposition(reference) {
+			keys = append(keys, compositionId)
 		}
+	}
+	c.JSON(http.StatusOK, LegacyListResponse{CompositionIds: strings.Join(keys, " ")})
+}
 
-		// Set status to queued
-		r.setContinueOperationsWithComposition(compositionId, queuedString)
+func (r *Webservice) handleCacheStats(c *gin.Context) {
+	stats, ok := r.Cache.Stats()
+	if !ok {
+		writeError(c, http.StatusNotImplemented, ErrorCodeNotImplemented, "the cache store does not report statistics")
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
 
-		log.Info().Msgf("Queuing CREATE job from GET request for composition id %s: ", compositionId)
+func (r *Webservice) handleRequest(c *gin.Context) {
+	r.serveResourceTree(c, c.Param("compositionId"), nil)
+}
 
-		// Subscribe to SSE before queueing the job
-		r.SSE.SubscribeTo(compositionId)
+// serveResourceTree writes the cached resource tree of the composition, or queues its creation.
+// The reference of the composition is looked up by id when nil.
+func (r *Webservice) serveResourceTree(c *gin.Context, compositionId string, reference *types.Reference) {
+	resourceTreeUpdate, ok := r.Cache.GetResourceTreeFromCache(compositionId)
 
-		// Create the job and submit it to the queue asynchronously
-		job := CreateJobRequest{
-			CompositionUnstructured: compositionUnstructured,
-			CompositionReference:    *compositionReferece,
-			CompositionID:           compositionId,
+	if !ok {
+		log.Warn().Msgf("could not find resource tree for CompositionId %s", compositionId)
+		status, err := r.queueCreate(compositionId, reference)
+		switch status {
+		case http.StatusNotFound:
+			writeError(c, http.StatusNotFound, ErrorCodeNotFound, "%s", err)
+		case http.StatusTooManyRequests:
+			writeError(c, http.StatusTooManyRequests, ErrorCodeBusy, "%s", err)
+		default:
+			c.JSON(http.StatusAccepted, MessageResponse{Message: fmt.Sprintf("Job for composition %s has been queued", compositionId)})
 		}
-
-		// Respond to client immediately with 202 Accepted
-		c.JSON(http.StatusAccepted, gin.H{"message": fmt.Sprintf("Job for composition %s has been queued", compositionId)})
-
-		// Submit job to queue after responding to client
-		go func() {
-			r.jobQueue <- job
-		}()
-
-		log.Info().Msgf("Job for composition %s has been queued", compositionId)
 		return
 	}
 
 	// Resource tree exists in cache, return it
 	log.Info().Msgf("Resouce tree for composition id %s ready", compositionId)
-	c.JSON(http.StatusOK, resourceTreeStatusObj)
-
-	resourceTreeUpdate, okData := r.Cache.GetResourceTreeFromCache(compositionId)
-	if !okData {
-		log.Error().Msgf("could not obtain resource tree data structure, this should not happen")
-		return
-	}
-
-	if time.Since(resourceTreeUpdate.LastUpdate) > time.Duration(8*time.Hour) {
-		log.Warn().Msgf("Updating resource tree for CompositionId %s, current resource tree may not be up to date if controllers do not report events...", compositionId)
+	r.writeResourceTree(c, compositionId, resourceTreeUpdate)
+}
 
-		compositionUnstructured, compositionReferece, err := compositionhelper.GetCompositionById(compositionId, r.Config)
+// queueCreate queues the creation of the resource tree for a composition that is not cached. It returns
+// http.StatusAccepted when the job is queued, http.StatusNotFound when the composition cannot be found,
+// and http.StatusTooManyRequests when the composition is already busy or queued. When the reference is
+// nil, the composition is looked up by id; otherwise the worker retrieves it through the reference.
+func (r *Webservice) queueCreate(compositionId string, reference *types.Reference) (int, error) {
+	job := CreateJobRequest{CompositionID: compositionId}
+	if reference != nil {
+		job.CompositionReference = *reference
+	} else {
+		compositionUnstructured, compositionReferece, err := r.compositionById(compositionId)
 		if err != nil {
 			log.Error().Err(err).Msgf("could not obtain composition object with composition id %s", compositionId)
-			return
+			return http.StatusNotFound, fmt.Errorf("could not obtain composition object with composition id %s: %v", compositionId, err)
 		}
+		job.CompositionUnstructured = compositionUnstructured
+		job.CompositionReference = *compositionReferece
+	}
 
-		if !r.continueOperationsWithComposition(compositionId) {
-			log.Warn().Msgf("composition id %s is busy or queued", compositionId)
-			return
-		}
+	if !r.continueOperationsWithComposition(compositionId) {
+		log.Warn().Msgf("composition id %s is busy or queued", compositionId)
+		return http.StatusTooManyRequests, fmt.Errorf("composition id %s is busy or queued", compositionId)
+	}
 
-		// Set status to queued
-		r.setContinueOperationsWithComposition(compositionId, queuedString)
+	// Set status to queued
+	r.setContinueOperationsWithComposition(compositionId, queuedString)
 
-		log.Info().Msgf("Queuing CREATE job from UPDATE request for composition id %s: ", compositionId)
+	log.Info().Msgf("Queuing CREATE job from GET request for composition id %s: ", compositionId)
 
-		// Create the job and submit it to the queue asynchronously
-		job := CreateJobRequest{
-			CompositionUnstructured: compositionUnstructured,
-			CompositionReference:    *compositionReferece,
-			CompositionID:           compositionId,
-		}
+	// Subscribe to SSE before queueing the job
+	r.SSE.SubscribeTo(compositionId)
 
-		// Submit job to queue after responding to client
-		go func() {
-			r.jobQueue <- job
-		}()
+	// Submit the job to the queue asynchronously
+	job.QueuedAt = time.Now()
+	go func() {
+		r.jobQueue <- job
+	}()
 
-		log.Info().Msgf("Job UPDATE for composition %s has been queued", compositionId)
-		return
-	}
+	log.Info().Msgf("Job for composition %s has been queued", compositionId)
+	return http.StatusAccepted, nil
 }
 
 func (r *Webservice) continueOperationsWithComposition(compositionId string) bool {
@@ -313,13 +464,18 @@ func (r *Webservice) setContinueOperationsWithComposition(compositionId string,
 	r.compositionStatus[compositionId] = value
 }
 
-// startWorker starts a worker that processes jobs from the queue
-func (r *Webservice) startWorker(workerId int) {
+// startWorker starts a worker that processes jobs from the queue, until stop is closed
+func (r *Webservice) startWorker(workerId int, stop <-chan struct{}) {
 	defer r.workersWg.Done()
 
 	log.Debug().Msgf("Starting worker %d", workerId)
 
-	for job := range r.jobQueue {
+	for {
+		job, ok := r.nextJob(stop)
+		if !ok {
+			log.Debug().Msgf("Stopping worker %d", workerId)
+			return
+		}
 		compositionId := job.CompositionID
 		log.Info().Msgf("Worker %d processing job for composition %s", workerId, compositionId)
 
@@ -327,7 +483,10 @@ func (r *Webservice) startWorker(workerId int) {
 		r.setContinueOperationsWithComposition(compositionId, busyString)
 
 		// Execute the actual job
-		err := resourcetreehelper.HandleCreate(job.CompositionUnstructured, job.CompositionReference, r.Cache, r.Config)
+		err := r.processJob(job)
+		if job.RefreshId != "" {
+			r.refreshes.complete(job.RefreshId, compositionId, err)
+		}
 
 		if err != nil {
 			log.Error().Err(err).Msgf("Worker %d failed to create resource tree for composition %s", workerId, compositionId)
@@ -340,17 +499,67 @@ func (r *Webservice) startWorker(workerId int) {
 	}
 }
 
+// nextJob returns the next job to process, low priority jobs are returned only when there are no other jobs queued.
+// It returns false when stop is closed.
+func (r *Webservice) nextJob(stop <-chan struct{}) (CreateJobRequest, bool) {
+	select {
+	case <-stop:
+		return CreateJobRequest{}, false
+	case job, ok := <-r.jobQueue:
+		return dequeued(job, metrics.PriorityHigh), ok
+	default:
+	}
+	select {
+	case <-stop:
+		return CreateJobRequest{}, false
+	case job, ok := <-r.jobQueue:
+		return dequeued(job, metrics.PriorityHigh), ok
+	case job, ok := <-r.lowPriorityJobQueue:
+		return dequeued(job, metrics.PriorityLow), ok
+	}
+}
+
+// dequeued records the wait of a job in the queue of its priority
+func dequeued(job CreateJobRequest, priority string) CreateJobRequest {
+	if !job.QueuedAt.IsZero() {
+		metrics.JobQueueWait.WithLabelValues(priority).Observe(time.Since(job.QueuedAt).Seconds())
+	}
+	return job
+}
+
+func (r *Webservice) processJob(job CreateJobRequest) error {
+	if job.CompositionUnstructured == nil {
+		compositionUnstructured, err := kubehelper.GetObj(context.Background(), &job.CompositionReference, r.Config)
+		if err != nil {
+			return fmt.Errorf("retrieving composition object: %w", err)
+		}
+		job.CompositionUnstructured = compositionUnstructured
+	}
+
+	if !job.Resync {
+		return resourcetreehelper.HandleCreate(job.CompositionUnstructured, job.CompositionReference, r.Cache, r.Config)
+	}
+
+	drift, err := resourcetreehelper.HandleResync(job.CompositionUnstructured, job.CompositionReference, r.Cache, r.Config)
+	if err != nil {
+		return err
+	}
+	r.recordDrift(job.CompositionID, drift)
+	return nil
+}
+
 // initWorkerPool initializes the worker pool
 func (r *Webservice) initWorkerPool() {
-	r.jobQueue = make(chan CreateJobRequest, 1000) // Buffer for pending jobs
+	r.settingsMu.Lock()
+	defer r.settingsMu.Unlock()
+	queueSize := cmp.Or(r.QueueSize, defaultQueueSize)
+	r.jobQueue = make(chan CreateJobRequest, queueSize)
+	r.lowPriorityJobQueue = make(chan CreateJobRequest, queueSize)
 
 	// Start the worker pool
-	r.workersWg.Add(maxConcurrentJobs)
-	for i := range maxConcurrentJobs {
-		go r.startWorker(i)
-	}
+	r.resizeWorkerPool()
 
-	log.Info().Msgf("Started worker pool with %d workers", maxConcurrentJobs)
+	log.Info().Msgf("Started worker pool with %d workers", len(r.workerStops))
 }
 
 func (r *Webservice) Spinup(ctx context.Context) {
@@ -359,6 +568,13 @@ func (r *Webservice) Spinup(ctx context.Context) {
 	// Initialize the worker pool
 	r.initWorkerPool()
 
+	// Start the background resync of the cached resource trees
+	go r.runResync(ctx)
+
+	// Start streaming the changes of the resource trees
+	r.hub = streaming.NewHub(r.Cache)
+	r.hub.Start(ctx)
+
 	var c *gin.Engine
 	if zerolog.GlobalLevel() == zerolog.DebugLevel {
 		c = gin.New()
@@ -369,19 +585,28 @@ func (r *Webservice) Spinup(ctx context.Context) {
 		c = gin.Default()
 	}
 
-	c.GET(homeEndpoint, r.handleHome)
-	c.GET(requestEndpoint, r.handleRequest)
-	c.GET(listEndpoint, r.handleList)
-	c.POST(refreshEndpoint, r.handleRefresh)
-	c.POST(allEventsEndpoint, r.handleAllEvents)
+	// Clients could choose their IP, and elude the rate limits, if every proxy were trusted
+	if err := c.SetTrustedProxies(r.TrustedProxies); err != nil {
+		log.Error().Err(err).Msg("invalid trusted proxies, none is trusted")
+		c.SetTrustedProxies(nil)
+	}
+	r.registerRoutes(c)
 
 	srv := &http.Server{
-		Addr:    fmt.Sprintf(":%d", r.WebservicePort),
-		Handler: c.Handler(),
+		Addr:      fmt.Sprintf(":%d", r.WebservicePort),
+		Handler:   c.Handler(),
+		TLSConfig: r.TLSConfig,
 	}
 	go func() {
 		// service connections
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if r.TLSConfig != nil {
+			// The certificates are provided by the TLSConfig
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Logger.Error().Err(err).Msgf("listen on %d", r.WebservicePort)
 		}
 	}()
@@ -2,21 +2,42 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
+	"slices"
+	"strings"
+
+	"resource-tree-handler/internal/auth"
 	cachehelper "resource-tree-handler/internal/cache"
+	"resource-tree-handler/internal/certificates"
 	parser "resource-tree-handler/internal/helpers/configuration"
+	kubehelper "resource-tree-handler/internal/helpers/kube/client"
+	compositionhelper "resource-tree-handler/internal/helpers/kube/compositions"
+	reviewshelper "resource-tree-handler/internal/helpers/kube/reviews"
+	schemahelper "resource-tree-handler/internal/helpers/kube/schema"
+	"resource-tree-handler/internal/helpers/kube/secrets"
+	"resource-tree-handler/internal/ratelimit"
 	"resource-tree-handler/internal/ssemanager"
 	"resource-tree-handler/internal/webservice"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
 	"k8s.io/client-go/rest"
 )
 
 func main() {
-	configuration, err := parser.ParseConfig()
+	configuration, err := parser.Load(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
-		configuration.Default()
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(1)
 	}
 
 	// Logger configuration
@@ -24,31 +45,69 @@ func main() {
 	zerolog.SetGlobalLevel(configuration.DebugLevel)
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 
-	if err != nil {
-		log.Error().Err(err).Msg("configuration missing")
-		log.Info().Msg("using default configuration for webservice")
-	}
-
 	log.Debug().Msg("List of environment variables:")
 	for _, s := range os.Environ() {
 		log.Debug().Msg(s)
 	}
 
-	// Kubernetes configuration
-	config, err := rest.InClusterConfig()
+	// Kubernetes configuration, from the kubeconfig or in-cluster
+	config, err := kubehelper.NewConfig(configuration.Kubeconfig, configuration.KubeContext)
 	if err != nil {
 		log.Error().Err(err).Msg("resolving kubeconfig for rest client")
 		return
 	}
+	log.Info().Msgf("connecting to the API server %s", config.Host)
+
+	authenticators, err := newAuthenticators(configuration, config)
+	if err != nil {
+		log.Error().Err(err).Msg("configuring authentication")
+		return
+	}
+	authorizer := newAuthorizer(configuration, config)
+	signatureVerifier := newSignatureVerifier(configuration, config)
+
+	serverTLSConfig, err := newServerTLSConfig(context.Background(), configuration, config)
+	if err != nil {
+		log.Error().Err(err).Msg("configuring TLS")
+		return
+	}
+	sseTLSConfig, err := newSSETLSConfig(context.Background(), configuration)
+	if err != nil {
+		log.Error().Err(err).Msg("configuring TLS of the SSE client")
+		return
+	}
+
+	for _, class := range ratelimit.Classes {
+		if limits, ok := configuration.RateLimits[class]; ok {
+			log.Info().Msgf("rate limits of the %s routes: %s per client, %s globally", class, limits.Client, limits.Global)
+		}
+	}
+
+	compositionhelper.SetReadyConditionTypes(configuration.HealthConditionTypes)
+	schemahelper.Set(configuration.Schema)
+	log.Info().Msgf("composition groups: %s", strings.Join(configuration.Schema.Compositions.Groups, ", "))
 
 	// Initialize cache object
-	cache := cachehelper.NewThreadSafeCache()
+	store := cachehelper.NewMemoryStoreWithEviction(cachehelper.EvictionPolicy{
+		MaxEntries: configuration.CacheMaxEntries,
+		MaxBytes:   configuration.CacheMaxBytes,
+		IdleTTL:    configuration.CacheIdleTTL,
+	})
+	store.SetHistorySize(configuration.CacheRevisionHistory)
+	cache := cachehelper.NewThreadSafeCacheWithStore(store)
 
 	// Start client to receive SSE events from eventsse
 	log.Info().Msgf("starting SSE client on %s", configuration.SSEUrl)
 	sse := &ssemanager.SSE{
-		Config: config,
-		Cache:  cache,
+		Config:    config,
+		Cache:     cache,
+		TLSConfig: sseTLSConfig,
+		Retry: ssemanager.RetryPolicy{
+			InitialDelay: configuration.SSERetryInitialDelay,
+			MaxDelay:     configuration.SSERetryMaxDelay,
+			MaxAttempts:  configuration.SSERetryMaxAttempts,
+		},
+		WaitTimeout: configuration.SSEWaitTimeout,
 	}
 	sse.Spinup(configuration.SSEUrl) // only initialization and go routines, non-blocking
 
@@ -58,7 +117,174 @@ func main() {
 		WebservicePort: configuration.WebServicePort,
 		Cache:          cache,
 		SSE:            sse,
+		ResyncPeriod:   configuration.ResyncPeriod,
+		ResyncJitter:   configuration.ResyncJitter,
+
+		Authenticators:   authenticators,
+		ReadRequirement:  configuration.AuthRead,
+		WriteRequirement: configuration.AuthWrite,
+		Authorizer:       authorizer,
+		Redaction:        configuration.AuthRedaction,
+
+		SignatureVerifier:  signatureVerifier,
+		MaxSignedBodyBytes: configuration.EventsSignatureMaxBodyBytes,
+
+		TLSConfig: serverTLSConfig,
+
+		RateLimits:            configuration.RateLimits,
+		TrustedProxies:        configuration.TrustedProxies,
+		UnknownCompositionTTL: configuration.UnknownCompositionTTL,
+
+		GraphQLMaxDepth:      configuration.GraphQLMaxDepth,
+		GraphQLMaxComplexity: configuration.GraphQLMaxComplexity,
+
+		MetricsAuthenticated: configuration.MetricsAuthenticated,
+
+		Workers:   configuration.Workers,
+		QueueSize: configuration.QueueSize,
 	}
 
+	// The reloadable settings are applied when the configuration file changes
+	w.ConfigReloader = parser.NewReloader(os.Args[1:], os.LookupEnv, configuration, func(configuration parser.Configuration) {
+		zerolog.SetGlobalLevel(configuration.DebugLevel)
+		w.SetWorkers(configuration.Workers)
+		w.SetRateLimits(configuration.RateLimits)
+		w.SetResync(configuration.ResyncPeriod, configuration.ResyncJitter)
+		compositionhelper.SetReadyConditionTypes(configuration.HealthConditionTypes)
+	})
+	w.ConfigReloader.Start(context.Background(), parser.DefaultReloadInterval)
+
 	w.Spinup(context.Background())
 }
+
+// newAuthenticators returns the authenticators of the methods required by the read or write routes,
+// in the order they are tried: the cheapest first, the TokenReview last since it calls the API server
+func newAuthenticators(configuration parser.Configuration, config *rest.Config) (auth.Authenticators, error) {
+	required := slices.Concat(configuration.AuthRead.Methods, configuration.AuthWrite.Methods)
+	authenticators := auth.Authenticators{}
+	if slices.Contains(required, auth.MethodStatic) {
+		if configuration.AuthStaticTokensFile == "" {
+			return nil, fmt.Errorf("the static method requires AUTH_STATIC_TOKENS_FILE")
+		}
+		authenticator, err := auth.NewStaticAuthenticator(configuration.AuthStaticTokensFile)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, authenticator)
+	}
+	if slices.Contains(required, auth.MethodJWT) {
+		if configuration.AuthJWT.JWKSFile == "" {
+			return nil, fmt.Errorf("the jwt method requires AUTH_JWKS_FILE")
+		}
+		authenticator, err := auth.NewJWTAuthenticator(configuration.AuthJWT)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, authenticator)
+	}
+	if slices.Contains(required, auth.MethodTokenReview) {
+		authenticators = append(authenticators, auth.NewTokenReviewAuthenticator(func(ctx context.Context, token string) (*authenticationv1.TokenReviewStatus, error) {
+			return reviewshelper.Token(ctx, config, token, configuration.AuthTokenReviewAudiences)
+		}))
+	}
+	if len(authenticators) > 0 {
+		log.Info().Msgf("authentication methods %v, read requirement %+v, write requirement %+v", authenticators.Configured(), configuration.AuthRead, configuration.AuthWrite)
+	} else {
+		log.Warn().Msg("authentication disabled, the API is open to anyone who can reach it")
+	}
+	return authenticators, nil
+}
+
+// newAuthorizer returns the authorizer of the nodes of the resource trees, nil if the redaction is off
+func newAuthorizer(configuration parser.Configuration, config *rest.Config) *auth.Authorizer {
+	if configuration.AuthRedaction == auth.RedactionOff {
+		return nil
+	}
+	log.Info().Msgf("resource trees trimmed to what each user can get, redaction mode %s", configuration.AuthRedaction)
+	return auth.NewAuthorizer(func(ctx context.Context, user *auth.User, attributes auth.Attributes) (bool, error) {
+		spec := authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Name,
+			UID:    user.UID,
+			Groups: user.Groups,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Verb:      "get",
+				Group:     attributes.Group,
+				Resource:  attributes.Resource,
+				Namespace: attributes.Namespace,
+			},
+		}
+		if len(user.Extra) > 0 {
+			spec.Extra = map[string]authorizationv1.ExtraValue{}
+			for key, values := range user.Extra {
+				spec.Extra[key] = values
+			}
+		}
+		status, err := reviewshelper.Access(ctx, config, spec)
+		if err != nil {
+			return false, err
+		}
+		return status.Allowed, nil
+	})
+}
+
+// newSignatureVerifier returns the verifier of the signatures of the events, nil if they are not signed.
+// The keys are read from the Secret, so that they can be rotated without restarting.
+func newSignatureVerifier(configuration parser.Configuration, config *rest.Config) *auth.SignatureVerifier {
+	selector := &configuration.EventsSignatureSecret
+	if selector.Name == "" {
+		log.Warn().Msg("events signatures disabled, the events are not verified")
+		return nil
+	}
+	log.Info().Msgf("events signed with the keys of %s/%s, key %s", selector.Namespace, selector.Name, selector.Key)
+	return auth.NewSignatureVerifier(func(ctx context.Context) ([][]byte, error) {
+		secret, err := secrets.Get(ctx, config, selector)
+		if err != nil {
+			return nil, fmt.Errorf("could not get secret %s/%s: %w", selector.Namespace, selector.Name, err)
+		}
+		return auth.ParseSignatureKeys(secret.Data[selector.Key]), nil
+	}, configuration.EventsSignatureTolerance)
+}
+
+// newServerTLSConfig returns the TLS configuration of the webservice, nil for plain HTTP. The certificates are
+// reloaded in the background, so that they can be rotated without restarting.
+func newServerTLSConfig(ctx context.Context, configuration parser.Configuration, config *rest.Config) (*tls.Config, error) {
+	if !configuration.TLSEnabled() {
+		return nil, nil
+	}
+	source := configuration.TLSCertFile
+	load := certificates.FromFiles(configuration.TLSCertFile, configuration.TLSKeyFile, configuration.TLSClientCAFile)
+	if configuration.TLSSecretName != "" {
+		selector := &secrets.SecretKeySelector{Name: configuration.TLSSecretName, Namespace: configuration.TLSSecretNamespace}
+		source = fmt.Sprintf("secret %s/%s", selector.Namespace, selector.Name)
+		load = certificates.FromSecret(func(ctx context.Context) (map[string][]byte, error) {
+			secret, err := secrets.Get(ctx, config, selector)
+			if err != nil {
+				return nil, fmt.Errorf("could not get secret %s/%s: %w", selector.Namespace, selector.Name, err)
+			}
+			return secret.Data, nil
+		})
+	}
+	reloader, err := certificates.NewReloader(ctx, "webservice", load)
+	if err != nil {
+		return nil, err
+	}
+	if configuration.TLSClientAuth != certificates.ClientAuthNone && reloader.Bundle().CAs == nil {
+		return nil, fmt.Errorf("TLS_CLIENT_AUTH requires a CA bundle, the %s of the Secret is missing", certificates.SecretCAKey)
+	}
+	reloader.Start(ctx, configuration.TLSReloadInterval)
+	log.Info().Msgf("serving HTTPS with the certificate of %s, client certificates %s", source, configuration.TLSClientAuth)
+	return reloader.ServerConfig(configuration.TLSClientAuth), nil
+}
+
+// newSSETLSConfig returns the TLS configuration of the SSE client, nil for the default one
+func newSSETLSConfig(ctx context.Context, configuration parser.Configuration) (*tls.Config, error) {
+	if configuration.SSECAFile == "" && configuration.SSECertFile == "" {
+		return nil, nil
+	}
+	reloader, err := certificates.NewReloader(ctx, "SSE client", certificates.FromFiles(configuration.SSECertFile, configuration.SSEKeyFile, configuration.SSECAFile))
+	if err != nil {
+		return nil, err
+	}
+	reloader.Start(ctx, configuration.TLSReloadInterval)
+	return reloader.ClientConfig(), nil
+}
@@ -0,0 +1,86 @@
+package render
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+func renderDOT(w io.Writer, graph Graph) error {
+	b := bufio.NewWriter(w)
+	b.WriteString("digraph " + strconv.Quote(graph.Title) + " {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box, style=\"rounded,filled\", fontname=\"Helvetica\"];\n")
+	for _, node := range graph.Nodes {
+		colour := colours[node.Health]
+		b.WriteString("  " + node.ID + " [label=" + dotString(strings.Join(node.Label(), "\n")) +
+			", fillcolor=\"" + colour[0] + "\", color=\"" + colour[1] + "\"];\n")
+	}
+	for _, edge := range graph.Edges {
+		b.WriteString("  " + edge.From + " -> " + edge.To + ";\n")
+	}
+	b.WriteString("}\n")
+	return b.Flush()
+}
+
+// dotString quotes a DOT string, newlines become centered line breaks
+func dotString(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+	return `"` + value + `"`
+}
+
+func renderMermaid(w io.Writer, graph Graph) error {
+	b := bufio.NewWriter(w)
+	if graph.Title != "" {
+		b.WriteString("---\ntitle: " + strconv.Quote(graph.Title) + "\n---\n")
+	}
+	b.WriteString("flowchart LR\n")
+	for _, health := range []Health{HealthHealthy, HealthUnhealthy, HealthUnknown} {
+		colour := colours[health]
+		b.WriteString("  classDef " + string(health) + " fill:" + colour[0] + ",stroke:" + colour[1] + "\n")
+	}
+	for _, node := range graph.Nodes {
+		lines := node.Label()
+		for i := range lines {
+			lines[i] = mermaidText(lines[i])
+		}
+		b.WriteString("  " + node.ID + "[\"" + strings.Join(lines, "<br/>") + "\"]:::" + string(node.Health) + "\n")
+	}
+	for _, edge := range graph.Edges {
+		b.WriteString("  " + edge.From + " --> " + edge.To + "\n")
+	}
+	return b.Flush()
+}
+
+// mermaidText escapes the text of a label with the entity codes of Mermaid
+func mermaidText(value string) string {
+	return strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;").Replace(value)
+}
+
+func renderPlantUML(w io.Writer, graph Graph) error {
+	b := bufio.NewWriter(w)
+	b.WriteString("@startuml\n")
+	if graph.Title != "" {
+		b.WriteString("title " + plantUMLText(graph.Title) + "\n")
+	}
+	b.WriteString("left to right direction\n")
+	for _, node := range graph.Nodes {
+		lines := node.Label()
+		for i := range lines {
+			lines[i] = plantUMLText(lines[i])
+		}
+		colour := colours[node.Health]
+		b.WriteString("rectangle \"" + strings.Join(lines, `\n`) + "\" as " + node.ID + " " + colour[0] + ";line:" + strings.TrimPrefix(colour[1], "#") + "\n")
+	}
+	for _, edge := range graph.Edges {
+		b.WriteString(edge.From + " --> " + edge.To + "\n")
+	}
+	b.WriteString("@enduml\n")
+	return b.Flush()
+}
+
+// plantUMLText makes the text safe in a PlantUML string, which cannot contain quotes or line breaks
+func plantUMLText(value string) string {
+	return strings.NewReplacer(`"`, "'", "\n", " ", `\`, `\\`).Replace(value)
+}
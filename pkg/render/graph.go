@@ -0,0 +1,176 @@
+// Package render renders resource trees as Graphviz DOT, Mermaid and PlantUML diagrams.
+// It only depends on the resource tree types, so it can render the JSON served by the
+// webservice offline, e.g., from a command line tool.
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	types "resource-tree-handler/apis"
+)
+
+// Format is a diagram language
+type Format string
+
+const (
+	FormatDOT      Format = "dot"
+	FormatMermaid  Format = "mermaid"
+	FormatPlantUML Format = "plantuml"
+)
+
+// Formats are the supported formats
+var Formats = []Format{FormatDOT, FormatMermaid, FormatPlantUML}
+
+// ParseFormat returns the format with the name, case insensitive
+func ParseFormat(name string) (Format, error) {
+	for _, format := range Formats {
+		if strings.EqualFold(name, string(format)) {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unknown format %q, expected %s, %s or %s", name, FormatDOT, FormatMermaid, FormatPlantUML)
+}
+
+// ContentType returns the media type of the diagrams in the format
+func (f Format) ContentType() string {
+	if f == FormatDOT {
+		return "text/vnd.graphviz; charset=utf-8"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// Health is the health of a node, it determines the colour of the node
+type Health string
+
+const (
+	HealthHealthy   Health = "healthy"
+	HealthUnhealthy Health = "unhealthy"
+	HealthUnknown   Health = "unknown"
+)
+
+// colours of the nodes by health: fill and border
+var colours = map[Health][2]string{
+	HealthHealthy:   {"#d4edda", "#28a745"},
+	HealthUnhealthy: {"#f8d7da", "#dc3545"},
+	HealthUnknown:   {"#e2e3e5", "#6c757d"},
+}
+
+// Graph is a resource tree ready to be rendered
+type Graph struct {
+	Title string
+	Nodes []Node
+	Edges []Edge
+}
+
+// Node is a resource of the tree, ID is unique in the graph and valid as an identifier in every format
+type Node struct {
+	ID        string
+	Kind      string
+	Name      string
+	Namespace string
+	Health    Health
+}
+
+// Edge goes from a parent to a child
+type Edge struct {
+	From string
+	To   string
+}
+
+// Label returns the text of the node: the kind, then the namespaced name
+func (n Node) Label() []string {
+	name := n.Name
+	if n.Namespace != "" {
+		name = n.Namespace + "/" + n.Name
+	}
+	return []string{n.Kind, name}
+}
+
+// NewGraph returns the graph of the nodes of a resource tree, with an edge from every parent in ParentRefs.
+// Parents are matched by uid, or by reference when they do not have one, since the parents in the JSON of
+// a resource tree are copies of the nodes.
+func NewGraph(title string, nodes []*types.ResourceNodeStatus) Graph {
+	graph := Graph{Title: title}
+	ids := map[string]string{}
+	for _, node := range nodes {
+		if node == nil {
+			continue
+		}
+		key := nodeKey(node)
+		if _, ok := ids[key]; ok {
+			continue
+		}
+		ids[key] = fmt.Sprintf("n%d", len(graph.Nodes))
+		graph.Nodes = append(graph.Nodes, Node{
+			ID:        ids[key],
+			Kind:      node.Kind,
+			Name:      node.Name,
+			Namespace: node.Namespace,
+			Health:    healthOf(node.Health),
+		})
+	}
+
+	edges := map[Edge]bool{}
+	for _, node := range nodes {
+		if node == nil {
+			continue
+		}
+		for _, parent := range node.ParentRefs {
+			if parent == nil {
+				continue
+			}
+			from, ok := ids[nodeKey(parent)]
+			edge := Edge{From: from, To: ids[nodeKey(node)]}
+			if ok && edge.From != edge.To && !edges[edge] {
+				edges[edge] = true
+				graph.Edges = append(graph.Edges, edge)
+			}
+		}
+	}
+	return graph
+}
+
+// Decode reads the nodes of a resource tree, as served by the webservice
+func Decode(r io.Reader) ([]*types.ResourceNodeStatus, error) {
+	var nodes []*types.ResourceNodeStatus
+	if err := json.NewDecoder(r).Decode(&nodes); err != nil {
+		return nil, fmt.Errorf("could not decode resource tree: %w", err)
+	}
+	return nodes, nil
+}
+
+// Render writes the graph in the format
+func Render(w io.Writer, format Format, graph Graph) error {
+	switch format {
+	case FormatDOT:
+		return renderDOT(w, graph)
+	case FormatMermaid:
+		return renderMermaid(w, graph)
+	case FormatPlantUML:
+		return renderPlantUML(w, graph)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+func nodeKey(node *types.ResourceNodeStatus) string {
+	if node.UID != nil && *node.UID != "" {
+		return *node.UID
+	}
+	return strings.Join([]string{node.Version, node.Kind, node.Namespace, node.Name}, "/")
+}
+
+func healthOf(health *types.Health) Health {
+	if health == nil {
+		return HealthUnknown
+	}
+	switch health.Status {
+	case "True":
+		return HealthHealthy
+	case "False":
+		return HealthUnhealthy
+	}
+	return HealthUnknown
+}
@@ -0,0 +1,94 @@
+package render
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	types "resource-tree-handler/apis"
+)
+
+// testTree is the JSON of a resource tree as served by the webservice: the parents are copies of the nodes
+const testTree = `[
+	{"version": "resourcetrees.krateo.io/v1", "kind": "CompositionReference", "namespace": "demo", "name": "app", "uid": "root", "health": {"status": "True"}},
+	{"version": "v1", "kind": "Secret", "namespace": "demo", "name": "say \"hi\"", "uid": "secret", "health": {"status": "False"},
+		"parentRefs": [{"kind": "CompositionReference", "namespace": "demo", "name": "app", "uid": "root"}]},
+	{"version": "helm.crossplane.io/v1beta1", "kind": "Release", "name": "app",
+		"parentRefs": [{"kind": "CompositionReference", "namespace": "demo", "name": "app", "uid": "root"}, {"uid": "missing"}]}
+]`
+
+func testGraph(t *testing.T) Graph {
+	t.Helper()
+	nodes, err := Decode(strings.NewReader(testTree))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewGraph("app", nodes)
+}
+
+func TestNewGraph(t *testing.T) {
+	graph := testGraph(t)
+	if len(graph.Nodes) != 3 {
+		t.Fatalf("expected 3 nodes, got %+v", graph.Nodes)
+	}
+	if graph.Nodes[0].Health != HealthHealthy || graph.Nodes[1].Health != HealthUnhealthy || graph.Nodes[2].Health != HealthUnknown {
+		t.Errorf("unexpected health %+v", graph.Nodes)
+	}
+	// The edge to the missing parent is dropped
+	expected := []Edge{{From: "n0", To: "n1"}, {From: "n0", To: "n2"}}
+	if len(graph.Edges) != len(expected) || graph.Edges[0] != expected[0] || graph.Edges[1] != expected[1] {
+		t.Errorf("expected edges %v, got %v", expected, graph.Edges)
+	}
+
+	// Nodes without uid are matched by reference
+	child := &types.ResourceNodeStatus{ResourceRefStatus: types.ResourceRefStatus{Kind: "ConfigMap", Name: "child"}}
+	parent := &types.ResourceNodeStatus{ResourceRefStatus: types.ResourceRefStatus{Kind: "Deployment", Name: "parent"}}
+	child.ParentRefs = []*types.ResourceNodeStatus{{ResourceRefStatus: parent.ResourceRefStatus}}
+	if graph := NewGraph("", []*types.ResourceNodeStatus{parent, child}); len(graph.Edges) != 1 {
+		t.Errorf("expected an edge between nodes without uid, got %v", graph.Edges)
+	}
+}
+
+func TestRender(t *testing.T) {
+	graph := testGraph(t)
+	expected := map[Format][]string{
+		FormatDOT: {
+			`digraph "app" {`,
+			`n0 [label="CompositionReference\ndemo/app", fillcolor="#d4edda", color="#28a745"];`,
+			`n1 [label="Secret\ndemo/say \"hi\"", fillcolor="#f8d7da", color="#dc3545"];`,
+			`n0 -> n2;`,
+		},
+		FormatMermaid: {
+			"flowchart LR",
+			"classDef unhealthy fill:#f8d7da,stroke:#dc3545",
+			`n1["Secret<br/>demo/say #quot;hi#quot;"]:::unhealthy`,
+			`n2["Release<br/>app"]:::unknown`,
+			"n0 --> n1",
+		},
+		FormatPlantUML: {
+			"@startuml",
+			"title app",
+			`rectangle "Secret\ndemo/say 'hi'" as n1 #f8d7da;line:dc3545`,
+			"n0 --> n2",
+			"@enduml",
+		},
+	}
+	for _, format := range Formats {
+		var buffer bytes.Buffer
+		if err := Render(&buffer, format, graph); err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range expected[format] {
+			if !strings.Contains(buffer.String(), line) {
+				t.Errorf("%s: %q missing in\n%s", format, line, buffer.String())
+			}
+		}
+	}
+
+	if _, err := ParseFormat("svg"); err == nil {
+		t.Error("unknown format parsed")
+	}
+	if format, _ := ParseFormat("PlantUML"); format != FormatPlantUML {
+		t.Errorf("expected %s, got %s", FormatPlantUML, format)
+	}
+}
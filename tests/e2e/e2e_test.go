@@ -273,7 +273,7 @@ func TestResourceTreeHandler(t *testing.T) {
 
 // startTestManager starts the controller manager with the given config
 func startTestManager(ctx context.Context, config *rest.Config) error {
-	configuration, err := configuration.ParseConfig()
+	configuration, err := configuration.Load(nil, os.LookupEnv)
 	if err != nil {
 		configuration.Default()
 	}
@@ -312,6 +312,8 @@ func startTestManager(ctx context.Context, config *rest.Config) error {
 		WebservicePort: configuration.WebServicePort,
 		Cache:          cache,
 		SSE:            sse,
+		ResyncPeriod:   configuration.ResyncPeriod,
+		ResyncJitter:   configuration.ResyncJitter,
 	}
 	w.Spinup(ctx)
 	return nil